@@ -3,4 +3,4 @@ sqlite3 test.db < schema.sql
 go generate
 go build ./...
 go test -count=1 -cover ./...
-go test -bench=. -benchmem ./ds
+go test -bench=. -benchmem ./ds ./dag
@@ -0,0 +1,85 @@
+package dag
+
+import "time"
+
+// TopologicalLevels returns task identifiers grouped into levels. Level 0
+// contains only the root and a task is placed on level k when the longest
+// path from the root to that task has k edges. All parents of a task are on
+// lower levels, so tasks within the same level can potentially run
+// concurrently.
+func (d *Dag) TopologicalLevels() [][]string {
+	levels := make([][]string, 0)
+	for _, ni := range d.FlattenNodes() {
+		for len(levels) < ni.Depth {
+			levels = append(levels, make([]string, 0))
+		}
+		levels[ni.Depth-1] = append(levels[ni.Depth-1], ni.Node.Task.Id())
+	}
+	return levels
+}
+
+// LongestPath returns task identifiers on the longest path (in number of
+// tasks) from the root. If there are several paths of the same length, the
+// first one in BFS order is returned.
+func (d *Dag) LongestPath() []string {
+	path, _ := d.CriticalPath(nil)
+	return path
+}
+
+// CriticalPath returns the path from the root which has the highest total
+// expected duration, based on given durations of tasks, and that total
+// duration. It's the estimated run time of the whole DAG run, assuming that
+// tasks which can run concurrently do run concurrently. Tasks without entry in
+// durations map are treated as if they'd take no time. When durations is nil,
+// each task is counted as one unit, which gives the longest path in number of
+// tasks.
+func (d *Dag) CriticalPath(
+	durations map[string]time.Duration,
+) ([]string, time.Duration) {
+	nodesInfo := d.FlattenNodes()
+	if len(nodesInfo) == 0 {
+		return []string{}, 0
+	}
+	taskParents := d.TaskParents()
+	finishTime := make(map[string]time.Duration, len(nodesInfo))
+	prevOnPath := make(map[string]string, len(nodesInfo))
+
+	var lastTaskId string
+	var maxFinish time.Duration = -1
+	// FlattenNodes returns nodes in topological order, so all parents are
+	// already processed.
+	for _, ni := range nodesInfo {
+		taskId := ni.Node.Task.Id()
+		var start time.Duration
+		for _, parent := range taskParents[taskId] {
+			if finishTime[parent] > start {
+				start = finishTime[parent]
+				prevOnPath[taskId] = parent
+			}
+		}
+		if _, hasPrev := prevOnPath[taskId]; !hasPrev && len(taskParents[taskId]) > 0 {
+			prevOnPath[taskId] = taskParents[taskId][0]
+		}
+		finishTime[taskId] = start + taskDuration(durations, taskId)
+		if finishTime[taskId] > maxFinish {
+			maxFinish = finishTime[taskId]
+			lastTaskId = taskId
+		}
+	}
+
+	path := make([]string, 0)
+	for taskId, ok := lastTaskId, true; ok; taskId, ok = prevOnPath[taskId] {
+		path = append(path, taskId)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, maxFinish
+}
+
+func taskDuration(durations map[string]time.Duration, taskId string) time.Duration {
+	if durations == nil {
+		return 1
+	}
+	return durations[taskId]
+}
@@ -0,0 +1,98 @@
+package dag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopologicalLevelsFewBranchoutsAndMerge(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(fewBranchoutsAndMergesGraph()).Done()
+	levels := d.TopologicalLevels()
+	expectedLevels := [][]string{
+		{"n1"},
+		{"g1n1", "g3", "g2n1"},
+		{"g1n21", "g1n22", "g2n21", "g2n22", "g2n23"},
+		{"g1n3", "g2n31", "g2n32"},
+		{"g2Merge"},
+		{"finish"},
+	}
+	if len(levels) != len(expectedLevels) {
+		t.Fatalf("Expected %d levels, got %d: %v", len(expectedLevels),
+			len(levels), levels)
+	}
+	for lvl, expected := range expectedLevels {
+		if len(levels[lvl]) != len(expected) {
+			t.Errorf("Expected level %d to be %v, got: %v", lvl, expected,
+				levels[lvl])
+			continue
+		}
+		for idx, taskId := range expected {
+			if levels[lvl][idx] != taskId {
+				t.Errorf("Expected level %d to be %v, got: %v", lvl, expected,
+					levels[lvl])
+				break
+			}
+		}
+	}
+}
+
+func TestTopologicalLevelsEmpty(t *testing.T) {
+	d := New(Id("empty_dag")).Done()
+	if levels := d.TopologicalLevels(); len(levels) != 0 {
+		t.Errorf("Expected no levels for empty DAG, got: %v", levels)
+	}
+}
+
+func TestLongestPath(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(fewBranchoutsAndMergesGraph()).Done()
+	path := d.LongestPath()
+	expectedPath := []string{"n1", "g2n1", "g2n21", "g2n31", "g2Merge", "finish"}
+	testPath(path, expectedPath, t)
+}
+
+func TestCriticalPathWithDurations(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(fewBranchoutsAndMergesGraph()).Done()
+	durations := map[string]time.Duration{
+		"n1":      1 * time.Minute,
+		"g3":      2 * time.Hour,
+		"g2n1":    5 * time.Minute,
+		"g2n23":   10 * time.Minute,
+		"finish":  1 * time.Minute,
+		"g2Merge": 1 * time.Minute,
+	}
+	path, total := d.CriticalPath(durations)
+	testPath(path, []string{"n1", "g3", "finish"}, t)
+	if total != 2*time.Hour+2*time.Minute {
+		t.Errorf("Expected total duration 2h2m, got: %v", total)
+	}
+
+	durations["g2n32"] = 3 * time.Hour
+	path, total = d.CriticalPath(durations)
+	testPath(path, []string{"n1", "g2n1", "g2n23", "g2n32", "g2Merge",
+		"finish"}, t)
+	if total != 3*time.Hour+18*time.Minute {
+		t.Errorf("Expected total duration 3h18m, got: %v", total)
+	}
+}
+
+func TestCriticalPathEmpty(t *testing.T) {
+	d := New(Id("empty_dag")).Done()
+	path, total := d.CriticalPath(map[string]time.Duration{})
+	if len(path) != 0 || total != 0 {
+		t.Errorf("Expected empty critical path, got: %v (%v)", path, total)
+	}
+}
+
+func testPath(path, expectedPath []string, t *testing.T) {
+	t.Helper()
+	if len(path) != len(expectedPath) {
+		t.Errorf("Expected path %v, got: %v", expectedPath, path)
+		return
+	}
+	for idx, taskId := range expectedPath {
+		if path[idx] != taskId {
+			t.Errorf("Expected path %v, got: %v", expectedPath, path)
+			return
+		}
+	}
+}
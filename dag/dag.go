@@ -21,6 +21,18 @@ type Dag struct {
 	Schedule *Schedule
 	Attr     Attr
 	Root     *Node
+
+	// Indexed representation of the graph. It's built once, when DAG is added
+	// to the registry.
+	graph *Graph
+
+	// Effective task priorities. Calculated once, when DAG is added to the
+	// registry.
+	priorities map[string]int
+
+	// Previous schedule ticks by DAG run, for schedules which don't implement
+	// PrevSchedule. Created once, when DAG is added to the registry.
+	prevTicks *prevTicksCache
 }
 
 type Attr struct {
@@ -28,6 +40,25 @@ type Attr struct {
 	// Start.
 	CatchUp bool     `json:"catchUp"`
 	Tags    []string `json:"tags"`
+
+	// Maximum number of DAG runs of this DAG that can be running at the same
+	// time. Zero means no limit. DAG runs exceeding the limit wait in
+	// SCHEDULED state and are started in exec time order.
+	MaxActiveRuns int `json:"maxActiveRuns"`
+
+	// Priority weight of the DAG, added to effective priority of each task.
+	// Tasks of DAGs with higher priority weight are picked up by executors
+	// first.
+	PriorityWeight int `json:"priorityWeight"`
+
+	// Rule of aggregating task priority weights into effective task priority.
+	// By default it's WeightAbsolute.
+	WeightRule WeightRule `json:"weightRule"`
+
+	// Parameters of DAG runs by their names. Values can be given on manual
+	// DAG run trigger, scheduled DAG runs use defaults. Tasks can read
+	// parameters of their DAG run using ParamsFromContext.
+	Params map[string]Param `json:"params,omitempty"`
 }
 
 func New(id Id) *Dag {
@@ -55,34 +86,39 @@ func (d *Dag) Done() Dag {
 	return *d
 }
 
+// Graph returns indexed representation of the DAG. For DAGs taken from the
+// registry the graph is built only once, on registration. Otherwise the graph
+// is built on each call.
+func (d *Dag) Graph() *Graph {
+	if d.graph != nil {
+		return d.graph
+	}
+	return NewGraph(d.Root)
+}
+
 // Graph is a valid DAG when the following conditions are met:
 //   - Is acyclic (does not have cycles)
 //   - Task identifiers are unique within the graph
 //   - Graph is no deeper then MAX_RECURSION
 func (d *Dag) IsValid() bool {
-	return d.Root.isAcyclic() && d.Root.taskIdsUnique() &&
-		d.Root.depth() <= MAX_RECURSION
+	g := d.Graph()
+	return g.IsAcyclic() && g.TaskIdsUnique() && g.Depth() <= MAX_RECURSION
 }
 
 // GetTask return task by its identifier. In case when there is no Task within
 // the DAG of given taskId, then non-nil error will be returned
 // (ErrTaskNotFoundInDag).
 func (d *Dag) GetTask(taskId string) (Task, error) {
-	nodesInfo := d.Root.Flatten()
-	for _, ni := range nodesInfo {
-		if ni.Node.Task.Id() == taskId {
-			return ni.Node.Task, nil
-		}
+	task, exists := d.Graph().Task(taskId)
+	if !exists {
+		return nil, ErrTaskNotFoundInDag
 	}
-	return nil, ErrTaskNotFoundInDag
+	return task, nil
 }
 
 // Flatten DAG into list of Tasks in BFS order.
 func (d *Dag) Flatten() []Task {
-	if d.Root == nil {
-		return []Task{}
-	}
-	nodesInfo := d.Root.Flatten()
+	nodesInfo := d.FlattenNodes()
 	tasks := make([]Task, len(nodesInfo))
 	for idx, ni := range nodesInfo {
 		tasks[idx] = ni.Node.Task
@@ -93,35 +129,12 @@ func (d *Dag) Flatten() []Task {
 // FlattenNodes flatten DAG into list of Nodes with enriched information in BFS
 // order.
 func (d *Dag) FlattenNodes() []NodeInfo {
-	if d.Root == nil {
-		return []NodeInfo{}
-	}
-	return d.Root.Flatten()
+	return d.Graph().Flatten()
 }
 
 // TaskParents returns mapping of DAG task IDs onto its parents task IDs.
 func (d *Dag) TaskParents() map[string][]string {
-	if d.Root == nil {
-		return map[string][]string{}
-	}
-	_, parentsNodeMap := d.Root.flattenBFS() // This does not include the root
-	taskParents := make(map[string][]string, len(parentsNodeMap))
-	taskParents[d.Root.Task.Id()] = []string{}
-
-	for node, nodeParents := range parentsNodeMap {
-		if node == nil {
-			// This should not happen
-			continue
-		}
-		parentTaskIds := make([]string, 0, len(nodeParents))
-		for _, parent := range nodeParents {
-			if parent != nil {
-				parentTaskIds = append(parentTaskIds, parent.Task.Id())
-			}
-		}
-		taskParents[node.Task.Id()] = parentTaskIds
-	}
-	return taskParents
+	return d.Graph().TaskParents()
 }
 
 // HashAttr calculates SHA256 hash based on DAG attribues, start time and
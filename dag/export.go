@@ -0,0 +1,117 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Colours used for filling nodes in graph exports, based on task status.
+var taskStatusColours = map[TaskStatus]string{
+	TaskScheduled:      "#a6cee3",
+	TaskRunning:        "#ffe680",
+	TaskFailed:         "#f4a6a6",
+	TaskSuccess:        "#b2df8a",
+	TaskUpstreamFailed: "#fdbf6f",
+	TaskNoStatus:       "#e0e0e0",
+	TaskCancelled:      "#cab2d6",
+}
+
+// Task statuses in the order in which Mermaid class definitions are rendered.
+var taskStatusesOrder = []TaskStatus{
+	TaskScheduled,
+	TaskRunning,
+	TaskFailed,
+	TaskSuccess,
+	TaskUpstreamFailed,
+	TaskNoStatus,
+	TaskCancelled,
+}
+
+// ToDot renders the DAG in Graphviz DOT format. Each task is rendered exactly
+// once, even when several parents points to it. When statuses is not nil,
+// nodes are filled with colour corresponding to the task status (usually
+// taken from dagruntasks for a particular DAG run). Tasks which are not in
+// statuses map are rendered without fill.
+func (d *Dag) ToDot(statuses map[string]TaskStatus) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "digraph %s {\n", dotQuote(string(d.Id)))
+	s.WriteString("\trankdir=LR;\n")
+	s.WriteString("\tnode [shape=box, style=rounded];\n")
+
+	nodesInfo := d.FlattenNodes()
+	for _, ni := range nodesInfo {
+		taskId := ni.Node.Task.Id()
+		status, hasStatus := statuses[taskId]
+		if !hasStatus {
+			fmt.Fprintf(&s, "\t%s;\n", dotQuote(taskId))
+			continue
+		}
+		fmt.Fprintf(&s, "\t%s [style=\"rounded,filled\", fillcolor=%s, tooltip=%s];\n",
+			dotQuote(taskId), dotQuote(taskStatusColours[status]),
+			dotQuote(status.String()))
+	}
+	for _, ni := range nodesInfo {
+		for _, child := range ni.Node.Children {
+			fmt.Fprintf(&s, "\t%s -> %s;\n", dotQuote(ni.Node.Task.Id()),
+				dotQuote(child.Task.Id()))
+		}
+	}
+	s.WriteString("}\n")
+	return s.String()
+}
+
+// ToMermaid renders the DAG as Mermaid flowchart. Similarly to ToDot each
+// task is rendered once and optionally coloured based on given statuses. Task
+// identifiers are mapped onto Mermaid node identifiers (t0, t1, ...) in BFS
+// order, because task identifiers might contain characters which are not
+// allowed by Mermaid syntax.
+func (d *Dag) ToMermaid(statuses map[string]TaskStatus) string {
+	var s strings.Builder
+	s.WriteString("flowchart LR\n")
+
+	nodesInfo := d.FlattenNodes()
+	mermaidIds := make(map[*Node]string, len(nodesInfo))
+	for idx, ni := range nodesInfo {
+		mermaidId := fmt.Sprintf("t%d", idx)
+		mermaidIds[ni.Node] = mermaidId
+		fmt.Fprintf(&s, "\t%s[\"%s\"]\n", mermaidId,
+			mermaidEscape(ni.Node.Task.Id()))
+	}
+	for _, ni := range nodesInfo {
+		for _, child := range ni.Node.Children {
+			fmt.Fprintf(&s, "\t%s --> %s\n", mermaidIds[ni.Node],
+				mermaidIds[child])
+		}
+	}
+	if len(statuses) == 0 {
+		return s.String()
+	}
+
+	usedStatuses := make(map[TaskStatus]struct{})
+	for _, ni := range nodesInfo {
+		status, hasStatus := statuses[ni.Node.Task.Id()]
+		if !hasStatus {
+			continue
+		}
+		usedStatuses[status] = struct{}{}
+		fmt.Fprintf(&s, "\tclass %s %s\n", mermaidIds[ni.Node], status.String())
+	}
+	// Iterate over statuses in fixed order to keep output stable.
+	for _, status := range taskStatusesOrder {
+		if _, used := usedStatuses[status]; used {
+			fmt.Fprintf(&s, "\tclassDef %s fill:%s\n", status.String(),
+				taskStatusColours[status])
+		}
+	}
+	return s.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
@@ -0,0 +1,125 @@
+package dag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToDotBranchoutAndMerge(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(branchOutAndMergeGraph()).Done()
+	dot := d.ToDot(nil)
+
+	if !strings.HasPrefix(dot, `digraph "mock_dag" {`) {
+		t.Errorf("Expected DOT output to start with digraph header, got: %s",
+			dot)
+	}
+	// Merge node n3 has three parents, but should be rendered only once.
+	if cnt := strings.Count(dot, "\t\"n3\";\n"); cnt != 1 {
+		t.Errorf("Expected n3 node to be rendered once, got %d times:\n%s",
+			cnt, dot)
+	}
+	expectedEdges := []string{
+		`"n1" -> "n21"`, `"n1" -> "n22"`, `"n1" -> "n23"`,
+		`"n21" -> "n3"`, `"n22" -> "n3"`, `"n23" -> "n3"`,
+	}
+	for _, edge := range expectedEdges {
+		if strings.Count(dot, edge) != 1 {
+			t.Errorf("Expected edge %s exactly once in:\n%s", edge, dot)
+		}
+	}
+	if strings.Count(dot, "->") != len(expectedEdges) {
+		t.Errorf("Expected %d edges, got %d", len(expectedEdges),
+			strings.Count(dot, "->"))
+	}
+}
+
+func TestToDotWithStatuses(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(branchOutAndMergeGraph()).Done()
+	statuses := map[string]TaskStatus{
+		"n1":  TaskSuccess,
+		"n21": TaskFailed,
+	}
+	dot := d.ToDot(statuses)
+
+	if !strings.Contains(dot, `"n1" [style="rounded,filled", fillcolor="#b2df8a", tooltip="SUCCESS"];`) {
+		t.Errorf("Expected n1 to be filled with SUCCESS colour, got:\n%s", dot)
+	}
+	if !strings.Contains(dot, `"n21" [style="rounded,filled", fillcolor="#f4a6a6", tooltip="FAILED"];`) {
+		t.Errorf("Expected n21 to be filled with FAILED colour, got:\n%s", dot)
+	}
+	if !strings.Contains(dot, "\t\"n22\";\n") {
+		t.Errorf("Expected n22 without status to be rendered plain, got:\n%s",
+			dot)
+	}
+}
+
+func TestToDotEscaping(t *testing.T) {
+	n := nameTaskNode(`say "hi"`)
+	d := New(Id("mock_dag")).AddRoot(n).Done()
+	dot := d.ToDot(nil)
+	if !strings.Contains(dot, `"say \"hi\""`) {
+		t.Errorf("Expected quotes in task ID to be escaped, got:\n%s", dot)
+	}
+}
+
+func TestToMermaidFewBranchoutsAndMerge(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(fewBranchoutsAndMergesGraph()).Done()
+	mermaid := d.ToMermaid(map[string]TaskStatus{"n1": TaskRunning})
+	lines := strings.Split(strings.TrimSpace(mermaid), "\n")
+
+	if lines[0] != "flowchart LR" {
+		t.Errorf("Expected flowchart header, got: %s", lines[0])
+	}
+	const expectedNodes = 14
+	const expectedEdges = 18
+	if cnt := strings.Count(mermaid, "[\""); cnt != expectedNodes {
+		t.Errorf("Expected %d nodes, got %d:\n%s", expectedNodes, cnt, mermaid)
+	}
+	if cnt := strings.Count(mermaid, "-->"); cnt != expectedEdges {
+		t.Errorf("Expected %d edges, got %d:\n%s", expectedEdges, cnt, mermaid)
+	}
+	if !strings.Contains(mermaid, "\tt0[\"n1\"]\n") {
+		t.Errorf("Expected root to be t0 node, got:\n%s", mermaid)
+	}
+	if !strings.Contains(mermaid, "\tclass t0 RUNNING\n") {
+		t.Errorf("Expected t0 to have RUNNING class, got:\n%s", mermaid)
+	}
+	if strings.Count(mermaid, "classDef") != 1 {
+		t.Errorf("Expected only classDef for used statuses, got:\n%s", mermaid)
+	}
+}
+
+func TestToMermaidEmptyDag(t *testing.T) {
+	d := New(Id("empty_dag")).Done()
+	mermaid := d.ToMermaid(nil)
+	if mermaid != "flowchart LR\n" {
+		t.Errorf("Expected only flowchart header for empty DAG, got: %s",
+			mermaid)
+	}
+}
+
+func TestExportCancelledStatus(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(branchOutAndMergeGraph()).Done()
+	statuses := map[string]TaskStatus{
+		"n1":  TaskSuccess,
+		"n21": TaskCancelled,
+	}
+	dot := d.ToDot(statuses)
+	if !strings.Contains(dot, `"n21" [style="rounded,filled", fillcolor="#cab2d6", tooltip="CANCELLED"];`) {
+		t.Errorf("Expected n21 to be filled with CANCELLED colour, got:\n%s",
+			dot)
+	}
+	mermaid := d.ToMermaid(statuses)
+	if !strings.Contains(mermaid, "\tclassDef CANCELLED fill:#cab2d6\n") {
+		t.Errorf("Expected class definition for CANCELLED, got:\n%s", mermaid)
+	}
+	for _, status := range taskStatusesOrder {
+		if taskStatusColours[status] == "" {
+			t.Errorf("Expected colour for status %s", status.String())
+		}
+	}
+	if len(taskStatusesOrder) != len(taskStatusColours) {
+		t.Errorf("Expected %d statuses in order, got %d",
+			len(taskStatusColours), len(taskStatusesOrder))
+	}
+}
@@ -0,0 +1,316 @@
+package dag
+
+// Graph is an indexed representation of a DAG starting from a root Node. It
+// is built once (in O(V+E)) and contains adjacency lists, map from task
+// identifiers onto nodes, topological order and depth of each node. Once
+// built, Graph is read-only and safe for concurrent use.
+//
+// Graph reflects state of the nodes in the moment of building it. Any changes
+// to the nodes (e.g. adding new children) after calling NewGraph are not
+// reflected.
+type Graph struct {
+	nodes    []*Node
+	nodeIdx  map[*Node]int
+	taskIdx  map[string]int
+	children [][]int
+	parents  [][]int
+	depths   []int
+	order    []int // nodes indexes in flatten order
+	acyclic  bool
+	uniqIds  bool
+	maxDepth int
+}
+
+// Colours used for marking nodes in cycle detection.
+const (
+	colourWhite = iota
+	colourGrey
+	colourBlack
+)
+
+// NewGraph builds indexed representation of the graph starting from given
+// root node. In case when root is nil, then empty Graph is returned.
+func NewGraph(root *Node) *Graph {
+	g := &Graph{
+		nodeIdx: make(map[*Node]int),
+		taskIdx: make(map[string]int),
+		acyclic: true,
+		uniqIds: true,
+	}
+	if root == nil {
+		return g
+	}
+	g.index(root)
+	g.detectCycles()
+	g.computeDepths()
+	return g
+}
+
+// Discovers all nodes reachable from root (in BFS order) and builds adjacency
+// lists.
+func (g *Graph) index(root *Node) {
+	g.addNode(root)
+	for i := 0; i < len(g.nodes); i++ {
+		node := g.nodes[i]
+		for _, child := range node.Children {
+			childIdx, known := g.nodeIdx[child]
+			if !known {
+				childIdx = g.addNode(child)
+			}
+			g.children[i] = append(g.children[i], childIdx)
+		}
+	}
+}
+
+func (g *Graph) addNode(node *Node) int {
+	idx := len(g.nodes)
+	g.nodes = append(g.nodes, node)
+	g.nodeIdx[node] = idx
+	g.children = append(g.children, nil)
+	g.parents = append(g.parents, nil)
+	g.depths = append(g.depths, 0)
+	if node.Task != nil {
+		if _, exists := g.taskIdx[node.Task.Id()]; exists {
+			g.uniqIds = false
+		} else {
+			g.taskIdx[node.Task.Id()] = idx
+		}
+	}
+	return idx
+}
+
+// Iterative DFS with white-grey-black colouring. Graph has a cycle if and only
+// if DFS finds an edge to a grey node (a node which is on the current path).
+func (g *Graph) detectCycles() {
+	type frame struct {
+		node     int
+		childPos int
+	}
+	colours := make([]int, len(g.nodes))
+	stack := []frame{{node: 0}}
+	colours[0] = colourGrey
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.childPos == len(g.children[top.node]) {
+			colours[top.node] = colourBlack
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		child := g.children[top.node][top.childPos]
+		top.childPos++
+		switch colours[child] {
+		case colourGrey:
+			g.acyclic = false
+			return
+		case colourWhite:
+			colours[child] = colourGrey
+			stack = append(stack, frame{node: child})
+		}
+	}
+}
+
+// Computes depth of each node as the longest path from the root (root has
+// depth 1) using topological order (Kahn's algorithm). Based on depths
+// flatten order and parents lists are determined. Nodes which are part of a
+// cycle are not reachable in topological order and are omitted.
+func (g *Graph) computeDepths() {
+	inDegree := make([]int, len(g.nodes))
+	for _, children := range g.children {
+		for _, child := range children {
+			inDegree[child]++
+		}
+	}
+	g.depths[0] = 1
+	topo := make([]int, 0, len(g.nodes))
+	topo = append(topo, 0)
+	for i := 0; i < len(topo); i++ {
+		node := topo[i]
+		for _, child := range g.children[node] {
+			if g.depths[node]+1 > g.depths[child] {
+				g.depths[child] = g.depths[node] + 1
+			}
+			inDegree[child]--
+			if inDegree[child] == 0 {
+				topo = append(topo, child)
+			}
+		}
+	}
+	inTopo := make([]bool, len(g.nodes))
+	for _, node := range topo {
+		inTopo[node] = true
+		if g.depths[node] > g.maxDepth {
+			g.maxDepth = g.depths[node]
+		}
+	}
+
+	// Flatten order - level by level. Each node on level k has at least one
+	// parent on level k-1, so nodes on level k are ordered by the order of
+	// their parents on level k-1 and then by the order of children.
+	added := make([]bool, len(g.nodes))
+	g.order = make([]int, 0, len(topo))
+	g.order = append(g.order, 0)
+	added[0] = true
+	for i := 0; i < len(g.order); i++ {
+		node := g.order[i]
+		for _, child := range g.children[node] {
+			if !added[child] && inTopo[child] &&
+				g.depths[child] == g.depths[node]+1 {
+				added[child] = true
+				g.order = append(g.order, child)
+			}
+		}
+	}
+
+	for _, node := range g.order {
+		for _, child := range g.children[node] {
+			parents := g.parents[child]
+			// The same child might be added more then once to a node.
+			if len(parents) > 0 && parents[len(parents)-1] == node {
+				continue
+			}
+			g.parents[child] = append(parents, node)
+		}
+	}
+}
+
+// Len returns number of nodes in the graph.
+func (g *Graph) Len() int {
+	return len(g.order)
+}
+
+// IsAcyclic returns true when graph does not contain cycles.
+func (g *Graph) IsAcyclic() bool {
+	return g.acyclic
+}
+
+// Depth returns the length of the longest path in the graph, counted in
+// nodes. Single node has depth 1 and empty graph has depth 0.
+func (g *Graph) Depth() int {
+	return g.maxDepth
+}
+
+// TaskIdsUnique returns true when task identifiers are unique within the
+// graph.
+func (g *Graph) TaskIdsUnique() bool {
+	return g.uniqIds
+}
+
+// Task returns task of given identifier. If there is no task with such
+// identifier, the second return value is false.
+func (g *Graph) Task(taskId string) (Task, bool) {
+	idx, exists := g.taskIdx[taskId]
+	if !exists {
+		return nil, false
+	}
+	return g.nodes[idx].Task, true
+}
+
+// Node returns node of the task of given identifier. If there is no task with
+// such identifier, the second return value is false.
+func (g *Graph) Node(taskId string) (*Node, bool) {
+	idx, exists := g.taskIdx[taskId]
+	if !exists {
+		return nil, false
+	}
+	return g.nodes[idx], true
+}
+
+// Parents returns parents task identifiers of given task.
+func (g *Graph) Parents(taskId string) []string {
+	idx, exists := g.taskIdx[taskId]
+	if !exists {
+		return nil
+	}
+	return g.taskIds(g.parents[idx])
+}
+
+// Children returns children task identifiers of given task.
+func (g *Graph) Children(taskId string) []string {
+	idx, exists := g.taskIdx[taskId]
+	if !exists {
+		return nil
+	}
+	return g.taskIds(g.children[idx])
+}
+
+// Downstream returns identifiers of all tasks reachable from given task
+// (excluding the task itself), in topological order.
+func (g *Graph) Downstream(taskId string) []string {
+	return g.reachable(taskId, g.children)
+}
+
+// Upstream returns identifiers of all tasks from which given task is
+// reachable (excluding the task itself), in topological order.
+func (g *Graph) Upstream(taskId string) []string {
+	return g.reachable(taskId, g.parents)
+}
+
+// Returns task identifiers of nodes reachable from given task by edges of
+// given adjacency lists, in topological order.
+func (g *Graph) reachable(taskId string, edges [][]int) []string {
+	start, exists := g.taskIdx[taskId]
+	if !exists {
+		return nil
+	}
+	visited := make([]bool, len(g.nodes))
+	stack := []int{start}
+	for len(stack) > 0 {
+		idx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range edges[idx] {
+			if !visited[next] {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	nodes := make([]int, 0)
+	for _, idx := range g.order {
+		if visited[idx] && idx != start {
+			nodes = append(nodes, idx)
+		}
+	}
+	return g.taskIds(nodes)
+}
+
+// TopologicalOrder returns task identifiers in topological order - each task
+// is placed after all of its parents. The order is the same as in Flatten.
+func (g *Graph) TopologicalOrder() []string {
+	return g.taskIds(g.order)
+}
+
+// Flatten returns list of NodeInfo for all nodes in BFS order, where each node
+// is placed on the level of its longest path from the root.
+func (g *Graph) Flatten() []NodeInfo {
+	ni := make([]NodeInfo, len(g.order))
+	for i, idx := range g.order {
+		var parents []*Node
+		if len(g.parents[idx]) > 0 {
+			parents = make([]*Node, len(g.parents[idx]))
+			for j, p := range g.parents[idx] {
+				parents[j] = g.nodes[p]
+			}
+		}
+		ni[i] = NodeInfo{Node: g.nodes[idx], Depth: g.depths[idx],
+			Parents: parents}
+	}
+	return ni
+}
+
+// TaskParents returns mapping of task IDs onto its parents task IDs.
+func (g *Graph) TaskParents() map[string][]string {
+	taskParents := make(map[string][]string, len(g.order))
+	for _, idx := range g.order {
+		taskParents[g.nodes[idx].Task.Id()] = g.taskIds(g.parents[idx])
+	}
+	return taskParents
+}
+
+func (g *Graph) taskIds(nodes []int) []string {
+	ids := make([]string, len(nodes))
+	for i, idx := range nodes {
+		ids[i] = g.nodes[idx].Task.Id()
+	}
+	return ids
+}
@@ -0,0 +1,233 @@
+package dag
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGraphEmpty(t *testing.T) {
+	g := NewGraph(nil)
+	if g.Len() != 0 {
+		t.Errorf("Expected empty graph, got %d nodes", g.Len())
+	}
+	if g.Depth() != 0 {
+		t.Errorf("Expected depth 0 for empty graph, got: %d", g.Depth())
+	}
+	if !g.IsAcyclic() {
+		t.Error("Expected empty graph to be acyclic")
+	}
+}
+
+func TestGraphCycleInSubgraph(t *testing.T) {
+	//        n21 -- n3 -- n4
+	//      /         \   /
+	//   n1            n5
+	//      \
+	//        n22
+	n1 := nameTaskNode("n1")
+	n21 := nameTaskNode("n21")
+	n22 := nameTaskNode("n22")
+	n3 := nameTaskNode("n3")
+	n4 := nameTaskNode("n4")
+	n5 := nameTaskNode("n5")
+	n1.Next(n21)
+	n1.Next(n22)
+	n21.Next(n3)
+	n3.Next(n4)
+	n4.Next(n5)
+	n5.Next(n3)
+
+	g := NewGraph(n1)
+	if g.IsAcyclic() {
+		t.Error("Expected graph to be cyclic, but IsAcyclic says otherwise")
+	}
+}
+
+func TestGraphMergeFromDifferentLevels(t *testing.T) {
+	// n1 -- n2 -- n3 -- n4
+	//   \_______________/
+	n1 := nameTaskNode("n1")
+	n2 := nameTaskNode("n2")
+	n3 := nameTaskNode("n3")
+	n4 := nameTaskNode("n4")
+	n1.Next(n2)
+	n2.Next(n3)
+	n3.Next(n4)
+	n1.Next(n4)
+
+	g := NewGraph(n1)
+	if !g.IsAcyclic() {
+		t.Error("Expected graph to be acyclic")
+	}
+	if g.Depth() != 4 {
+		t.Errorf("Expected depth 4, got: %d", g.Depth())
+	}
+	order := g.TopologicalOrder()
+	expectedOrder := []string{"n1", "n2", "n3", "n4"}
+	for idx, taskId := range expectedOrder {
+		if order[idx] != taskId {
+			t.Errorf("Expected task %s on position %d, got: %s", taskId, idx,
+				order[idx])
+		}
+	}
+	n4Parents := g.Parents("n4")
+	if len(n4Parents) != 2 || n4Parents[0] != "n1" || n4Parents[1] != "n3" {
+		t.Errorf("Expected n4 parents [n1 n3], got: %v", n4Parents)
+	}
+}
+
+func TestGraphDuplicatedEdge(t *testing.T) {
+	n1 := nameTaskNode("n1")
+	n2 := nameTaskNode("n2")
+	n1.Next(n2)
+	n1.Next(n2)
+
+	g := NewGraph(n1)
+	if g.Len() != 2 {
+		t.Errorf("Expected 2 nodes, got: %d", g.Len())
+	}
+	if parents := g.Parents("n2"); len(parents) != 1 {
+		t.Errorf("Expected single parent of n2, got: %v", parents)
+	}
+}
+
+func TestGraphTaskLookup(t *testing.T) {
+	g := NewGraph(fewBranchoutsAndMergesGraph())
+	task, exists := g.Task("g2n31")
+	if !exists {
+		t.Fatal("Expected task g2n31 to exist in the graph")
+	}
+	if task.Id() != "g2n31" {
+		t.Errorf("Expected task g2n31, got: %s", task.Id())
+	}
+	if _, exists := g.Task("not_there"); exists {
+		t.Error("Expected task not_there to not exist in the graph")
+	}
+	children := g.Children("g2n1")
+	if len(children) != 3 {
+		t.Errorf("Expected 3 children of g2n1, got: %v", children)
+	}
+}
+
+func TestGraphTopologicalOrderIsValid(t *testing.T) {
+	g := NewGraph(fewBranchoutsAndMergesGraph())
+	position := make(map[string]int)
+	for idx, taskId := range g.TopologicalOrder() {
+		position[taskId] = idx
+	}
+	for taskId, parents := range g.TaskParents() {
+		for _, parent := range parents {
+			if position[parent] >= position[taskId] {
+				t.Errorf("Parent %s is placed after its child %s", parent,
+					taskId)
+			}
+		}
+	}
+}
+
+func TestGraphDownstreamAndUpstream(t *testing.T) {
+	g := NewGraph(fewBranchoutsAndMergesGraph())
+	downstream := g.Downstream("g2n23")
+	expected := []string{"g2n32", "g2Merge", "finish"}
+	if !reflect.DeepEqual(downstream, expected) {
+		t.Errorf("Expected downstream of g2n23 %v, got: %v", expected,
+			downstream)
+	}
+	upstream := g.Upstream("g2n31")
+	expected = []string{"n1", "g2n1", "g2n21", "g2n22"}
+	if !reflect.DeepEqual(upstream, expected) {
+		t.Errorf("Expected upstream of g2n31 %v, got: %v", expected, upstream)
+	}
+	if len(g.Downstream("finish")) != 0 || len(g.Upstream("n1")) != 0 {
+		t.Error("Expected no downstream of leaf and no upstream of root")
+	}
+	if g.Downstream("not_there") != nil {
+		t.Error("Expected nil downstream of not existing task")
+	}
+}
+
+func BenchmarkNewGraphWide10k(b *testing.B) {
+	root := wideGraph(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewGraph(root)
+	}
+}
+
+func BenchmarkNewGraphLinkedList10k(b *testing.B) {
+	root := linkedList(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewGraph(root)
+	}
+}
+
+func BenchmarkNewGraphLayered10k(b *testing.B) {
+	root := layeredGraph(100, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewGraph(root)
+	}
+}
+
+func BenchmarkDagGetTaskWide10k(b *testing.B) {
+	// Only DAGs from the registry have cached graph. Benchmark function is
+	// called several times, so the DAG is registered only once.
+	dagId := Id("bench_dag_get_task_wide")
+	if _, err := Get(dagId); err != nil {
+		d := New(dagId).AddRoot(wideGraph(10000)).Done()
+		if addErr := Add(d); addErr != nil {
+			b.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+		}
+	}
+	d, _ := Get(dagId)
+	taskIds := make([]string, 10000)
+	for i := range taskIds {
+		taskIds[i] = fmt.Sprintf("node_%d", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.GetTask(taskIds[i%len(taskIds)])
+	}
+}
+
+func BenchmarkDagIsValidLayered10k(b *testing.B) {
+	d := New(Id("bench_dag")).AddRoot(layeredGraph(100, 100)).Done()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.IsValid()
+	}
+}
+
+// Root with n children which are merged into a single final node.
+func wideGraph(n int) *Node {
+	root := nameTaskNode("root")
+	final := nameTaskNode("final")
+	nodes := make([]*Node, n)
+	for i := 0; i < n; i++ {
+		nodes[i] = nameTaskNode(fmt.Sprintf("node_%d", i))
+	}
+	root.NextAsyncAndMerge(nodes, final)
+	return root
+}
+
+// Graph of given number of layers of given width. Each node is connected to
+// every node in the next layer.
+func layeredGraph(layers, width int) *Node {
+	root := nameTaskNode("root")
+	prev := []*Node{root}
+	for l := 0; l < layers; l++ {
+		curr := make([]*Node, width)
+		for w := 0; w < width; w++ {
+			curr[w] = nameTaskNode(fmt.Sprintf("node_%d_%d", l, w))
+		}
+		for _, p := range prev {
+			for _, c := range curr {
+				p.Next(c)
+			}
+		}
+		prev = curr
+	}
+	return root
+}
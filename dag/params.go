@@ -0,0 +1,244 @@
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrInvalidParams is returned when given DAG run parameters don't match
+// parameters declared in the DAG (see Attr.Params).
+var ErrInvalidParams = errors.New("invalid dag run parameters")
+
+// ParamType enumerates types of DAG run parameters.
+type ParamType int
+
+const (
+	ParamString ParamType = iota
+	ParamInt
+	ParamFloat
+	ParamBool
+)
+
+var paramTypeNames = [...]string{
+	"STRING",
+	"INT",
+	"FLOAT",
+	"BOOL",
+}
+
+func (pt ParamType) String() string {
+	if pt < 0 || int(pt) >= len(paramTypeNames) {
+		return fmt.Sprintf("ParamType(%d)", int(pt))
+	}
+	return paramTypeNames[pt]
+}
+
+// Param declares parameter of DAG runs. Default value is used, when the
+// parameter is not given on DAG run trigger and for scheduled DAG runs. It
+// should be of the parameter type (string, int, float64 or bool).
+type Param struct {
+	Type        ParamType `json:"type"`
+	Default     any       `json:"default"`
+	Description string    `json:"description,omitempty"`
+}
+
+// Params are values of DAG run parameters by their names. Values are of types
+// corresponding to declared ParamType - string, int, float64 or bool.
+type Params map[string]any
+
+// String returns value of given string parameter. Empty string is returned,
+// when there is no such parameter.
+func (p Params) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+// Int returns value of given int parameter. Zero is returned, when there is no
+// such parameter.
+func (p Params) Int(name string) int {
+	i, _ := toInt(p[name])
+	return i
+}
+
+// Float returns value of given float parameter. Zero is returned, when there
+// is no such parameter.
+func (p Params) Float(name string) float64 {
+	f, _ := toFloat(p[name])
+	return f
+}
+
+// Bool returns value of given bool parameter. False is returned, when there
+// is no such parameter.
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// ParseParams parses DAG run parameters serialized as JSON object. Empty
+// string means no parameters.
+func ParseParams(s string) (Params, error) {
+	params := Params{}
+	if s == "" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(s), &params); err != nil {
+		return nil, fmt.Errorf("cannot parse dag run parameters: %w", err)
+	}
+	return params, nil
+}
+
+// Checks parameters declared in the DAG. Each parameter has to be of known
+// type and its default value has to be of that type. Otherwise tasks would
+// not get the parameter at all.
+func (d *Dag) checkParams() error {
+	names := make([]string, 0, len(d.Attr.Params))
+	for name := range d.Attr.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param := d.Attr.Params[name]
+		if _, err := convertParam(param.Type, param.Default); err != nil {
+			return fmt.Errorf("incorrect default value of parameter %s: %w",
+				name, err)
+		}
+	}
+	return nil
+}
+
+// DefaultParams returns default values of all parameters declared in the DAG.
+// Defaults are checked when the DAG is added to the registry (see Add).
+func (d *Dag) DefaultParams() Params {
+	params := make(Params, len(d.Attr.Params))
+	for name, param := range d.Attr.Params {
+		if value, err := convertParam(param.Type, param.Default); err == nil {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+// ValidateParams checks given parameters values against parameters declared
+// in the DAG. Parameters which are not declared or values which cannot be
+// converted into declared type are reported as ErrInvalidParams. Returns
+// parameters with converted values and defaults for not given parameters.
+func (d *Dag) ValidateParams(values map[string]any) (Params, error) {
+	params := d.DefaultParams()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param, declared := d.Attr.Params[name]
+		if !declared {
+			return nil, fmt.Errorf("%w: parameter %s is not declared",
+				ErrInvalidParams, name)
+		}
+		value, err := convertParam(param.Type, values[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: parameter %s: %s", ErrInvalidParams,
+				name, err.Error())
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// RunParams returns parameters for tasks of a DAG run, based on stored
+// parameters values of the DAG run. Unlike ValidateParams values which are not
+// declared anymore or have incompatible type (the DAG might have changed since
+// the DAG run was triggered) are skipped and defaults are used instead.
+func (d *Dag) RunParams(stored Params) Params {
+	params := d.DefaultParams()
+	for name, value := range stored {
+		param, declared := d.Attr.Params[name]
+		if !declared {
+			continue
+		}
+		if converted, err := convertParam(param.Type, value); err == nil {
+			params[name] = converted
+		}
+	}
+	return params
+}
+
+// Converts given value into Go type of given parameter type. Numbers decoded
+// from JSON are float64, so integral floats are accepted as ints.
+func convertParam(pt ParamType, value any) (any, error) {
+	var converted any
+	var ok bool
+	switch pt {
+	case ParamString:
+		converted, ok = value.(string)
+	case ParamInt:
+		converted, ok = toInt(value)
+	case ParamFloat:
+		converted, ok = toFloat(value)
+	case ParamBool:
+		converted, ok = value.(bool)
+	default:
+		return nil, fmt.Errorf("unknown parameter type %s", pt.String())
+	}
+	if !ok {
+		return nil, fmt.Errorf("expected %s value, got %v (%T)", pt.String(),
+			value, value)
+	}
+	return converted, nil
+}
+
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		// float64(math.MaxInt64) is 2^63, which is already out of int64 range.
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return int(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type paramsContextKey struct{}
+
+// ContextWithParams returns copy of given context carrying DAG run
+// parameters. Executors pass such context to tasks (see ExecuteTask).
+func ContextWithParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsContextKey{}, params)
+}
+
+// ParamsFromContext returns DAG run parameters carried by given context. Tasks
+// which implement CancellableTask can read parameters of their DAG run this
+// way. Empty Params are returned, when the context doesn't carry parameters.
+func ParamsFromContext(ctx context.Context) Params {
+	if params, ok := ctx.Value(paramsContextKey{}).(Params); ok {
+		return params
+	}
+	return Params{}
+}
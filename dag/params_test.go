@@ -0,0 +1,126 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func paramsDag() Dag {
+	return New(Id("mock_dag_params")).AddRoot(nameTaskNode("n1")).
+		AddAttributes(Attr{Params: map[string]Param{
+			"customerId":  {Type: ParamString, Default: ""},
+			"fullRefresh": {Type: ParamBool, Default: false},
+			"batchSize":   {Type: ParamInt, Default: 100},
+			"sampleRate":  {Type: ParamFloat, Default: 0.5},
+		}}).Done()
+}
+
+func TestValidateParams(t *testing.T) {
+	d := paramsDag()
+	params, err := d.ValidateParams(map[string]any{
+		"customerId":  "c42",
+		"fullRefresh": true,
+		"batchSize":   float64(250), // as decoded from JSON
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := Params{
+		"customerId":  "c42",
+		"fullRefresh": true,
+		"batchSize":   250,
+		"sampleRate":  0.5,
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected params %v, got %v", expected, params)
+	}
+
+	invalid := []map[string]any{
+		{"unknown": "x"},
+		{"batchSize": 2.5},
+		{"batchSize": 1e300},
+		{"batchSize": -1e300},
+		{"batchSize": float64(math.MaxInt64)},
+		{"batchSize": math.Inf(1)},
+		{"batchSize": math.NaN()},
+		{"batchSize": "250"},
+		{"fullRefresh": "true"},
+		{"sampleRate": true},
+	}
+	for _, values := range invalid {
+		_, err := d.ValidateParams(values)
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Expected ErrInvalidParams for %v, got: %v", values, err)
+		}
+	}
+}
+
+func TestAddRejectsInvalidParams(t *testing.T) {
+	invalid := map[Id]Param{
+		"mock_dag_params_wrong_default": {Type: ParamInt, Default: "100"},
+		"mock_dag_params_no_default":    {Type: ParamBool},
+		"mock_dag_params_unknown_type":  {Type: ParamType(42), Default: 1},
+	}
+	for dagId, param := range invalid {
+		d := New(dagId).AddRoot(nameTaskNode("n1")).
+			AddAttributes(Attr{Params: map[string]Param{"p": param}}).Done()
+		if err := Add(d); err == nil {
+			delete(registry, dagId)
+			t.Errorf("Expected error while adding %s with param %+v", dagId,
+				param)
+		}
+	}
+
+	d := paramsDag()
+	if err := Add(d); err != nil {
+		t.Fatalf("Unexpected error while adding DAG: %s", err.Error())
+	}
+	delete(registry, d.Id)
+}
+
+func TestParamTypeString(t *testing.T) {
+	if s := ParamInt.String(); s != "INT" {
+		t.Errorf("Expected INT, got %s", s)
+	}
+	if s := ParamType(42).String(); s != "ParamType(42)" {
+		t.Errorf("Expected ParamType(42), got %s", s)
+	}
+	if s := ParamType(-1).String(); s != "ParamType(-1)" {
+		t.Errorf("Expected ParamType(-1), got %s", s)
+	}
+}
+
+func TestRunParamsSkipsStaleValues(t *testing.T) {
+	d := paramsDag()
+	stored, pErr := ParseParams(
+		`{"customerId": "c42", "batchSize": "wrong", "removed": 1}`)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	params := d.RunParams(stored)
+	if params.String("customerId") != "c42" {
+		t.Errorf("Expected stored customerId, got %v", params["customerId"])
+	}
+	if params.Int("batchSize") != 100 {
+		t.Errorf("Expected default batchSize, got %v", params["batchSize"])
+	}
+	if _, exists := params["removed"]; exists {
+		t.Error("Expected not declared parameter to be skipped")
+	}
+	if params.Float("sampleRate") != 0.5 || params.Bool("fullRefresh") {
+		t.Errorf("Expected defaults, got %v", params)
+	}
+}
+
+func TestParamsFromContext(t *testing.T) {
+	if params := ParamsFromContext(context.Background()); len(params) != 0 {
+		t.Errorf("Expected no params, got %v", params)
+	}
+	ctx := ContextWithParams(context.Background(), Params{"batchSize": 10})
+	if size := ParamsFromContext(ctx).Int("batchSize"); size != 10 {
+		t.Errorf("Expected batchSize 10, got %d", size)
+	}
+}
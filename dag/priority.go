@@ -0,0 +1,112 @@
+package dag
+
+// Default priority weight of a task which does not implement PriorityTask.
+const DefaultPriorityWeight = 1
+
+// PriorityTask is an optional interface for tasks which should have priority
+// weight different then DefaultPriorityWeight. Tasks with higher effective
+// priority are picked up by executors before tasks with lower priority.
+type PriorityTask interface {
+	Task
+	PriorityWeight() int
+}
+
+// WeightRule defines how task priority weights are aggregated into effective
+// task priority.
+type WeightRule int
+
+const (
+	// Effective priority is the task own priority weight.
+	WeightAbsolute WeightRule = iota
+	// Effective priority is the sum of the task priority weight and priority
+	// weights of all its downstream tasks. Tasks which block many other tasks
+	// are picked up first.
+	WeightDownstream
+	// Effective priority is the sum of the task priority weight and priority
+	// weights of all its upstream tasks. Tasks closer to the end of the DAG
+	// run are picked up first, so started DAG runs finish sooner.
+	WeightUpstream
+)
+
+func (wr WeightRule) String() string {
+	return [...]string{
+		"ABSOLUTE",
+		"DOWNSTREAM",
+		"UPSTREAM",
+	}[wr]
+}
+
+// TaskPriorityWeight returns priority weight of given task. For tasks which
+// don't implement PriorityTask DefaultPriorityWeight is returned.
+func TaskPriorityWeight(t Task) int {
+	if pt, ok := t.(PriorityTask); ok {
+		return pt.PriorityWeight()
+	}
+	return DefaultPriorityWeight
+}
+
+// TaskPriorities returns effective priority for each task in the DAG. It's
+// DAG priority weight (Attr.PriorityWeight) plus task priority weights
+// aggregated according to Attr.WeightRule. For DAGs taken from the registry
+// priorities are calculated only once, on registration. Aggregation for
+// WeightDownstream and WeightUpstream takes O(V*(V+E)), so for very large and
+// dense DAGs WeightAbsolute is preferable.
+func (d *Dag) TaskPriorities() map[string]int {
+	if d.priorities != nil {
+		return d.priorities
+	}
+	g := d.Graph()
+	weights := make([]int, len(g.nodes))
+	for _, idx := range g.order {
+		weights[idx] = TaskPriorityWeight(g.nodes[idx].Task)
+	}
+	switch d.Attr.WeightRule {
+	case WeightDownstream:
+		weights = g.aggregateWeights(weights, g.children)
+	case WeightUpstream:
+		weights = g.aggregateWeights(weights, g.parents)
+	}
+	priorities := make(map[string]int, len(g.order))
+	for _, idx := range g.order {
+		priorities[g.nodes[idx].Task.Id()] = d.Attr.PriorityWeight + weights[idx]
+	}
+	return priorities
+}
+
+// TaskPriority returns effective priority of given task. If there's no such
+// task in the DAG, then DAG priority weight is returned.
+func (d *Dag) TaskPriority(taskId string) int {
+	priority, exists := d.TaskPriorities()[taskId]
+	if !exists {
+		return d.Attr.PriorityWeight
+	}
+	return priority
+}
+
+// Sums up weights of each node and all nodes reachable from it via given
+// adjacency lists. Each reachable node is counted once, even if it can be
+// reached by many paths. It takes O(V*(V+E)).
+func (g *Graph) aggregateWeights(weights []int, adjacency [][]int) []int {
+	aggregated := make([]int, len(weights))
+	visitedBy := make([]int, len(weights))
+	stack := make([]int, 0, len(weights))
+	for _, start := range g.order {
+		// Nodes are marked by start+1, so we don't need to clear visitedBy
+		// after each traversal.
+		mark := start + 1
+		visitedBy[start] = mark
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			aggregated[start] += weights[node]
+			for _, next := range adjacency[node] {
+				if visitedBy[next] != mark {
+					visitedBy[next] = mark
+					stack = append(stack, next)
+				}
+			}
+		}
+	}
+	return aggregated
+}
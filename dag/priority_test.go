@@ -0,0 +1,76 @@
+package dag
+
+import "testing"
+
+type weightedTask struct {
+	Name   string
+	Weight int
+}
+
+func (wt weightedTask) Id() string          { return wt.Name }
+func (wt weightedTask) Execute()            {}
+func (wt weightedTask) PriorityWeight() int { return wt.Weight }
+
+func TestTaskPrioritiesAbsolute(t *testing.T) {
+	root := nameTaskNode("n1")
+	urgent := &Node{Task: weightedTask{Name: "urgent", Weight: 10}}
+	root.Next(urgent)
+	d := New(Id("mock_dag")).AddRoot(root).
+		AddAttributes(Attr{PriorityWeight: 100}).Done()
+
+	checkPriorities(t, d.TaskPriorities(), map[string]int{
+		"n1":     101,
+		"urgent": 110,
+	})
+	if p := d.TaskPriority("not_existing"); p != 100 {
+		t.Errorf("Expected DAG priority weight for not existing task, got %d",
+			p)
+	}
+}
+
+func TestTaskPrioritiesDownstream(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(branchOutAndMergeGraph()).
+		AddAttributes(Attr{WeightRule: WeightDownstream}).Done()
+	// n3 is reachable by three paths from n1, but it's counted only once
+	checkPriorities(t, d.TaskPriorities(), map[string]int{
+		"n1": 5, "n21": 2, "n22": 2, "n23": 2, "n3": 1,
+	})
+}
+
+func TestTaskPrioritiesUpstream(t *testing.T) {
+	d := New(Id("mock_dag")).AddRoot(branchOutAndMergeGraph()).
+		AddAttributes(Attr{WeightRule: WeightUpstream}).Done()
+	checkPriorities(t, d.TaskPriorities(), map[string]int{
+		"n1": 1, "n21": 2, "n22": 2, "n23": 2, "n3": 5,
+	})
+}
+
+func TestTaskPrioritiesEmptyDag(t *testing.T) {
+	d := New(Id("mock_dag")).Done()
+	if len(d.TaskPriorities()) != 0 {
+		t.Errorf("Expected no priorities for empty DAG, got: %v",
+			d.TaskPriorities())
+	}
+}
+
+func BenchmarkTaskPrioritiesDownstreamLayered1k(b *testing.B) {
+	d := New(Id("mock_dag")).AddRoot(layeredGraph(20, 50)).
+		AddAttributes(Attr{WeightRule: WeightDownstream}).Done()
+	for i := 0; i < b.N; i++ {
+		d.TaskPriorities()
+	}
+}
+
+func checkPriorities(t *testing.T, priorities, expected map[string]int) {
+	t.Helper()
+	if len(priorities) != len(expected) {
+		t.Errorf("Expected %d priorities, got %d: %v", len(expected),
+			len(priorities), priorities)
+	}
+	for taskId, expPrio := range expected {
+		if priorities[taskId] != expPrio {
+			t.Errorf("Expected priority %d for task %s, got %d", expPrio,
+				taskId, priorities[taskId])
+		}
+	}
+}
@@ -2,6 +2,8 @@ package dag
 
 import (
 	"fmt"
+
+	"github.com/dskrzypiec/scheduler/ds"
 )
 
 // Registry is a package-level map storing all defined and added DAGs. This
@@ -13,11 +15,30 @@ type Id string
 
 // Add adds new DAG to the registry. If dag is already added in the registry,
 // which means dag.Attr.Id is already a key in the registry map, then non-nil
-// error is returned.
+// error is returned. Error is also returned, when declared DAG run parameters
+// have unknown type or default value of different type (see Attr.Params), or
+// when a task declares templates it cannot read (see TemplatedTask).
 func Add(dag Dag) error {
 	if _, exists := registry[dag.Id]; exists {
 		return fmt.Errorf("Dag %s is already registered", dag.Id)
 	}
+	if err := dag.checkParams(); err != nil {
+		return fmt.Errorf("Dag %s has invalid parameters: %w", dag.Id, err)
+	}
+	if err := dag.checkTemplates(); err != nil {
+		return fmt.Errorf("Dag %s has invalid templates: %w", dag.Id, err)
+	}
+	if dag.graph == nil {
+		dag.graph = NewGraph(dag.Root)
+	}
+	if dag.priorities == nil {
+		dag.priorities = dag.TaskPriorities()
+	}
+	if dag.Schedule != nil && dag.prevTicks == nil {
+		if _, ok := (*dag.Schedule).(PrevSchedule); !ok {
+			dag.prevTicks = ds.NewLruCache[int64, prevTick](prevTicksCacheSize)
+		}
+	}
 	registry[dag.Id] = dag
 	return nil
 }
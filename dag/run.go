@@ -11,6 +11,7 @@ const (
 	RunRunning
 	RunSuccess
 	RunFailed
+	RunCancelled
 )
 
 // String serialize RunStatus.
@@ -21,6 +22,7 @@ func (s RunStatus) String() string {
 		"RUNNING",
 		"SUCCESS",
 		"FAILED",
+		"CANCELLED",
 	}[s]
 }
 
@@ -34,6 +36,7 @@ func ParseRunStatus(s string) (RunStatus, error) {
 		"RUNNING":           RunRunning,
 		"SUCCESS":           RunSuccess,
 		"FAILED":            RunFailed,
+		"CANCELLED":         RunCancelled,
 	}
 	if status, ok := states[s]; ok {
 		return status, nil
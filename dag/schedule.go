@@ -3,6 +3,8 @@ package dag
 import (
 	"fmt"
 	"time"
+
+	"github.com/dskrzypiec/scheduler/ds"
 )
 
 // Schedule represents process' schedule. StartTime says when schedule starts.
@@ -41,6 +43,107 @@ func (is FixedSchedule) Next(baseTime time.Time) time.Time {
 	}
 }
 
+// Prev returns the latest tick before baseTime. Zero time is returned, when
+// baseTime is not after Start.
+func (is FixedSchedule) Prev(baseTime time.Time) time.Time {
+	if !baseTime.After(is.Start) || is.Interval <= 0 {
+		return time.Time{}
+	}
+	ticks := (baseTime.Sub(is.Start) - 1) / is.Interval
+	return is.Start.Add(ticks * is.Interval)
+}
+
 func (is FixedSchedule) String() string {
 	return fmt.Sprintf("FixedSchedule: %s", is.Interval)
 }
+
+// PrevSchedule is an optional interface for schedules which can efficiently
+// determine the previous tick (see PrevScheduleTime).
+type PrevSchedule interface {
+	Schedule
+	Prev(time.Time) time.Time
+}
+
+// PrevScheduleTime returns the latest tick of given schedule before given
+// time. Schedules which don't implement PrevSchedule are iterated using Next,
+// starting from StartTime, which costs a call per tick since StartTime (see
+// PrevScheduleTimeFrom). DAGs from the registry cache the result per DAG run
+// (see Dag.PrevExecTs). False is returned, when there is no tick before given
+// time.
+func PrevScheduleTime(sched Schedule, t time.Time) (time.Time, bool) {
+	return PrevScheduleTimeFrom(sched, time.Time{}, t)
+}
+
+// PrevScheduleTimeFrom works like PrevScheduleTime, but schedules which don't
+// implement PrevSchedule are iterated starting from given tick, like execution
+// timestamp of the previous DAG run, instead of StartTime. When from is not a
+// tick of the schedule before t, iteration starts from StartTime.
+func PrevScheduleTimeFrom(
+	sched Schedule, from, t time.Time,
+) (time.Time, bool) {
+	if ps, ok := sched.(PrevSchedule); ok {
+		prev := ps.Prev(t)
+		return prev, !prev.IsZero()
+	}
+	tick := sched.StartTime()
+	if !tick.Before(t) {
+		return time.Time{}, false
+	}
+	if from.After(tick) && from.Before(t) && isScheduleTick(sched, from) {
+		tick = from
+	}
+	for {
+		next := sched.Next(tick)
+		if !next.Before(t) || !next.After(tick) {
+			return tick, true
+		}
+		tick = next
+	}
+}
+
+// Checks whether given time is a tick of given schedule.
+func isScheduleTick(sched Schedule, t time.Time) bool {
+	return sched.Next(t.Add(-time.Nanosecond)).Equal(t)
+}
+
+// Number of DAG runs for which the previous schedule tick is cached, for
+// schedules which don't implement PrevSchedule.
+const prevTicksCacheSize = 1024
+
+type prevTick struct {
+	ts     time.Time
+	exists bool
+}
+
+// Cache of previous schedule ticks by DAG run execution timestamp (UnixNano).
+type prevTicksCache = ds.LruCache[int64, prevTick]
+
+// PrevExecTs returns the previous schedule tick before given execution
+// timestamp (see PrevScheduleTime). For DAGs taken from the registry, which
+// schedule doesn't implement PrevSchedule, the result is cached per DAG run,
+// so templates of all tasks of the DAG run are rendered without iterating the
+// schedule again. False is returned, when the DAG has no schedule or there is
+// no tick before execTs.
+func (d *Dag) PrevExecTs(execTs time.Time) (time.Time, bool) {
+	return d.PrevExecTsFrom(execTs, time.Time{})
+}
+
+// PrevExecTsFrom works like PrevExecTs, but the schedule is iterated starting
+// from given tick (see PrevScheduleTimeFrom). Scheduler calls it with
+// execution timestamp of the previous DAG run, when the DAG run starts, so
+// rendering templates doesn't iterate the schedule since StartTime.
+func (d *Dag) PrevExecTsFrom(execTs, from time.Time) (time.Time, bool) {
+	if d.Schedule == nil {
+		return time.Time{}, false
+	}
+	if d.prevTicks == nil {
+		return PrevScheduleTimeFrom(*d.Schedule, from, execTs)
+	}
+	key := execTs.UnixNano()
+	if tick, cached := d.prevTicks.Get(key); cached {
+		return tick.ts, tick.exists
+	}
+	prev, exists := PrevScheduleTimeFrom(*d.Schedule, from, execTs)
+	d.prevTicks.Put(key, prevTick{ts: prev, exists: exists})
+	return prev, exists
+}
@@ -77,3 +77,123 @@ func BenchmarkFixedScheduleLong(b *testing.B) {
 func timeForFixDay(hour, minute, second int) time.Time {
 	return time.Date(2023, time.September, 24, hour, minute, second, 0, time.UTC)
 }
+
+// Schedule which doesn't implement PrevSchedule.
+type nextOnlySchedule struct {
+	fs FixedSchedule
+}
+
+func (ns nextOnlySchedule) StartTime() time.Time       { return ns.fs.StartTime() }
+func (ns nextOnlySchedule) Next(t time.Time) time.Time { return ns.fs.Next(t) }
+func (ns nextOnlySchedule) String() string             { return ns.fs.String() }
+
+func TestPrevScheduleTime(t *testing.T) {
+	start := timeForFixDay(8, 0, 0)
+	fs := FixedSchedule{Start: start, Interval: 10 * time.Minute}
+	cases := []struct {
+		input    time.Time
+		expected time.Time
+		exists   bool
+	}{
+		{timeForFixDay(12, 0, 0), timeForFixDay(11, 50, 0), true},
+		{timeForFixDay(12, 5, 0), timeForFixDay(12, 0, 0), true},
+		{timeForFixDay(8, 10, 0), start, true},
+		{start, time.Time{}, false},
+		{timeForFixDay(2, 0, 0), time.Time{}, false},
+	}
+	schedules := []Schedule{fs, nextOnlySchedule{fs}}
+	for _, sched := range schedules {
+		for _, c := range cases {
+			prev, exists := PrevScheduleTime(sched, c.input)
+			if prev != c.expected || exists != c.exists {
+				t.Errorf("Expected previous tick of %v to be %v (%t), got %v "+
+					"(%t) for %T", c.input, c.expected, c.exists, prev, exists,
+					sched)
+			}
+		}
+	}
+}
+
+func TestPrevScheduleTimeFrom(t *testing.T) {
+	start := timeForFixDay(8, 0, 0)
+	nextCalls := 0
+	sched := countingSchedule{
+		nextOnlySchedule: nextOnlySchedule{
+			FixedSchedule{Start: start, Interval: 10 * time.Minute},
+		},
+		nextCalls: &nextCalls,
+	}
+	input := timeForFixDay(12, 5, 0)
+	expected := timeForFixDay(12, 0, 0)
+	seeds := []time.Time{
+		timeForFixDay(11, 50, 0), // tick
+		timeForFixDay(11, 55, 0), // not a tick
+		timeForFixDay(13, 0, 0),  // after input
+		time.Time{},
+	}
+	for _, from := range seeds {
+		prev, exists := PrevScheduleTimeFrom(sched, from, input)
+		if !exists || prev != expected {
+			t.Errorf("Expected previous tick %v from %v, got %v (%t)",
+				expected, from, prev, exists)
+		}
+	}
+
+	nextCalls = 0
+	PrevScheduleTimeFrom(sched, timeForFixDay(11, 50, 0), input)
+	if nextCalls > 3 {
+		t.Errorf("Expected iteration to start from given tick, got %d Next "+
+			"calls", nextCalls)
+	}
+}
+
+// nextOnlySchedule which counts calls of Next.
+type countingSchedule struct {
+	nextOnlySchedule
+	nextCalls *int
+}
+
+func (cs countingSchedule) Next(t time.Time) time.Time {
+	*cs.nextCalls++
+	return cs.nextOnlySchedule.Next(t)
+}
+
+func TestPrevExecTsIsCachedPerDagRun(t *testing.T) {
+	start := timeForFixDay(8, 0, 0)
+	nextCalls := 0
+	sched := countingSchedule{
+		nextOnlySchedule: nextOnlySchedule{
+			FixedSchedule{Start: start, Interval: time.Minute},
+		},
+		nextCalls: &nextCalls,
+	}
+	d := New("mock_dag_prev_exec_ts_cached").
+		AddRoot(&Node{Task: constTask{}}).
+		AddSchedule(sched).Done()
+	if addErr := Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	d, _ = Get(d.Id)
+
+	execTs := timeForFixDay(12, 0, 0)
+	expected := timeForFixDay(11, 59, 0)
+	prev, exists := d.PrevExecTs(execTs)
+	if !exists || prev != expected {
+		t.Fatalf("Expected previous tick %v, got %v (%t)", expected, prev,
+			exists)
+	}
+	calls := nextCalls
+	for i := 0; i < 10; i++ {
+		if prev, exists = d.PrevExecTs(execTs); !exists || prev != expected {
+			t.Fatalf("Expected cached previous tick %v, got %v (%t)",
+				expected, prev, exists)
+		}
+	}
+	if nextCalls != calls {
+		t.Errorf("Expected schedule not to be iterated again for the same "+
+			"DAG run, got %d more Next calls", nextCalls-calls)
+	}
+	if _, exists = d.PrevExecTs(start); exists {
+		t.Errorf("Expected no previous tick before schedule start")
+	}
+}
@@ -1,11 +1,13 @@
 package dag
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/dskrzypiec/scheduler/meta"
@@ -20,6 +22,83 @@ type Task interface {
 	Execute()
 }
 
+// CancellableTask is an optional interface for tasks which can be stopped
+// before they finish, when their DAG run is cancelled. Executors call
+// ExecuteContext instead of Execute and cancel given context, once they
+// receive cancellation signal from the scheduler. Given context carries also
+// DAG run parameters (see ParamsFromContext) and rendered task templates (see
+// RenderedFromContext).
+type CancellableTask interface {
+	Task
+	ExecuteContext(ctx context.Context)
+}
+
+// ExecuteTask executes given task. Tasks which implement CancellableTask get
+// given context, other tasks are executed using Execute and cannot be stopped.
+func ExecuteTask(ctx context.Context, t Task) {
+	if ct, ok := t.(CancellableTask); ok {
+		ct.ExecuteContext(ctx)
+		return
+	}
+	t.Execute()
+}
+
+// PoolTask is an optional interface for tasks which use a shared resource
+// (like rate-limited API or a database). Tasks which return the same pool name
+// share slots of that pool, so number of concurrently running tasks in the
+// pool is limited. Pools and their slots are defined in scheduler
+// configuration.
+type PoolTask interface {
+	Task
+	Pool() string
+}
+
+// TaskPool returns pool name of given task. Empty string is returned for tasks
+// which don't implement PoolTask.
+func TaskPool(t Task) string {
+	if pt, ok := t.(PoolTask); ok {
+		return pt.Pool()
+	}
+	return ""
+}
+
+// LabeledTask is an optional interface for tasks which can be executed only
+// by executors of certain capabilities (like access to a specific database or
+// big amount of memory). Such tasks are handed only to executors which
+// advertise all of the task labels.
+type LabeledTask interface {
+	Task
+	Labels() []string
+}
+
+// TaskLabels returns sorted, distinct and non-empty labels required by given
+// task. Empty slice is returned for tasks which don't implement LabeledTask.
+func TaskLabels(t Task) []string {
+	lt, ok := t.(LabeledTask)
+	if !ok {
+		return []string{}
+	}
+	return NormalizeLabels(lt.Labels())
+}
+
+// NormalizeLabels returns sorted and distinct labels without empty ones and
+// surrounding whitespaces.
+func NormalizeLabels(labels []string) []string {
+	set := make(map[string]struct{}, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label != "" {
+			set[label] = struct{}{}
+		}
+	}
+	normalized := make([]string, 0, len(set))
+	for label := range set {
+		normalized = append(normalized, label)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
 // TaskStatus enumerates possible Task states within the DAG run.
 type TaskStatus int
 
@@ -30,6 +109,7 @@ const (
 	TaskSuccess
 	TaskUpstreamFailed
 	TaskNoStatus
+	TaskCancelled
 )
 
 func (s TaskStatus) String() string {
@@ -40,6 +120,7 @@ func (s TaskStatus) String() string {
 		"SUCCESS",
 		"UPSTREAM_FAILED",
 		"NO_STATUS",
+		"CANCELLED",
 	}[s]
 }
 
@@ -48,7 +129,8 @@ func (s TaskStatus) CanProceed() bool {
 }
 
 func (s TaskStatus) IsTerminal() bool {
-	return s == TaskSuccess || s == TaskFailed || s == TaskUpstreamFailed
+	return s == TaskSuccess || s == TaskFailed || s == TaskUpstreamFailed ||
+		s == TaskCancelled
 }
 
 // ParseTaskStatus parses task status based on given string. If given string
@@ -62,6 +144,7 @@ func ParseTaskStatus(s string) (TaskStatus, error) {
 		"SUCCESS":         TaskSuccess,
 		"UPSTREAM_FAILED": TaskUpstreamFailed,
 		"NO_STATUS":       TaskNoStatus,
+		"CANCELLED":       TaskCancelled,
 	}
 	if status, ok := states[s]; ok {
 		return status, nil
@@ -138,45 +221,12 @@ func (dn *Node) Hash() string {
 
 // Get graph depth. Single node has depth=1.
 func (dn *Node) depth() int {
-	maxChildDepth := 0
-	for _, child := range dn.Children {
-		childDepth := child.depth()
-		if childDepth > maxChildDepth {
-			maxChildDepth = childDepth
-		}
-	}
-	return maxChildDepth + 1
+	return NewGraph(dn).Depth()
 }
 
 // Checks whenever graph starting from this node does not have cycles.
 func (dn *Node) isAcyclic() bool {
-	nodeMap := make(map[*Node]int)
-	return dn.isAcyclicImpl(nodeMap, 0)
-}
-
-// Checks whenever address of a node already exists in the set of traversed
-// nodes, to determine cycles. If traversing depth exceeds MAX_RECURSION, then
-// false is returned and further examination is stopped.
-func (dn *Node) isAcyclicImpl(traversed map[*Node]int, depth int) bool {
-	if depth > MAX_RECURSION {
-		slog.Error("Max recursion depth reached. Cannot determine if graph is acyclic",
-			"depth", MAX_RECURSION)
-		return false
-	}
-	// condition for traversedOnDepth < depth-1 is for case when there are
-	// multiply nodes merging into one node
-	traversedOnDepth, alreadyTraversed := traversed[dn]
-	if alreadyTraversed && traversedOnDepth < depth-1 {
-		return false
-	}
-	traversed[dn] = depth
-	for _, child := range dn.Children {
-		check := child.isAcyclicImpl(traversed, depth+1)
-		if !check {
-			return false
-		}
-	}
-	return true
+	return NewGraph(dn).IsAcyclic()
 }
 
 // NodeInfo represents enriched information about node in the DAG. It's used
@@ -189,85 +239,15 @@ type NodeInfo struct {
 }
 
 // Flattens tree (DAG) into a list of NodeInfo. Flattening is done in BFS
-// order. Result slice does not contain duplicates. List of nodes might be
-// incomplete if depth of the graph exceeds MAX_RECURSION value.
+// order. Result slice does not contain duplicates. Each node is placed on the
+// level of the longest path from the root to that node. If the graph has
+// cycles, then nodes within cycles (and below) are omitted.
 func (dn *Node) Flatten() []NodeInfo {
-	flattenNodes, parentsMap := dn.flattenBFS()
-	ni := make([]NodeInfo, 0, len(flattenNodes))
-	for idx, nodeD := range flattenNodes {
-		thereIsBetterCandidate := false
-		if idx < len(flattenNodes)-1 {
-			for i := idx + 1; i < len(flattenNodes); i++ {
-				if flattenNodes[i].Node == nodeD.Node {
-					// This is for case where there are several edges from
-					// different depth level of graph into the same target
-					// node. In such case we want to put target node on level
-					// of deepest edge.
-					thereIsBetterCandidate = true
-					break
-				}
-			}
-		}
-		if !thereIsBetterCandidate {
-			parents, parentsExists := parentsMap[nodeD.Node]
-			if parentsExists {
-				nodeD.Parents = parents
-			}
-			ni = append(ni, nodeD)
-		}
-	}
-	return ni
-}
-
-func (dn *Node) flattenBFS() ([]NodeInfo, map[*Node][]*Node) {
-	visited := make(map[*Node]int)
-	parentsMap := make(map[*Node][]*Node)
-	var ni []NodeInfo
-	var queue []*Node
-	depthMarker := &Node{}
-	depth := 1
-	queue = append(queue, dn, depthMarker)
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		visitedOnDepth, alreadyVisited := visited[current]
-		if alreadyVisited && visitedOnDepth == depth {
-			continue
-		}
-		if current == depthMarker {
-			depth++
-			if depth > MAX_RECURSION {
-				slog.Error("Max level reached. Returned result might be incomplete",
-					"level", MAX_RECURSION)
-				break
-			}
-			if len(queue) > 0 {
-				queue = append(queue, depthMarker)
-			}
-			continue
-		}
-		visited[current] = depth
-		ni = append(ni, NodeInfo{Node: current, Depth: depth, Parents: nil})
-		for _, child := range current.Children {
-			parentsMap[child] = append(parentsMap[child], current)
-			queue = append(queue, child)
-		}
-	}
-	return ni, parentsMap
+	return NewGraph(dn).Flatten()
 }
 
 func (dn *Node) taskIdsUnique() bool {
-	nodesInfo := dn.Flatten()
-	taskIds := make(map[string]struct{})
-
-	for _, ni := range nodesInfo {
-		if _, alreadyExists := taskIds[ni.Node.Task.Id()]; alreadyExists {
-			return false
-		}
-		taskIds[ni.Node.Task.Id()] = struct{}{}
-	}
-	return true
+	return NewGraph(dn).TaskIdsUnique()
 }
 
 // This method is getting DAG tasks Execute() methods source code and join it
@@ -4,6 +4,7 @@ import (
 	"embed"
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/dskrzypiec/scheduler/meta"
@@ -84,9 +85,11 @@ func TestIsAcyclicLongList(t *testing.T) {
 }
 
 func TestIsAcyclicTooLongList(t *testing.T) {
+	// Cycle detection does not depend on graph depth. Too deep graphs are
+	// rejected by Dag.IsValid.
 	g := linkedList(MAX_RECURSION + 2)
-	if g.isAcyclic() {
-		t.Error("Expected isAcyclic to be false on too deep graphs")
+	if !g.isAcyclic() {
+		t.Error("Expected very long list to be acyclic, but is not")
 	}
 }
 
@@ -572,3 +575,22 @@ func addNChildren(node *Node, n int) {
 		node.Next(&n)
 	}
 }
+
+type labeledTask struct {
+	emptyTask
+	labels []string
+}
+
+func (lt labeledTask) Labels() []string { return lt.labels }
+
+func TestTaskLabels(t *testing.T) {
+	if labels := TaskLabels(emptyTask{}); len(labels) != 0 {
+		t.Errorf("Expected no labels for regular task, got %v", labels)
+	}
+	lt := labeledTask{labels: []string{"highmem", " db_vpn", "", "highmem"}}
+	labels := TaskLabels(lt)
+	expected := []string{"db_vpn", "highmem"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Expected labels %v, got %v", expected, labels)
+	}
+}
@@ -0,0 +1,214 @@
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplatedTask is an optional interface for tasks which configuration
+// depends on the DAG run, like partition of the data to be processed. Task
+// declares named templates (text/template syntax) which are rendered by the
+// scheduler for each dag run task, stored for inspection and given to the task
+// at execution (see RenderedFromContext).
+//
+// Rendered templates are carried only by the context given to ExecuteContext,
+// so templated tasks have to implement CancellableTask to read them. DAGs with
+// tasks which declare templates, but implement only Execute, are rejected by
+// Add.
+//
+// Besides TemplateData fields, the following functions are available in
+// templates:
+//   - ds, ds_nodash - execution date as 2006-01-02 or 20060102
+//   - ts, ts_nodash - execution timestamp as RFC3339 or 20060102T150405
+//   - prev_ds, prev_ds_nodash, prev_ts - the previous schedule tick before
+//     the execution timestamp (empty, when there is none)
+//   - next_ds, next_ds_nodash, next_ts - the next schedule tick after the
+//     execution timestamp (empty, when the DAG has no schedule)
+//   - ds_add DS DAYS - adds given number of days to date in ds format
+//   - param NAME - value of DAG run parameter (error, when not declared)
+type TemplatedTask interface {
+	CancellableTask
+	Templates() map[string]string
+}
+
+// Task which declares templates, regardless of whether it can read them.
+type templatesDeclarer interface {
+	Templates() map[string]string
+}
+
+// Checks that tasks which declare templates implement TemplatedTask.
+func (d *Dag) checkTemplates() error {
+	for _, ni := range d.FlattenNodes() {
+		task := ni.Node.Task
+		if _, declares := task.(templatesDeclarer); !declares {
+			continue
+		}
+		if _, ok := task.(TemplatedTask); !ok {
+			return fmt.Errorf("task %s declares templates, but doesn't "+
+				"implement ExecuteContext to read them", task.Id())
+		}
+	}
+	return nil
+}
+
+// TaskTemplates returns templates of given task. Nil is returned for tasks
+// which don't implement TemplatedTask.
+func TaskTemplates(t Task) map[string]string {
+	if tt, ok := t.(TemplatedTask); ok {
+		return tt.Templates()
+	}
+	return nil
+}
+
+// HasTemplates checks whether any task of the DAG declares templates.
+func (d *Dag) HasTemplates() bool {
+	for _, ni := range d.FlattenNodes() {
+		if len(TaskTemplates(ni.Node.Task)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TemplateData is the data (dot) of task templates. PrevExecTs and NextExecTs
+// are zero, when there is no previous or next schedule tick.
+type TemplateData struct {
+	DagId      string
+	TaskId     string
+	ExecTs     time.Time
+	PrevExecTs time.Time
+	NextExecTs time.Time
+	Params     Params
+}
+
+const (
+	dsLayout       = "2006-01-02"
+	dsNodashLayout = "20060102"
+	tsNodashLayout = "20060102T150405"
+)
+
+// RenderTemplates renders templates of given task for DAG run at given
+// execution timestamp with given parameters (see TemplatedTask). Nil is
+// returned for tasks without templates.
+func (d *Dag) RenderTemplates(
+	taskId string, execTs time.Time, params Params,
+) (map[string]string, error) {
+	task, tErr := d.GetTask(taskId)
+	if tErr != nil {
+		return nil, tErr
+	}
+	templates := TaskTemplates(task)
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	data := TemplateData{
+		DagId:  string(d.Id),
+		TaskId: taskId,
+		ExecTs: execTs,
+		Params: params,
+	}
+	if d.Schedule != nil {
+		data.PrevExecTs, _ = d.PrevExecTs(execTs)
+		data.NextExecTs = (*d.Schedule).Next(execTs)
+	}
+	funcs := templateFuncs(data)
+
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rendered := make(map[string]string, len(templates))
+	for _, name := range names {
+		tmpl, pErr := template.New(name).Funcs(funcs).
+			Option("missingkey=error").Parse(templates[name])
+		if pErr != nil {
+			return nil, fmt.Errorf("cannot parse template %s of task %s: %w",
+				name, taskId, pErr)
+		}
+		var sb strings.Builder
+		if eErr := tmpl.Execute(&sb, data); eErr != nil {
+			return nil, fmt.Errorf("cannot render template %s of task %s: %w",
+				name, taskId, eErr)
+		}
+		rendered[name] = sb.String()
+	}
+	return rendered, nil
+}
+
+// Template functions for given template data.
+func templateFuncs(data TemplateData) template.FuncMap {
+	timeFunc := func(t time.Time, layout string) func() string {
+		return func() string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format(layout)
+		}
+	}
+	return template.FuncMap{
+		"ds":             timeFunc(data.ExecTs, dsLayout),
+		"ds_nodash":      timeFunc(data.ExecTs, dsNodashLayout),
+		"ts":             timeFunc(data.ExecTs, time.RFC3339),
+		"ts_nodash":      timeFunc(data.ExecTs, tsNodashLayout),
+		"prev_ds":        timeFunc(data.PrevExecTs, dsLayout),
+		"prev_ds_nodash": timeFunc(data.PrevExecTs, dsNodashLayout),
+		"prev_ts":        timeFunc(data.PrevExecTs, time.RFC3339),
+		"next_ds":        timeFunc(data.NextExecTs, dsLayout),
+		"next_ds_nodash": timeFunc(data.NextExecTs, dsNodashLayout),
+		"next_ts":        timeFunc(data.NextExecTs, time.RFC3339),
+		"ds_add": func(ds string, days int) (string, error) {
+			t, err := time.Parse(dsLayout, ds)
+			if err != nil {
+				return "", err
+			}
+			return t.AddDate(0, 0, days).Format(dsLayout), nil
+		},
+		"param": func(name string) (any, error) {
+			value, exists := data.Params[name]
+			if !exists {
+				return nil, fmt.Errorf("parameter %s is not declared", name)
+			}
+			return value, nil
+		},
+	}
+}
+
+// ParseRendered parses rendered task templates serialized as JSON object.
+// Empty string means no rendered templates.
+func ParseRendered(s string) (map[string]string, error) {
+	rendered := map[string]string{}
+	if s == "" {
+		return rendered, nil
+	}
+	if err := json.Unmarshal([]byte(s), &rendered); err != nil {
+		return nil, fmt.Errorf("cannot parse rendered templates: %w", err)
+	}
+	return rendered, nil
+}
+
+type renderedContextKey struct{}
+
+// ContextWithRendered returns copy of given context carrying rendered task
+// templates. Executors pass such context to tasks (see ExecuteTask).
+func ContextWithRendered(
+	ctx context.Context, rendered map[string]string,
+) context.Context {
+	return context.WithValue(ctx, renderedContextKey{}, rendered)
+}
+
+// RenderedFromContext returns rendered templates of the task carried by given
+// context, by template names. The context is given to ExecuteContext (see
+// TemplatedTask). Empty map is returned, when the
+// context doesn't carry rendered templates.
+func RenderedFromContext(ctx context.Context) map[string]string {
+	if rendered, ok := ctx.Value(renderedContextKey{}).(map[string]string); ok {
+		return rendered
+	}
+	return map[string]string{}
+}
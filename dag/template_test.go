@@ -0,0 +1,122 @@
+package dag
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type templatedTask struct {
+	Name      string
+	templates map[string]string
+}
+
+func (tt templatedTask) Id() string                     { return tt.Name }
+func (tt templatedTask) Execute()                       {}
+func (tt templatedTask) Templates() map[string]string   { return tt.templates }
+func (tt templatedTask) ExecuteContext(context.Context) {}
+
+// Task which declares templates, but implements only Execute.
+type executeOnlyTemplatedTask struct{ Name string }
+
+func (tt executeOnlyTemplatedTask) Id() string { return tt.Name }
+func (tt executeOnlyTemplatedTask) Execute()   {}
+func (tt executeOnlyTemplatedTask) Templates() map[string]string {
+	return map[string]string{"partition": "dt={{ ds }}"}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	start := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	task := templatedTask{Name: "load", templates: map[string]string{
+		"partition": "dt={{ prev_ds_nodash }}",
+		"query": "SELECT * FROM t WHERE ds = '{{ ds }}' " +
+			"AND ds < '{{ next_ds }}' AND c = '{{ param \"customerId\" }}'",
+		"window": "{{ ds_add ds -7 }}..{{ .ExecTs.Format \"15:04\" }}",
+		"meta":   "{{ .DagId }}.{{ .TaskId }} {{ ts }} {{ .Params.batchSize }}",
+	}}
+	d := New(Id("mock_dag_templates")).
+		AddRoot(&Node{Task: task}).
+		AddSchedule(FixedSchedule{Start: start, Interval: 24 * time.Hour}).
+		Done()
+	execTs := time.Date(2023, time.October, 10, 0, 0, 0, 0, time.UTC)
+	params := Params{"customerId": "c42", "batchSize": 100}
+
+	rendered, err := d.RenderTemplates("load", execTs, params)
+	if err != nil {
+		t.Fatalf("Cannot render templates: %s", err.Error())
+	}
+	expected := map[string]string{
+		"partition": "dt=20231009",
+		"query": "SELECT * FROM t WHERE ds = '2023-10-10' " +
+			"AND ds < '2023-10-11' AND c = 'c42'",
+		"window": "2023-10-03..00:00",
+		"meta":   "mock_dag_templates.load 2023-10-10T00:00:00Z 100",
+	}
+	if !reflect.DeepEqual(rendered, expected) {
+		t.Errorf("Expected rendered templates %v, got %v", expected, rendered)
+	}
+
+	// The first DAG run has no previous schedule tick
+	rendered, err = d.RenderTemplates("load", start, params)
+	if err != nil {
+		t.Fatalf("Cannot render templates: %s", err.Error())
+	}
+	if rendered["partition"] != "dt=" {
+		t.Errorf("Expected empty prev_ds_nodash, got %s", rendered["partition"])
+	}
+}
+
+func TestRenderTemplatesErrors(t *testing.T) {
+	templates := []string{
+		"{{ param \"unknown\" }}",
+		"{{ .Params.unknown }}",
+		"{{ ds_add \"not a date\" 1 }}",
+		"{{ ds ",
+	}
+	execTs := time.Date(2023, time.October, 10, 0, 0, 0, 0, time.UTC)
+	for _, tmpl := range templates {
+		task := templatedTask{Name: "task",
+			templates: map[string]string{"t": tmpl}}
+		d := New(Id("mock_dag_templates_err")).AddRoot(&Node{Task: task}).
+			Done()
+		if _, err := d.RenderTemplates("task", execTs, Params{}); err == nil {
+			t.Errorf("Expected error for template %s", tmpl)
+		}
+	}
+
+	d := New(Id("mock_dag_no_templates")).AddRoot(nameTaskNode("n1")).Done()
+	rendered, err := d.RenderTemplates("n1", execTs, Params{})
+	if err != nil || rendered != nil {
+		t.Errorf("Expected no templates for regular task, got %v, %v",
+			rendered, err)
+	}
+}
+
+func TestRenderedFromContext(t *testing.T) {
+	if rendered := RenderedFromContext(context.Background()); len(rendered) != 0 {
+		t.Errorf("Expected no rendered templates, got %v", rendered)
+	}
+	ctx := ContextWithRendered(context.Background(),
+		map[string]string{"partition": "dt=20231009"})
+	if p := RenderedFromContext(ctx)["partition"]; p != "dt=20231009" {
+		t.Errorf("Expected rendered partition, got %s", p)
+	}
+}
+
+func TestAddRejectsTemplatesWithoutExecuteContext(t *testing.T) {
+	d := New(Id("mock_dag_templates_execute_only")).
+		AddRoot(&Node{Task: executeOnlyTemplatedTask{Name: "load"}}).Done()
+	if err := Add(d); err == nil {
+		delete(registry, d.Id)
+		t.Error("Expected error while adding DAG with task which cannot " +
+			"read its templates")
+	}
+
+	d = New(Id("mock_dag_templates_context")).
+		AddRoot(&Node{Task: templatedTask{Name: "load"}}).Done()
+	if err := Add(d); err != nil {
+		t.Fatalf("Unexpected error while adding DAG: %s", err.Error())
+	}
+	delete(registry, d.Id)
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// AuditLogEntry represents single row in auditlog table in the database.
+type AuditLogEntry struct {
+	Id        int64
+	InsertTs  string
+	Principal string
+	Action    string
+	DagId     *string
+	Details   *string
+	Allowed   bool
+}
+
+// InsertAuditLog inserts new entry into auditlog table. Id and InsertTs of
+// given entry are ignored - they are set by this method.
+func (c *Client) InsertAuditLog(ctx context.Context, entry AuditLogEntry) error {
+	start := time.Now()
+	insertTs := timeutils.ToString(time.Now())
+	allowed := 0
+	if entry.Allowed {
+		allowed = 1
+	}
+	_, err := c.dbConn.ExecContext(ctx, c.insertAuditLogQuery(), insertTs,
+		entry.Principal, entry.Action, entry.DagId, entry.Details, allowed)
+	if err != nil {
+		slog.Error("Cannot insert audit log entry", "entry", entry, "err", err)
+		return err
+	}
+	slog.Debug("Inserted audit log entry", "entry", entry, "duration",
+		time.Since(start))
+	return nil
+}
+
+// ReadAuditLog reads at most limit latest audit log entries, starting from the
+// newest one.
+func (c *Client) ReadAuditLog(
+	ctx context.Context, limit int,
+) ([]AuditLogEntry, error) {
+	start := time.Now()
+	slog.Debug("Start reading audit log", "limit", limit)
+	entries := make([]AuditLogEntry, 0)
+
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readAuditLogQuery(), limit)
+	if qErr != nil {
+		slog.Error("Failed querying audit log", "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditLogEntry
+		var allowed int
+		scanErr := rows.Scan(&entry.Id, &entry.InsertTs, &entry.Principal,
+			&entry.Action, &entry.DagId, &entry.Details, &allowed)
+		if scanErr != nil {
+			slog.Error("Failed scanning audit log entry", "err", scanErr)
+			return nil, scanErr
+		}
+		entry.Allowed = allowed == 1
+		entries = append(entries, entry)
+	}
+	slog.Debug("Finished reading audit log", "entries", len(entries),
+		"duration", time.Since(start))
+	return entries, nil
+}
+
+func (c *Client) insertAuditLogQuery() string {
+	return `
+		INSERT INTO auditlog (InsertTs, Principal, Action, DagId, Details, Allowed)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+}
+
+func (c *Client) readAuditLogQuery() string {
+	return `
+		SELECT
+			Id,
+			InsertTs,
+			Principal,
+			Action,
+			DagId,
+			Details,
+			Allowed
+		FROM
+			auditlog
+		ORDER BY
+			Id DESC
+		LIMIT ?
+	`
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInsertAuditLogAndRead(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	dagId := "dag_1"
+	entries := []AuditLogEntry{
+		{Principal: "alice", Action: "dag.pause", DagId: &dagId, Allowed: true},
+		{Principal: "bob", Action: "dag.unpause", DagId: &dagId},
+		{Principal: "admin", Action: "auditlog.read", Allowed: true},
+	}
+	for _, entry := range entries {
+		if iErr := c.InsertAuditLog(ctx, entry); iErr != nil {
+			t.Fatalf("Cannot insert audit log entry: %s", iErr.Error())
+		}
+	}
+
+	read, rErr := c.ReadAuditLog(ctx, 2)
+	if rErr != nil {
+		t.Fatalf("Cannot read audit log: %s", rErr.Error())
+	}
+	if len(read) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(read))
+	}
+	if read[0].Principal != "admin" || read[0].DagId != nil ||
+		!read[0].Allowed {
+		t.Errorf("Expected the newest entry of admin, got: %+v", read[0])
+	}
+	if read[1].Principal != "bob" || read[1].Allowed ||
+		read[1].DagId == nil || *read[1].DagId != dagId {
+		t.Errorf("Expected denied entry of bob, got: %+v", read[1])
+	}
+}
@@ -23,6 +23,7 @@ type Dag struct {
 	HashDagMeta         string
 	HashTasks           string
 	Attributes          string // serialized dag.Dag.Attr
+	IsPaused            bool
 }
 
 // ReadDag reads metadata about DAG from dags table for given dagId.
@@ -86,11 +87,7 @@ func (c *Client) readDagTx(ctx context.Context, tx *sql.Tx, dagId string) (Dag,
 	slog.Debug("Start reading dag from dags table", "dagId", dagId)
 
 	row := tx.QueryRowContext(ctx, c.readDagQuery(), dagId)
-	var dId, createTs, createVersion, hashMeta, hashTasks, attr string
-	var startTs, schedule, latestUpdateTs, latestUpdateVersion *string
-
-	scanErr := row.Scan(&dId, &startTs, &schedule, &createTs, &latestUpdateTs,
-		&createVersion, &latestUpdateVersion, &hashMeta, &hashTasks, &attr)
+	dag, scanErr := parseDag(row)
 	if scanErr == sql.ErrNoRows {
 		return Dag{}, scanErr
 	}
@@ -98,6 +95,49 @@ func (c *Client) readDagTx(ctx context.Context, tx *sql.Tx, dagId string) (Dag,
 		slog.Error("Failed scanning dag record", "dagId", dagId, "err", scanErr)
 		return Dag{}, scanErr
 	}
+	slog.Debug("Finished reading dag from dags table", "dagId", dagId, "duration",
+		time.Since(start))
+	return dag, nil
+}
+
+// ReadDags reads all DAGs from dags table ordered by DagId. When tag is not
+// empty, only DAGs which have that tag in attributes are read.
+func (c *Client) ReadDags(ctx context.Context, tag string) ([]Dag, error) {
+	start := time.Now()
+	slog.Debug("Start reading dags", "tag", tag)
+	dags := make([]Dag, 0)
+
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readDagsQuery(), tag, tag)
+	if qErr != nil {
+		slog.Error("Failed querying dags", "tag", tag, "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, scanErr := parseDag(rows)
+		if scanErr != nil {
+			slog.Error("Failed scanning dag record", "err", scanErr)
+			return nil, scanErr
+		}
+		dags = append(dags, d)
+	}
+	slog.Debug("Finished reading dags", "tag", tag, "dags", len(dags),
+		"duration", time.Since(start))
+	return dags, nil
+}
+
+func parseDag(row interface{ Scan(...any) error }) (Dag, error) {
+	var dId, createTs, createVersion, hashMeta, hashTasks, attr string
+	var startTs, schedule, latestUpdateTs, latestUpdateVersion *string
+	var isPaused int
+
+	scanErr := row.Scan(&dId, &startTs, &schedule, &createTs, &latestUpdateTs,
+		&createVersion, &latestUpdateVersion, &hashMeta, &hashTasks, &attr,
+		&isPaused)
+	if scanErr != nil {
+		return Dag{}, scanErr
+	}
 	dag := Dag{
 		DagId:               dId,
 		StartTs:             startTs,
@@ -109,9 +149,8 @@ func (c *Client) readDagTx(ctx context.Context, tx *sql.Tx, dagId string) (Dag,
 		HashDagMeta:         hashMeta,
 		HashTasks:           hashTasks,
 		Attributes:          attr,
+		IsPaused:            isPaused == 1,
 	}
-	slog.Debug("Finished reading dag from dags table", "dagId", dagId, "duration",
-		time.Since(start))
 	return dag, nil
 }
 
@@ -142,6 +181,58 @@ func (c *Client) updateDag(ctx context.Context, tx *sql.Tx, d Dag) error {
 	return nil
 }
 
+// SetDagPaused sets IsPaused flag for given DAG in dags table. If there is no
+// DAG of given dagId in dags table, then sql.ErrNoRows is returned.
+func (c *Client) SetDagPaused(ctx context.Context, dagId string, paused bool) error {
+	start := time.Now()
+	slog.Debug("Start updating DAG IsPaused flag", "dagId", dagId, "paused",
+		paused)
+	isPaused := 0
+	if paused {
+		isPaused = 1
+	}
+	res, err := c.dbConn.ExecContext(ctx, c.dagSetPausedQuery(), isPaused,
+		dagId)
+	if err != nil {
+		slog.Error("Cannot update DAG IsPaused flag", "dagId", dagId, "paused",
+			paused, "err", err)
+		return err
+	}
+	rowsUpdated, _ := res.RowsAffected()
+	if rowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Debug("Finished updating DAG IsPaused flag", "dagId", dagId,
+		"paused", paused, "duration", time.Since(start))
+	return nil
+}
+
+// ReadPausedDagIds reads identifiers of all paused DAGs.
+func (c *Client) ReadPausedDagIds(ctx context.Context) (map[string]struct{}, error) {
+	start := time.Now()
+	slog.Debug("Start reading paused DAGs")
+	paused := make(map[string]struct{})
+
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readPausedDagIdsQuery())
+	if qErr != nil {
+		slog.Error("Failed querying paused DAGs", "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dagId string
+		scanErr := rows.Scan(&dagId)
+		if scanErr != nil {
+			slog.Error("Failed scanning paused DAG", "err", scanErr)
+			return nil, scanErr
+		}
+		paused[dagId] = struct{}{}
+	}
+	slog.Debug("Finished reading paused DAGs", "duration", time.Since(start))
+	return paused, nil
+}
+
 func fromDagToDag(d dag.Dag, createTs string) Dag {
 	attrJson, jErr := json.Marshal(d.Attr)
 	if jErr != nil {
@@ -165,6 +256,7 @@ func fromDagToDag(d dag.Dag, createTs string) Dag {
 		HashDagMeta:         d.HashDagMeta(),
 		HashTasks:           d.HashTasks(),
 		Attributes:          string(attrJson),
+		IsPaused:            false,
 	}
 }
 
@@ -184,6 +276,7 @@ func dagUpdate(d dag.Dag, currDagRow Dag, insertTs string) Dag {
 		HashDagMeta:         d.HashDagMeta(),
 		HashTasks:           d.HashTasks(),
 		Attributes:          string(attrJson),
+		IsPaused:            currDagRow.IsPaused,
 	}
 }
 
@@ -199,7 +292,8 @@ func (c *Client) readDagQuery() string {
 			LatestUpdateVersion,
 			HashDagMeta,
 			HashTasks,
-			Attributes
+			Attributes,
+			IsPaused
 		FROM
 			dags
 		WHERE
@@ -207,6 +301,34 @@ func (c *Client) readDagQuery() string {
 	`
 }
 
+func (c *Client) readDagsQuery() string {
+	return `
+		SELECT
+			DagId,
+			StartTs,
+			Schedule,
+			CreateTs,
+			LatestUpdateTs,
+			CreateVersion,
+			LatestUpdateVersion,
+			HashDagMeta,
+			HashTasks,
+			Attributes,
+			IsPaused
+		FROM
+			dags
+		WHERE
+				? = ''
+			OR EXISTS (
+				SELECT 1
+				FROM json_each(dags.Attributes, '$.tags') t
+				WHERE t.value = ?
+			)
+		ORDER BY
+			DagId
+	`
+}
+
 func (c *Client) dagInsertQuery() string {
 	return `
 		INSERT INTO dags (
@@ -234,6 +356,28 @@ func (c *Client) dagUpdateQuery() string {
 	`
 }
 
+func (c *Client) dagSetPausedQuery() string {
+	return `
+		UPDATE
+			dags
+		SET
+			IsPaused = ?
+		WHERE
+			DagId = ?
+	`
+}
+
+func (c *Client) readPausedDagIdsQuery() string {
+	return `
+		SELECT
+			DagId
+		FROM
+			dags
+		WHERE
+			IsPaused = 1
+	`
+}
+
 // TODO: Move somewhere?
 func pointerEqual[T comparable](a, b *T) bool {
 	if a == nil && b == nil {
@@ -276,5 +420,8 @@ func (d Dag) Equals(e Dag) bool {
 	if d.Attributes != e.Attributes {
 		return false
 	}
+	if d.IsPaused != e.IsPaused {
+		return false
+	}
 	return true
 }
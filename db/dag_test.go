@@ -120,3 +120,102 @@ func insertSimpleDagAndTest(c *Client, t *testing.T) (string, string) {
 	}
 	return dagFromDb.HashTasks, dagFromDb.HashDagMeta
 }
+
+func TestSetDagPaused(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertSimpleDagAndTest(c, t)
+	ctx := context.Background()
+	dagId := "my_simple_dag"
+
+	paused, rErr := c.ReadPausedDagIds(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read paused DAGs: %s", rErr.Error())
+	}
+	if len(paused) != 0 {
+		t.Errorf("Expected no paused DAGs after insert, got: %v", paused)
+	}
+
+	if pErr := c.SetDagPaused(ctx, dagId, true); pErr != nil {
+		t.Fatalf("Cannot pause DAG: %s", pErr.Error())
+	}
+	paused, rErr = c.ReadPausedDagIds(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read paused DAGs: %s", rErr.Error())
+	}
+	if _, isPaused := paused[dagId]; !isPaused || len(paused) != 1 {
+		t.Errorf("Expected only %s to be paused, got: %v", dagId, paused)
+	}
+
+	// Updating DAG definition should not change its pause state
+	uErr := c.UpsertDag(ctx, simpleDag(dagId, 3))
+	if uErr != nil {
+		t.Fatalf("Cannot update DAG: %s", uErr.Error())
+	}
+	dbDag, dErr := c.ReadDag(ctx, dagId)
+	if dErr != nil {
+		t.Fatalf("Cannot read DAG: %s", dErr.Error())
+	}
+	if !dbDag.IsPaused {
+		t.Error("Expected DAG to be still paused after UpsertDag")
+	}
+
+	if pErr := c.SetDagPaused(ctx, dagId, false); pErr != nil {
+		t.Fatalf("Cannot unpause DAG: %s", pErr.Error())
+	}
+	paused, rErr = c.ReadPausedDagIds(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read paused DAGs: %s", rErr.Error())
+	}
+	if len(paused) != 0 {
+		t.Errorf("Expected no paused DAGs after unpause, got: %v", paused)
+	}
+}
+
+func TestSetDagPausedNoDag(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pErr := c.SetDagPaused(context.Background(), "not_existing_dag", true)
+	if pErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for not existing DAG, got: %v", pErr)
+	}
+}
+
+func TestReadDagsByTag(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tags := map[string][]string{
+		"dag_a": {"finance", "daily"},
+		"dag_b": {"marketing"},
+		"dag_c": nil,
+	}
+	for dagId, dagTags := range tags {
+		d := simpleDag(dagId, 1)
+		d.Attr.Tags = dagTags
+		if uErr := c.UpsertDag(ctx, d); uErr != nil {
+			t.Fatalf("Cannot upsert DAG %s: %s", dagId, uErr.Error())
+		}
+	}
+
+	dags, rErr := c.ReadDags(ctx, "")
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if len(dags) != 3 || dags[0].DagId != "dag_a" || dags[2].DagId != "dag_c" {
+		t.Errorf("Expected all 3 DAGs ordered by DagId, got: %+v", dags)
+	}
+	dags, rErr = c.ReadDags(ctx, "finance")
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if len(dags) != 1 || dags[0].DagId != "dag_a" {
+		t.Errorf("Expected only dag_a, got: %+v", dags)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/dskrzypiec/scheduler/timeutils"
@@ -19,6 +20,10 @@ type DagRun struct {
 	Status         string
 	StatusUpdateTs string
 	Version        string
+
+	// DAG run parameters serialized as JSON object. It's nil for DAG runs
+	// without parameters.
+	Params *string
 }
 
 // Those should be consistent with dag.RunStatus string values. We cannot use
@@ -26,6 +31,9 @@ type DagRun struct {
 const (
 	statusReadyToSchedule = "READY_TO_SCHEDULE"
 	statusScheduled       = "SCHEDULED"
+	statusSuccess         = "SUCCESS"
+	statusFailed          = "FAILED"
+	statusCancelled       = "CANCELLED"
 )
 
 // ReadDagRuns reads topN latest dag runs for given DAG ID.
@@ -71,13 +79,22 @@ func (c *Client) ReadDagRuns(ctx context.Context, dagId string, topN int) ([]Dag
 // execution timestamp. Initial status is set to DagRunStatusScheduled. RunId
 // for just inserted dag run is returned or -1 in case when error is not nil.
 func (c *Client) InsertDagRun(ctx context.Context, dagId, execTs string) (int64, error) {
+	return c.InsertDagRunWithParams(ctx, dagId, execTs, nil)
+}
+
+// InsertDagRunWithParams inserts new row into dagruns table, the same way as
+// InsertDagRun, together with DAG run parameters serialized as JSON object.
+// When params is nil, the DAG run has no parameters.
+func (c *Client) InsertDagRunWithParams(
+	ctx context.Context, dagId, execTs string, params *string,
+) (int64, error) {
 	start := time.Now()
 	insertTs := timeutils.ToString(time.Now())
 	slog.Debug("Start inserting dag run", "dagId", dagId, "execTs", insertTs)
 	res, err := c.dbConn.ExecContext(
 		ctx, c.insertDagRunQuery(),
 		dagId, execTs, insertTs, statusScheduled, insertTs,
-		version.Version,
+		version.Version, params,
 	)
 	if err != nil {
 		slog.Error("Cannot insert new dag run", "dagId", dagId, "execTs", execTs,
@@ -89,6 +106,44 @@ func (c *Client) InsertDagRun(ctx context.Context, dagId, execTs string) (int64,
 	return res.LastInsertId()
 }
 
+// ErrDagRunExists is returned by InsertNewDagRun, when there is already a DAG
+// run of the DAG at given execution timestamp.
+var ErrDagRunExists = errors.New("dag run already exists")
+
+// InsertNewDagRun inserts new row into dagruns table, the same way as
+// InsertDagRunWithParams, only when there is no DAG run of the DAG at given
+// execution timestamp yet. The check and the insert are done in a single
+// statement, so concurrent calls cannot insert duplicated DAG runs. In case
+// when the DAG run already exists, ErrDagRunExists is returned.
+func (c *Client) InsertNewDagRun(
+	ctx context.Context, dagId, execTs string, params *string,
+) (int64, error) {
+	start := time.Now()
+	insertTs := timeutils.ToString(time.Now())
+	slog.Debug("Start inserting new dag run", "dagId", dagId, "execTs",
+		execTs)
+	res, err := c.dbConn.ExecContext(
+		ctx, c.insertNewDagRunQuery(),
+		dagId, execTs, insertTs, statusScheduled, insertTs,
+		version.Version, params, dagId, execTs,
+	)
+	if err != nil {
+		slog.Error("Cannot insert new dag run", "dagId", dagId, "execTs", execTs,
+			"err", err)
+		return -1, err
+	}
+	inserted, rErr := res.RowsAffected()
+	if rErr != nil {
+		return -1, rErr
+	}
+	if inserted == 0 {
+		return -1, ErrDagRunExists
+	}
+	slog.Debug("Finished inserting new dag run in state SCHEDULED", "dagId",
+		dagId, "execTs", execTs, "duration", time.Since(start))
+	return res.LastInsertId()
+}
+
 // ReadLatestDagRuns reads latest dag run for each Dag. Returns map from DagId
 // to DagRun.
 func (c *Client) ReadLatestDagRuns(ctx context.Context) (map[string]DagRun, error) {
@@ -186,6 +241,59 @@ func (c *Client) UpdateDagRunStatusByExecTs(
 	return nil
 }
 
+// ReadDagRun reads single dag run for given dagId and execTs. If there is no
+// such dag run, then sql.ErrNoRows is returned.
+func (c *Client) ReadDagRun(
+	ctx context.Context, dagId, execTs string,
+) (DagRun, error) {
+	start := time.Now()
+	slog.Debug("Start reading dag run", "dagId", dagId, "execTs", execTs)
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readDagRunQuery(), dagId,
+		execTs)
+	if qErr != nil {
+		slog.Error("Failed querying dag run", "dagId", dagId, "execTs", execTs,
+			"err", qErr)
+		return DagRun{}, qErr
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return DagRun{}, sql.ErrNoRows
+	}
+	dagrun, scanErr := parseDagRun(rows)
+	if scanErr != nil {
+		slog.Error("Failed scanning dagrun record", "dagId", dagId, "execTs",
+			execTs, "err", scanErr)
+		return DagRun{}, scanErr
+	}
+	slog.Debug("Finished reading dag run", "dagId", dagId, "execTs", execTs,
+		"duration", time.Since(start))
+	return dagrun, nil
+}
+
+// ReadPrevDagRunExecTs reads execution timestamp of the latest dag run of
+// given DAG before given execution timestamp. If there is no such dag run,
+// then sql.ErrNoRows is returned.
+func (c *Client) ReadPrevDagRunExecTs(
+	ctx context.Context, dagId, execTs string,
+) (string, error) {
+	start := time.Now()
+	slog.Debug("Start reading previous dag run", "dagId", dagId, "execTs",
+		execTs)
+	row := c.dbConn.QueryRowContext(ctx, c.readPrevDagRunExecTsQuery(), dagId,
+		execTs, execTs)
+	var prevExecTs string
+	if err := row.Scan(&prevExecTs); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Failed reading previous dag run", "dagId", dagId,
+				"execTs", execTs, "err", err)
+		}
+		return "", err
+	}
+	slog.Debug("Finished reading previous dag run", "dagId", dagId, "execTs",
+		execTs, "duration", time.Since(start))
+	return prevExecTs, nil
+}
+
 // DagRunAlreadyScheduled checks whenever dagrun already exists for given DAG ID and
 // schedule timestamp.
 func (c *Client) DagRunAlreadyScheduled(
@@ -245,12 +353,64 @@ func (c *Client) ReadDagRunsToBeScheduled(ctx context.Context) ([]DagRun, error)
 	return dagruns, nil
 }
 
+// DagRunFilter describes which DAG runs should be read by ReadDagRunsFiltered.
+// Empty fields are not taken into account.
+type DagRunFilter struct {
+	DagId  string
+	Status string
+
+	// Tag of the DAG (see dag.Attr.Tags).
+	Tag string
+
+	// Range of execution timestamps - ExecTsFrom is inclusive, ExecTsTo is
+	// exclusive. Timestamps are in the format of timeutils.ToString and are
+	// compared in UTC with seconds precision.
+	ExecTsFrom string
+	ExecTsTo   string
+
+	// Maximum number of DAG runs to be read and number of DAG runs to be
+	// skipped, for pagination. Non-positive limit means no limit.
+	Limit  int
+	Offset int
+}
+
+// ReadDagRunsFiltered reads DAG runs matching given filter, starting from the
+// most recently inserted.
+func (c *Client) ReadDagRunsFiltered(
+	ctx context.Context, filter DagRunFilter,
+) ([]DagRun, error) {
+	start := time.Now()
+	slog.Debug("Start reading filtered dag runs", "filter", filter)
+	query, args := c.readDagRunsFilteredQuery(filter)
+	rows, qErr := c.dbConn.QueryContext(ctx, query, args...)
+	if qErr != nil {
+		slog.Error("Failed querying dag runs", "filter", filter, "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	dagruns := make([]DagRun, 0)
+	for rows.Next() {
+		dagrun, scanErr := parseDagRun(rows)
+		if scanErr != nil {
+			slog.Error("Failed scanning dagrun record", "filter", filter,
+				"err", scanErr)
+			return nil, scanErr
+		}
+		dagruns = append(dagruns, dagrun)
+	}
+	slog.Debug("Finished reading filtered dag runs", "filter", filter,
+		"dagruns", len(dagruns), "duration", time.Since(start))
+	return dagruns, nil
+}
+
 func parseDagRun(rows *sql.Rows) (DagRun, error) {
 	var runId int64
 	var dagId, execTs, insertTs, status, statusTs, version string
+	var params *string
 
 	scanErr := rows.Scan(&runId, &dagId, &execTs, &insertTs, &status,
-		&statusTs, &version)
+		&statusTs, &version, &params)
 	if scanErr != nil {
 		return DagRun{}, scanErr
 	}
@@ -262,6 +422,7 @@ func parseDagRun(rows *sql.Rows) (DagRun, error) {
 		Status:         status,
 		StatusUpdateTs: statusTs,
 		Version:        version,
+		Params:         params,
 	}
 	return dagrun, nil
 }
@@ -276,7 +437,8 @@ func (c *Client) readDagRunsQuery(topN int) string {
 				InsertTs,
 				Status,
 				StatusUpdateTs,
-				Version
+				Version,
+				Params
 			FROM
 				dagruns
 			WHERE
@@ -293,7 +455,8 @@ func (c *Client) readDagRunsQuery(topN int) string {
 			InsertTs,
 			Status,
 			StatusUpdateTs,
-			Version
+			Version,
+			Params
 		FROM
 			dagruns
 		WHERE
@@ -305,10 +468,85 @@ func (c *Client) readDagRunsQuery(topN int) string {
 	`
 }
 
+// Builds query of ReadDagRunsFiltered and its arguments.
+func (c *Client) readDagRunsFilteredQuery(filter DagRunFilter) (string, []any) {
+	conditions := []string{"1 = 1"}
+	args := make([]any, 0, 7)
+	if filter.DagId != "" {
+		conditions = append(conditions, "dr.DagId = ?")
+		args = append(args, filter.DagId)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "dr.Status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, `EXISTS (
+				SELECT 1
+				FROM dags d, json_each(d.Attributes, '$.tags') t
+				WHERE d.DagId = dr.DagId AND t.value = ?
+			)`)
+		args = append(args, filter.Tag)
+	}
+	if filter.ExecTsFrom != "" {
+		conditions = append(conditions, utcSeconds("dr.ExecTs")+" >= "+
+			utcSeconds("?"))
+		args = append(args, filter.ExecTsFrom, filter.ExecTsFrom)
+	}
+	if filter.ExecTsTo != "" {
+		conditions = append(conditions, utcSeconds("dr.ExecTs")+" < "+
+			utcSeconds("?"))
+		args = append(args, filter.ExecTsTo, filter.ExecTsTo)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit, max(filter.Offset, 0))
+	query := `
+		SELECT
+			dr.RunId,
+			dr.DagId,
+			dr.ExecTs,
+			dr.InsertTs,
+			dr.Status,
+			dr.StatusUpdateTs,
+			dr.Version,
+			dr.Params
+		FROM
+			dagruns dr
+		WHERE
+			` + strings.Join(conditions, "\n\t\t\tAND ") + `
+		ORDER BY
+			dr.RunId DESC
+		LIMIT ? OFFSET ?
+	`
+	return query, args
+}
+
+// Returns SQL expression which converts timestamp in timeutils.TimestampFormat
+// into UTC timestamp with seconds precision. Local date and time are taken
+// together with the zone offset (the last 6 characters), so timestamps stored
+// in different time zones can be compared. Placeholder "?" as the argument
+// requires the same value given twice.
+func utcSeconds(expr string) string {
+	return "datetime(substr(" + expr + ", 1, 19) || substr(" + expr + ", -6))"
+}
+
 func (c *Client) insertDagRunQuery() string {
 	return `
-		INSERT INTO dagruns (DagId, ExecTs, InsertTs, Status, StatusUpdateTs, Version)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO dagruns (DagId, ExecTs, InsertTs, Status, StatusUpdateTs, Version, Params)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+}
+
+func (c *Client) insertNewDagRunQuery() string {
+	return `
+		INSERT INTO dagruns (DagId, ExecTs, InsertTs, Status, StatusUpdateTs, Version, Params)
+		SELECT ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM dagruns WHERE DagId = ? AND ExecTs = ?
+		)
 	`
 }
 
@@ -330,7 +568,8 @@ func (c *Client) latestDagRunsQuery() string {
 			d.InsertTs,
 			d.Status,
 			d.StatusUpdateTs,
-			d.Version
+			d.Version,
+			d.Params
 		FROM
 			dagruns d
 		INNER JOIN
@@ -338,6 +577,41 @@ func (c *Client) latestDagRunsQuery() string {
 	`
 }
 
+func (c *Client) readDagRunQuery() string {
+	return `
+		SELECT
+			RunId,
+			DagId,
+			ExecTs,
+			InsertTs,
+			Status,
+			StatusUpdateTs,
+			Version,
+			Params
+		FROM
+			dagruns
+		WHERE
+				DagId = ?
+			AND ExecTs = ?
+	`
+}
+
+func (c *Client) readPrevDagRunExecTsQuery() string {
+	return `
+		SELECT
+			ExecTs
+		FROM
+			dagruns
+		WHERE
+				DagId = ?
+			AND ` + utcSeconds("ExecTs") + ` < ` + utcSeconds("?") + `
+		ORDER BY
+			` + utcSeconds("ExecTs") + ` DESC
+		LIMIT
+			1
+	`
+}
+
 func (c *Client) updateDagRunStatusQuery() string {
 	return `
 	UPDATE
@@ -372,7 +646,8 @@ func (c *Client) readDagRunToBeScheduledQuery() string {
 			InsertTs,
 			Status,
 			StatusUpdateTs,
-			Version
+			Version,
+			Params
 		FROM
 			dagruns
 		WHERE
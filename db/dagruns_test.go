@@ -2,7 +2,10 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,6 +47,84 @@ func TestInsertDagRunSimple(t *testing.T) {
 	}
 }
 
+func TestInsertNewDagRunConcurrently(t *testing.T) {
+	c, err := NewSqliteTmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CleanUpSqliteTmp(c, t)
+	ctx := context.Background()
+	dagId := "mock_dag"
+	execTs := timeutils.ToString(time.Now())
+	const inserts = 10
+	errs := make(chan error, inserts)
+	var wg sync.WaitGroup
+	for i := 0; i < inserts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, iErr := c.InsertNewDagRun(ctx, dagId, execTs, nil)
+			errs <- iErr
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	inserted, existing := 0, 0
+	for iErr := range errs {
+		switch {
+		case iErr == nil:
+			inserted++
+		case errors.Is(iErr, ErrDagRunExists):
+			existing++
+		default:
+			t.Errorf("Unexpected error while inserting dag run: %s",
+				iErr.Error())
+		}
+	}
+	if inserted != 1 || existing != inserts-1 {
+		t.Errorf("Expected 1 inserted and %d existing dag runs, got %d and %d",
+			inserts-1, inserted, existing)
+	}
+	if cnt := c.Count("dagruns"); cnt != 1 {
+		t.Errorf("Expected 1 row in dagruns, got: %d", cnt)
+	}
+}
+
+func TestInsertDagRunWithParams(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	dagId := "mock_dag"
+	execTs := timeutils.ToString(time.Now())
+	params := `{"customerId":"c42"}`
+	_, iErr := c.InsertDagRunWithParams(ctx, dagId, execTs, &params)
+	if iErr != nil {
+		t.Fatalf("Error while inserting dag run: %s", iErr.Error())
+	}
+	otherTs := timeutils.ToString(time.Now().Add(time.Hour))
+	if _, iErr = c.InsertDagRun(ctx, dagId, otherTs); iErr != nil {
+		t.Fatalf("Error while inserting dag run: %s", iErr.Error())
+	}
+
+	dr, rErr := c.ReadDagRun(ctx, dagId, execTs)
+	if rErr != nil {
+		t.Fatalf("Error while reading dag run: %s", rErr.Error())
+	}
+	if dr.Params == nil || *dr.Params != params {
+		t.Errorf("Expected params %s, got: %v", params, dr.Params)
+	}
+	dr, rErr = c.ReadDagRun(ctx, dagId, otherTs)
+	if rErr != nil {
+		t.Fatalf("Error while reading dag run: %s", rErr.Error())
+	}
+	if dr.Params != nil {
+		t.Errorf("Expected no params, got: %s", *dr.Params)
+	}
+}
+
 func TestInsertAndReadDagRunsAll(t *testing.T) {
 	c, err := NewInMemoryClient(sqlSchemaPath)
 	if err != nil {
@@ -497,3 +578,161 @@ func insertDagRun(c *Client, ctx context.Context, dagId, execTs string, t *testi
 		t.Errorf("Error while inserting dag run: %s", iErr.Error())
 	}
 }
+
+func TestReadDagRunsFiltered(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	d := simpleDag("dag_tagged", 1)
+	d.Attr.Tags = []string{"finance"}
+	if uErr := c.UpsertDag(ctx, d); uErr != nil {
+		t.Fatal(uErr)
+	}
+	base := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		for _, dagId := range []string{"dag_tagged", "dag_other"} {
+			execTs := timeutils.ToString(base.Add(time.Duration(i) * time.Hour))
+			if _, iErr := c.InsertDagRun(ctx, dagId, execTs); iErr != nil {
+				t.Fatal(iErr)
+			}
+		}
+	}
+	uErr := c.UpdateDagRunStatusByExecTs(ctx, "dag_tagged",
+		timeutils.ToString(base), "SUCCESS")
+	if uErr != nil {
+		t.Fatal(uErr)
+	}
+
+	data := []struct {
+		filter   DagRunFilter
+		expected int
+	}{
+		{DagRunFilter{}, 10},
+		{DagRunFilter{DagId: "dag_other"}, 5},
+		{DagRunFilter{Tag: "finance"}, 5},
+		{DagRunFilter{Tag: "finance", Status: "SUCCESS"}, 1},
+		{DagRunFilter{
+			ExecTsFrom: timeutils.ToString(base.Add(time.Hour)),
+			ExecTsTo:   timeutils.ToString(base.Add(3 * time.Hour)),
+		}, 4},
+		{DagRunFilter{Limit: 3}, 3},
+		{DagRunFilter{Limit: 3, Offset: 9}, 1},
+	}
+	for _, input := range data {
+		dagruns, rErr := c.ReadDagRunsFiltered(ctx, input.filter)
+		if rErr != nil {
+			t.Fatalf("Cannot read dag runs for %+v: %s", input.filter,
+				rErr.Error())
+		}
+		if len(dagruns) != input.expected {
+			t.Errorf("Expected %d dag runs for %+v, got %d", input.expected,
+				input.filter, len(dagruns))
+		}
+	}
+	dagruns, _ := c.ReadDagRunsFiltered(ctx, DagRunFilter{Limit: 1})
+	if len(dagruns) != 1 || dagruns[0].RunId != 10 {
+		t.Errorf("Expected the latest dag run first, got: %+v", dagruns)
+	}
+}
+
+func TestReadPrevDagRunExecTs(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	day := func(d int) string {
+		return timeutils.ToString(time.Date(2023, time.October, d, 0, 0, 0, 0,
+			time.UTC))
+	}
+	// Inserted out of order, like backfill of older DAG runs
+	for _, execTs := range []string{day(1), day(3), day(2)} {
+		if _, iErr := c.InsertDagRun(ctx, "dag_prev", execTs); iErr != nil {
+			t.Fatal(iErr)
+		}
+	}
+	if _, iErr := c.InsertDagRun(ctx, "dag_other", day(4)); iErr != nil {
+		t.Fatal(iErr)
+	}
+
+	data := map[string]string{day(4): day(3), day(3): day(2), day(2): day(1)}
+	for execTs, expected := range data {
+		prev, rErr := c.ReadPrevDagRunExecTs(ctx, "dag_prev", execTs)
+		if rErr != nil {
+			t.Fatalf("Cannot read previous dag run of %s: %s", execTs,
+				rErr.Error())
+		}
+		if prev != expected {
+			t.Errorf("Expected previous dag run of %s at %s, got %s", execTs,
+				expected, prev)
+		}
+	}
+	_, rErr := c.ReadPrevDagRunExecTs(ctx, "dag_prev", day(1))
+	if !errors.Is(rErr, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for the first dag run, got: %v", rErr)
+	}
+}
+
+func TestReadDagRunsFilteredMixedTimeZones(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cet := time.FixedZone("CET", 3600)
+	pst := time.FixedZone("PST", -8*3600)
+	// All of them are between 10:00 and 11:00 UTC
+	execTss := []time.Time{
+		time.Date(2023, time.October, 1, 11, 30, 0, 0, cet),
+		time.Date(2023, time.October, 1, 2, 15, 0, 0, pst),
+		time.Date(2023, time.October, 1, 10, 45, 0, 0, time.UTC),
+	}
+	for _, execTs := range execTss {
+		_, iErr := c.InsertDagRun(ctx, "dag_zones", timeutils.ToString(execTs))
+		if iErr != nil {
+			t.Fatal(iErr)
+		}
+	}
+
+	data := []struct {
+		from, to time.Time
+		expected int
+	}{
+		{
+			time.Date(2023, time.October, 1, 10, 0, 0, 0, time.UTC),
+			time.Date(2023, time.October, 1, 11, 0, 0, 0, time.UTC),
+			3,
+		},
+		{
+			time.Date(2023, time.October, 1, 10, 20, 0, 0, time.UTC),
+			time.Date(2023, time.October, 1, 12, 0, 0, 0, cet),
+			2,
+		},
+		{
+			time.Date(2023, time.October, 1, 11, 30, 0, 0, cet),
+			time.Date(2023, time.October, 1, 2, 50, 0, 0, pst),
+			2,
+		},
+		{
+			time.Date(2023, time.October, 1, 11, 16, 0, 0, cet),
+			time.Date(2023, time.October, 1, 11, 30, 0, 0, cet),
+			0,
+		},
+	}
+	for _, input := range data {
+		filter := DagRunFilter{
+			ExecTsFrom: timeutils.ToString(input.from),
+			ExecTsTo:   timeutils.ToString(input.to),
+		}
+		dagruns, rErr := c.ReadDagRunsFiltered(ctx, filter)
+		if rErr != nil {
+			t.Fatalf("Cannot read dag runs for %+v: %s", filter, rErr.Error())
+		}
+		if len(dagruns) != input.expected {
+			t.Errorf("Expected %d dag runs for %+v, got %d: %+v",
+				input.expected, filter, len(dagruns), dagruns)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/dskrzypiec/scheduler/timeutils"
@@ -13,6 +14,8 @@ import (
 
 const (
 	DagRunTaskStatusScheduled = "SCHEDULED"
+	DagRunTaskStatusRunning   = "RUNNING"
+	DagRunTaskStatusSuccess   = "SUCCESS"
 )
 
 type DagRunTask struct {
@@ -23,6 +26,15 @@ type DagRunTask struct {
 	Status         string
 	StatusUpdateTs string
 	Version        string
+	ExecutorId     *string
+
+	// Current lease of the task, when it's handed out to an executor (see
+	// scheduler.TaskLeases).
+	LeaseId *string
+
+	// Rendered task templates serialized as JSON object. It's nil for tasks
+	// without templates.
+	Rendered *string
 }
 
 // Reads DAG run tasks information from dagruntasks table for given DAG run.
@@ -97,7 +109,9 @@ func (c *Client) ReadDagRunTask(
 	row := c.dbConn.QueryRowContext(ctx, c.readDagRunTaskQuery(), dagId,
 		execTs, taskId)
 	var insertTs, status, statusTs, version string
-	scanErr := row.Scan(&insertTs, &status, &statusTs, &version)
+	var executorId, leaseId, rendered *string
+	scanErr := row.Scan(&insertTs, &status, &statusTs, &version, &executorId,
+		&leaseId, &rendered)
 	if scanErr == sql.ErrNoRows {
 		return DagRunTask{}, scanErr
 	}
@@ -115,6 +129,9 @@ func (c *Client) ReadDagRunTask(
 		Status:         status,
 		StatusUpdateTs: statusTs,
 		Version:        version,
+		ExecutorId:     executorId,
+		LeaseId:        leaseId,
+		Rendered:       rendered,
 	}
 	slog.Debug("Finished reading dag run task", "dagId", dagId, "execTs",
 		execTs, "taskId", taskId, "duration", time.Since(start))
@@ -154,10 +171,213 @@ func (c *Client) UpdateDagRunTaskStatus(
 	return nil
 }
 
+// SetDagRunTaskExecutor sets executor which owns (executes) given dag run
+// task. When executorId is nil, then the task is not owned by any executor.
+func (c *Client) SetDagRunTaskExecutor(
+	ctx context.Context, dagId, execTs, taskId string, executorId *string,
+) error {
+	start := time.Now()
+	slog.Debug("Start updating dag run task executor", "dagId", dagId,
+		"execTs", execTs, "taskId", taskId, "executorId", executorId)
+	res, err := c.dbConn.ExecContext(
+		ctx, c.updateDagRunTaskExecutorQuery(),
+		executorId, dagId, execTs, taskId,
+	)
+	if err != nil {
+		slog.Error("Cannot update dag run task executor", "dagId", dagId,
+			"execTs", execTs, "taskId", taskId, "err", err)
+		return err
+	}
+	rowsUpdated, _ := res.RowsAffected()
+	if rowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Debug("Finished updating dag run task executor", "dagId", dagId,
+		"execTs", execTs, "taskId", taskId, "duration", time.Since(start))
+	return nil
+}
+
+// SetDagRunTaskLease sets current lease of given dag run task. When leaseId
+// is nil, then the task has no lease. If there is no such dag run task, then
+// sql.ErrNoRows is returned.
+func (c *Client) SetDagRunTaskLease(
+	ctx context.Context, dagId, execTs, taskId string, leaseId *string,
+) error {
+	start := time.Now()
+	slog.Debug("Start updating dag run task lease", "dagId", dagId,
+		"execTs", execTs, "taskId", taskId, "leaseId", leaseId)
+	res, err := c.dbConn.ExecContext(
+		ctx, c.updateDagRunTaskLeaseQuery(),
+		leaseId, dagId, execTs, taskId,
+	)
+	if err != nil {
+		slog.Error("Cannot update dag run task lease", "dagId", dagId,
+			"execTs", execTs, "taskId", taskId, "err", err)
+		return err
+	}
+	rowsUpdated, _ := res.RowsAffected()
+	if rowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Debug("Finished updating dag run task lease", "dagId", dagId,
+		"execTs", execTs, "taskId", taskId, "duration", time.Since(start))
+	return nil
+}
+
+// SetDagRunTaskRendered sets rendered templates of given dag run task,
+// serialized as JSON object. If there is no such dag run task, then
+// sql.ErrNoRows is returned.
+func (c *Client) SetDagRunTaskRendered(
+	ctx context.Context, dagId, execTs, taskId string, rendered *string,
+) error {
+	start := time.Now()
+	slog.Debug("Start updating dag run task rendered templates", "dagId",
+		dagId, "execTs", execTs, "taskId", taskId)
+	res, err := c.dbConn.ExecContext(
+		ctx, c.updateDagRunTaskRenderedQuery(),
+		rendered, dagId, execTs, taskId,
+	)
+	if err != nil {
+		slog.Error("Cannot update dag run task rendered templates", "dagId",
+			dagId, "execTs", execTs, "taskId", taskId, "err", err)
+		return err
+	}
+	rowsUpdated, _ := res.RowsAffected()
+	if rowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Debug("Finished updating dag run task rendered templates", "dagId",
+		dagId, "execTs", execTs, "taskId", taskId, "duration",
+		time.Since(start))
+	return nil
+}
+
+// ClearDagRunTasks removes given tasks of finished (SUCCESS, FAILED or
+// CANCELLED) dag run from dagruntasks table and sets the dag run status back
+// to SCHEDULED, in a single transaction. This way cleared tasks have no status
+// and can be scheduled again, once the dag run is put back onto the dag run
+// queue. Returns number of removed dagruntasks rows. If the dag run does not
+// exist or is not finished, then sql.ErrNoRows is returned and nothing is
+// changed.
+func (c *Client) ClearDagRunTasks(
+	ctx context.Context, dagId, execTs string, taskIds []string,
+) (int64, error) {
+	start := time.Now()
+	slog.Debug("Start clearing dag run tasks", "dagId", dagId, "execTs",
+		execTs, "taskIds", taskIds)
+	tx, txErr := c.dbConn.Begin()
+	if txErr != nil {
+		return 0, txErr
+	}
+	defer tx.Rollback()
+
+	res, uErr := tx.ExecContext(ctx, c.updateFinishedDagRunStatusQuery(),
+		statusScheduled, timeutils.ToString(start), dagId, execTs,
+		statusSuccess, statusFailed, statusCancelled)
+	if uErr != nil {
+		slog.Error("Cannot update dag run status", "dagId", dagId, "execTs",
+			execTs, "err", uErr)
+		return 0, uErr
+	}
+	if rowsUpdated, _ := res.RowsAffected(); rowsUpdated == 0 {
+		return 0, sql.ErrNoRows
+	}
+	var removed int64
+	if len(taskIds) > 0 {
+		args := make([]any, 0, len(taskIds)+2)
+		args = append(args, dagId, execTs)
+		for _, taskId := range taskIds {
+			args = append(args, taskId)
+		}
+		dRes, dErr := tx.ExecContext(ctx,
+			c.deleteDagRunTasksQuery(len(taskIds)), args...)
+		if dErr != nil {
+			slog.Error("Cannot delete dag run tasks", "dagId", dagId, "execTs",
+				execTs, "err", dErr)
+			return 0, dErr
+		}
+		removed, _ = dRes.RowsAffected()
+	}
+	if cErr := tx.Commit(); cErr != nil {
+		slog.Error("Could not commit SQL transaction", "dagId", dagId,
+			"execTs", execTs, "err", cErr)
+		return 0, cErr
+	}
+	slog.Debug("Finished clearing dag run tasks", "dagId", dagId, "execTs",
+		execTs, "removed", removed, "duration", time.Since(start))
+	return removed, nil
+}
+
+// ReadExecutorDagRunTasks reads dag run tasks owned by given executor, which
+// are not yet finished (are in SCHEDULED or RUNNING status).
+func (c *Client) ReadExecutorDagRunTasks(
+	ctx context.Context, executorId string,
+) ([]DagRunTask, error) {
+	start := time.Now()
+	slog.Debug("Start reading executor dag run tasks", "executorId",
+		executorId)
+	dagruntasks := make([]DagRunTask, 0)
+
+	rows, qErr := c.dbConn.QueryContext(ctx,
+		c.readExecutorDagRunTasksQuery(), executorId,
+		DagRunTaskStatusScheduled, DagRunTaskStatusRunning)
+	if qErr != nil {
+		slog.Error("Failed querying executor dag run tasks", "executorId",
+			executorId, "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dagruntask, scanErr := parseDagRunTask(rows)
+		if scanErr != nil {
+			slog.Error("Failed scanning a DagRunTask record", "executorId",
+				executorId, "err", scanErr)
+			return nil, scanErr
+		}
+		dagruntasks = append(dagruntasks, dagruntask)
+	}
+	slog.Debug("Finished reading executor dag run tasks", "executorId",
+		executorId, "duration", time.Since(start))
+	return dagruntasks, nil
+}
+
+// ReadNotFinishedDagRunTasks reads all dag run tasks which are not yet
+// finished (are in SCHEDULED or RUNNING status).
+func (c *Client) ReadNotFinishedDagRunTasks(
+	ctx context.Context,
+) ([]DagRunTask, error) {
+	start := time.Now()
+	slog.Debug("Start reading not finished dag run tasks")
+	dagruntasks := make([]DagRunTask, 0)
+
+	rows, qErr := c.dbConn.QueryContext(ctx,
+		c.readNotFinishedDagRunTasksQuery(), DagRunTaskStatusScheduled,
+		DagRunTaskStatusRunning)
+	if qErr != nil {
+		slog.Error("Failed querying not finished dag run tasks", "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dagruntask, scanErr := parseDagRunTask(rows)
+		if scanErr != nil {
+			slog.Error("Failed scanning a DagRunTask record", "err", scanErr)
+			return nil, scanErr
+		}
+		dagruntasks = append(dagruntasks, dagruntask)
+	}
+	slog.Debug("Finished reading not finished dag run tasks", "tasks",
+		len(dagruntasks), "duration", time.Since(start))
+	return dagruntasks, nil
+}
+
 func parseDagRunTask(rows *sql.Rows) (DagRunTask, error) {
 	var dagId, execTs, taskId, insertTs, status, statusTs, version string
+	var executorId, leaseId, rendered *string
 	scanErr := rows.Scan(&dagId, &execTs, &taskId, &insertTs, &status,
-		&statusTs, &version)
+		&statusTs, &version, &executorId, &leaseId, &rendered)
 	if scanErr != nil {
 		return DagRunTask{}, scanErr
 	}
@@ -169,6 +389,9 @@ func parseDagRunTask(rows *sql.Rows) (DagRunTask, error) {
 		Status:         status,
 		StatusUpdateTs: statusTs,
 		Version:        version,
+		ExecutorId:     executorId,
+		LeaseId:        leaseId,
+		Rendered:       rendered,
 	}
 	return dagRunTask, nil
 }
@@ -182,7 +405,10 @@ func (c *Client) readDagRunTasksQuery() string {
 		InsertTs,
 		Status,
 		StatusUpdateTs,
-		Version
+		Version,
+		ExecutorId,
+		LeaseId,
+		Rendered
 	FROM
 		dagruntasks
 	WHERE
@@ -197,7 +423,10 @@ func (c *Client) readDagRunTaskQuery() string {
 		InsertTs,
 		Status,
 		StatusUpdateTs,
-		Version
+		Version,
+		ExecutorId,
+		LeaseId,
+		Rendered
 	FROM
 		dagruntasks
 	WHERE
@@ -229,3 +458,202 @@ func (c *Client) updateDagRunTaskStatusQuery() string {
 		AND TaskId = ?
 	`
 }
+
+func (c *Client) updateDagRunTaskExecutorQuery() string {
+	return `
+	UPDATE
+		dagruntasks
+	SET
+		ExecutorId = ?
+	WHERE
+			DagId = ?
+		AND ExecTs = ?
+		AND TaskId = ?
+	`
+}
+
+func (c *Client) updateDagRunTaskLeaseQuery() string {
+	return `
+	UPDATE
+		dagruntasks
+	SET
+		LeaseId = ?
+	WHERE
+			DagId = ?
+		AND ExecTs = ?
+		AND TaskId = ?
+	`
+}
+
+func (c *Client) updateDagRunTaskRenderedQuery() string {
+	return `
+	UPDATE
+		dagruntasks
+	SET
+		Rendered = ?
+	WHERE
+			DagId = ?
+		AND ExecTs = ?
+		AND TaskId = ?
+	`
+}
+
+func (c *Client) updateFinishedDagRunStatusQuery() string {
+	return `
+	UPDATE
+		dagruns
+	SET
+		Status = ?,
+		StatusUpdateTs = ?
+	WHERE
+			DagId = ?
+		AND ExecTs = ?
+		AND Status IN (?, ?, ?)
+	`
+}
+
+func (c *Client) deleteDagRunTasksQuery(tasksNum int) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", tasksNum), ",")
+	return `
+	DELETE FROM
+		dagruntasks
+	WHERE
+			DagId = ?
+		AND ExecTs = ?
+		AND TaskId IN (` + placeholders + `)
+	`
+}
+
+func (c *Client) readExecutorDagRunTasksQuery() string {
+	return `
+	SELECT
+		DagId,
+		ExecTs,
+		TaskId,
+		InsertTs,
+		Status,
+		StatusUpdateTs,
+		Version,
+		ExecutorId,
+		LeaseId,
+		Rendered
+	FROM
+		dagruntasks
+	WHERE
+			ExecutorId = ?
+		AND Status IN (?, ?)
+	`
+}
+
+func (c *Client) readNotFinishedDagRunTasksQuery() string {
+	return `
+	SELECT
+		DagId,
+		ExecTs,
+		TaskId,
+		InsertTs,
+		Status,
+		StatusUpdateTs,
+		Version,
+		ExecutorId,
+		LeaseId,
+		Rendered
+	FROM
+		dagruntasks
+	WHERE
+		Status IN (?, ?)
+	`
+}
+
+// ReadDagRunTaskDurations reads average durations of tasks of given DAG, based
+// on successful task runs within lastNRuns latest DAG runs. Task duration is
+// measured from inserting dag run task (usually when it's scheduled) till its
+// latest status update, thus it also includes time spent in the task queue.
+// Tasks without successful runs are not included in the result map. Number of
+// distinct DAG runs which durations were based on is returned as well - it
+// might be less than lastNRuns.
+func (c *Client) ReadDagRunTaskDurations(
+	ctx context.Context, dagId string, lastNRuns int,
+) (map[string]time.Duration, int, error) {
+	start := time.Now()
+	slog.Debug("Start reading dag run task durations", "dagId", dagId,
+		"lastNRuns", lastNRuns)
+	totals := make(map[string]time.Duration)
+	counts := make(map[string]int)
+	runs := make(map[string]struct{})
+
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readDagRunTaskDurationsQuery(),
+		dagId, lastNRuns, DagRunTaskStatusSuccess)
+	if qErr != nil {
+		slog.Error("Failed querying dag run task durations", "dagId", dagId,
+			"err", qErr)
+		return nil, 0, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		select {
+		case <-ctx.Done():
+			slog.Warn("Context done while processing dag run task durations",
+				"dagId", dagId, "err", ctx.Err())
+			return nil, 0, ctx.Err()
+		default:
+		}
+		var execTs, taskId, insertTs, statusUpdateTs string
+		scanErr := rows.Scan(&execTs, &taskId, &insertTs, &statusUpdateTs)
+		if scanErr != nil {
+			slog.Error("Failed scanning dag run task duration", "dagId", dagId,
+				"err", scanErr)
+			return nil, 0, scanErr
+		}
+		from, fErr := timeutils.FromString(insertTs)
+		to, tErr := timeutils.FromString(statusUpdateTs)
+		if fErr != nil || tErr != nil {
+			slog.Warn("Cannot parse dag run task timestamps", "dagId", dagId,
+				"taskId", taskId, "insertTs", insertTs, "statusUpdateTs",
+				statusUpdateTs)
+			continue
+		}
+		totals[taskId] += to.Sub(from)
+		counts[taskId]++
+		runs[execTs] = struct{}{}
+	}
+
+	durations := make(map[string]time.Duration, len(totals))
+	for taskId, total := range totals {
+		durations[taskId] = total / time.Duration(counts[taskId])
+	}
+	slog.Debug("Finished reading dag run task durations", "dagId", dagId,
+		"lastNRuns", lastNRuns, "runs", len(runs), "duration",
+		time.Since(start))
+	return durations, len(runs), nil
+}
+
+func (c *Client) readDagRunTaskDurationsQuery() string {
+	return `
+	WITH latestDagRuns AS (
+		SELECT
+			DagId,
+			ExecTs
+		FROM
+			dagruns
+		WHERE
+			DagId = ?
+		ORDER BY
+			RunId DESC
+		LIMIT
+			?
+	)
+	SELECT
+		drt.ExecTs,
+		drt.TaskId,
+		drt.InsertTs,
+		drt.StatusUpdateTs
+	FROM
+		dagruntasks drt
+	INNER JOIN
+		latestDagRuns ldr ON drt.DagId = ldr.DagId AND drt.ExecTs = ldr.ExecTs
+	WHERE
+		drt.Status = ?
+	`
+}
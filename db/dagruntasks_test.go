@@ -198,3 +198,211 @@ func insertDagRunTask(
 		t.Errorf("Error while inserting dag run: %s", iErr.Error())
 	}
 }
+
+func TestSetDagRunTaskRendered(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const dagId = "mock_dag"
+	const execTs = "2023-10-05T12:00:00UTC+00:00"
+	insertDagRunTask(c, ctx, dagId, execTs, "t1", t)
+	insertDagRunTask(c, ctx, dagId, execTs, "t2", t)
+	rendered := `{"partition":"dt=20231004"}`
+	sErr := c.SetDagRunTaskRendered(ctx, dagId, execTs, "t1", &rendered)
+	if sErr != nil {
+		t.Fatalf("Cannot set rendered templates: %s", sErr.Error())
+	}
+	sErr = c.SetDagRunTaskRendered(ctx, dagId, execTs, "t3", &rendered)
+	if sErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for missing task, got: %v", sErr)
+	}
+
+	drt, rErr := c.ReadDagRunTask(ctx, dagId, execTs, "t1")
+	if rErr != nil {
+		t.Fatalf("Cannot read dag run task: %s", rErr.Error())
+	}
+	if drt.Rendered == nil || *drt.Rendered != rendered {
+		t.Errorf("Expected rendered templates %s, got: %v", rendered,
+			drt.Rendered)
+	}
+	drts, rErr := c.ReadDagRunTasks(ctx, dagId, execTs)
+	if rErr != nil {
+		t.Fatalf("Cannot read dag run tasks: %s", rErr.Error())
+	}
+	for _, drt := range drts {
+		if drt.TaskId == "t2" && drt.Rendered != nil {
+			t.Errorf("Expected no rendered templates for t2, got: %s",
+				*drt.Rendered)
+		}
+	}
+}
+
+func TestSetDagRunTaskLease(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const dagId = "mock_dag"
+	const execTs = "2023-10-05T12:00:00UTC+00:00"
+	insertDagRunTask(c, ctx, dagId, execTs, "t1", t)
+	leaseId := "lease1"
+	sErr := c.SetDagRunTaskLease(ctx, dagId, execTs, "t1", &leaseId)
+	if sErr != nil {
+		t.Fatalf("Cannot set dag run task lease: %s", sErr.Error())
+	}
+	sErr = c.SetDagRunTaskLease(ctx, dagId, execTs, "t2", &leaseId)
+	if sErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for missing task, got: %v", sErr)
+	}
+	drts, rErr := c.ReadNotFinishedDagRunTasks(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read dag run tasks: %s", rErr.Error())
+	}
+	if len(drts) != 1 || drts[0].LeaseId == nil ||
+		*drts[0].LeaseId != leaseId {
+		t.Errorf("Expected t1 with lease %s, got: %+v", leaseId, drts)
+	}
+
+	sErr = c.SetDagRunTaskLease(ctx, dagId, execTs, "t1", nil)
+	if sErr != nil {
+		t.Fatalf("Cannot clear dag run task lease: %s", sErr.Error())
+	}
+	drt, rErr := c.ReadDagRunTask(ctx, dagId, execTs, "t1")
+	if rErr != nil {
+		t.Fatalf("Cannot read dag run task: %s", rErr.Error())
+	}
+	if drt.LeaseId != nil {
+		t.Errorf("Expected no lease, got: %s", *drt.LeaseId)
+	}
+}
+
+func TestReadDagRunTaskDurations(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	dagId := "mock_dag"
+	oldExecTs := timeutils.ToString(time.Now().Add(-time.Hour))
+	execTs := timeutils.ToString(time.Now())
+	insertDagRun(c, ctx, dagId, oldExecTs, t)
+	insertDagRun(c, ctx, dagId, execTs, t)
+
+	insertDagRunTask(c, ctx, dagId, oldExecTs, "old_task", t)
+	insertDagRunTask(c, ctx, dagId, execTs, "task_1", t)
+	insertDagRunTask(c, ctx, dagId, execTs, "task_2", t)
+	time.Sleep(5 * time.Millisecond)
+	for _, taskId := range []string{"old_task", "task_1"} {
+		ts := execTs
+		if taskId == "old_task" {
+			ts = oldExecTs
+		}
+		uErr := c.UpdateDagRunTaskStatus(ctx, dagId, ts, taskId,
+			DagRunTaskStatusSuccess)
+		if uErr != nil {
+			t.Errorf("Error while updating dag run task status: %s",
+				uErr.Error())
+		}
+	}
+	uErr := c.UpdateDagRunTaskStatus(ctx, dagId, execTs, "task_2", "FAILED")
+	if uErr != nil {
+		t.Errorf("Error while updating dag run task status: %s", uErr.Error())
+	}
+
+	durations, runs, dErr := c.ReadDagRunTaskDurations(ctx, dagId, 1)
+	if dErr != nil {
+		t.Fatalf("Error while reading dag run task durations: %s",
+			dErr.Error())
+	}
+	if runs != 1 {
+		t.Errorf("Expected durations based on 1 dag run, got: %d", runs)
+	}
+	if len(durations) != 1 {
+		t.Errorf("Expected duration only for task_1, got: %v", durations)
+	}
+	if durations["task_1"] < 5*time.Millisecond {
+		t.Errorf("Expected task_1 duration to be at least 5ms, got: %v",
+			durations["task_1"])
+	}
+
+	durations, runs, dErr = c.ReadDagRunTaskDurations(ctx, dagId, 10)
+	if dErr != nil {
+		t.Fatalf("Error while reading dag run task durations: %s",
+			dErr.Error())
+	}
+	if runs != 2 {
+		t.Errorf("Expected durations based on 2 dag runs, got: %d", runs)
+	}
+	if _, exists := durations["old_task"]; !exists {
+		t.Errorf("Expected old_task duration for all runs, got: %v",
+			durations)
+	}
+}
+
+func TestClearDagRunTasks(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	dagId := "mock_dag"
+	execTs := timeutils.ToString(time.Now())
+	if _, iErr := c.InsertDagRun(ctx, dagId, execTs); iErr != nil {
+		t.Fatal(iErr)
+	}
+	uErr := c.UpdateDagRunStatusByExecTs(ctx, dagId, execTs, "FAILED")
+	if uErr != nil {
+		t.Fatal(uErr)
+	}
+	for i := 0; i < 3; i++ {
+		insertDagRunTask(c, ctx, dagId, execTs, fmt.Sprintf("my_task_%d", i), t)
+	}
+
+	removed, cErr := c.ClearDagRunTasks(ctx, dagId, execTs,
+		[]string{"my_task_1", "my_task_2", "not_started"})
+	if cErr != nil {
+		t.Fatalf("Unexpected error while clearing dag run tasks: %s",
+			cErr.Error())
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 removed dag run tasks, got: %d", removed)
+	}
+	if cnt := c.Count("dagruntasks"); cnt != 1 {
+		t.Errorf("Expected 1 dag run task left, got: %d", cnt)
+	}
+	dagrun, rErr := c.ReadDagRun(ctx, dagId, execTs)
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if dagrun.Status != statusScheduled {
+		t.Errorf("Expected dag run status %s, got: %s", statusScheduled,
+			dagrun.Status)
+	}
+
+	_, cErr = c.ClearDagRunTasks(ctx, dagId, execTs, []string{"my_task_0"})
+	if cErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for not finished dag run, got: %v",
+			cErr)
+	}
+	if cnt := c.Count("dagruntasks"); cnt != 1 {
+		t.Errorf("Expected dag run task of not finished dag run to be kept")
+	}
+	_, cErr = c.ClearDagRunTasks(ctx, "other_dag", execTs, []string{"t"})
+	if cErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for not existing dag run, got: %v",
+			cErr)
+	}
+
+	uErr = c.UpdateDagRunStatusByExecTs(ctx, dagId, execTs, statusCancelled)
+	if uErr != nil {
+		t.Fatal(uErr)
+	}
+	removed, cErr = c.ClearDagRunTasks(ctx, dagId, execTs, []string{"my_task_0"})
+	if cErr != nil || removed != 1 {
+		t.Errorf("Expected cancelled dag run to be cleared, got: %d, %v",
+			removed, cErr)
+	}
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+const (
+	ExecutorStatusAlive = "ALIVE"
+	ExecutorStatusDead  = "DEAD"
+)
+
+// Executor represents single row in executors table in the database.
+type Executor struct {
+	ExecutorId      string
+	Hostname        string
+	Capacity        int
+	Status          string
+	RegisterTs      string
+	LastHeartbeatTs string
+}
+
+// RegisterExecutor inserts new executor or updates already existing one. In
+// both cases executor is marked as alive and its heartbeat timestamp is set
+// to the current time.
+func (c *Client) RegisterExecutor(
+	ctx context.Context, executorId, hostname string, capacity int,
+) error {
+	start := time.Now()
+	registerTs := timeutils.ToString(start)
+	slog.Debug("Start registering executor", "executorId", executorId,
+		"hostname", hostname, "capacity", capacity)
+	_, err := c.dbConn.ExecContext(ctx, c.registerExecutorQuery(), executorId,
+		hostname, capacity, ExecutorStatusAlive, registerTs, registerTs)
+	if err != nil {
+		slog.Error("Cannot register executor", "executorId", executorId,
+			"err", err)
+		return err
+	}
+	slog.Debug("Finished registering executor", "executorId", executorId,
+		"duration", time.Since(start))
+	return nil
+}
+
+// UpdateExecutorHeartbeat updates heartbeat timestamp of given alive
+// executor. If there is no such alive executor, then sql.ErrNoRows is
+// returned.
+func (c *Client) UpdateExecutorHeartbeat(
+	ctx context.Context, executorId string,
+) error {
+	start := time.Now()
+	heartbeatTs := timeutils.ToString(start)
+	slog.Debug("Start updating executor heartbeat", "executorId", executorId)
+	res, err := c.dbConn.ExecContext(ctx, c.updateExecutorHeartbeatQuery(),
+		heartbeatTs, executorId, ExecutorStatusAlive)
+	if err != nil {
+		slog.Error("Cannot update executor heartbeat", "executorId",
+			executorId, "err", err)
+		return err
+	}
+	rowsUpdated, _ := res.RowsAffected()
+	if rowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Debug("Finished updating executor heartbeat", "executorId",
+		executorId, "duration", time.Since(start))
+	return nil
+}
+
+// UpdateExecutorStatus updates status of given executor.
+func (c *Client) UpdateExecutorStatus(
+	ctx context.Context, executorId, status string,
+) error {
+	start := time.Now()
+	slog.Debug("Start updating executor status", "executorId", executorId,
+		"status", status)
+	res, err := c.dbConn.ExecContext(ctx, c.updateExecutorStatusQuery(),
+		status, executorId)
+	if err != nil {
+		slog.Error("Cannot update executor status", "executorId", executorId,
+			"status", status, "err", err)
+		return err
+	}
+	rowsUpdated, _ := res.RowsAffected()
+	if rowsUpdated == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Debug("Finished updating executor status", "executorId", executorId,
+		"status", status, "duration", time.Since(start))
+	return nil
+}
+
+// ReadExecutors reads executors of given status. When status is empty, all
+// executors are returned.
+func (c *Client) ReadExecutors(
+	ctx context.Context, status string,
+) ([]Executor, error) {
+	start := time.Now()
+	slog.Debug("Start reading executors", "status", status)
+	executors := make([]Executor, 0)
+
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readExecutorsQuery(), status,
+		status)
+	if qErr != nil {
+		slog.Error("Failed querying executors", "status", status, "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Executor
+		scanErr := rows.Scan(&e.ExecutorId, &e.Hostname, &e.Capacity,
+			&e.Status, &e.RegisterTs, &e.LastHeartbeatTs)
+		if scanErr != nil {
+			slog.Error("Failed scanning executor", "err", scanErr)
+			return nil, scanErr
+		}
+		executors = append(executors, e)
+	}
+	slog.Debug("Finished reading executors", "status", status, "duration",
+		time.Since(start))
+	return executors, nil
+}
+
+func (c *Client) registerExecutorQuery() string {
+	return `
+		INSERT INTO executors (
+			ExecutorId, Hostname, Capacity, Status, RegisterTs, LastHeartbeatTs
+		)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (ExecutorId) DO UPDATE SET
+			Hostname = excluded.Hostname,
+			Capacity = excluded.Capacity,
+			Status = excluded.Status,
+			RegisterTs = excluded.RegisterTs,
+			LastHeartbeatTs = excluded.LastHeartbeatTs
+	`
+}
+
+func (c *Client) updateExecutorHeartbeatQuery() string {
+	return `
+		UPDATE
+			executors
+		SET
+			LastHeartbeatTs = ?
+		WHERE
+				ExecutorId = ?
+			AND Status = ?
+	`
+}
+
+func (c *Client) updateExecutorStatusQuery() string {
+	return `
+		UPDATE
+			executors
+		SET
+			Status = ?
+		WHERE
+			ExecutorId = ?
+	`
+}
+
+func (c *Client) readExecutorsQuery() string {
+	return `
+		SELECT
+			ExecutorId,
+			Hostname,
+			Capacity,
+			Status,
+			RegisterTs,
+			LastHeartbeatTs
+		FROM
+			executors
+		WHERE
+			? = '' OR Status = ?
+		ORDER BY
+			ExecutorId
+	`
+}
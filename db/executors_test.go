@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestRegisterExecutorAndHeartbeat(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hErr := c.UpdateExecutorHeartbeat(ctx, "exec1")
+	if hErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for not registered executor, got: %v",
+			hErr)
+	}
+	if rErr := c.RegisterExecutor(ctx, "exec1", "host1", 4); rErr != nil {
+		t.Fatalf("Cannot register executor: %s", rErr.Error())
+	}
+	if hErr := c.UpdateExecutorHeartbeat(ctx, "exec1"); hErr != nil {
+		t.Errorf("Cannot update executor heartbeat: %s", hErr.Error())
+	}
+
+	executors, rErr := c.ReadExecutors(ctx, ExecutorStatusAlive)
+	if rErr != nil {
+		t.Fatalf("Cannot read executors: %s", rErr.Error())
+	}
+	if len(executors) != 1 {
+		t.Fatalf("Expected 1 alive executor, got %d", len(executors))
+	}
+	if executors[0].Hostname != "host1" || executors[0].Capacity != 4 {
+		t.Errorf("Unexpected executor: %+v", executors[0])
+	}
+
+	uErr := c.UpdateExecutorStatus(ctx, "exec1", ExecutorStatusDead)
+	if uErr != nil {
+		t.Fatalf("Cannot update executor status: %s", uErr.Error())
+	}
+	hErr = c.UpdateExecutorHeartbeat(ctx, "exec1")
+	if hErr != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for dead executor heartbeat, got: %v",
+			hErr)
+	}
+
+	// Registering again makes executor alive
+	if rErr := c.RegisterExecutor(ctx, "exec1", "host2", 8); rErr != nil {
+		t.Fatalf("Cannot register executor again: %s", rErr.Error())
+	}
+	executors, rErr = c.ReadExecutors(ctx, "")
+	if rErr != nil {
+		t.Fatalf("Cannot read executors: %s", rErr.Error())
+	}
+	if len(executors) != 1 || executors[0].Status != ExecutorStatusAlive ||
+		executors[0].Hostname != "host2" {
+		t.Errorf("Expected single alive executor on host2, got: %+v", executors)
+	}
+}
+
+func TestReadExecutorDagRunTasks(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const dagId = "mock_dag"
+	const execTs = "2023-10-05T12:00:00UTC+00:00"
+	for _, taskId := range []string{"t1", "t2", "t3"} {
+		insertDagRunTask(c, ctx, dagId, execTs, taskId, t)
+	}
+	executorId := "exec1"
+	for _, taskId := range []string{"t1", "t2"} {
+		sErr := c.SetDagRunTaskExecutor(ctx, dagId, execTs, taskId, &executorId)
+		if sErr != nil {
+			t.Fatalf("Cannot set executor for %s: %s", taskId, sErr.Error())
+		}
+	}
+	uErr := c.UpdateDagRunTaskStatus(ctx, dagId, execTs, "t2",
+		DagRunTaskStatusSuccess)
+	if uErr != nil {
+		t.Fatalf("Cannot update task status: %s", uErr.Error())
+	}
+
+	drts, rErr := c.ReadExecutorDagRunTasks(ctx, executorId)
+	if rErr != nil {
+		t.Fatalf("Cannot read executor dag run tasks: %s", rErr.Error())
+	}
+	if len(drts) != 1 || drts[0].TaskId != "t1" {
+		t.Errorf("Expected only unfinished t1 task, got: %+v", drts)
+	}
+	if drts[0].ExecutorId == nil || *drts[0].ExecutorId != executorId {
+		t.Errorf("Expected executor %s, got: %v", executorId,
+			drts[0].ExecutorId)
+	}
+
+	sErr := c.SetDagRunTaskExecutor(ctx, dagId, execTs, "t1", nil)
+	if sErr != nil {
+		t.Fatalf("Cannot clear task executor: %s", sErr.Error())
+	}
+	drts, rErr = c.ReadExecutorDagRunTasks(ctx, executorId)
+	if rErr != nil {
+		t.Fatalf("Cannot read executor dag run tasks: %s", rErr.Error())
+	}
+	if len(drts) != 0 {
+		t.Errorf("Expected no tasks owned by executor, got: %+v", drts)
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// Pool represents single row in pools table in the database.
+type Pool struct {
+	Name           string
+	Slots          int
+	CreateTs       string
+	LatestUpdateTs *string
+}
+
+// UpsertPool inserts new pool with given number of slots or updates number of
+// slots, if the pool already exists.
+func (c *Client) UpsertPool(ctx context.Context, name string, slots int) error {
+	start := time.Now()
+	insertTs := timeutils.ToString(time.Now())
+	slog.Debug("Start upserting pool", "name", name, "slots", slots)
+	_, err := c.dbConn.ExecContext(ctx, c.upsertPoolQuery(), name, slots,
+		insertTs, insertTs)
+	if err != nil {
+		slog.Error("Cannot upsert pool", "name", name, "slots", slots, "err",
+			err)
+		return err
+	}
+	slog.Debug("Finished upserting pool", "name", name, "slots", slots,
+		"duration", time.Since(start))
+	return nil
+}
+
+// ReadPools reads all pools ordered by name.
+func (c *Client) ReadPools(ctx context.Context) ([]Pool, error) {
+	start := time.Now()
+	slog.Debug("Start reading pools")
+	pools := make([]Pool, 0)
+
+	rows, qErr := c.dbConn.QueryContext(ctx, c.readPoolsQuery())
+	if qErr != nil {
+		slog.Error("Failed querying pools", "err", qErr)
+		return nil, qErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pool Pool
+		scanErr := rows.Scan(&pool.Name, &pool.Slots, &pool.CreateTs,
+			&pool.LatestUpdateTs)
+		if scanErr != nil {
+			slog.Error("Failed scanning pool", "err", scanErr)
+			return nil, scanErr
+		}
+		pools = append(pools, pool)
+	}
+	slog.Debug("Finished reading pools", "duration", time.Since(start))
+	return pools, nil
+}
+
+// DeletePool deletes pool of given name. Deleting not existing pool is a
+// no-op.
+func (c *Client) DeletePool(ctx context.Context, name string) error {
+	start := time.Now()
+	slog.Debug("Start deleting pool", "name", name)
+	_, err := c.dbConn.ExecContext(ctx, c.deletePoolQuery(), name)
+	if err != nil {
+		slog.Error("Cannot delete pool", "name", name, "err", err)
+		return err
+	}
+	slog.Debug("Finished deleting pool", "name", name, "duration",
+		time.Since(start))
+	return nil
+}
+
+func (c *Client) upsertPoolQuery() string {
+	return `
+		INSERT INTO pools (Name, Slots, CreateTs, LatestUpdateTs)
+		VALUES (?, ?, ?, NULL)
+		ON CONFLICT (Name) DO UPDATE SET
+			Slots = excluded.Slots,
+			LatestUpdateTs = ?
+		WHERE
+			pools.Slots <> excluded.Slots
+	`
+}
+
+func (c *Client) readPoolsQuery() string {
+	return `
+		SELECT
+			Name,
+			Slots,
+			CreateTs,
+			LatestUpdateTs
+		FROM
+			pools
+		ORDER BY
+			Name
+	`
+}
+
+func (c *Client) deletePoolQuery() string {
+	return `
+		DELETE FROM
+			pools
+		WHERE
+			Name = ?
+	`
+}
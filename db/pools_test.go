@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpsertPoolsAndRead(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	pools, rErr := c.ReadPools(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read pools: %s", rErr.Error())
+	}
+	if len(pools) != 0 {
+		t.Errorf("Expected no pools in empty database, got: %v", pools)
+	}
+
+	for name, slots := range map[string]int{"vendor_api": 2, "dwh": 5} {
+		if uErr := c.UpsertPool(ctx, name, slots); uErr != nil {
+			t.Fatalf("Cannot insert pool %s: %s", name, uErr.Error())
+		}
+	}
+	pools, rErr = c.ReadPools(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read pools: %s", rErr.Error())
+	}
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %d", len(pools))
+	}
+	if pools[0].Name != "dwh" || pools[0].Slots != 5 {
+		t.Errorf("Expected pool dwh with 5 slots, got: %+v", pools[0])
+	}
+	if pools[1].LatestUpdateTs != nil {
+		t.Errorf("Expected NULL LatestUpdateTs for new pool, got: %s",
+			*pools[1].LatestUpdateTs)
+	}
+
+	// The same number of slots should not update the row
+	if uErr := c.UpsertPool(ctx, "dwh", 5); uErr != nil {
+		t.Fatalf("Cannot upsert pool: %s", uErr.Error())
+	}
+	if uErr := c.UpsertPool(ctx, "vendor_api", 3); uErr != nil {
+		t.Fatalf("Cannot upsert pool: %s", uErr.Error())
+	}
+	pools, rErr = c.ReadPools(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read pools: %s", rErr.Error())
+	}
+	if pools[0].LatestUpdateTs != nil {
+		t.Errorf("Expected pool dwh not to be updated, got: %+v", pools[0])
+	}
+	if pools[1].Slots != 3 || pools[1].LatestUpdateTs == nil {
+		t.Errorf("Expected vendor_api to be updated to 3 slots, got: %+v",
+			pools[1])
+	}
+}
+
+func TestDeletePool(t *testing.T) {
+	c, err := NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"vendor_api", "dwh"} {
+		if uErr := c.UpsertPool(ctx, name, 1); uErr != nil {
+			t.Fatalf("Cannot insert pool %s: %s", name, uErr.Error())
+		}
+	}
+	if dErr := c.DeletePool(ctx, "dwh"); dErr != nil {
+		t.Fatalf("Cannot delete pool: %s", dErr.Error())
+	}
+	if dErr := c.DeletePool(ctx, "not_existing"); dErr != nil {
+		t.Errorf("Expected deleting not existing pool to be no-op, got: %s",
+			dErr.Error())
+	}
+	pools, rErr := c.ReadPools(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read pools: %s", rErr.Error())
+	}
+	if len(pools) != 1 || pools[0].Name != "vendor_api" {
+		t.Errorf("Expected only vendor_api pool, got: %v", pools)
+	}
+}
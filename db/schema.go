@@ -16,6 +16,9 @@ func SchemaStatements(dbDriver string) ([]string, error) {
 			sqliteCreateDagtasksTable(),
 			sqliteCreateDagrunsTable(),
 			sqliteCreateDagruntasksTable(),
+			sqliteCreatePoolsTable(),
+			sqliteCreateExecutorsTable(),
+			sqliteCreateAuditlogTable(),
 		}, nil
 	}
 
@@ -23,6 +26,34 @@ func SchemaStatements(dbDriver string) ([]string, error) {
 		dbDriver)
 }
 
+// AddedColumn is a column which was added to already existing table. New
+// databases get such columns from SchemaStatements, but databases created
+// before the change have to be migrated.
+type AddedColumn struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// SchemaAddedColumns returns a list of columns which were added to tables
+// after their initial version, for given database driver. Missing columns are
+// added to existing databases on connecting (see NewSqliteClient). If given
+// database driver is not supported, then non-nil error is returned.
+func SchemaAddedColumns(dbDriver string) ([]AddedColumn, error) {
+	if dbDriver == "sqlite" || dbDriver == "sqlite3" {
+		return []AddedColumn{
+			{"dags", "IsPaused", "INT NOT NULL DEFAULT 0"},
+			{"dagruntasks", "ExecutorId", "TEXT NULL"},
+			{"dagruntasks", "LeaseId", "TEXT NULL"},
+			{"dagruns", "Params", "TEXT NULL"},
+			{"dagruntasks", "Rendered", "TEXT NULL"},
+		}, nil
+	}
+
+	return []AddedColumn{}, fmt.Errorf("there is no schema for %s driver "+
+		"defined", dbDriver)
+}
+
 func sqliteCreateDagsTable() string {
 	return `
 -- Table dags stores DAGs and its metadata. Information about DAG tasks are
@@ -38,6 +69,7 @@ CREATE TABLE IF NOT EXISTS dags (
     HashDagMeta TEXT NOT NULL,      -- SHA256 hash of DAG attributes + StartTs + Schedule
     HashTasks TEXT NOT NULL,        -- SHA256 hash of DAG tasks
     Attributes TEXT NOT NULL,       -- DAG attributes like tags
+    IsPaused INT NOT NULL DEFAULT 0,-- Flag if DAG is paused (new DAG runs are not scheduled)
     -- TODO: probably many more, but sometime later
 
     PRIMARY KEY (DagId)
@@ -76,7 +108,8 @@ CREATE TABLE IF NOT EXISTS dagruns (
     InsertTs TEXT NOT NULL,         -- Row insertion timestamp
     Status TEXT NOT NULL,           -- DAG run status
     StatusUpdateTs TEXT NOT NULL,   -- Status update timestamp (on first insert it's the same as InsertTs)
-    Version TEXT NOT NULL           -- Scheduler Version
+    Version TEXT NOT NULL,          -- Scheduler Version
+    Params TEXT NULL                -- DAG run parameters as JSON object
 );
 `
 }
@@ -92,8 +125,58 @@ CREATE TABLE IF NOT EXISTS dagruntasks (
     Status TEXT NOT NULL,           -- DAG task execution status
     StatusUpdateTs TEXT NOT NULL,   -- Status update timestamp (on first insert it's the same as InsertTs)
     Version TEXT NOT NULL,          -- Scheduler version
+    ExecutorId TEXT NULL,           -- ID of executor which owns (executes) the task
+    Rendered TEXT NULL,             -- Rendered task templates as JSON object
+    LeaseId TEXT NULL,              -- Current lease of the task handed out to an executor
 
     PRIMARY KEY (DagId, ExecTs, TaskId)
 );
 `
 }
+
+func sqliteCreatePoolsTable() string {
+	return `
+-- Table pools stores named pools of slots. Tasks can be assigned to a pool,
+-- to limit number of concurrently running tasks which use the same resource.
+CREATE TABLE IF NOT EXISTS pools (
+    Name TEXT NOT NULL,             -- Pool name
+    Slots INT NOT NULL,             -- Number of slots in the pool
+    CreateTs TEXT NOT NULL,         -- Timestamp when pool was initially inserted
+    LatestUpdateTs TEXT NULL,       -- Timestamp of the pool latest update
+
+    PRIMARY KEY (Name)
+);
+`
+}
+
+func sqliteCreateExecutorsTable() string {
+	return `
+-- Table executors stores registered executors and their latest heartbeats.
+CREATE TABLE IF NOT EXISTS executors (
+    ExecutorId TEXT NOT NULL,       -- Executor ID
+    Hostname TEXT NOT NULL,         -- Hostname of the executor
+    Capacity INT NOT NULL,          -- Maximum number of concurrently executed tasks
+    Status TEXT NOT NULL,           -- Executor status (ALIVE or DEAD)
+    RegisterTs TEXT NOT NULL,       -- Timestamp of the latest registration
+    LastHeartbeatTs TEXT NOT NULL,  -- Timestamp of the latest heartbeat
+
+    PRIMARY KEY (ExecutorId)
+);
+`
+}
+
+func sqliteCreateAuditlogTable() string {
+	return `
+-- Table auditlog stores operator actions (e.g. pausing a DAG) - who did what
+-- and when, including actions which were denied.
+CREATE TABLE IF NOT EXISTS auditlog (
+    Id INTEGER PRIMARY KEY,         -- Auto-incremented entry ID
+    InsertTs TEXT NOT NULL,         -- Timestamp of the action
+    Principal TEXT NOT NULL,        -- Name of authenticated caller
+    Action TEXT NOT NULL,           -- Action name, like dag.pause
+    DagId TEXT NULL,                -- DAG ID, if the action concerns a DAG
+    Details TEXT NULL,              -- Additional details, like request parameters
+    Allowed INT NOT NULL            -- Flag if the action was allowed by the policy
+);
+`
+}
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"os"
 	"testing"
 )
 
@@ -22,3 +25,164 @@ func TestSqliteSchema(t *testing.T) {
 		}
 	}
 }
+
+// Schema of the initial version of the scheduler, before any columns were
+// added to existing tables.
+var legacySqliteSchema = []string{
+	`CREATE TABLE dags (
+		DagId TEXT NOT NULL,
+		StartTs TEXT NULL,
+		Schedule TEXT NULL,
+		CreateTs TEXT NOT NULL,
+		LatestUpdateTs TEXT NULL,
+		CreateVersion TEXT NOT NULL,
+		LatestUpdateVersion TEXT NULL,
+		HashDagMeta TEXT NOT NULL,
+		HashTasks TEXT NOT NULL,
+		Attributes TEXT NOT NULL,
+		PRIMARY KEY (DagId)
+	)`,
+	`CREATE TABLE dagruns (
+		RunId INTEGER PRIMARY KEY,
+		DagId TEXT NOT NULL,
+		ExecTs TEXT NOT NULL,
+		InsertTs TEXT NOT NULL,
+		Status TEXT NOT NULL,
+		StatusUpdateTs TEXT NOT NULL,
+		Version TEXT NOT NULL
+	)`,
+	`CREATE TABLE dagruntasks (
+		DagId TEXT NOT NULL,
+		ExecTs TEXT NOT NULL,
+		TaskId TEXT NOT NULL,
+		InsertTs TEXT NOT NULL,
+		Status TEXT NOT NULL,
+		StatusUpdateTs TEXT NOT NULL,
+		Version TEXT NOT NULL,
+		PRIMARY KEY (DagId, ExecTs, TaskId)
+	)`,
+	`INSERT INTO dags VALUES ('legacy_dag', NULL, NULL, '', NULL, '', NULL,
+		'', '', '{}')`,
+	`INSERT INTO dagruns VALUES (1, 'legacy_dag', '` + legacyExecTs + `', '',
+		'RUNNING', '', '')`,
+	`INSERT INTO dagruntasks VALUES ('legacy_dag', '` + legacyExecTs + `',
+		'task', '', 'SCHEDULED', '', '')`,
+}
+
+const legacyExecTs = "2023-10-01T00:00:00UTC+00:00"
+
+func TestSqliteSchemaMigration(t *testing.T) {
+	tmpFile, tErr := os.CreateTemp("", "sqlite-legacy-")
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	dbPath := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(dbPath)
+
+	legacyDb, err := sql.Open("sqlite", sqliteConnString(dbPath))
+	if err != nil {
+		t.Fatalf("Cannot open legacy database: %s", err.Error())
+	}
+	for _, stmt := range legacySqliteSchema {
+		if _, err := legacyDb.Exec(stmt); err != nil {
+			t.Fatalf("Error while executing [%s] query: %s", stmt, err.Error())
+		}
+	}
+	legacyDb.Close()
+
+	// Migration is expected to be idempotent
+	for i := 0; i < 2; i++ {
+		c, cErr := NewSqliteClient(dbPath)
+		if cErr != nil {
+			t.Fatalf("Cannot migrate legacy database: %s", cErr.Error())
+		}
+		checkMigratedSchema(t, c)
+		c.dbConn.Close()
+	}
+}
+
+func checkMigratedSchema(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+	if pErr := c.SetDagPaused(ctx, "legacy_dag", true); pErr != nil {
+		t.Errorf("Cannot pause DAG in migrated database: %s", pErr.Error())
+	}
+	paused, rErr := c.ReadPausedDagIds(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read paused DAGs: %s", rErr.Error())
+	}
+	if _, isPaused := paused["legacy_dag"]; !isPaused {
+		t.Errorf("Expected legacy_dag to be paused, got: %v", paused)
+	}
+	executorId := "executor_1"
+	eErr := c.SetDagRunTaskExecutor(ctx, "legacy_dag", legacyExecTs, "task",
+		&executorId)
+	if eErr != nil {
+		t.Errorf("Cannot set dag run task executor in migrated database: %s",
+			eErr.Error())
+	}
+	dr, dErr := c.ReadDagRun(ctx, "legacy_dag", legacyExecTs)
+	if dErr != nil {
+		t.Errorf("Cannot read dag run in migrated database: %s", dErr.Error())
+	} else if dr.Params != nil {
+		t.Errorf("Expected no params of legacy dag run, got: %s", *dr.Params)
+	}
+	// Checks run twice on the same database, so the DAG run might exist
+	params := `{"customerId":"c42"}`
+	execTs := "2023-10-02T00:00:00UTC+00:00"
+	_, iErr := c.InsertNewDagRun(ctx, "legacy_dag", execTs, &params)
+	if iErr != nil && !errors.Is(iErr, ErrDagRunExists) {
+		t.Errorf("Cannot insert dag run with params in migrated database: %s",
+			iErr.Error())
+	}
+	dr, dErr = c.ReadDagRun(ctx, "legacy_dag", execTs)
+	if dErr != nil {
+		t.Errorf("Cannot read dag run in migrated database: %s", dErr.Error())
+	} else if dr.Params == nil || *dr.Params != params {
+		t.Errorf("Expected params %s, got: %v", params, dr.Params)
+	}
+	_, tsErr := c.ReadDagRunTasks(ctx, "legacy_dag", legacyExecTs)
+	if tsErr != nil {
+		t.Errorf("Cannot read dag run tasks in migrated database: %s",
+			tsErr.Error())
+	}
+	rendered := `{"partition":"dt=20231001"}`
+	sErr := c.SetDagRunTaskRendered(ctx, "legacy_dag", legacyExecTs, "task",
+		&rendered)
+	if sErr != nil {
+		t.Errorf("Cannot set rendered templates in migrated database: %s",
+			sErr.Error())
+	}
+	drt, tErr := c.ReadDagRunTask(ctx, "legacy_dag", legacyExecTs, "task")
+	if tErr != nil {
+		t.Errorf("Cannot read dag run task in migrated database: %s",
+			tErr.Error())
+	} else if drt.Rendered == nil || *drt.Rendered != rendered {
+		t.Errorf("Expected rendered templates %s, got: %v", rendered,
+			drt.Rendered)
+	}
+}
+
+func TestSqliteSchemaContainsAddedColumns(t *testing.T) {
+	c, err := NewSqliteTmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CleanUpSqliteTmp(c, t)
+	columns, cErr := SchemaAddedColumns("sqlite")
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	db := c.dbConn.(*SqliteDB).dbConn
+	for _, col := range columns {
+		exists, eErr := sqliteColumnExists(db, col.Table, col.Name)
+		if eErr != nil {
+			t.Fatalf("Cannot check column %s.%s: %s", col.Table, col.Name,
+				eErr.Error())
+		}
+		if !exists {
+			t.Errorf("Column %s.%s is not in the schema", col.Table, col.Name)
+		}
+	}
+}
@@ -16,7 +16,8 @@ import (
 
 // Produces new Client based on given connection string to SQLite database. If
 // database file does not exist in given location, then empty SQLite database
-// with setup schema will be created.
+// with setup schema will be created. Schema of existing database is migrated
+// to the current version.
 func NewSqliteClient(dbFilePath string) (*Client, error) {
 	dbFilePathAbs, absErr := filepath.Abs(dbFilePath)
 	if absErr != nil {
@@ -38,13 +39,16 @@ func NewSqliteClient(dbFilePath string) (*Client, error) {
 		return nil, fmt.Errorf("cannot connect to SQLite DB (%s): %w",
 			connString, dbErr)
 	}
+	var schemaErr error
 	if newDbCreated {
-		schemaErr := setupSqliteSchema(db)
-		if schemaErr != nil {
-			db.Close()
-			return nil, fmt.Errorf("cannot setup SQLite schema for %s: %w",
-				connString, schemaErr)
-		}
+		schemaErr = setupSqliteSchema(db)
+	} else {
+		schemaErr = migrateSqliteSchema(db)
+	}
+	if schemaErr != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot setup SQLite schema for %s: %w",
+			connString, schemaErr)
 	}
 	sqliteDB := SqliteDB{dbConn: db, dbFilePath: dbFilePathAbs}
 	return &Client{&sqliteDB}, nil
@@ -108,6 +112,50 @@ func setupSqliteSchema(db *sql.DB) error {
 	return nil
 }
 
+// Migrates schema of existing SQLite database to the current version. Tables
+// which don't exist yet are created and columns added to existing tables
+// (SchemaAddedColumns) are added, when they are missing. Migration is
+// idempotent.
+func migrateSqliteSchema(db *sql.DB) error {
+	if err := setupSqliteSchema(db); err != nil {
+		return err
+	}
+	columns, err := SchemaAddedColumns("sqlite")
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		exists, cErr := sqliteColumnExists(db, col.Table, col.Name)
+		if cErr != nil {
+			return fmt.Errorf("cannot check if column %s.%s exists: %w",
+				col.Table, col.Name, cErr)
+		}
+		if exists {
+			continue
+		}
+		slog.Info("Adding missing column", "table", col.Table, "column",
+			col.Name)
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.Table,
+			col.Name, col.Definition)
+		if _, aErr := db.Exec(query); aErr != nil {
+			return fmt.Errorf("cannot add column %s.%s: %w", col.Table,
+				col.Name, aErr)
+		}
+	}
+	return nil
+}
+
+func sqliteColumnExists(db *sql.DB, table, column string) (bool, error) {
+	const query = `
+	SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ? COLLATE NOCASE
+	`
+	var count int
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func createSqliteDbIfNotExist(dbFilePath string) (bool, error) {
 	if _, err := os.Stat(dbFilePath); os.IsNotExist(err) {
 		dirErr := os.MkdirAll(filepath.Dir(dbFilePath), os.ModePerm)
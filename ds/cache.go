@@ -37,10 +37,11 @@ type lruCacheItem[K comparable, V any] struct {
 }
 
 // Get gets value from the cache for given key. If given key does not exist,
-// then the second return value is false.
+// then the second return value is false. Get moves the item to the front of
+// the LRU queue, so it needs the write lock.
 func (lc *LruCache[K, V]) Get(key K) (V, bool) {
-	lc.lock.RLock()
-	defer lc.lock.RUnlock()
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
 	if element, found := lc.items[key]; found {
 		lc.queue.MoveToFront(element)
 		return element.Value.(*lruCacheItem[K, V]).value, true
@@ -158,6 +158,25 @@ func TestLruCacheConcurrency(t *testing.T) {
 	}
 }
 
+func TestLruCacheConcurrentGets(t *testing.T) {
+	c := NewLruCache[int, int](10)
+	for i := 0; i < 10; i++ {
+		c.Put(i, i)
+	}
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for g := 0; g < 5; g++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				c.Get(i % 10)
+			}
+		}()
+	}
+	wg.Wait()
+	testCacheLen[int, int](c, 10, t)
+}
+
 func putManyIntoCache(c Cache[int, int], start, end, value int, wg *sync.WaitGroup) {
 	for i := start; i < end; i++ {
 		c.Put(i, value)
@@ -0,0 +1,177 @@
+package ds
+
+import (
+	"sort"
+	"sync"
+)
+
+// KeyedQueue is a set of queues, one for each key. Objects are put onto the
+// queue determined by given key function. Sub-queues are created on demand
+// using given factory function. Maximum size applies to all sub-queues
+// together. Pop returns objects of any key, to get objects only of given keys
+// use PopFrom. When sub-queues implement PrioritizedQueue, objects of the
+// highest priority among heads of sub-queues are popped first. KeyedQueue
+// implements Queue, NotifyingQueue and RemovableQueue interfaces and it's safe
+// for concurrent use, as long as sub-queues are.
+type KeyedQueue[T comparable] struct {
+	maxSize  int
+	key      func(T) string
+	newQueue func() Queue[T]
+	sync.Mutex
+	queues  map[string]Queue[T]
+	size    int
+	changed chan struct{}
+}
+
+// NewKeyedQueue creates new KeyedQueue of given maximum size (for all keys
+// together).
+func NewKeyedQueue[T comparable](
+	queueMaxSize int, key func(T) string, newQueue func() Queue[T],
+) KeyedQueue[T] {
+	return KeyedQueue[T]{
+		maxSize:  queueMaxSize,
+		key:      key,
+		newQueue: newQueue,
+		queues:   make(map[string]Queue[T]),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Put puts given object onto the queue of its key. Returns ErrQueueIsFull is
+// the queue is full and object cannot be put there.
+func (kq *KeyedQueue[T]) Put(obj T) error {
+	key := kq.key(obj)
+	kq.Lock()
+	defer kq.Unlock()
+	if kq.size >= kq.maxSize {
+		return ErrQueueIsFull
+	}
+	q, exists := kq.queues[key]
+	if !exists {
+		q = kq.newQueue()
+		kq.queues[key] = q
+	}
+	if err := q.Put(obj); err != nil {
+		return err
+	}
+	kq.size++
+	close(kq.changed)
+	kq.changed = make(chan struct{})
+	return nil
+}
+
+// Changed returns a channel which is closed when the next object is put onto
+// any of the queues.
+func (kq *KeyedQueue[T]) Changed() <-chan struct{} {
+	kq.Lock()
+	defer kq.Unlock()
+	return kq.changed
+}
+
+// Pop pops object from any non-empty queue, as PopFrom called with all keys
+// in sorted order. If all queues are empty, then ErrQueueIsEmpty is returned.
+func (kq *KeyedQueue[T]) Pop() (T, error) {
+	kq.Lock()
+	defer kq.Unlock()
+	return kq.popFrom(kq.keys())
+}
+
+// PopFrom pops object of the highest priority among heads of queues of given
+// keys. Objects in queues which don't implement PrioritizedQueue have zero
+// priority. In case of equal priorities, the first of given keys wins, so for
+// queues which are not prioritized object is popped from the first non-empty
+// queue of given keys. If all of those queues are empty, then ErrQueueIsEmpty
+// is returned.
+func (kq *KeyedQueue[T]) PopFrom(keys ...string) (T, error) {
+	kq.Lock()
+	defer kq.Unlock()
+	return kq.popFrom(keys)
+}
+
+func (kq *KeyedQueue[T]) popFrom(keys []string) (T, error) {
+	var best Queue[T]
+	bestPriority := 0
+	for _, key := range keys {
+		q, exists := kq.queues[key]
+		if !exists || q.Size() == 0 {
+			continue
+		}
+		priority := 0
+		if pq, ok := q.(PrioritizedQueue[T]); ok {
+			p, err := pq.PeekPriority()
+			if err != nil {
+				continue
+			}
+			priority = p
+		}
+		if best == nil || priority > bestPriority {
+			best, bestPriority = q, priority
+		}
+	}
+	if best == nil {
+		var t T
+		return t, ErrQueueIsEmpty
+	}
+	obj, err := best.Pop()
+	if err != nil {
+		var t T
+		return t, err
+	}
+	kq.size--
+	return obj, nil
+}
+
+// Keys returns sorted keys of non-empty queues.
+func (kq *KeyedQueue[T]) Keys() []string {
+	kq.Lock()
+	defer kq.Unlock()
+	return kq.keys()
+}
+
+func (kq *KeyedQueue[T]) keys() []string {
+	keys := make([]string, 0, len(kq.queues))
+	for key, q := range kq.queues {
+		if q.Size() > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Contains verifies whenever queue of given element key contains it.
+func (kq *KeyedQueue[T]) Contains(elem T) bool {
+	key := kq.key(elem)
+	kq.Lock()
+	defer kq.Unlock()
+	q, exists := kq.queues[key]
+	return exists && q.Contains(elem)
+}
+
+// RemoveWhere removes all objects for which given predicate is true, from all
+// sub-queues which implement RemovableQueue. Returns number of removed
+// objects.
+func (kq *KeyedQueue[T]) RemoveWhere(pred func(T) bool) int {
+	kq.Lock()
+	defer kq.Unlock()
+	removed := 0
+	for _, q := range kq.queues {
+		if rq, ok := q.(RemovableQueue[T]); ok {
+			removed += rq.RemoveWhere(pred)
+		}
+	}
+	kq.size -= removed
+	return removed
+}
+
+func (kq *KeyedQueue[T]) Capacity() int {
+	kq.Lock()
+	defer kq.Unlock()
+	return kq.maxSize - kq.size
+}
+
+func (kq *KeyedQueue[T]) Size() int {
+	kq.Lock()
+	defer kq.Unlock()
+	return kq.size
+}
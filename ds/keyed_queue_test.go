@@ -0,0 +1,156 @@
+package ds
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestKeyedQueue(size int) KeyedQueue[string] {
+	// Key is a prefix before colon, e.g. gpu:task1 has key gpu.
+	key := func(s string) string {
+		prefix, _, found := strings.Cut(s, ":")
+		if !found {
+			return ""
+		}
+		return prefix
+	}
+	return NewKeyedQueue[string](size, key, func() Queue[string] {
+		q := NewSimpleQueue[string](size)
+		return &q
+	})
+}
+
+func TestKeyedQueueRouting(t *testing.T) {
+	const size = 10
+	q := newTestKeyedQueue(size)
+	for _, item := range []string{"t1", "gpu:t2", "db:t3", "gpu:t4", "t5"} {
+		testPutErr(q.Put(item), t)
+	}
+	testQueueSize[string](&q, 5, t)
+	testQueueCapacity[string](&q, size-5, t)
+
+	keys := q.Keys()
+	if strings.Join(keys, ",") != ",db,gpu" {
+		t.Errorf("Expected keys [ db gpu], got: %v", keys)
+	}
+
+	item, err := q.Pop()
+	testPop(item, err, "t1", t)
+	item, err = q.PopFrom("gpu", "")
+	testPop(item, err, "gpu:t2", t)
+	item, err = q.PopFrom("gpu", "")
+	testPop(item, err, "gpu:t4", t)
+	item, err = q.PopFrom("gpu", "")
+	testPop(item, err, "t5", t)
+	if _, err := q.PopFrom("gpu", ""); err != ErrQueueIsEmpty {
+		t.Errorf("Expected ErrQueueIsEmpty, got: %v", err)
+	}
+	if !q.Contains("db:t3") || q.Contains("t3") {
+		t.Error("Expected db:t3 to be found only in db queue")
+	}
+	testQueueSize[string](&q, 1, t)
+}
+
+func TestKeyedQueueFull(t *testing.T) {
+	q := newTestKeyedQueue(2)
+	testPutErr(q.Put("a:t1"), t)
+	testPutErr(q.Put("b:t2"), t)
+	if err := q.Put("c:t3"); err != ErrQueueIsFull {
+		t.Errorf("Expected ErrQueueIsFull, got: %v", err)
+	}
+	testQueueCapacity[string](&q, 0, t)
+}
+
+func TestKeyedQueueRemoveWhere(t *testing.T) {
+	const size = 10
+	q := newTestKeyedQueue(size)
+	for _, item := range []string{"t1", "gpu:t2", "db:t3", "gpu:t4", "t5"} {
+		testPutErr(q.Put(item), t)
+	}
+	removed := q.RemoveWhere(func(s string) bool {
+		return s == "t1" || s == "gpu:t4"
+	})
+	if removed != 2 {
+		t.Errorf("Expected 2 removed items, got %d", removed)
+	}
+	testQueueSize[string](&q, 3, t)
+	testQueueCapacity[string](&q, size-3, t)
+	item, err := q.PopFrom("gpu", "")
+	testPop(item, err, "gpu:t2", t)
+	item, err = q.PopFrom("gpu", "")
+	testPop(item, err, "t5", t)
+}
+
+func TestKeyedQueueChanged(t *testing.T) {
+	q := newTestKeyedQueue(10)
+	changed := q.Changed()
+	select {
+	case <-changed:
+		t.Fatal("Expected no notification before Put")
+	default:
+	}
+	testPutErr(q.Put("gpu:t1"), t)
+	select {
+	case <-changed:
+	default:
+		t.Error("Expected notification after Put")
+	}
+	select {
+	case <-q.Changed():
+		t.Error("Expected new channel to be open after Put")
+	default:
+	}
+}
+
+func TestKeyedQueuePopAnyKey(t *testing.T) {
+	q := newTestKeyedQueue(10)
+	for _, item := range []string{"gpu:t1", "db:t2"} {
+		testPutErr(q.Put(item), t)
+	}
+	item, err := q.Pop()
+	testPop(item, err, "db:t2", t)
+	item, err = q.Pop()
+	testPop(item, err, "gpu:t1", t)
+	if _, err := q.Pop(); err != ErrQueueIsEmpty {
+		t.Errorf("Expected ErrQueueIsEmpty, got: %v", err)
+	}
+	testQueueSize[string](&q, 0, t)
+}
+
+func TestKeyedQueuePriorities(t *testing.T) {
+	const size = 10
+	q := NewKeyedQueue[prioItem](size,
+		func(pi prioItem) string {
+			prefix, _, _ := strings.Cut(pi.Name, ":")
+			return prefix
+		},
+		func() Queue[prioItem] {
+			pq := NewPriorityQueue[prioItem](size, itemPriority)
+			return &pq
+		},
+	)
+	items := []prioItem{
+		{"gpu:backfill", 1}, {"gpu:urgent", 10}, {"any:normal", 5},
+		{"any:backfill", 1}, {"db:urgent", 10},
+	}
+	for _, item := range items {
+		testPutErr(q.Put(item), t)
+	}
+	// On equal priorities the first of given keys wins
+	expectedOrder := []string{
+		"gpu:urgent", "any:normal", "gpu:backfill", "any:backfill",
+	}
+	for _, expected := range expectedOrder {
+		item, err := q.PopFrom("gpu", "any")
+		if err != nil || item.Name != expected {
+			t.Errorf("Expected %s, got %v (err: %v)", expected, item, err)
+		}
+	}
+	if _, err := q.PopFrom("gpu", "any"); err != ErrQueueIsEmpty {
+		t.Errorf("Expected ErrQueueIsEmpty, got: %v", err)
+	}
+	item, err := q.Pop()
+	if err != nil || item.Name != "db:urgent" {
+		t.Errorf("Expected db:urgent, got %v (err: %v)", item, err)
+	}
+}
@@ -0,0 +1,152 @@
+package ds
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// PriorityQueue is a fixed size queue which returns objects with the highest
+// priority first. Priority of an object is determined by given function, when
+// object is put onto the queue. Objects of the same priority are returned in
+// FIFO order. PriorityQueue implements Queue, PrioritizedQueue and
+// RemovableQueue interfaces and it's safe for concurrent use.
+type PriorityQueue[T comparable] struct {
+	maxSize  int
+	priority func(T) int
+	sync.Mutex
+	items  priorityItems[T]
+	putSeq uint64
+}
+
+// NewPriorityQueue creates new PriorityQueue of given maximum size. Given
+// priority function is used to determine priority of objects put onto the
+// queue - the higher the value, the earlier object is popped.
+func NewPriorityQueue[T comparable](
+	queueMaxSize int, priority func(T) int,
+) PriorityQueue[T] {
+	return PriorityQueue[T]{
+		maxSize:  queueMaxSize,
+		priority: priority,
+		items:    make(priorityItems[T], 0, queueMaxSize),
+	}
+}
+
+// Put puts given object onto the queue. Returns ErrQueueIsFull is the queue is
+// full and object cannot be put there.
+func (pq *PriorityQueue[T]) Put(obj T) error {
+	prio := pq.priority(obj)
+	pq.Lock()
+	defer pq.Unlock()
+	if len(pq.items) >= pq.maxSize {
+		return ErrQueueIsFull
+	}
+	heap.Push(&pq.items, priorityItem[T]{
+		value:    obj,
+		priority: prio,
+		seq:      pq.putSeq,
+	})
+	pq.putSeq++
+	return nil
+}
+
+// Pop returns the object with the highest priority and removes it from the
+// queue. If there are many objects with the same highest priority, the one
+// which was put first is returned. If the queue is empty, then non-nil error
+// ErrQueueIsEmpty is returned.
+func (pq *PriorityQueue[T]) Pop() (T, error) {
+	pq.Lock()
+	defer pq.Unlock()
+	if len(pq.items) == 0 {
+		var t T
+		return t, ErrQueueIsEmpty
+	}
+	item := heap.Pop(&pq.items).(priorityItem[T])
+	return item.value, nil
+}
+
+// PeekPriority returns priority of the object which would be popped next. If
+// the queue is empty, then non-nil error ErrQueueIsEmpty is returned.
+func (pq *PriorityQueue[T]) PeekPriority() (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+	if len(pq.items) == 0 {
+		return 0, ErrQueueIsEmpty
+	}
+	return pq.items[0].priority, nil
+}
+
+// Contains verifies whenever queue contains given element.
+func (pq *PriorityQueue[T]) Contains(elem T) bool {
+	pq.Lock()
+	defer pq.Unlock()
+	for _, item := range pq.items {
+		if item.value == elem {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveWhere removes all objects for which given predicate is true. Returns
+// number of removed objects.
+func (pq *PriorityQueue[T]) RemoveWhere(pred func(T) bool) int {
+	pq.Lock()
+	defer pq.Unlock()
+	remaining := make(priorityItems[T], 0, pq.maxSize)
+	for _, item := range pq.items {
+		if !pred(item.value) {
+			remaining = append(remaining, item)
+		}
+	}
+	removed := len(pq.items) - len(remaining)
+	pq.items = remaining
+	heap.Init(&pq.items)
+	return removed
+}
+
+func (pq *PriorityQueue[T]) Capacity() int {
+	pq.Lock()
+	size := len(pq.items)
+	pq.Unlock()
+	return pq.maxSize - size
+}
+
+func (pq *PriorityQueue[T]) Size() int {
+	pq.Lock()
+	size := len(pq.items)
+	pq.Unlock()
+	return size
+}
+
+type priorityItem[T any] struct {
+	value    T
+	priority int
+	seq      uint64
+}
+
+// Type priorityItems implements heap.Interface. The "smallest" item is the one
+// with the highest priority and then the lowest sequence number.
+type priorityItems[T any] []priorityItem[T]
+
+func (pi priorityItems[T]) Len() int { return len(pi) }
+
+func (pi priorityItems[T]) Less(i, j int) bool {
+	if pi[i].priority != pi[j].priority {
+		return pi[i].priority > pi[j].priority
+	}
+	return pi[i].seq < pi[j].seq
+}
+
+func (pi priorityItems[T]) Swap(i, j int) { pi[i], pi[j] = pi[j], pi[i] }
+
+func (pi *priorityItems[T]) Push(x any) {
+	*pi = append(*pi, x.(priorityItem[T]))
+}
+
+func (pi *priorityItems[T]) Pop() any {
+	old := *pi
+	n := len(old)
+	item := old[n-1]
+	*pi = old[:n-1]
+	return item
+}
@@ -0,0 +1,157 @@
+package ds
+
+import (
+	"sync"
+	"testing"
+)
+
+type prioItem struct {
+	Name     string
+	Priority int
+}
+
+func itemPriority(pi prioItem) int { return pi.Priority }
+
+func TestPriorityQueueOrder(t *testing.T) {
+	const size = 10
+	q := NewPriorityQueue[prioItem](size, itemPriority)
+	items := []prioItem{
+		{"backfill1", 1}, {"backfill2", 1}, {"urgent", 10}, {"normal1", 5},
+		{"backfill3", 1}, {"normal2", 5},
+	}
+	for _, item := range items {
+		testPutErr(q.Put(item), t)
+	}
+	testQueueCapacity[prioItem](&q, size-len(items), t)
+	testQueueSize[prioItem](&q, len(items), t)
+
+	expectedOrder := []string{
+		"urgent", "normal1", "normal2", "backfill1", "backfill2", "backfill3",
+	}
+	for _, expected := range expectedOrder {
+		item, popErr := q.Pop()
+		if popErr != nil {
+			t.Fatalf("Error while popping from the queue: %s", popErr.Error())
+		}
+		if item.Name != expected {
+			t.Errorf("Expected %s, got %s", expected, item.Name)
+		}
+	}
+	_, popErr := q.Pop()
+	if popErr != ErrQueueIsEmpty {
+		t.Errorf("Expected ErrQueueIsEmpty, got: %v", popErr)
+	}
+}
+
+func TestPriorityQueueFifoAmongEquals(t *testing.T) {
+	const size = 1000
+	q := NewPriorityQueue[int](size, func(int) int { return 0 })
+	for i := 0; i < size; i++ {
+		testPutErr(q.Put(i), t)
+	}
+	for i := 0; i < size; i++ {
+		item, popErr := q.Pop()
+		testPop(item, popErr, i, t)
+	}
+}
+
+func TestPriorityQueuePeekPriority(t *testing.T) {
+	q := NewPriorityQueue[prioItem](10, itemPriority)
+	if _, err := q.PeekPriority(); err != ErrQueueIsEmpty {
+		t.Errorf("Expected ErrQueueIsEmpty, got: %v", err)
+	}
+	testPutErr(q.Put(prioItem{"backfill", 1}), t)
+	testPutErr(q.Put(prioItem{"urgent", 10}), t)
+	if prio, err := q.PeekPriority(); err != nil || prio != 10 {
+		t.Errorf("Expected priority 10, got %d (err: %v)", prio, err)
+	}
+	testQueueSize[prioItem](&q, 2, t)
+}
+
+func TestPriorityQueueFullAndContains(t *testing.T) {
+	const size = 2
+	q := NewPriorityQueue[prioItem](size, itemPriority)
+	testPutErr(q.Put(prioItem{"a", 1}), t)
+	testPutErr(q.Put(prioItem{"b", 2}), t)
+	if err := q.Put(prioItem{"c", 3}); err != ErrQueueIsFull {
+		t.Errorf("Expected ErrQueueIsFull, got: %v", err)
+	}
+	if !q.Contains(prioItem{"a", 1}) {
+		t.Error("Expected queue to contain item a")
+	}
+	if q.Contains(prioItem{"c", 3}) {
+		t.Error("Expected queue not to contain item c")
+	}
+	testQueueCapacity[prioItem](&q, 0, t)
+}
+
+func TestPriorityQueueRemoveWhere(t *testing.T) {
+	const size = 10
+	q := NewPriorityQueue[prioItem](size, itemPriority)
+	items := []prioItem{
+		{"backfill1", 1}, {"urgent", 10}, {"normal1", 5}, {"backfill2", 1},
+		{"normal2", 5},
+	}
+	for _, item := range items {
+		testPutErr(q.Put(item), t)
+	}
+	removed := q.RemoveWhere(func(pi prioItem) bool {
+		return pi.Name == "urgent" || pi.Name == "backfill1"
+	})
+	if removed != 2 {
+		t.Errorf("Expected 2 removed items, got %d", removed)
+	}
+	testQueueSize[prioItem](&q, 3, t)
+	for _, expected := range []string{"normal1", "normal2", "backfill2"} {
+		item, popErr := q.Pop()
+		if popErr != nil {
+			t.Fatalf("Error while popping from the queue: %s", popErr.Error())
+		}
+		if item.Name != expected {
+			t.Errorf("Expected %s, got %s", expected, item.Name)
+		}
+	}
+}
+
+func TestPriorityQueueConcurrent(t *testing.T) {
+	const chunkSize = 10000
+	q := NewPriorityQueue[int](4*chunkSize, func(i int) int { return i % 7 })
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < chunkSize; j++ {
+				testPutErr(q.Put(j), t)
+			}
+		}()
+	}
+	wg.Wait()
+	testQueueSize[int](&q, 4*chunkSize, t)
+
+	prevPriority := 7
+	for i := 0; i < 4*chunkSize; i++ {
+		item, popErr := q.Pop()
+		if popErr != nil {
+			t.Fatalf("Error while popping from the queue: %s", popErr.Error())
+		}
+		if item%7 > prevPriority {
+			t.Fatalf("Popped item %d of priority %d after priority %d", item,
+				item%7, prevPriority)
+		}
+		prevPriority = item % 7
+	}
+}
+
+func BenchmarkPriorityQueuePutAndPop(b *testing.B) {
+	const size = 1000
+	q := NewPriorityQueue[int](size, func(i int) int { return i % 10 })
+	for i := 0; i < size/2; i++ {
+		q.Put(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Put(i)
+		q.Pop()
+	}
+}
@@ -26,6 +26,31 @@ type Queue[T comparable] interface {
 	Size() int
 }
 
+// NotifyingQueue is a Queue which can notify waiters about new objects, so
+// consumers don't have to poll an empty queue. Changed returns a channel which
+// is closed when the next object is put onto the queue. Consumer should get
+// the channel before trying to Pop, to not miss any notification.
+type NotifyingQueue[T comparable] interface {
+	Queue[T]
+	Changed() <-chan struct{}
+}
+
+// RemovableQueue is a Queue from which objects can be removed before they are
+// popped. RemoveWhere removes all objects for which given predicate is true
+// and returns number of removed objects.
+type RemovableQueue[T comparable] interface {
+	Queue[T]
+	RemoveWhere(pred func(T) bool) int
+}
+
+// PrioritizedQueue is a Queue which pops objects in priority order.
+// PeekPriority returns priority of the object which would be popped next,
+// without removing it. On empty queue it should return ErrQueueIsEmpty.
+type PrioritizedQueue[T comparable] interface {
+	Queue[T]
+	PeekPriority() (int, error)
+}
+
 // PutContext tries to put item onto the queue. In case of failures it tries
 // again and again until either successfully put item onto the queue or context
 // is done.
@@ -97,6 +122,22 @@ func (stq *SimpleQueue[T]) Contains(elem T) bool {
 	return false
 }
 
+// RemoveWhere removes all objects for which given predicate is true. Order of
+// remaining objects is preserved. Returns number of removed objects.
+func (stq *SimpleQueue[T]) RemoveWhere(pred func(T) bool) int {
+	stq.Lock()
+	defer stq.Unlock()
+	remaining := make([]T, 0, stq.maxSize)
+	for _, item := range stq.buffer {
+		if !pred(item) {
+			remaining = append(remaining, item)
+		}
+	}
+	removed := len(stq.buffer) - len(remaining)
+	stq.buffer = remaining
+	return removed
+}
+
 func (stq *SimpleQueue[T]) Capacity() int {
 	stq.Lock()
 	size := len(stq.buffer)
@@ -126,6 +126,24 @@ func TestSimpeQueueFull(t *testing.T) {
 	testQueueSize(&q, 2, t)
 }
 
+func TestSimpleQueueRemoveWhere(t *testing.T) {
+	const size = 10
+	q := NewSimpleQueue[int](size)
+	for i := 0; i < 6; i++ {
+		testPutErr(q.Put(i), t)
+	}
+	removed := q.RemoveWhere(func(i int) bool { return i%2 == 1 })
+	if removed != 3 {
+		t.Errorf("Expected 3 removed items, got %d", removed)
+	}
+	testQueueSize(&q, 3, t)
+	testQueueCapacity(&q, size-3, t)
+	for _, expected := range []int{0, 2, 4} {
+		item, popErr := q.Pop()
+		testPop(item, popErr, expected, t)
+	}
+}
+
 func TestSimpleQueueConcurrent(t *testing.T) {
 	const size = 3000000
 	const chunkSize = 100000
@@ -202,14 +220,14 @@ func BenchmarkQueuePut1000Objects(b *testing.B) {
 	}
 }
 
-func testQueueCapacity[T comparable](q *SimpleQueue[T], expectedCapacity int, t *testing.T) {
+func testQueueCapacity[T comparable](q Queue[T], expectedCapacity int, t *testing.T) {
 	cap := q.Capacity()
 	if cap != expectedCapacity {
 		t.Errorf("Expected queue capacity %d, got: %d", expectedCapacity, cap)
 	}
 }
 
-func testQueueSize[T comparable](q *SimpleQueue[T], expectedSize int, t *testing.T) {
+func testQueueSize[T comparable](q Queue[T], expectedSize int, t *testing.T) {
 	s := q.Size()
 	if s != expectedSize {
 		t.Errorf("Expected queue size %d, got: %d", expectedSize, s)
@@ -1,35 +1,179 @@
 package exec
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime/debug"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dskrzypiec/scheduler/dag"
 	"github.com/dskrzypiec/scheduler/ds"
 	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type Executor struct {
-	schedClient *SchedulerClient
+	schedClient schedulerApi
+	clientErr   error
 	config      Config
+	running     *runningTasks
+	statuses    *statusBatcher
 }
 
+// schedulerApi is the scheduler API used by executors. It's implemented by
+// SchedulerClient (HTTP) and GrpcClient.
+type schedulerApi interface {
+	Handshake() (models.ProtocolInfo, error)
+	ProtocolVersion() int
+	Register(info models.ExecutorInfo) error
+	Heartbeat() (models.ExecutorHeartbeatResponse, error)
+	GetTaskContext(ctx context.Context) (models.TaskToExec, error)
+	GetTasksContext(
+		ctx context.Context, maxTasks int,
+	) ([]models.TaskToExec, error)
+	UpdateTaskStatus(tte models.TaskToExec, status string) error
+	UpdateTaskStatuses(
+		updates []models.DagRunTaskStatus,
+	) ([]models.DagRunTaskStatusError, error)
+	AckTask(tte models.TaskToExec) (models.TaskLease, error)
+	RenewTaskLease(tte models.TaskToExec) (models.TaskLease, error)
+	ReleaseTaskLease(tte models.TaskToExec) (models.TaskLease, error)
+}
+
+// Transports available for communication with the scheduler.
+const (
+	TransportHttp = "http"
+	TransportGrpc = "grpc"
+)
+
 // Executor configuration.
 type Config struct {
 	PollInterval       time.Duration
 	HttpRequestTimeout time.Duration
+
+	// Transport used for communication with the scheduler - TransportHttp
+	// (the default) or TransportGrpc. In case of gRPC the scheduler sends
+	// tasks over a stream as soon as they are available and output of
+	// isolated tasks is sent to the scheduler.
+	Transport string
+
+	// Address (host:port) of the scheduler gRPC service. It's used only with
+	// TransportGrpc.
+	GrpcAddr string
+
+	// Bearer token presented to the scheduler, when it requires
+	// authentication.
+	AuthToken string
+
+	// TLS configuration for connections to the scheduler. For mutual TLS it
+	// should contain the executor client certificate. When nil, HTTP client
+	// uses default TLS settings (for https scheduler address) and gRPC
+	// connection is not encrypted.
+	TLSConfig *tls.Config
+
+	// How long the scheduler may wait for a task on a single GetTask
+	// request, when the queue is empty (long polling). It should be shorter
+	// than HttpRequestTimeout. When it's zero, executor polls the scheduler
+	// every PollInterval.
+	PopWait time.Duration
+
+	// Executor identifier used for registration in the scheduler. By default
+	// it's hostname and process ID.
+	ExecutorId string
+
+	// Labels advertised by the executor. Executor gets tasks without labels
+	// and tasks which require only labels from this list.
+	Labels []string
+
+	// Maximum number of concurrently executed tasks. When all of them are
+	// running, executor doesn't poll for new tasks. It's also reported to the
+	// scheduler on registration.
+	MaxConcurrentTasks int
+
+	// How often executor should send heartbeats to the scheduler. It should
+	// be significantly shorter than scheduler heartbeat timeout.
+	HeartbeatInterval time.Duration
+
+	// How often lease on the task which is being executed should be renewed.
+	// It should be significantly shorter than scheduler task lease timeout.
+	LeaseRenewInterval time.Duration
+
+	// When set, each task is executed in a separate child process, so tasks
+	// which crash, leak memory or call os.Exit do not affect other tasks. It
+	// requires calling RunIsolatedTask at the beginning of the main function.
+	IsolateTasks bool
+
+	// Limit of virtual memory of isolated task process in bytes. Zero means
+	// no limit. Go runtime reserves more virtual memory than it uses, so the
+	// limit should be generous.
+	TaskMemoryLimitBytes uint64
+
+	// Limit of CPU time of isolated task process. Zero means no limit.
+	TaskCpuTimeLimit time.Duration
+
+	// Maximum number of tasks popped from the scheduler in a single request.
+	// Executor never pops more tasks than it has free slots.
+	PopBatchSize int
+
+	// When it's positive, task statuses are not sent one by one, but in
+	// batches every StatusFlushInterval (or sooner, when StatusBatchSize
+	// updates are collected).
+	StatusFlushInterval time.Duration
+
+	// Maximum number of task status updates sent in a single request.
+	StatusBatchSize int
+
+	// How long executor waits for running tasks to finish on shutdown.
+	ShutdownTimeout time.Duration
+
+	// When set, tasks which are still running after ShutdownTimeout are put
+	// back onto the scheduler queue, instead of being marked as failed. It
+	// requires task leases to be enabled in the scheduler.
+	RequeueOnShutdown bool
 }
 
 // Setup default configuration values.
 func defaultConfig() Config {
 	return Config{
-		PollInterval:       10 * time.Millisecond,
-		HttpRequestTimeout: 30 * time.Second,
+		PollInterval:        10 * time.Millisecond,
+		HttpRequestTimeout:  30 * time.Second,
+		Transport:           TransportHttp,
+		PopWait:             10 * time.Second,
+		ExecutorId:          defaultExecutorId(),
+		MaxConcurrentTasks:  10,
+		HeartbeatInterval:   5 * time.Second,
+		LeaseRenewInterval:  10 * time.Second,
+		ShutdownTimeout:     30 * time.Second,
+		PopBatchSize:        10,
+		StatusFlushInterval: 50 * time.Millisecond,
+		StatusBatchSize:     100,
 	}
 }
 
+// Default executor identifier in form of hostname-pid.
+func defaultExecutorId() string {
+	return fmt.Sprintf("%s-%d", hostname(), os.Getpid())
+}
+
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
 // New creates new Executor instance. When config is nil, then default
 // configuration values will be used.
 func New(schedAddr string, config *Config) *Executor {
@@ -39,62 +183,557 @@ func New(schedAddr string, config *Config) *Executor {
 	} else {
 		cfg = defaultConfig()
 	}
-	httpClient := &http.Client{Timeout: cfg.HttpRequestTimeout}
-	sc := NewSchedulerClient(schedAddr, httpClient)
+	if cfg.ExecutorId == "" {
+		cfg.ExecutorId = defaultExecutorId()
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = defaultConfig().HeartbeatInterval
+	}
+	if cfg.MaxConcurrentTasks <= 0 {
+		cfg.MaxConcurrentTasks = defaultConfig().MaxConcurrentTasks
+	}
+	if cfg.PopBatchSize <= 0 {
+		cfg.PopBatchSize = 1
+	}
+	if cfg.StatusBatchSize <= 0 {
+		cfg.StatusBatchSize = defaultConfig().StatusBatchSize
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = defaultConfig().ShutdownTimeout
+	}
+	if cfg.LeaseRenewInterval == 0 {
+		cfg.LeaseRenewInterval = defaultConfig().LeaseRenewInterval
+	}
+	sc, clientErr := newSchedulerApi(schedAddr, cfg)
+	var statuses *statusBatcher
+	if cfg.StatusFlushInterval > 0 && sc != nil {
+		statuses = newStatusBatcher(sc, cfg.StatusFlushInterval,
+			cfg.StatusBatchSize)
+	}
 	return &Executor{
 		schedClient: sc,
+		clientErr:   clientErr,
 		config:      cfg,
+		running:     newRunningTasks(),
+		statuses:    statuses,
+	}
+}
+
+// Creates scheduler client of configured transport.
+func newSchedulerApi(schedAddr string, cfg Config) (schedulerApi, error) {
+	switch cfg.Transport {
+	case TransportHttp, "":
+		httpClient := &http.Client{Timeout: cfg.HttpRequestTimeout}
+		if cfg.TLSConfig != nil {
+			httpClient.Transport = &http.Transport{
+				TLSClientConfig: cfg.TLSConfig,
+			}
+		}
+		sc := NewSchedulerClient(schedAddr, httpClient)
+		sc.SetLabels(cfg.Labels)
+		sc.SetPopWait(cfg.PopWait)
+		sc.SetBearerToken(cfg.AuthToken)
+		return sc, nil
+	case TransportGrpc:
+		var opts []grpc.DialOption
+		if cfg.TLSConfig != nil {
+			opts = append(opts, grpc.WithTransportCredentials(
+				credentials.NewTLS(cfg.TLSConfig)))
+		}
+		gc, err := NewGrpcClient(cfg.GrpcAddr, cfg.HttpRequestTimeout,
+			opts...)
+		if err != nil {
+			return nil, err
+		}
+		gc.SetLabels(cfg.Labels)
+		gc.SetPopWait(cfg.PopWait)
+		gc.SetBearerToken(cfg.AuthToken)
+		return gc, nil
 	}
+	return nil, fmt.Errorf("unknown transport: %s", cfg.Transport)
 }
 
-// Start starts executor. TODO...
+// Start starts executor. At first executor registers itself in the scheduler
+// (retrying until the scheduler is available) and starts sending heartbeats
+// in the background. Then it gets tasks from
+// the scheduler and executes them, up to MaxConcurrentTasks at the same time.
+// When all slots are taken, executor stops polling for new tasks. Start blocks
+// until SIGTERM or SIGINT is received, then executor drains gracefully (see
+// Run).
 func (e *Executor) Start() {
-	for {
-		tte, err := e.schedClient.GetTask()
-		if err == ds.ErrQueueIsEmpty {
-			time.Sleep(e.config.PollInterval)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM,
+		os.Interrupt)
+	defer stop()
+	e.Run(ctx)
+}
+
+// Run runs executor until given context is done. After that executor stops
+// taking new tasks and waits up to ShutdownTimeout for running tasks to
+// finish. Tasks still running after the deadline are cancelled and reported
+// as FAILED or, when RequeueOnShutdown is set, their leases are released, so
+// the scheduler put them back onto the queue.
+func (e *Executor) Run(ctx context.Context) {
+	exitIfIsolatedTaskProcess()
+	if e.clientErr != nil {
+		slog.Error("Cannot create scheduler client", "executorId",
+			e.config.ExecutorId, "err", e.clientErr)
+		return
+	}
+	if closer, ok := e.schedClient.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if rErr := e.registerWithRetries(ctx); rErr != nil {
+		slog.Error("Cannot register executor in the scheduler", "executorId",
+			e.config.ExecutorId, "err", rErr)
+		return
+	}
+	heartbeatsDone := make(chan struct{})
+	stopHeartbeats := make(chan struct{})
+	go func() {
+		e.sendHeartbeats(stopHeartbeats)
+		close(heartbeatsDone)
+	}()
+	defer func() {
+		// Heartbeats are sent until draining is finished and they have to
+		// stop before the client is closed.
+		close(stopHeartbeats)
+		<-heartbeatsDone
+	}()
+	if e.statuses != nil {
+		go e.statuses.start()
+		defer e.statuses.close()
+	}
+	slots := make(chan struct{}, e.config.MaxConcurrentTasks)
+	var wg sync.WaitGroup
+
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
 			continue
 		}
-		if err != nil {
-			slog.Error("GetTask error", "err", err)
-			break
+		free := 1 + acquireFreeSlots(slots, e.config.PopBatchSize-1)
+		tasks := e.nextTasks(ctx, free)
+		for i := len(tasks); i < free; i++ {
+			<-slots
+		}
+		for _, t := range tasks {
+			wg.Add(1)
+			taskCtx, cancel := context.WithCancel(dag.ContextWithRendered(
+				dag.ContextWithParams(context.Background(), t.params),
+				t.rendered))
+			e.running.add(t.tte, cancel)
+			go func(t taskToRun) {
+				defer func() {
+					cancel()
+					<-slots
+					wg.Done()
+				}()
+				e.executeTask(taskCtx, t.tte, t.task)
+			}(t)
+		}
+	}
+	e.drain(&wg)
+}
+
+// Acquires up to n free slots without blocking. Returns number of acquired
+// slots.
+func acquireFreeSlots(slots chan struct{}, n int) int {
+	for i := 0; i < n; i++ {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return i
+		}
+	}
+	return n
+}
+
+type taskToRun struct {
+	tte      models.TaskToExec
+	task     dag.Task
+	params   dag.Params
+	rendered map[string]string
+}
+
+// Gets at most maxTasks tasks to be executed. In case when there is no task to
+// be executed, or tasks cannot be received, empty slice is returned.
+func (e *Executor) nextTasks(ctx context.Context, maxTasks int) []taskToRun {
+	var ttes []models.TaskToExec
+	var err error
+	if maxTasks == 1 {
+		var tte models.TaskToExec
+		tte, err = e.schedClient.GetTaskContext(ctx)
+		ttes = []models.TaskToExec{tte}
+	} else {
+		ttes, err = e.schedClient.GetTasksContext(ctx, maxTasks)
+	}
+	if err != nil && ctx.Err() != nil {
+		// Executor is shutting down
+		return nil
+	}
+	if err == ds.ErrQueueIsEmpty {
+		sleepContext(ctx, e.config.PollInterval)
+		return nil
+	}
+	if err != nil {
+		slog.Error("GetTask error", "err", err)
+		sleepContext(ctx, e.config.PollInterval)
+		return nil
+	}
+	tasks := make([]taskToRun, 0, len(ttes))
+	for _, tte := range ttes {
+		if t, ok := e.prepareTask(tte); ok {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// Acknowledges given task, finds it in the DAG registry and resolves
+// parameters of its DAG run and its rendered templates. Returns false, when
+// the task should not be executed.
+func (e *Executor) prepareTask(tte models.TaskToExec) (taskToRun, bool) {
+	if !e.ackTask(tte) {
+		return taskToRun{}, false
+	}
+	slog.Info("Start executing task", "taskToExec", tte)
+	d, dErr := dag.Get(dag.Id(tte.DagId))
+	if dErr != nil {
+		slog.Error("Could not get DAG from registry", "dagId", tte.DagId)
+		e.reportStatus(tte, dag.TaskFailed)
+		return taskToRun{}, false
+	}
+	task, tErr := d.GetTask(tte.TaskId)
+	if tErr != nil {
+		slog.Error("Could not get task from DAG", "dagId", tte.DagId,
+			"taskId", tte.TaskId)
+		e.reportStatus(tte, dag.TaskFailed)
+		return taskToRun{}, false
+	}
+	stored, pErr := dag.ParseParams(tte.Params)
+	if pErr != nil {
+		slog.Error("Could not parse dag run parameters. Using defaults",
+			"taskToExec", tte, "err", pErr)
+	}
+	rendered, rErr := dag.ParseRendered(tte.Rendered)
+	if rErr != nil {
+		slog.Error("Could not parse rendered task templates", "taskToExec",
+			tte, "err", rErr)
+		e.reportStatus(tte, dag.TaskFailed)
+		return taskToRun{}, false
+	}
+	return taskToRun{
+		tte:      tte,
+		task:     task,
+		params:   d.RunParams(stored),
+		rendered: rendered,
+	}, true
+}
+
+// Waits up to ShutdownTimeout for running tasks to finish. Tasks which are
+// still running after that are abandoned - their contexts are cancelled (so
+// isolated task processes are killed) and they are reported as FAILED or
+// released back onto the queue.
+func (e *Executor) drain(wg *sync.WaitGroup) {
+	slog.Info("Executor is shutting down. Waiting for running tasks",
+		"executorId", e.config.ExecutorId, "running", e.running.size(),
+		"timeout", e.config.ShutdownTimeout)
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		slog.Info("All running tasks finished", "executorId",
+			e.config.ExecutorId)
+		return
+	case <-time.After(e.config.ShutdownTimeout):
+	}
+	for _, tte := range e.running.abandonAll() {
+		if e.config.RequeueOnShutdown && tte.LeaseId != "" {
+			slog.Warn("Task is still running. Releasing it back onto the queue",
+				"taskToExec", tte)
+			if _, err := e.schedClient.ReleaseTaskLease(tte); err != nil {
+				slog.Error("Cannot release task lease", "taskToExec", tte,
+					"err", err)
+			}
+			continue
+		}
+		slog.Warn("Task is still running. Marking it as failed", "taskToExec",
+			tte)
+		e.reportStatus(tte, dag.TaskFailed)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// Acknowledges receipt of the task. Returns false, when the task should not
+// be executed, because the lease couldn't be acknowledged. In that case the
+// scheduler would put the task back onto the queue.
+func (e *Executor) ackTask(tte models.TaskToExec) bool {
+	if tte.LeaseId == "" {
+		return true
+	}
+	_, err := e.schedClient.AckTask(tte)
+	if err != nil {
+		slog.Error("Cannot acknowledge task lease. Task will not be executed",
+			"taskToExec", tte, "err", err)
+		return false
+	}
+	return true
+}
+
+// Renews lease on given task every LeaseRenewInterval, until done channel is
+// closed. When the lease has expired, the scheduler has already put the task
+// back onto the queue, so the task is cancelled, the same as tasks cancelled
+// by the scheduler, and its status is not reported.
+func (e *Executor) renewLease(tte models.TaskToExec, done <-chan struct{}) {
+	if tte.LeaseId == "" {
+		return
+	}
+	ticker := time.NewTicker(e.config.LeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_, err := e.schedClient.RenewTaskLease(tte)
+			if errors.Is(err, ErrLeaseExpired) {
+				if e.running.stop(tte) {
+					slog.Warn("Task lease has expired. Task is cancelled",
+						"taskToExec", tte)
+				}
+				return
+			}
+			if err != nil {
+				slog.Error("Cannot renew task lease", "taskToExec", tte, "err",
+					err)
+			}
+		}
+	}
+}
+
+// Negotiates protocol version with the scheduler and registers the executor.
+func (e *Executor) register() error {
+	if _, hErr := e.schedClient.Handshake(); hErr != nil {
+		return hErr
+	}
+	return e.schedClient.Register(models.ExecutorInfo{
+		ExecutorId:      e.config.ExecutorId,
+		Hostname:        hostname(),
+		Capacity:        e.config.MaxConcurrentTasks,
+		Version:         version.Current(),
+		ProtocolVersion: e.schedClient.ProtocolVersion(),
+	})
+}
+
+// Maximum delay between executor registration attempts.
+const maxRegisterBackoff = 10 * time.Second
+
+// Registers the executor in the scheduler. When registration fails (e.g. the
+// scheduler is not up yet), it's retried with exponential backoff, starting
+// from PollInterval, until given context is done. Incompatible protocol
+// versions are not retried.
+func (e *Executor) registerWithRetries(ctx context.Context) error {
+	backoff := max(e.config.PollInterval, time.Millisecond)
+	for {
+		err := e.register()
+		if err == nil || errors.Is(err, version.ErrIncompatibleProtocol) {
+			return err
+		}
+		slog.Warn("Cannot register executor in the scheduler. Will retry",
+			"executorId", e.config.ExecutorId, "retryIn", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("executor was not registered before shutdown: %w",
+				err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRegisterBackoff)
+	}
+}
+
+// Sends heartbeats to the scheduler every HeartbeatInterval, until done
+// channel is closed. When the scheduler does not know this executor (e.g. it
+// considered it dead or was restarted with a new database), executor
+// registers again. Tasks cancelled by the scheduler, returned in heartbeat
+// responses, are stopped.
+func (e *Executor) sendHeartbeats(done <-chan struct{}) {
+	ticker := time.NewTicker(e.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		resp, err := e.schedClient.Heartbeat()
+		if err == nil {
+			e.cancelTasks(resp.CancelledTasks)
 		}
-		slog.Info("Start executing task", "taskToExec", tte)
-		d, dErr := dag.Get(dag.Id(tte.DagId))
-		if dErr != nil {
-			slog.Error("Could not get DAG from registry", "dagId", tte.DagId)
-			break
+		if err == ErrExecutorNotRegistered {
+			slog.Warn("Executor is not registered in the scheduler. Will "+
+				"register again", "executorId", e.config.ExecutorId)
+			err = e.register()
 		}
-		task, tErr := d.GetTask(tte.TaskId)
-		if tErr != nil {
-			slog.Error("Could not get task from DAG", "dagId", tte.DagId,
-				"taskId", tte.TaskId)
-			break
+		if err != nil {
+			slog.Error("Heartbeat failed", "executorId", e.config.ExecutorId,
+				"err", err)
 		}
-		go executeTask(tte, task, e.schedClient)
 	}
 }
 
-func executeTask(
-	tte models.TaskToExec, task dag.Task, schedClient *SchedulerClient,
+// Stops execution of given tasks, which have been cancelled by the
+// scheduler. Final statuses of cancelled tasks are not reported, because the
+// scheduler has already marked them as CANCELLED. Tasks executed in-process
+// which don't implement dag.CancellableTask run until they finish.
+func (e *Executor) cancelTasks(ttes []models.TaskToExec) {
+	for _, tte := range e.running.cancel(ttes) {
+		slog.Warn("Task has been cancelled by the scheduler", "taskToExec",
+			tte)
+	}
+}
+
+func (e *Executor) executeTask(
+	ctx context.Context, tte models.TaskToExec, task dag.Task,
 ) {
+	done := make(chan struct{})
+	defer close(done)
+	go e.renewLease(tte, done)
 	defer func() {
 		if r := recover(); r != nil {
-			schedClient.UpdateTaskStatus(tte, dag.TaskFailed.String())
+			if e.running.remove(tte) {
+				e.reportStatus(tte, dag.TaskFailed)
+			}
 			slog.Error("Recovered from panic:", "err", r, "stack",
 				string(debug.Stack()))
 		}
 	}()
-	uErr := schedClient.UpdateTaskStatus(tte, dag.TaskRunning.String())
-	if uErr != nil {
-		slog.Error("Error while updating status", "tte", tte, "status",
-			dag.TaskRunning.String(), "err", uErr.Error())
+	e.reportStatus(tte, dag.TaskRunning)
+	status := dag.TaskSuccess
+	if e.config.IsolateTasks {
+		if err := e.executeIsolated(ctx, tte); err != nil {
+			slog.Error("Isolated task failed", "taskToExec", tte, "err", err)
+			status = dag.TaskFailed
+		}
+	} else {
+		dag.ExecuteTask(ctx, task)
 	}
-	task.Execute()
-	slog.Info("Finished executing task", "taskToExec", tte)
-	uErr = schedClient.UpdateTaskStatus(tte, dag.TaskSuccess.String())
+	slog.Info("Finished executing task", "taskToExec", tte, "status",
+		status.String())
+	if !e.running.remove(tte) {
+		// Task was abandoned on shutdown and its status was already reported
+		// or it was cancelled by the scheduler
+		return
+	}
+	e.reportStatus(tte, status)
+}
+
+// Reports task status to the scheduler. When status batching is enabled,
+// status is sent with the next batch.
+func (e *Executor) reportStatus(tte models.TaskToExec, status dag.TaskStatus) {
+	if e.statuses != nil {
+		e.statuses.report(tte, status.String())
+		return
+	}
+	uErr := e.schedClient.UpdateTaskStatus(tte, status.String())
 	if uErr != nil {
 		slog.Error("Error while updating status", "tte", tte, "status",
-			dag.TaskSuccess.String(), "err", uErr.Error())
+			status.String(), "err", uErr.Error())
 	}
 }
+
+// Set of tasks which are being executed, together with functions cancelling
+// their contexts. It's safe for concurrent use.
+type runningTasks struct {
+	sync.Mutex
+	tasks map[models.TaskToExec]context.CancelFunc
+}
+
+func newRunningTasks() *runningTasks {
+	return &runningTasks{tasks: make(map[models.TaskToExec]context.CancelFunc)}
+}
+
+func (rt *runningTasks) add(tte models.TaskToExec, cancel context.CancelFunc) {
+	rt.Lock()
+	defer rt.Unlock()
+	rt.tasks[tte] = cancel
+}
+
+// Removes given task. Returns false, if the task was not there, because it
+// has been abandoned.
+func (rt *runningTasks) remove(tte models.TaskToExec) bool {
+	rt.Lock()
+	defer rt.Unlock()
+	_, exists := rt.tasks[tte]
+	delete(rt.tasks, tte)
+	return exists
+}
+
+// Cancels and removes given task. Returns false, if the task was not there.
+func (rt *runningTasks) stop(tte models.TaskToExec) bool {
+	rt.Lock()
+	defer rt.Unlock()
+	cancel, exists := rt.tasks[tte]
+	if !exists {
+		return false
+	}
+	cancel()
+	delete(rt.tasks, tte)
+	return true
+}
+
+// Cancels and removes all running tasks. Returns removed tasks.
+func (rt *runningTasks) abandonAll() []models.TaskToExec {
+	rt.Lock()
+	defer rt.Unlock()
+	ttes := make([]models.TaskToExec, 0, len(rt.tasks))
+	for tte, cancel := range rt.tasks {
+		cancel()
+		ttes = append(ttes, tte)
+	}
+	rt.tasks = make(map[models.TaskToExec]context.CancelFunc)
+	return ttes
+}
+
+// Cancels and removes running tasks which match given tasks by DAG ID,
+// execution timestamp and task ID. Returns cancelled tasks.
+func (rt *runningTasks) cancel(
+	ttes []models.TaskToExec,
+) []models.TaskToExec {
+	if len(ttes) == 0 {
+		return nil
+	}
+	type taskKey struct{ dagId, execTs, taskId string }
+	toCancel := make(map[taskKey]struct{}, len(ttes))
+	for _, tte := range ttes {
+		toCancel[taskKey{tte.DagId, tte.ExecTs, tte.TaskId}] = struct{}{}
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	cancelled := make([]models.TaskToExec, 0, len(ttes))
+	for tte, cancel := range rt.tasks {
+		key := taskKey{tte.DagId, tte.ExecTs, tte.TaskId}
+		if _, ok := toCancel[key]; !ok {
+			continue
+		}
+		cancel()
+		delete(rt.tasks, tte)
+		cancelled = append(cancelled, tte)
+	}
+	return cancelled
+}
+
+func (rt *runningTasks) size() int {
+	rt.Lock()
+	defer rt.Unlock()
+	return len(rt.tasks)
+}
@@ -0,0 +1,587 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+)
+
+// fakeScheduler is in-memory implementation of schedulerApi. Tasks put onto
+// its queue are handed out on GetTask and GetTasks and all calls which
+// executors make are recorded.
+type fakeScheduler struct {
+	sync.Mutex
+	queue         []models.TaskToExec
+	popRequests   []int
+	statuses      []models.DagRunTaskStatus
+	statusBatches [][]models.DagRunTaskStatus
+	released      []models.TaskToExec
+
+	// Number of registration attempts which should fail, before the
+	// registration succeeds.
+	registerFailures int
+	registrations    int
+	heartbeats       int
+
+	// When set, GetTasksContext on empty queue blocks until the context is
+	// done, as long polling would.
+	popBlocks bool
+
+	// When set, RenewTaskLease returns ErrLeaseExpired.
+	leasesExpired bool
+
+	// Number of UpdateTaskStatuses calls which should fail, as if the
+	// scheduler couldn't be reached.
+	statusFailures int
+}
+
+func (fs *fakeScheduler) put(ttes ...models.TaskToExec) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.queue = append(fs.queue, ttes...)
+}
+
+func (fs *fakeScheduler) Handshake() (models.ProtocolInfo, error) {
+	return models.ProtocolInfo{
+		ProtocolVersion:    version.ProtocolVersion,
+		MinProtocolVersion: version.MinProtocolVersion,
+	}, nil
+}
+
+func (fs *fakeScheduler) ProtocolVersion() int {
+	return version.ProtocolVersion
+}
+
+func (fs *fakeScheduler) Register(models.ExecutorInfo) error {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.registrations++
+	if fs.registrations <= fs.registerFailures {
+		return errors.New("scheduler is not available")
+	}
+	return nil
+}
+
+func (fs *fakeScheduler) Heartbeat() (models.ExecutorHeartbeatResponse, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.heartbeats++
+	return models.ExecutorHeartbeatResponse{}, nil
+}
+
+func (fs *fakeScheduler) GetTaskContext(
+	ctx context.Context,
+) (models.TaskToExec, error) {
+	ttes, err := fs.GetTasksContext(ctx, 1)
+	if err != nil {
+		return models.TaskToExec{}, err
+	}
+	return ttes[0], nil
+}
+
+func (fs *fakeScheduler) GetTasksContext(
+	ctx context.Context, maxTasks int,
+) ([]models.TaskToExec, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.popRequests = append(fs.popRequests, maxTasks)
+	if len(fs.queue) == 0 && fs.popBlocks {
+		fs.Unlock()
+		<-ctx.Done()
+		fs.Lock()
+		return nil, ctx.Err()
+	}
+	if len(fs.queue) == 0 {
+		return nil, ds.ErrQueueIsEmpty
+	}
+	n := min(maxTasks, len(fs.queue))
+	ttes := fs.queue[:n]
+	fs.queue = fs.queue[n:]
+	return ttes, nil
+}
+
+func (fs *fakeScheduler) UpdateTaskStatus(
+	tte models.TaskToExec, status string,
+) error {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.statuses = append(fs.statuses, models.DagRunTaskStatus{
+		DagId:   tte.DagId,
+		ExecTs:  tte.ExecTs,
+		TaskId:  tte.TaskId,
+		Status:  status,
+		LeaseId: tte.LeaseId,
+	})
+	return nil
+}
+
+func (fs *fakeScheduler) UpdateTaskStatuses(
+	updates []models.DagRunTaskStatus,
+) ([]models.DagRunTaskStatusError, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.statusFailures > 0 {
+		fs.statusFailures--
+		return nil, errors.New("scheduler is not available")
+	}
+	fs.statusBatches = append(fs.statusBatches, updates)
+	fs.statuses = append(fs.statuses, updates...)
+	return nil, nil
+}
+
+func (fs *fakeScheduler) AckTask(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	return models.TaskLease{LeaseId: tte.LeaseId}, nil
+}
+
+func (fs *fakeScheduler) RenewTaskLease(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.leasesExpired {
+		return models.TaskLease{}, ErrLeaseExpired
+	}
+	return models.TaskLease{LeaseId: tte.LeaseId}, nil
+}
+
+func (fs *fakeScheduler) ReleaseTaskLease(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.released = append(fs.released, tte)
+	return models.TaskLease{LeaseId: tte.LeaseId}, nil
+}
+
+// Returns reported statuses of given task, in order.
+func (fs *fakeScheduler) taskStatuses(taskId string) []string {
+	fs.Lock()
+	defer fs.Unlock()
+	statuses := make([]string, 0)
+	for _, s := range fs.statuses {
+		if s.TaskId == taskId {
+			statuses = append(statuses, s.Status)
+		}
+	}
+	return statuses
+}
+
+func (fs *fakeScheduler) queueSize() int {
+	fs.Lock()
+	defer fs.Unlock()
+	return len(fs.queue)
+}
+
+// Task which signals when it's started and blocks until it's released.
+type blockingTask struct {
+	TaskId  string
+	started chan string
+	release chan struct{}
+}
+
+func (bt blockingTask) Id() string { return bt.TaskId }
+func (bt blockingTask) Execute() {
+	bt.started <- bt.TaskId
+	<-bt.release
+}
+
+// Task which signals when it's started and blocks until its context is done.
+type cancellableTask struct {
+	TaskId  string
+	started chan string
+}
+
+func (ct cancellableTask) Id() string { return ct.TaskId }
+func (ct cancellableTask) Execute()   {}
+func (ct cancellableTask) ExecuteContext(ctx context.Context) {
+	ct.started <- ct.TaskId
+	<-ctx.Done()
+}
+
+// Registers DAG of given number of independent blocking tasks (t0, t1, ...)
+// and returns tasks to execute for them. Closing release channel releases all
+// tasks.
+func blockingDag(
+	t *testing.T, dagId string, tasks int, started chan string,
+	release chan struct{},
+) []models.TaskToExec {
+	t.Helper()
+	root := &dag.Node{Task: blockingTask{"t0", started, release}}
+	for i := 1; i < tasks; i++ {
+		root.Next(&dag.Node{
+			Task: blockingTask{taskName(i), started, release},
+		})
+	}
+	d := dag.New(dag.Id(dagId)).AddRoot(root).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	ttes := make([]models.TaskToExec, tasks)
+	for i := range ttes {
+		ttes[i] = models.TaskToExec{
+			DagId:   dagId,
+			ExecTs:  "2023-10-05T12:00:00UTC+00:00",
+			TaskId:  taskName(i),
+			LeaseId: "lease_" + taskName(i),
+		}
+	}
+	return ttes
+}
+
+func taskName(i int) string {
+	return fmt.Sprintf("t%d", i)
+}
+
+func newTestExecutor(sc schedulerApi, config Config) *Executor {
+	config.ExecutorId = "test_executor"
+	config.PollInterval = time.Millisecond
+	config.HeartbeatInterval = time.Hour
+	config.LeaseRenewInterval = time.Hour
+	if config.PopBatchSize <= 0 {
+		config.PopBatchSize = 1
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 5 * time.Second
+	}
+	var statuses *statusBatcher
+	if config.StatusFlushInterval > 0 {
+		statuses = newStatusBatcher(sc, config.StatusFlushInterval,
+			config.StatusBatchSize)
+	}
+	return &Executor{
+		schedClient: sc,
+		config:      config,
+		running:     newRunningTasks(),
+		statuses:    statuses,
+	}
+}
+
+// Starts executor and returns function which stops it and waits until Run
+// returns.
+func runExecutor(e *Executor) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitForStarted(t *testing.T, started chan string, n int) []string {
+	t.Helper()
+	taskIds := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case taskId := <-started:
+			taskIds = append(taskIds, taskId)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %d started tasks, got %v", n, taskIds)
+		}
+	}
+	return taskIds
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAcquireFreeSlots(t *testing.T) {
+	slots := make(chan struct{}, 3)
+	slots <- struct{}{}
+	if acquired := acquireFreeSlots(slots, 5); acquired != 2 {
+		t.Errorf("Expected 2 acquired slots, got %d", acquired)
+	}
+	if acquired := acquireFreeSlots(slots, 1); acquired != 0 {
+		t.Errorf("Expected no free slots, got %d", acquired)
+	}
+	<-slots
+	if acquired := acquireFreeSlots(slots, 0); acquired != 0 {
+		t.Errorf("Expected no acquired slots for n=0, got %d", acquired)
+	}
+}
+
+func TestExecutorRunLimitsConcurrentTasks(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	fs := &fakeScheduler{}
+	fs.put(blockingDag(t, "mock_exec_concurrency", 5, started, release)...)
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 2, PopBatchSize: 5})
+	stop := runExecutor(e)
+
+	waitForStarted(t, started, 2)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case taskId := <-started:
+		t.Errorf("Expected at most 2 running tasks, but %s started", taskId)
+	default:
+	}
+	if size := fs.queueSize(); size != 3 {
+		t.Errorf("Expected 3 tasks left in the scheduler, got %d", size)
+	}
+	fs.Lock()
+	for _, maxTasks := range fs.popRequests {
+		if maxTasks > 2 {
+			t.Errorf("Expected pop of at most 2 tasks, got %d", maxTasks)
+		}
+	}
+	fs.Unlock()
+
+	close(release)
+	waitForStarted(t, started, 3)
+	waitFor(t, func() bool { return len(fs.taskStatuses("t4")) == 2 },
+		"Expected all tasks to finish")
+	stop()
+	for i := 0; i < 5; i++ {
+		statuses := fs.taskStatuses(taskName(i))
+		if len(statuses) != 2 || statuses[0] != "RUNNING" ||
+			statuses[1] != "SUCCESS" {
+			t.Errorf("Expected RUNNING and SUCCESS for %s, got %v",
+				taskName(i), statuses)
+		}
+	}
+}
+
+func TestExecutorReleasesSlotsNotUsedByBatch(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	fs := &fakeScheduler{}
+	ttes := blockingDag(t, "mock_exec_batch_slots", 2, started, release)
+	fs.put(ttes[0])
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 2, PopBatchSize: 2})
+	stop := runExecutor(e)
+	defer stop()
+	defer close(release)
+
+	// Batch of 2 slots got only one task, the other slot has to be released
+	waitForStarted(t, started, 1)
+	fs.put(ttes[1])
+	if taskIds := waitForStarted(t, started, 1); taskIds[0] != "t1" {
+		t.Errorf("Expected t1 to be started, got %v", taskIds)
+	}
+}
+
+func TestExecutorDrainWaitsForRunningTasks(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	fs := &fakeScheduler{}
+	fs.put(blockingDag(t, "mock_exec_drain", 1, started, release)...)
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 2, PopBatchSize: 1})
+	stop := runExecutor(e)
+	waitForStarted(t, started, 1)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	stop()
+	statuses := fs.taskStatuses("t0")
+	if len(statuses) != 2 || statuses[1] != "SUCCESS" {
+		t.Errorf("Expected task to finish before shutdown, got %v", statuses)
+	}
+}
+
+func TestExecutorDrainTimeoutMarksTasksFailed(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	defer close(release)
+	fs := &fakeScheduler{}
+	fs.put(blockingDag(t, "mock_exec_drain_timeout", 1, started, release)...)
+	e := newTestExecutor(fs, Config{
+		MaxConcurrentTasks: 1,
+		ShutdownTimeout:    20 * time.Millisecond,
+	})
+	stop := runExecutor(e)
+	waitForStarted(t, started, 1)
+	stop()
+
+	statuses := fs.taskStatuses("t0")
+	if len(statuses) != 2 || statuses[1] != "FAILED" {
+		t.Errorf("Expected task to be marked as FAILED, got %v", statuses)
+	}
+	if e.running.size() != 0 {
+		t.Errorf("Expected no running tasks, got %d", e.running.size())
+	}
+}
+
+func TestExecutorRequeueOnShutdown(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	fs := &fakeScheduler{}
+	fs.put(blockingDag(t, "mock_exec_requeue", 1, started, release)...)
+	e := newTestExecutor(fs, Config{
+		MaxConcurrentTasks: 1,
+		ShutdownTimeout:    20 * time.Millisecond,
+		RequeueOnShutdown:  true,
+	})
+	stop := runExecutor(e)
+	waitForStarted(t, started, 1)
+	stop()
+
+	fs.Lock()
+	released := fs.released
+	fs.Unlock()
+	if len(released) != 1 || released[0].TaskId != "t0" {
+		t.Errorf("Expected lease of t0 to be released, got %v", released)
+	}
+	// Abandoned task finishes, but its status is not reported anymore
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	if statuses := fs.taskStatuses("t0"); len(statuses) != 1 {
+		t.Errorf("Expected only RUNNING status, got %v", statuses)
+	}
+}
+
+func TestExecutorRetriesRegistration(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	close(release)
+	fs := &fakeScheduler{registerFailures: 3}
+	fs.put(blockingDag(t, "mock_exec_register_retry", 1, started, release)...)
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 1})
+	stop := runExecutor(e)
+	defer stop()
+
+	waitForStarted(t, started, 1)
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.registrations != 4 {
+		t.Errorf("Expected 4 registration attempts, got %d", fs.registrations)
+	}
+}
+
+func TestExecutorStopsRetryingRegistrationOnShutdown(t *testing.T) {
+	fs := &fakeScheduler{registerFailures: 1000}
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 1})
+	stop := runExecutor(e)
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected executor to stop while retrying registration")
+	}
+}
+
+func TestRunningTasksAbandonAllCancelsTasks(t *testing.T) {
+	rt := newRunningTasks()
+	ctx, cancel := context.WithCancel(context.Background())
+	tte := models.TaskToExec{DagId: "dag", TaskId: "t0"}
+	rt.add(tte, cancel)
+
+	abandoned := rt.abandonAll()
+	if len(abandoned) != 1 || abandoned[0] != tte {
+		t.Errorf("Expected %v to be abandoned, got %v", tte, abandoned)
+	}
+	if ctx.Err() == nil {
+		t.Error("Expected context of abandoned task to be cancelled")
+	}
+	if rt.remove(tte) {
+		t.Error("Expected abandoned task to be removed")
+	}
+}
+
+func TestExecutorStopsHeartbeatsAfterRun(t *testing.T) {
+	fs := &fakeScheduler{}
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 1})
+	e.config.HeartbeatInterval = time.Millisecond
+	stop := runExecutor(e)
+	waitFor(t, func() bool {
+		fs.Lock()
+		defer fs.Unlock()
+		return fs.heartbeats > 0
+	}, "Expected executor to send heartbeats")
+	stop()
+
+	fs.Lock()
+	heartbeats := fs.heartbeats
+	fs.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.heartbeats != heartbeats {
+		t.Errorf("Expected no heartbeats after Run returned, got %d more",
+			fs.heartbeats-heartbeats)
+	}
+}
+
+func TestExecutorShutdownAbortsLongPolling(t *testing.T) {
+	fs := &fakeScheduler{popBlocks: true}
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 1})
+	stop := runExecutor(e)
+	waitFor(t, func() bool {
+		fs.Lock()
+		defer fs.Unlock()
+		return len(fs.popRequests) > 0
+	}, "Expected executor to wait for tasks")
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected executor to stop while waiting for tasks")
+	}
+}
+
+func TestExecutorCancelsTaskWithExpiredLease(t *testing.T) {
+	started := make(chan string, 1)
+	root := &dag.Node{Task: cancellableTask{"t0", started}}
+	d := dag.New("mock_dag_exec_lease_expired").AddRoot(root).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	fs := &fakeScheduler{}
+	fs.put(models.TaskToExec{
+		DagId:   string(d.Id),
+		ExecTs:  "2023-10-05T12:00:00UTC+00:00",
+		TaskId:  "t0",
+		LeaseId: "lease_t0",
+	})
+	e := newTestExecutor(fs, Config{MaxConcurrentTasks: 1})
+	e.config.LeaseRenewInterval = time.Millisecond
+	stop := runExecutor(e)
+	defer stop()
+	waitForStarted(t, started, 1)
+
+	// The scheduler has put the task back onto the queue in the meantime
+	fs.Lock()
+	fs.leasesExpired = true
+	fs.Unlock()
+	waitFor(t, func() bool { return e.running.size() == 0 },
+		"Expected task with expired lease to be cancelled")
+	time.Sleep(10 * time.Millisecond)
+	statuses := fs.taskStatuses("t0")
+	if len(statuses) != 1 || statuses[0] != dag.TaskRunning.String() {
+		t.Errorf("Expected only RUNNING status to be reported, got %v",
+			statuses)
+	}
+}
@@ -0,0 +1,381 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/grpcapi"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcClient is a client of the scheduler gRPC executor service. It has the
+// same API as SchedulerClient. Tasks are received over a single Dispatch
+// stream, so the scheduler sends them as soon as they are available, and
+// output of isolated tasks is sent to the scheduler over StreamLogs stream.
+type GrpcClient struct {
+	conn           *grpc.ClientConn
+	client         *grpcapi.ExecutorClient
+	requestTimeout time.Duration
+	executorId     string
+	labels         []string
+	popWait        time.Duration
+	bearerToken    string
+
+	// Negotiated protocol version. Zero means the handshake has not been
+	// done yet.
+	protocolVersion int
+
+	dispatchMu     sync.Mutex
+	dispatch       grpc.BidiStreamingClient[models.PopTasksRequest, models.TaskBatch]
+	dispatchCancel context.CancelFunc
+
+	logsMu sync.Mutex
+	logs   grpc.ClientStreamingClient[models.TaskLog, models.Empty]
+}
+
+// NewGrpcClient creates new GrpcClient for the scheduler gRPC service of
+// given address (host:port). Connection is established lazily, on the first
+// call. By default connection is not encrypted, it can be changed by given
+// dial options.
+func NewGrpcClient(
+	addr string, requestTimeout time.Duration, opts ...grpc.DialOption,
+) (*GrpcClient, error) {
+	if requestTimeout == 0 {
+		requestTimeout = 30 * time.Second
+	}
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gRPC client for %s: %w", addr,
+			err)
+	}
+	return &GrpcClient{
+		conn:           conn,
+		client:         grpcapi.NewExecutorClient(conn),
+		requestTimeout: requestTimeout,
+	}, nil
+}
+
+// SetLabels sets labels advertised by the client on getting new tasks.
+func (c *GrpcClient) SetLabels(labels []string) {
+	c.labels = labels
+}
+
+// SetPopWait sets how long the scheduler may wait for a task, when the queue
+// is empty.
+func (c *GrpcClient) SetPopWait(wait time.Duration) {
+	c.popWait = wait
+}
+
+// SetBearerToken sets token sent in metadata of each call, when the
+// scheduler requires authentication.
+func (c *GrpcClient) SetBearerToken(token string) {
+	c.bearerToken = token
+}
+
+// Handshake negotiates protocol version with the scheduler. It should be
+// called before any other call. If there is no common protocol version,
+// version.ErrIncompatibleProtocol is returned.
+func (c *GrpcClient) Handshake() (models.ProtocolInfo, error) {
+	ctx, cancel := c.callContext()
+	defer cancel()
+	info, err := c.client.Handshake(ctx, &models.Empty{})
+	if err != nil {
+		return models.ProtocolInfo{}, grpcError("Handshake", err)
+	}
+	negotiated, nErr := version.NegotiateProtocol(info.MinProtocolVersion,
+		info.ProtocolVersion)
+	if nErr != nil {
+		return *info, fmt.Errorf("scheduler supports protocol versions %d-%d, "+
+			"executor supports %d-%d: %w", info.MinProtocolVersion,
+			info.ProtocolVersion, version.MinProtocolVersion,
+			version.ProtocolVersion, nErr)
+	}
+	c.protocolVersion = negotiated
+	slog.Info("Negotiated protocol version", "protocolVersion", negotiated,
+		"schedulerVersion", info.Version, "executorVersion", version.Current())
+	return *info, nil
+}
+
+// ProtocolVersion returns negotiated protocol version or zero, when the
+// handshake has not been done.
+func (c *GrpcClient) ProtocolVersion() int {
+	return c.protocolVersion
+}
+
+// Register registers executor in the scheduler.
+func (c *GrpcClient) Register(info models.ExecutorInfo) error {
+	ctx, cancel := c.callContext()
+	defer cancel()
+	if _, err := c.client.Register(ctx, &info); err != nil {
+		return grpcError("Register", err)
+	}
+	c.executorId = info.ExecutorId
+	return nil
+}
+
+// Heartbeat sends heartbeat of registered executor to the scheduler. If the
+// scheduler does not know the executor, ErrExecutorNotRegistered is returned.
+// Response contains tasks of the executor cancelled by the scheduler.
+func (c *GrpcClient) Heartbeat() (models.ExecutorHeartbeatResponse, error) {
+	ctx, cancel := c.callContext()
+	defer cancel()
+	resp, err := c.client.Heartbeat(ctx, &models.ExecutorHeartbeat{
+		ExecutorId: c.executorId,
+	})
+	if status.Code(err) == codes.NotFound {
+		return models.ExecutorHeartbeatResponse{}, ErrExecutorNotRegistered
+	}
+	if err != nil {
+		return models.ExecutorHeartbeatResponse{}, grpcError("Heartbeat", err)
+	}
+	return *resp, nil
+}
+
+// GetTask gets new task from the scheduler. If there is no task,
+// ds.ErrQueueIsEmpty is returned.
+func (c *GrpcClient) GetTask() (models.TaskToExec, error) {
+	return c.GetTaskContext(context.Background())
+}
+
+// GetTaskContext works as GetTask, but waiting for the task is aborted, when
+// given context is done.
+func (c *GrpcClient) GetTaskContext(
+	ctx context.Context,
+) (models.TaskToExec, error) {
+	ttes, err := c.GetTasksContext(ctx, 1)
+	if err != nil {
+		return models.TaskToExec{}, err
+	}
+	return ttes[0], nil
+}
+
+// GetTasks gets at most maxTasks tasks from the scheduler, over Dispatch
+// stream. If there are no tasks, ds.ErrQueueIsEmpty is returned. Broken
+// stream is opened again on the next call.
+func (c *GrpcClient) GetTasks(maxTasks int) ([]models.TaskToExec, error) {
+	return c.GetTasksContext(context.Background(), maxTasks)
+}
+
+// GetTasksContext works as GetTasks, but waiting for tasks is aborted, when
+// given context is done. In that case Dispatch stream is closed and the
+// context error is returned.
+func (c *GrpcClient) GetTasksContext(
+	ctx context.Context, maxTasks int,
+) ([]models.TaskToExec, error) {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+	if c.dispatch == nil {
+		streamCtx, cancel := context.WithCancel(c.streamContext())
+		stream, err := c.client.Dispatch(streamCtx)
+		if err != nil {
+			cancel()
+			return nil, grpcError("Dispatch", err)
+		}
+		c.dispatch = stream
+		c.dispatchCancel = cancel
+	}
+	stop := context.AfterFunc(ctx, c.dispatchCancel)
+	defer stop()
+	sErr := c.dispatch.Send(&models.PopTasksRequest{
+		ExecutorId: c.executorId,
+		Labels:     c.labels,
+		MaxTasks:   maxTasks,
+		WaitMs:     int(c.popWait.Milliseconds()),
+	})
+	if sErr != nil {
+		c.closeDispatch()
+		return nil, dispatchError(ctx, sErr)
+	}
+	batch, rErr := c.dispatch.Recv()
+	if rErr != nil {
+		c.closeDispatch()
+		return nil, dispatchError(ctx, rErr)
+	}
+	if len(batch.Tasks) == 0 {
+		return nil, ds.ErrQueueIsEmpty
+	}
+	return batch.Tasks, nil
+}
+
+// Cancels and forgets Dispatch stream, so it's opened again on the next
+// call. It has to be called with dispatchMu locked.
+func (c *GrpcClient) closeDispatch() {
+	if c.dispatchCancel != nil {
+		c.dispatchCancel()
+	}
+	c.dispatch = nil
+	c.dispatchCancel = nil
+}
+
+// Returns context error, if Dispatch stream was broken, because given context
+// is done. Otherwise gRPC error is returned.
+func dispatchError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return grpcError("Dispatch", err)
+}
+
+// UpdateTaskStatus updates status of given task.
+func (c *GrpcClient) UpdateTaskStatus(
+	tte models.TaskToExec, status string,
+) error {
+	failed, err := c.UpdateTaskStatuses([]models.DagRunTaskStatus{{
+		DagId:   tte.DagId,
+		ExecTs:  tte.ExecTs,
+		TaskId:  tte.TaskId,
+		Status:  status,
+		LeaseId: tte.LeaseId,
+	}})
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return errors.New(failed[0].Error)
+	}
+	return nil
+}
+
+// UpdateTaskStatuses updates statuses of many tasks in a single call.
+// Returns list of updates which failed on the scheduler side.
+func (c *GrpcClient) UpdateTaskStatuses(
+	updates []models.DagRunTaskStatus,
+) ([]models.DagRunTaskStatusError, error) {
+	ctx, cancel := c.callContext()
+	defer cancel()
+	result, err := c.client.UpdateTaskStatuses(ctx, &models.TaskStatusBatch{
+		Updates: updates,
+	})
+	if err != nil {
+		return nil, grpcError("UpdateTaskStatuses", err)
+	}
+	return result.Failed, nil
+}
+
+// AckTask acknowledges receipt of the task. If ErrLeaseExpired is returned,
+// then the task should not be executed.
+func (c *GrpcClient) AckTask(tte models.TaskToExec) (models.TaskLease, error) {
+	return c.extendLease("AckTask", tte, c.client.AckTask)
+}
+
+// RenewTaskLease renews lease on the task which is being executed.
+func (c *GrpcClient) RenewTaskLease(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	return c.extendLease("RenewTaskLease", tte, c.client.RenewTaskLease)
+}
+
+// ReleaseTaskLease releases lease on the task which won't be finished by this
+// executor.
+func (c *GrpcClient) ReleaseTaskLease(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	return c.extendLease("ReleaseTaskLease", tte, c.client.ReleaseTaskLease)
+}
+
+func (c *GrpcClient) extendLease(
+	method string,
+	tte models.TaskToExec,
+	call func(context.Context, *models.LeaseRequest) (*models.TaskLease, error),
+) (models.TaskLease, error) {
+	ctx, cancel := c.callContext()
+	defer cancel()
+	lease, err := call(ctx, &models.LeaseRequest{LeaseId: tte.LeaseId})
+	if status.Code(err) == codes.NotFound {
+		return models.TaskLease{}, ErrLeaseExpired
+	}
+	if err != nil {
+		return models.TaskLease{}, grpcError(method, err)
+	}
+	return *lease, nil
+}
+
+// SendTaskLog sends single line of task output to the scheduler, over
+// StreamLogs stream. Broken stream is opened again on the next call.
+func (c *GrpcClient) SendTaskLog(taskLog models.TaskLog) error {
+	c.logsMu.Lock()
+	defer c.logsMu.Unlock()
+	if c.logs == nil {
+		stream, err := c.client.StreamLogs(c.streamContext())
+		if err != nil {
+			return grpcError("StreamLogs", err)
+		}
+		c.logs = stream
+	}
+	if err := c.logs.Send(&taskLog); err != nil {
+		c.logs = nil
+		return grpcError("StreamLogs", err)
+	}
+	return nil
+}
+
+// Close closes streams and the connection to the scheduler.
+func (c *GrpcClient) Close() error {
+	c.logsMu.Lock()
+	if c.logs != nil {
+		if _, err := c.logs.CloseAndRecv(); err != nil && err != io.EOF {
+			slog.Warn("Cannot close task logs stream", "err", err)
+		}
+		c.logs = nil
+	}
+	c.logsMu.Unlock()
+	return c.conn.Close()
+}
+
+// Returns context for unary calls with request timeout, negotiated protocol
+// version and credentials.
+func (c *GrpcClient) callContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	return c.withMetadata(ctx), cancel
+}
+
+// Returns context for long-lived streams.
+func (c *GrpcClient) streamContext() context.Context {
+	return c.withMetadata(context.Background())
+}
+
+func (c *GrpcClient) withMetadata(ctx context.Context) context.Context {
+	kv := make([]string, 0, 4)
+	if c.protocolVersion > 0 {
+		kv = append(kv, grpcapi.ProtocolVersionKey,
+			strconv.Itoa(c.protocolVersion))
+	}
+	if c.bearerToken != "" {
+		kv = append(kv, "authorization", "Bearer "+c.bearerToken)
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// Converts error of gRPC call. Errors of incompatible protocol wrap
+// version.ErrIncompatibleProtocol.
+func grpcError(method string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("gRPC %s: %w", method, err)
+	}
+	if st.Code() == codes.FailedPrecondition {
+		return fmt.Errorf("gRPC %s: %s: %w", method, st.Message(),
+			version.ErrIncompatibleProtocol)
+	}
+	return fmt.Errorf("gRPC %s failed with %s: %s", method, st.Code(),
+		st.Message())
+}
@@ -0,0 +1,230 @@
+package exec
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	osexec "os/exec"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/models"
+)
+
+// Environment variables used to run a single task in a child process.
+const (
+	envIsolatedDagId    = "SCHEDULER_ISOLATED_DAG_ID"
+	envIsolatedExecTs   = "SCHEDULER_ISOLATED_EXEC_TS"
+	envIsolatedTaskId   = "SCHEDULER_ISOLATED_TASK_ID"
+	envIsolatedParams   = "SCHEDULER_ISOLATED_PARAMS"
+	envIsolatedRendered = "SCHEDULER_ISOLATED_RENDERED"
+	envIsolatedMemLimit = "SCHEDULER_ISOLATED_MEMORY_LIMIT_BYTES"
+	envIsolatedCpuLimit = "SCHEDULER_ISOLATED_CPU_LIMIT_SECONDS"
+)
+
+// Exit codes of isolated task process.
+const (
+	isolatedExitSuccess    = 0
+	isolatedExitTaskFailed = 1
+	isolatedExitSetupError = 2
+)
+
+// RunIsolatedTask executes a single task and exits the process, when the
+// process has been started by the executor in isolation mode (see
+// Config.IsolateTasks). Otherwise it does nothing. It should be called at the
+// beginning of the main function of the executor binary, after DAGs are
+// registered.
+func RunIsolatedTask() {
+	if !isIsolatedTaskProcess() {
+		return
+	}
+	dagId := os.Getenv(envIsolatedDagId)
+	os.Exit(runIsolatedTask(dagId, os.Getenv(envIsolatedExecTs),
+		os.Getenv(envIsolatedTaskId), os.Getenv(envIsolatedParams),
+		os.Getenv(envIsolatedRendered)))
+}
+
+// Checks whether current process has been started by the executor to run
+// a single isolated task.
+func isIsolatedTaskProcess() bool {
+	_, isChild := os.LookupEnv(envIsolatedDagId)
+	return isChild
+}
+
+// Exits the process with isolatedExitSetupError, when it's an isolated task
+// process which reached executor's main loop. That happens when the main
+// function of the executor binary doesn't call RunIsolatedTask. Without this
+// check each isolated task would start another executor which would pop and
+// run more tasks recursively.
+func exitIfIsolatedTaskProcess() {
+	if !isIsolatedTaskProcess() {
+		return
+	}
+	slog.Error("Executor started in isolated task process. RunIsolatedTask " +
+		"has to be called at the beginning of the main function")
+	os.Exit(isolatedExitSetupError)
+}
+
+func runIsolatedTask(
+	dagId, execTs, taskId, params, renderedJson string,
+) (exitCode int) {
+	if err := applyLimitsFromEnv(); err != nil {
+		slog.Error("Cannot set isolated task limits", "err", err)
+		return isolatedExitSetupError
+	}
+	d, dErr := dag.Get(dag.Id(dagId))
+	if dErr != nil {
+		slog.Error("Could not get DAG from registry", "dagId", dagId)
+		return isolatedExitSetupError
+	}
+	task, tErr := d.GetTask(taskId)
+	if tErr != nil {
+		slog.Error("Could not get task from DAG", "dagId", dagId, "taskId",
+			taskId)
+		return isolatedExitSetupError
+	}
+	stored, pErr := dag.ParseParams(params)
+	if pErr != nil {
+		slog.Error("Could not parse dag run parameters. Using defaults",
+			"dagId", dagId, "err", pErr)
+	}
+	rendered, rErr := dag.ParseRendered(renderedJson)
+	if rErr != nil {
+		slog.Error("Could not parse rendered task templates", "dagId", dagId,
+			"taskId", taskId, "err", rErr)
+		return isolatedExitSetupError
+	}
+	ctx := dag.ContextWithParams(context.Background(), d.RunParams(stored))
+	ctx = dag.ContextWithRendered(ctx, rendered)
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered from panic:", "err", r, "stack",
+				string(debug.Stack()))
+			exitCode = isolatedExitTaskFailed
+		}
+	}()
+	slog.Info("Start executing isolated task", "dagId", dagId, "execTs",
+		execTs, "taskId", taskId)
+	dag.ExecuteTask(ctx, task)
+	return isolatedExitSuccess
+}
+
+// Sets process limits based on environment variables.
+func applyLimitsFromEnv() error {
+	memLimit, mErr := parseUintEnv(envIsolatedMemLimit)
+	if mErr != nil {
+		return mErr
+	}
+	cpuLimit, cErr := parseUintEnv(envIsolatedCpuLimit)
+	if cErr != nil {
+		return cErr
+	}
+	return setLimits(memLimit, cpuLimit)
+}
+
+func parseUintEnv(name string) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("incorrect value of %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// Executes given task in a child process which is the same binary as the
+// executor. Output of the child process is logged line by line. Non-nil error
+// is returned when the process couldn't be started or the task has failed.
+// The process is killed, when given context is cancelled.
+func (e *Executor) executeIsolated(
+	ctx context.Context, tte models.TaskToExec,
+) error {
+	binary, bErr := os.Executable()
+	if bErr != nil {
+		return fmt.Errorf("cannot find executor binary: %w", bErr)
+	}
+	cmd := osexec.CommandContext(ctx, binary)
+	cmd.Env = append(os.Environ(),
+		envIsolatedDagId+"="+tte.DagId,
+		envIsolatedExecTs+"="+tte.ExecTs,
+		envIsolatedTaskId+"="+tte.TaskId,
+		envIsolatedParams+"="+tte.Params,
+		envIsolatedRendered+"="+tte.Rendered,
+	)
+	if e.config.TaskMemoryLimitBytes > 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", envIsolatedMemLimit,
+			e.config.TaskMemoryLimitBytes))
+	}
+	if e.config.TaskCpuTimeLimit > 0 {
+		seconds := uint64((e.config.TaskCpuTimeLimit + time.Second - 1) /
+			time.Second)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", envIsolatedCpuLimit,
+			seconds))
+	}
+	stdout, oErr := cmd.StdoutPipe()
+	if oErr != nil {
+		return oErr
+	}
+	stderr, sErr := cmd.StderrPipe()
+	if sErr != nil {
+		return sErr
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start isolated task process: %w", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go e.streamLogs(&wg, tte, "stdout", stdout)
+	go e.streamLogs(&wg, tte, "stderr", stderr)
+	wg.Wait()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("isolated task process: %w", err)
+	}
+	return nil
+}
+
+// taskLogSender is implemented by scheduler clients which can send task
+// output to the scheduler (GrpcClient).
+type taskLogSender interface {
+	SendTaskLog(taskLog models.TaskLog) error
+}
+
+// Logs output of isolated task process line by line. When the scheduler
+// client supports it, output is also sent to the scheduler.
+func (e *Executor) streamLogs(
+	wg *sync.WaitGroup, tte models.TaskToExec, stream string, r io.Reader,
+) {
+	defer wg.Done()
+	sender, canSend := e.schedClient.(taskLogSender)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		slog.Info("Task output", "taskToExec", tte, "stream", stream, "line",
+			scanner.Text())
+		if !canSend {
+			continue
+		}
+		sErr := sender.SendTaskLog(models.TaskLog{
+			DagId:  tte.DagId,
+			ExecTs: tte.ExecTs,
+			TaskId: tte.TaskId,
+			Stream: stream,
+			Line:   scanner.Text(),
+		})
+		if sErr != nil {
+			slog.Warn("Cannot send task output to the scheduler",
+				"taskToExec", tte, "err", sErr)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Error("Cannot read task output", "taskToExec", tte, "stream",
+			stream, "err", err)
+	}
+}
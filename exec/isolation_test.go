@@ -0,0 +1,212 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/models"
+)
+
+// When set, the test binary simulates executor binary which doesn't call
+// RunIsolatedTask in its main function.
+const envTestSkipRunIsolatedTask = "SCHEDULER_TEST_SKIP_RUN_ISOLATED_TASK"
+
+const isolationTestDagId = "isolation_test_dag"
+
+// DAGs registered in both the test process and isolated task processes
+// started from the test binary.
+var isolationTestDags = []dag.Dag{isolationTestDag()}
+
+// TestMain turns the test binary into an executor binary. Isolated tasks
+// started by tests re-execute the test binary, which runs the task in
+// RunIsolatedTask and exits before running any test.
+func TestMain(m *testing.M) {
+	for _, d := range isolationTestDags {
+		if addErr := dag.Add(d); addErr != nil {
+			fmt.Fprintf(os.Stderr, "Cannot add DAG to the registry: %s\n",
+				addErr.Error())
+			os.Exit(1)
+		}
+	}
+	if os.Getenv(envTestSkipRunIsolatedTask) != "" {
+		e := newTestExecutor(&fakeScheduler{}, Config{})
+		e.Run(context.Background())
+		os.Exit(0)
+	}
+	RunIsolatedTask()
+	os.Exit(m.Run())
+}
+
+// Task which prints DAG run parameters and rendered templates.
+type echoTask struct{ TaskId string }
+
+func (et echoTask) Id() string { return et.TaskId }
+func (et echoTask) Execute()   {}
+func (et echoTask) ExecuteContext(ctx context.Context) {
+	params := dag.ParamsFromContext(ctx)
+	rendered := dag.RenderedFromContext(ctx)
+	fmt.Printf("customerId=%s limit=%d partition=%s\n",
+		params.String("customerId"), params.Int("limit"),
+		rendered["partition"])
+}
+
+type panicTask struct{ TaskId string }
+
+func (pt panicTask) Id() string { return pt.TaskId }
+func (pt panicTask) Execute()   { panic("task failed") }
+
+func isolationTestDag() dag.Dag {
+	root := &dag.Node{Task: echoTask{"echo"}}
+	root.Next(&dag.Node{Task: panicTask{"panic"}})
+	return dag.New(isolationTestDagId).
+		AddRoot(root).
+		AddAttributes(dag.Attr{Params: map[string]dag.Param{
+			"customerId": {Type: dag.ParamString, Default: "c1"},
+			"limit":      {Type: dag.ParamInt, Default: 10},
+		}}).Done()
+}
+
+// logRecordingScheduler is fakeScheduler which also records task output.
+type logRecordingScheduler struct {
+	*fakeScheduler
+	logs []models.TaskLog
+}
+
+func (ls *logRecordingScheduler) SendTaskLog(taskLog models.TaskLog) error {
+	ls.Lock()
+	defer ls.Unlock()
+	ls.logs = append(ls.logs, taskLog)
+	return nil
+}
+
+func (ls *logRecordingScheduler) stdout() []string {
+	ls.Lock()
+	defer ls.Unlock()
+	lines := make([]string, 0, len(ls.logs))
+	for _, taskLog := range ls.logs {
+		if taskLog.Stream == "stdout" {
+			lines = append(lines, taskLog.Line)
+		}
+	}
+	return lines
+}
+
+func isolatedTaskToExec(taskId string) models.TaskToExec {
+	return models.TaskToExec{
+		DagId:  isolationTestDagId,
+		ExecTs: "2023-10-05T12:00:00UTC+00:00",
+		TaskId: taskId,
+	}
+}
+
+func runIsolated(
+	t *testing.T, config Config, tte models.TaskToExec,
+) ([]string, error) {
+	t.Helper()
+	ls := &logRecordingScheduler{fakeScheduler: &fakeScheduler{}}
+	config.IsolateTasks = true
+	e := newTestExecutor(ls, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := e.executeIsolated(ctx, tte)
+	return ls.stdout(), err
+}
+
+func exitCode(t *testing.T, err error) int {
+	t.Helper()
+	if err == nil {
+		return isolatedExitSuccess
+	}
+	var exitErr *osexec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Expected process exit error, got: %s", err.Error())
+	}
+	return exitErr.ExitCode()
+}
+
+func TestIsolatedTaskParamsAndRendered(t *testing.T) {
+	tte := isolatedTaskToExec("echo")
+	tte.Params = `{"customerId":"c42","limit":5}`
+	tte.Rendered = `{"partition":"dt=20231005"}`
+	stdout, err := runIsolated(t, Config{}, tte)
+	if err != nil {
+		t.Fatalf("Expected isolated task to succeed, got: %s", err.Error())
+	}
+	expected := "customerId=c42 limit=5 partition=dt=20231005"
+	if len(stdout) != 1 || stdout[0] != expected {
+		t.Errorf("Expected task output [%s], got %v", expected, stdout)
+	}
+}
+
+func TestIsolatedTaskDefaultParams(t *testing.T) {
+	stdout, err := runIsolated(t, Config{}, isolatedTaskToExec("echo"))
+	if err != nil {
+		t.Fatalf("Expected isolated task to succeed, got: %s", err.Error())
+	}
+	expected := "customerId=c1 limit=10 partition="
+	if len(stdout) != 1 || stdout[0] != expected {
+		t.Errorf("Expected task output [%s], got %v", expected, stdout)
+	}
+}
+
+func TestIsolatedTaskExitCodes(t *testing.T) {
+	cases := []struct {
+		name     string
+		tte      models.TaskToExec
+		exitCode int
+	}{
+		{"success", isolatedTaskToExec("echo"), isolatedExitSuccess},
+		{"panic", isolatedTaskToExec("panic"), isolatedExitTaskFailed},
+		{"unknown task", isolatedTaskToExec("unknown"), isolatedExitSetupError},
+		{"unknown dag", models.TaskToExec{DagId: "unknown_dag", TaskId: "echo"},
+			isolatedExitSetupError},
+	}
+	for _, c := range cases {
+		_, err := runIsolated(t, Config{}, c.tte)
+		if code := exitCode(t, err); code != c.exitCode {
+			t.Errorf("[%s] Expected exit code %d, got %d", c.name,
+				c.exitCode, code)
+		}
+	}
+}
+
+func TestIsolatedTaskInvalidRendered(t *testing.T) {
+	tte := isolatedTaskToExec("echo")
+	tte.Rendered = "{"
+	_, err := runIsolated(t, Config{}, tte)
+	if code := exitCode(t, err); code != isolatedExitSetupError {
+		t.Errorf("Expected exit code %d, got %d", isolatedExitSetupError, code)
+	}
+}
+
+func TestIsolatedProcessWithoutRunIsolatedTaskFailsFast(t *testing.T) {
+	binary, bErr := os.Executable()
+	if bErr != nil {
+		t.Fatalf("Cannot find test binary: %s", bErr.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := osexec.CommandContext(ctx, binary)
+	cmd.Env = append(os.Environ(),
+		envTestSkipRunIsolatedTask+"=1",
+		envIsolatedDagId+"="+isolationTestDagId,
+		envIsolatedTaskId+"=echo",
+	)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatal("Expected isolated process to exit, it's still running")
+	}
+	if code := exitCode(t, err); code != isolatedExitSetupError {
+		t.Errorf("Expected exit code %d, got %d", isolatedExitSetupError, code)
+	}
+	if !strings.Contains(string(out), "RunIsolatedTask") {
+		t.Errorf("Expected error about missing RunIsolatedTask, got: %s", out)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package exec
+
+import "log/slog"
+
+// Process limits are not supported on this platform, isolated tasks run
+// without limits.
+func setLimits(memoryBytes, cpuSeconds uint64) error {
+	if memoryBytes > 0 || cpuSeconds > 0 {
+		slog.Warn("Process limits are not supported on this platform")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package exec
+
+import "syscall"
+
+// Sets limits of virtual memory (in bytes) and CPU time (in seconds) of the
+// current process. Zero means no limit.
+func setLimits(memoryBytes, cpuSeconds uint64) error {
+	if memoryBytes > 0 {
+		limit := syscall.Rlimit{Cur: memoryBytes, Max: memoryBytes}
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &limit); err != nil {
+			return err
+		}
+	}
+	if cpuSeconds > 0 {
+		limit := syscall.Rlimit{Cur: cpuSeconds, Max: cpuSeconds}
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package exec
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+)
+
+const limitsTestDagId = "isolation_limits_test_dag"
+
+func init() {
+	isolationTestDags = append(isolationTestDags, dag.New(limitsTestDagId).
+		AddRoot(&dag.Node{Task: limitsTask{"limits"}}).Done())
+}
+
+// Task which prints its process memory and CPU time limits.
+type limitsTask struct{ TaskId string }
+
+func (lt limitsTask) Id() string { return lt.TaskId }
+func (lt limitsTask) Execute() {
+	var mem, cpu syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_AS, &mem); err != nil {
+		panic(err)
+	}
+	if err := syscall.Getrlimit(syscall.RLIMIT_CPU, &cpu); err != nil {
+		panic(err)
+	}
+	fmt.Println(mem.Cur, cpu.Cur)
+}
+
+func TestIsolatedTaskLimits(t *testing.T) {
+	const memLimit = 8 << 30
+	tte := isolatedTaskToExec("limits")
+	tte.DagId = limitsTestDagId
+	stdout, err := runIsolated(t, Config{
+		TaskMemoryLimitBytes: memLimit,
+		TaskCpuTimeLimit:     90*time.Second + time.Millisecond,
+	}, tte)
+	if err != nil {
+		t.Fatalf("Expected isolated task to succeed, got: %s", err.Error())
+	}
+	// CPU time limit is rounded up to full seconds
+	expected := strconv.Itoa(memLimit) + " 91"
+	if len(stdout) != 1 || stdout[0] != expected {
+		t.Errorf("Expected task output [%s], got %v", expected, stdout)
+	}
+}
+
+func TestIsolatedTaskWithoutLimits(t *testing.T) {
+	var mem, cpu syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_AS, &mem); err != nil {
+		t.Fatalf("Cannot get memory limit: %s", err.Error())
+	}
+	if err := syscall.Getrlimit(syscall.RLIMIT_CPU, &cpu); err != nil {
+		t.Fatalf("Cannot get CPU time limit: %s", err.Error())
+	}
+	tte := isolatedTaskToExec("limits")
+	tte.DagId = limitsTestDagId
+	stdout, err := runIsolated(t, Config{}, tte)
+	if err != nil {
+		t.Fatalf("Expected isolated task to succeed, got: %s", err.Error())
+	}
+	expected := fmt.Sprintf("%d %d", mem.Cur, cpu.Cur)
+	if len(stdout) != 1 || stdout[0] != expected {
+		t.Errorf("Expected inherited limits [%s], got %v", expected, stdout)
+	}
+}
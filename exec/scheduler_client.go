@@ -2,25 +2,77 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dskrzypiec/scheduler/ds"
 	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
 )
 
 const (
-	getTaskEndpoint          = "/dag/task/pop"
-	updateTaskStatusEndpoint = "/dag/task/update"
+	getTaskEndpoint           = "/dag/task/pop"
+	updateTaskStatusEndpoint  = "/dag/task/update"
+	getTasksEndpoint          = "/dag/task/popmany"
+	updateTasksEndpoint       = "/dag/task/updatemany"
+	ackTaskEndpoint           = "/dag/task/ack"
+	renewTaskLeaseEndpoint    = "/dag/task/renew"
+	releaseTaskLeaseEndpoint  = "/dag/task/release"
+	registerExecutorEndpoint  = "/executor/register"
+	executorHeartbeatEndpoint = "/executor/heartbeat"
+	protocolEndpoint          = "/protocol"
 )
 
+// ErrExecutorNotRegistered is returned by Heartbeat, when the scheduler does
+// not know the executor (or it already considered the executor dead).
+var ErrExecutorNotRegistered = errors.New("executor is not registered")
+
+// ErrLeaseExpired is returned by AckTask and RenewTaskLease, when the lease
+// has already expired and the task has been put back onto the queue.
+var ErrLeaseExpired = errors.New("task lease has expired")
+
+// SchedulerError is an error returned by the scheduler in models.ErrorResponse
+// envelope.
+type SchedulerError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *SchedulerError) Error() string {
+	return fmt.Sprintf("scheduler error %d %s: %s", e.StatusCode, e.Code,
+		e.Message)
+}
+
+// Unwrap makes errors.Is(err, version.ErrIncompatibleProtocol) true for
+// scheduler errors of incompatible protocol.
+func (e *SchedulerError) Unwrap() error {
+	if e.Code == models.ErrCodeIncompatibleProtocol {
+		return version.ErrIncompatibleProtocol
+	}
+	return nil
+}
+
 type SchedulerClient struct {
 	httpClient   *http.Client
 	schedulerUrl string
+	executorId   string
+	labels       []string
+	popWait      time.Duration
+	bearerToken  string
+
+	// Negotiated protocol version. Zero means the handshake has not been
+	// done yet.
+	protocolVersion int
 }
 
 // Instantiate new Client.
@@ -36,16 +88,44 @@ func NewSchedulerClient(
 	}
 }
 
+// SetLabels sets labels advertised by the client on getting new tasks. Only
+// tasks which require a subset of those labels are returned by the scheduler.
+func (c *SchedulerClient) SetLabels(labels []string) {
+	c.labels = labels
+}
+
+// SetPopWait sets how long the scheduler may hold GetTask request, waiting for
+// a task, when the queue is empty. It should be shorter than HTTP client
+// timeout. Zero means GetTask returns immediately.
+func (c *SchedulerClient) SetPopWait(wait time.Duration) {
+	c.popWait = wait
+}
+
+// SetBearerToken sets token sent in Authorization header of each request,
+// when the scheduler requires authentication.
+func (c *SchedulerClient) SetBearerToken(token string) {
+	c.bearerToken = token
+}
+
 // GetTask gets new task from scheduler to be executed by executor.
 func (c *SchedulerClient) GetTask() (models.TaskToExec, error) {
+	return c.GetTaskContext(context.Background())
+}
+
+// GetTaskContext works as GetTask, but the request is aborted, when given
+// context is done. It's useful for long polling (see SetPopWait).
+func (c *SchedulerClient) GetTaskContext(
+	ctx context.Context,
+) (models.TaskToExec, error) {
 	startTs := time.Now()
 	var taskToExec models.TaskToExec
 
-	resp, err := c.httpClient.Get(c.getTaskUrl())
+	resp, err := c.do(ctx, "GET", c.getTaskUrl(), "", nil)
 	if err != nil {
 		slog.Error("GetTask failed", "err", err)
 		return taskToExec, err
 	}
+	defer resp.Body.Close()
 
 	body, rErr := io.ReadAll(resp.Body)
 	if rErr != nil {
@@ -60,8 +140,8 @@ func (c *SchedulerClient) GetTask() (models.TaskToExec, error) {
 	if resp.StatusCode != http.StatusOK {
 		slog.Error("Got status code != 200 on GetTask response", "statuscode",
 			resp.StatusCode, "body", string(body))
-		return taskToExec, fmt.Errorf("got %d status code in GetTask response",
-			resp.StatusCode)
+		return taskToExec, responseError(resp.StatusCode, "GET",
+			getTaskEndpoint, body)
 	}
 
 	jErr := json.Unmarshal(body, &taskToExec)
@@ -81,16 +161,17 @@ func (c *SchedulerClient) UpdateTaskStatus(
 	start := time.Now()
 	slog.Debug("Start updating task status", "taskToExec", tte, "status", status)
 	drts := models.DagRunTaskStatus{
-		DagId:  tte.DagId,
-		ExecTs: tte.ExecTs,
-		TaskId: tte.TaskId,
-		Status: status,
+		DagId:   tte.DagId,
+		ExecTs:  tte.ExecTs,
+		TaskId:  tte.TaskId,
+		Status:  status,
+		LeaseId: tte.LeaseId,
 	}
 	drtsJson, jErr := json.Marshal(drts)
 	if jErr != nil {
 		return fmt.Errorf("cannot marshal DagRunTaskStatus: %s", jErr.Error())
 	}
-	resp, postErr := c.httpClient.Post(
+	resp, postErr := c.post(
 		c.getUpdateTaskStatusUrl(),
 		"application/json",
 		bytes.NewBuffer(drtsJson),
@@ -106,16 +187,331 @@ func (c *SchedulerClient) UpdateTaskStatus(
 			updateTaskStatusEndpoint, rErr.Error())
 	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error with status %s for POST %s: %s",
-			resp.Status, updateTaskStatusEndpoint, string(body))
+		return responseError(resp.StatusCode, "POST",
+			updateTaskStatusEndpoint, body)
 	}
 	slog.Debug("Updated task status", "taskToExec", tte, "status", status,
 		"duration", time.Since(start))
 	return nil
 }
 
+// GetTasks gets at most maxTasks tasks from scheduler to be executed by
+// executor. If there are no tasks, ds.ErrQueueIsEmpty is returned.
+func (c *SchedulerClient) GetTasks(maxTasks int) ([]models.TaskToExec, error) {
+	return c.GetTasksContext(context.Background(), maxTasks)
+}
+
+// GetTasksContext works as GetTasks, but the request is aborted, when given
+// context is done.
+func (c *SchedulerClient) GetTasksContext(
+	ctx context.Context, maxTasks int,
+) ([]models.TaskToExec, error) {
+	startTs := time.Now()
+	resp, err := c.do(ctx, "GET", c.getTasksUrl(maxTasks), "", nil)
+	if err != nil {
+		slog.Error("GetTasks failed", "err", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, rErr := io.ReadAll(resp.Body)
+	if rErr != nil {
+		slog.Error("Could not read GetTasks response body", "err", rErr)
+		return nil, rErr
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, ds.ErrQueueIsEmpty
+	}
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Got status code != 200 on GetTasks response", "statuscode",
+			resp.StatusCode, "body", string(body))
+		return nil, responseError(resp.StatusCode, "GET", getTasksEndpoint,
+			body)
+	}
+	var ttes []models.TaskToExec
+	jErr := json.Unmarshal(body, &ttes)
+	if jErr != nil {
+		return nil, fmt.Errorf("couldn't unmarshal into []models.TaskToExec: %s",
+			jErr.Error())
+	}
+	slog.Debug("GetTasks finished", "tasks", len(ttes), "duration",
+		time.Since(startTs))
+	return ttes, nil
+}
+
+// UpdateTaskStatuses updates statuses of many tasks in a single request.
+// Returns list of updates which failed on the scheduler side.
+func (c *SchedulerClient) UpdateTaskStatuses(
+	updates []models.DagRunTaskStatus,
+) ([]models.DagRunTaskStatusError, error) {
+	start := time.Now()
+	statusCode, body, err := c.postJson(updateTasksEndpoint, updates)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, responseError(statusCode, "POST", updateTasksEndpoint,
+			body)
+	}
+	var failed []models.DagRunTaskStatusError
+	jErr := json.Unmarshal(body, &failed)
+	if jErr != nil {
+		return nil, fmt.Errorf(
+			"couldn't unmarshal into []models.DagRunTaskStatusError: %s",
+			jErr.Error())
+	}
+	slog.Debug("Updated task statuses", "updates", len(updates), "failed",
+		len(failed), "duration", time.Since(start))
+	return failed, nil
+}
+
+// AckTask acknowledges receipt of the task. It should be called right after
+// getting the task, before executing it. If ErrLeaseExpired is returned, then
+// the task should not be executed.
+func (c *SchedulerClient) AckTask(tte models.TaskToExec) (models.TaskLease, error) {
+	return c.extendLease(ackTaskEndpoint, tte.LeaseId)
+}
+
+// RenewTaskLease renews lease on the task which is being executed.
+func (c *SchedulerClient) RenewTaskLease(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	return c.extendLease(renewTaskLeaseEndpoint, tte.LeaseId)
+}
+
+// ReleaseTaskLease releases lease on the task which won't be finished by this
+// executor. The scheduler puts the task back onto the queue.
+func (c *SchedulerClient) ReleaseTaskLease(
+	tte models.TaskToExec,
+) (models.TaskLease, error) {
+	return c.extendLease(releaseTaskLeaseEndpoint, tte.LeaseId)
+}
+
+func (c *SchedulerClient) extendLease(
+	endpoint, leaseId string,
+) (models.TaskLease, error) {
+	var lease models.TaskLease
+	endpointWithLease := fmt.Sprintf("%s?leaseId=%s", endpoint,
+		url.QueryEscape(leaseId))
+	statusCode, body, err := c.postJson(endpointWithLease, nil)
+	if err != nil {
+		return lease, err
+	}
+	if statusCode == http.StatusNotFound {
+		return lease, ErrLeaseExpired
+	}
+	if statusCode != http.StatusOK {
+		return lease, responseError(statusCode, "POST", endpoint, body)
+	}
+	jErr := json.Unmarshal(body, &lease)
+	if jErr != nil {
+		return lease, fmt.Errorf("couldn't unmarshal into models.TaskLease: %s",
+			jErr.Error())
+	}
+	return lease, nil
+}
+
+// Register registers executor in the scheduler. After successful
+// registration, tasks popped by this client are owned by registered executor.
+func (c *SchedulerClient) Register(info models.ExecutorInfo) error {
+	start := time.Now()
+	slog.Debug("Start registering executor", "executorInfo", info)
+	statusCode, body, err := c.postJson(registerExecutorEndpoint, info)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return responseError(statusCode, "POST", registerExecutorEndpoint,
+			body)
+	}
+	c.executorId = info.ExecutorId
+	slog.Debug("Registered executor", "executorInfo", info, "duration",
+		time.Since(start))
+	return nil
+}
+
+// Heartbeat sends heartbeat of registered executor to the scheduler. If the
+// scheduler does not know the executor, ErrExecutorNotRegistered is returned
+// and executor should register again. Response contains tasks of the
+// executor cancelled by the scheduler. Older schedulers respond with empty
+// body, which means there is nothing to cancel.
+func (c *SchedulerClient) Heartbeat() (
+	models.ExecutorHeartbeatResponse, error,
+) {
+	var resp models.ExecutorHeartbeatResponse
+	hb := models.ExecutorHeartbeat{ExecutorId: c.executorId}
+	statusCode, body, err := c.postJson(executorHeartbeatEndpoint, hb)
+	if err != nil {
+		return resp, err
+	}
+	if statusCode == http.StatusNotFound {
+		return resp, ErrExecutorNotRegistered
+	}
+	if statusCode != http.StatusOK {
+		return resp, responseError(statusCode, "POST",
+			executorHeartbeatEndpoint, body)
+	}
+	if len(body) == 0 {
+		return resp, nil
+	}
+	if jErr := json.Unmarshal(body, &resp); jErr != nil {
+		return resp, fmt.Errorf("couldn't unmarshal into "+
+			"models.ExecutorHeartbeatResponse: %s", jErr.Error())
+	}
+	return resp, nil
+}
+
+// Handshake negotiates protocol version with the scheduler. It should be
+// called before any other request. Schedulers which don't support handshake
+// are considered to be in protocol version 1. If there is no common protocol
+// version, version.ErrIncompatibleProtocol is returned.
+func (c *SchedulerClient) Handshake() (models.ProtocolInfo, error) {
+	info := models.ProtocolInfo{ProtocolVersion: 1, MinProtocolVersion: 1}
+	resp, err := c.get(fmt.Sprintf("%s%s", c.schedulerUrl, protocolEndpoint))
+	if err != nil {
+		return info, fmt.Errorf("could not do GET %s request: %s",
+			protocolEndpoint, err)
+	}
+	defer resp.Body.Close()
+	body, rErr := io.ReadAll(resp.Body)
+	if rErr != nil {
+		return info, fmt.Errorf("cannot read GET %s response body: %s",
+			protocolEndpoint, rErr.Error())
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if jErr := json.Unmarshal(body, &info); jErr != nil {
+			return info, fmt.Errorf(
+				"couldn't unmarshal into models.ProtocolInfo: %s", jErr.Error())
+		}
+	case http.StatusNotFound:
+		slog.Warn("Scheduler does not support protocol handshake. Assuming " +
+			"protocol version 1")
+	default:
+		return info, responseError(resp.StatusCode, "GET", protocolEndpoint,
+			body)
+	}
+	negotiated, nErr := version.NegotiateProtocol(info.MinProtocolVersion,
+		info.ProtocolVersion)
+	if nErr != nil {
+		return info, fmt.Errorf("scheduler supports protocol versions %d-%d, "+
+			"executor supports %d-%d: %w", info.MinProtocolVersion,
+			info.ProtocolVersion, version.MinProtocolVersion,
+			version.ProtocolVersion, nErr)
+	}
+	c.protocolVersion = negotiated
+	slog.Info("Negotiated protocol version", "protocolVersion", negotiated,
+		"schedulerVersion", info.Version, "executorVersion", version.Current())
+	return info, nil
+}
+
+// ProtocolVersion returns negotiated protocol version or zero, when the
+// handshake has not been done.
+func (c *SchedulerClient) ProtocolVersion() int {
+	return c.protocolVersion
+}
+
+func (c *SchedulerClient) get(reqUrl string) (*http.Response, error) {
+	return c.do(context.Background(), "GET", reqUrl, "", nil)
+}
+
+func (c *SchedulerClient) post(
+	reqUrl, contentType string, body io.Reader,
+) (*http.Response, error) {
+	return c.do(context.Background(), "POST", reqUrl, contentType, body)
+}
+
+// Sends HTTP request with negotiated protocol version header and credentials.
+func (c *SchedulerClient) do(
+	ctx context.Context, method, reqUrl, contentType string, body io.Reader,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.protocolVersion > 0 {
+		req.Header.Set(models.ProtocolVersionHeader,
+			strconv.Itoa(c.protocolVersion))
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	return c.httpClient.Do(req)
+}
+
+// Returns error for the scheduler response with unexpected status code. When
+// the response contains models.ErrorResponse, *SchedulerError is returned.
+func responseError(
+	statusCode int, method, endpoint string, body []byte,
+) error {
+	var errResp models.ErrorResponse
+	jErr := json.Unmarshal(body, &errResp)
+	if jErr == nil && errResp.Error.Code != "" {
+		return &SchedulerError{
+			StatusCode: statusCode,
+			Code:       errResp.Error.Code,
+			Message:    errResp.Error.Message,
+		}
+	}
+	return fmt.Errorf("error with status %d for %s %s: %s", statusCode, method,
+		endpoint, string(body))
+}
+
+// Sends POST request with given object serialized to JSON. Returns response
+// status code and body.
+func (c *SchedulerClient) postJson(endpoint string, obj any) (int, []byte, error) {
+	objJson, jErr := json.Marshal(obj)
+	if jErr != nil {
+		return 0, nil, fmt.Errorf("cannot marshal %T: %s", obj, jErr.Error())
+	}
+	resp, postErr := c.post(
+		fmt.Sprintf("%s%s", c.schedulerUrl, endpoint),
+		"application/json",
+		bytes.NewBuffer(objJson),
+	)
+	if postErr != nil {
+		return 0, nil, fmt.Errorf("could not do POST %s request: %s",
+			endpoint, postErr)
+	}
+	defer resp.Body.Close()
+	body, rErr := io.ReadAll(resp.Body)
+	if rErr != nil {
+		return 0, nil, fmt.Errorf("cannot read POST %s response body: %s",
+			endpoint, rErr.Error())
+	}
+	return resp.StatusCode, body, nil
+}
+
 func (c *SchedulerClient) getTaskUrl() string {
-	return fmt.Sprintf("%s%s", c.schedulerUrl, getTaskEndpoint)
+	params := c.popParams()
+	if len(params) == 0 {
+		return fmt.Sprintf("%s%s", c.schedulerUrl, getTaskEndpoint)
+	}
+	return fmt.Sprintf("%s%s?%s", c.schedulerUrl, getTaskEndpoint,
+		params.Encode())
+}
+
+func (c *SchedulerClient) getTasksUrl(maxTasks int) string {
+	params := c.popParams()
+	params.Set("max", strconv.Itoa(maxTasks))
+	return fmt.Sprintf("%s%s?%s", c.schedulerUrl, getTasksEndpoint,
+		params.Encode())
+}
+
+func (c *SchedulerClient) popParams() url.Values {
+	params := url.Values{}
+	if c.executorId != "" {
+		params.Set("executorId", c.executorId)
+	}
+	if len(c.labels) > 0 {
+		params.Set("labels", strings.Join(c.labels, ","))
+	}
+	if c.popWait > 0 {
+		params.Set("waitMs", strconv.FormatInt(c.popWait.Milliseconds(), 10))
+	}
+	return params
 }
 
 func (c *SchedulerClient) getUpdateTaskStatusUrl() string {
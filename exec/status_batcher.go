@@ -0,0 +1,138 @@
+package exec
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/models"
+)
+
+// How many times sending status updates is retried, when the scheduler cannot
+// be reached, before the updates are dropped.
+const statusBatchMaxRetries = 5
+
+// statusBatcher collects task status updates and sends them to the scheduler
+// in batches, every flush interval or when the batch is full. Updates are
+// sent in the same order as they were reported. Updates which couldn't be
+// sent are retried with the next batch, up to statusBatchMaxRetries times.
+type statusBatcher struct {
+	client   schedulerApi
+	interval time.Duration
+	maxSize  int
+
+	sync.Mutex
+	updates  []models.DagRunTaskStatus
+	failures int
+	full     chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+func newStatusBatcher(
+	client schedulerApi, interval time.Duration, maxSize int,
+) *statusBatcher {
+	return &statusBatcher{
+		client:   client,
+		interval: interval,
+		maxSize:  maxSize,
+		updates:  make([]models.DagRunTaskStatus, 0, maxSize),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Adds status update to the current batch.
+func (sb *statusBatcher) report(tte models.TaskToExec, status string) {
+	sb.Lock()
+	sb.updates = append(sb.updates, models.DagRunTaskStatus{
+		DagId:   tte.DagId,
+		ExecTs:  tte.ExecTs,
+		TaskId:  tte.TaskId,
+		Status:  status,
+		LeaseId: tte.LeaseId,
+	})
+	isFull := len(sb.updates) >= sb.maxSize
+	sb.Unlock()
+	if isFull {
+		select {
+		case sb.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Sends batches until close is called.
+func (sb *statusBatcher) start() {
+	defer close(sb.stopped)
+	ticker := time.NewTicker(sb.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sb.stop:
+			retryDelay := min(sb.interval, time.Second)
+			for !sb.flush() {
+				time.Sleep(retryDelay)
+			}
+			return
+		case <-sb.full:
+		case <-ticker.C:
+		}
+		sb.flush()
+	}
+}
+
+// Stops the batcher, after sending remaining updates. Sending is retried, the
+// same as for regular batches.
+func (sb *statusBatcher) close() {
+	close(sb.stop)
+	<-sb.stopped
+}
+
+// Sends collected updates to the scheduler. When the scheduler cannot be
+// reached, updates are put back in front of updates reported in the meantime
+// and false is returned, unless they have been already retried
+// statusBatchMaxRetries times.
+func (sb *statusBatcher) flush() bool {
+	sb.Lock()
+	updates := sb.updates
+	sb.updates = make([]models.DagRunTaskStatus, 0, sb.maxSize)
+	sb.Unlock()
+	if len(updates) == 0 {
+		return true
+	}
+	failed, err := sb.client.UpdateTaskStatuses(updates)
+	if err != nil {
+		return sb.retryLater(updates, err)
+	}
+	sb.Lock()
+	sb.failures = 0
+	sb.Unlock()
+	for _, f := range failed {
+		slog.Error("Error while updating status", "update",
+			f.DagRunTaskStatus, "err", f.Error)
+	}
+	return true
+}
+
+// Puts given updates, which couldn't be sent, back in front of the current
+// batch. Returns true, when updates are dropped instead, because they have
+// been already retried statusBatchMaxRetries times.
+func (sb *statusBatcher) retryLater(
+	updates []models.DagRunTaskStatus, err error,
+) bool {
+	sb.Lock()
+	defer sb.Unlock()
+	sb.failures++
+	if sb.failures > statusBatchMaxRetries {
+		sb.failures = 0
+		slog.Error("Error while updating statuses. Dropping updates",
+			"updates", updates, "err", err)
+		return true
+	}
+	slog.Warn("Error while updating statuses. Will try again", "updates",
+		len(updates), "attempt", sb.failures, "err", err)
+	sb.updates = append(updates, sb.updates...)
+	return false
+}
@@ -0,0 +1,188 @@
+package exec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/models"
+)
+
+// Returns sizes of status batches sent to the scheduler, in order.
+func (fs *fakeScheduler) batchSizes() []int {
+	fs.Lock()
+	defer fs.Unlock()
+	sizes := make([]int, len(fs.statusBatches))
+	for i, batch := range fs.statusBatches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func (fs *fakeScheduler) statusesNum() int {
+	fs.Lock()
+	defer fs.Unlock()
+	return len(fs.statuses)
+}
+
+func statusUpdates(n int) []models.TaskToExec {
+	ttes := make([]models.TaskToExec, n)
+	for i := range ttes {
+		ttes[i] = models.TaskToExec{
+			DagId:   "status_batcher_dag",
+			ExecTs:  "2023-10-05T12:00:00UTC+00:00",
+			TaskId:  taskName(i),
+			LeaseId: "lease_" + taskName(i),
+		}
+	}
+	return ttes
+}
+
+func TestStatusBatcherFlushBySize(t *testing.T) {
+	fs := &fakeScheduler{}
+	sb := newStatusBatcher(fs, time.Hour, 3)
+	go sb.start()
+	defer sb.close()
+
+	ttes := statusUpdates(3)
+	sb.report(ttes[0], "RUNNING")
+	sb.report(ttes[1], "RUNNING")
+	time.Sleep(10 * time.Millisecond)
+	if sizes := fs.batchSizes(); len(sizes) != 0 {
+		t.Fatalf("Expected no batches before batch is full, got %v", sizes)
+	}
+	sb.report(ttes[2], "RUNNING")
+	waitFor(t, func() bool { return len(fs.batchSizes()) == 1 },
+		"Expected batch to be sent when it's full")
+	if sizes := fs.batchSizes(); !reflect.DeepEqual(sizes, []int{3}) {
+		t.Errorf("Expected single batch of 3 updates, got %v", sizes)
+	}
+	fs.Lock()
+	batch := fs.statusBatches[0]
+	fs.Unlock()
+	for i, update := range batch {
+		if update.TaskId != ttes[i].TaskId ||
+			update.LeaseId != ttes[i].LeaseId || update.Status != "RUNNING" {
+			t.Errorf("Expected update %d for %v RUNNING, got %v", i, ttes[i],
+				update)
+		}
+	}
+}
+
+func TestStatusBatcherFlushByInterval(t *testing.T) {
+	fs := &fakeScheduler{}
+	sb := newStatusBatcher(fs, 20*time.Millisecond, 100)
+	go sb.start()
+	defer sb.close()
+
+	ttes := statusUpdates(2)
+	sb.report(ttes[0], "RUNNING")
+	sb.report(ttes[1], "RUNNING")
+	waitFor(t, func() bool { return fs.statusesNum() == 2 },
+		"Expected updates to be sent after flush interval")
+	sb.report(ttes[0], "SUCCESS")
+	waitFor(t, func() bool { return fs.statusesNum() == 3 },
+		"Expected next update to be sent after flush interval")
+
+	statuses := fs.taskStatuses(ttes[0].TaskId)
+	if !reflect.DeepEqual(statuses, []string{"RUNNING", "SUCCESS"}) {
+		t.Errorf("Expected statuses [RUNNING SUCCESS], got %v", statuses)
+	}
+}
+
+func TestStatusBatcherCloseFlushesPending(t *testing.T) {
+	fs := &fakeScheduler{}
+	sb := newStatusBatcher(fs, time.Hour, 100)
+	go sb.start()
+
+	ttes := statusUpdates(5)
+	for _, tte := range ttes {
+		sb.report(tte, "SUCCESS")
+	}
+	sb.close()
+	if sizes := fs.batchSizes(); !reflect.DeepEqual(sizes, []int{5}) {
+		t.Fatalf("Expected pending updates sent in a batch on close, got %v",
+			sizes)
+	}
+	for _, tte := range ttes {
+		statuses := fs.taskStatuses(tte.TaskId)
+		if !reflect.DeepEqual(statuses, []string{"SUCCESS"}) {
+			t.Errorf("Expected SUCCESS status of %s, got %v", tte.TaskId,
+				statuses)
+		}
+	}
+}
+
+func TestStatusBatcherCloseWithoutUpdates(t *testing.T) {
+	fs := &fakeScheduler{}
+	sb := newStatusBatcher(fs, time.Hour, 100)
+	go sb.start()
+	sb.close()
+	if sizes := fs.batchSizes(); len(sizes) != 0 {
+		t.Errorf("Expected no batches without updates, got %v", sizes)
+	}
+}
+
+func TestStatusBatcherRetriesFailedBatch(t *testing.T) {
+	fs := &fakeScheduler{statusFailures: 2}
+	sb := newStatusBatcher(fs, time.Hour, 100)
+	ttes := statusUpdates(3)
+	sb.report(ttes[0], "RUNNING")
+	sb.report(ttes[1], "RUNNING")
+
+	if sb.flush() {
+		t.Error("Expected failed flush to be retried")
+	}
+	sb.report(ttes[2], "RUNNING")
+	if sb.flush() {
+		t.Error("Expected failed flush to be retried")
+	}
+	if !sb.flush() {
+		t.Fatal("Expected successful flush")
+	}
+	if sizes := fs.batchSizes(); !reflect.DeepEqual(sizes, []int{3}) {
+		t.Fatalf("Expected single batch of 3 updates, got %v", sizes)
+	}
+	fs.Lock()
+	batch := fs.statusBatches[0]
+	fs.Unlock()
+	for i, update := range batch {
+		if update.TaskId != ttes[i].TaskId {
+			t.Errorf("Expected update %d for %s, got %v", i, ttes[i].TaskId,
+				update)
+		}
+	}
+}
+
+func TestStatusBatcherDropsUpdatesAfterMaxRetries(t *testing.T) {
+	fs := &fakeScheduler{statusFailures: statusBatchMaxRetries + 1}
+	sb := newStatusBatcher(fs, time.Hour, 100)
+	sb.report(statusUpdates(1)[0], "SUCCESS")
+	for i := 0; i < statusBatchMaxRetries; i++ {
+		if sb.flush() {
+			t.Fatalf("Expected attempt %d to be retried", i+1)
+		}
+	}
+	if !sb.flush() {
+		t.Error("Expected updates to be dropped after max retries")
+	}
+	if !sb.flush() || fs.statusesNum() != 0 {
+		t.Errorf("Expected no updates left, got %d sent", fs.statusesNum())
+	}
+}
+
+func TestStatusBatcherCloseRetriesFailedBatch(t *testing.T) {
+	fs := &fakeScheduler{statusFailures: 1}
+	sb := newStatusBatcher(fs, 50*time.Millisecond, 100)
+	go sb.start()
+	ttes := statusUpdates(2)
+	for _, tte := range ttes {
+		sb.report(tte, "SUCCESS")
+	}
+	// First flush on close fails
+	sb.close()
+	if fs.statusesNum() != 2 {
+		t.Errorf("Expected updates to be sent on close after retry, got %d",
+			fs.statusesNum())
+	}
+}
@@ -0,0 +1,32 @@
+// Package grpcapi contains gRPC service for communication between executors
+// and the scheduler. Messages are types from models package encoded in JSON,
+// so the service doesn't require generated protobuf code.
+package grpcapi
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the name of JSON codec used by the service. It's used as gRPC
+// content subtype (application/grpc+json).
+const CodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return CodecName
+}
@@ -0,0 +1,201 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/dskrzypiec/scheduler/models"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the full name of gRPC service for executors.
+const ServiceName = "scheduler.Executor"
+
+// ProtocolVersionKey is gRPC metadata key in which executors send negotiated
+// protocol version (see version.ProtocolVersion).
+const ProtocolVersionKey = "x-scheduler-protocol-version"
+
+// ExecutorServer is the server API of the executor service. Methods have the
+// same semantics as corresponding HTTP endpoints of the scheduler. Dispatch is
+// a bidirectional stream on which executor sends requests for tasks and the
+// scheduler pushes tasks as soon as they are available. StreamLogs is a
+// client stream of task output.
+type ExecutorServer interface {
+	Handshake(context.Context, *models.Empty) (*models.ProtocolInfo, error)
+	Register(context.Context, *models.ExecutorInfo) (*models.Empty, error)
+	Heartbeat(
+		context.Context, *models.ExecutorHeartbeat,
+	) (*models.ExecutorHeartbeatResponse, error)
+	UpdateTaskStatuses(
+		context.Context, *models.TaskStatusBatch,
+	) (*models.TaskStatusBatchResult, error)
+	AckTask(context.Context, *models.LeaseRequest) (*models.TaskLease, error)
+	RenewTaskLease(context.Context, *models.LeaseRequest) (*models.TaskLease, error)
+	ReleaseTaskLease(context.Context, *models.LeaseRequest) (*models.TaskLease, error)
+	Dispatch(grpc.BidiStreamingServer[models.PopTasksRequest, models.TaskBatch]) error
+	StreamLogs(grpc.ClientStreamingServer[models.TaskLog, models.Empty]) error
+}
+
+// RegisterExecutorServer registers executor service implementation in given
+// gRPC server.
+func RegisterExecutorServer(s grpc.ServiceRegistrar, srv ExecutorServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+// ServiceDesc describes executor gRPC service.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ExecutorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("Handshake", ExecutorServer.Handshake),
+		unaryMethod("Register", ExecutorServer.Register),
+		unaryMethod("Heartbeat", ExecutorServer.Heartbeat),
+		unaryMethod("UpdateTaskStatuses", ExecutorServer.UpdateTaskStatuses),
+		unaryMethod("AckTask", ExecutorServer.AckTask),
+		unaryMethod("RenewTaskLease", ExecutorServer.RenewTaskLease),
+		unaryMethod("ReleaseTaskLease", ExecutorServer.ReleaseTaskLease),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Dispatch",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(ExecutorServer).Dispatch(
+					&grpc.GenericServerStream[models.PopTasksRequest, models.TaskBatch]{
+						ServerStream: stream,
+					})
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName: "StreamLogs",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(ExecutorServer).StreamLogs(
+					&grpc.GenericServerStream[models.TaskLog, models.Empty]{
+						ServerStream: stream,
+					})
+			},
+			ClientStreams: true,
+		},
+	},
+}
+
+func fullMethod(name string) string {
+	return "/" + ServiceName + "/" + name
+}
+
+// Builds unary method description for given server method.
+func unaryMethod[Req, Res any](
+	name string, call func(ExecutorServer, context.Context, *Req) (*Res, error),
+) grpc.MethodDesc {
+	handler := func(
+		srv any,
+		ctx context.Context,
+		dec func(any) error,
+		interceptor grpc.UnaryServerInterceptor,
+	) (any, error) {
+		in := new(Req)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		s := srv.(ExecutorServer)
+		if interceptor == nil {
+			return call(s, ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(name)}
+		return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+			return call(s, ctx, req.(*Req))
+		})
+	}
+	return grpc.MethodDesc{MethodName: name, Handler: handler}
+}
+
+// ExecutorClient is the client API of the executor service.
+type ExecutorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewExecutorClient creates new ExecutorClient on given connection.
+func NewExecutorClient(cc grpc.ClientConnInterface) *ExecutorClient {
+	return &ExecutorClient{cc: cc}
+}
+
+func (c *ExecutorClient) Handshake(
+	ctx context.Context, in *models.Empty,
+) (*models.ProtocolInfo, error) {
+	return invoke[models.ProtocolInfo](ctx, c.cc, "Handshake", in)
+}
+
+func (c *ExecutorClient) Register(
+	ctx context.Context, in *models.ExecutorInfo,
+) (*models.Empty, error) {
+	return invoke[models.Empty](ctx, c.cc, "Register", in)
+}
+
+func (c *ExecutorClient) Heartbeat(
+	ctx context.Context, in *models.ExecutorHeartbeat,
+) (*models.ExecutorHeartbeatResponse, error) {
+	return invoke[models.ExecutorHeartbeatResponse](ctx, c.cc, "Heartbeat", in)
+}
+
+func (c *ExecutorClient) UpdateTaskStatuses(
+	ctx context.Context, in *models.TaskStatusBatch,
+) (*models.TaskStatusBatchResult, error) {
+	return invoke[models.TaskStatusBatchResult](ctx, c.cc,
+		"UpdateTaskStatuses", in)
+}
+
+func (c *ExecutorClient) AckTask(
+	ctx context.Context, in *models.LeaseRequest,
+) (*models.TaskLease, error) {
+	return invoke[models.TaskLease](ctx, c.cc, "AckTask", in)
+}
+
+func (c *ExecutorClient) RenewTaskLease(
+	ctx context.Context, in *models.LeaseRequest,
+) (*models.TaskLease, error) {
+	return invoke[models.TaskLease](ctx, c.cc, "RenewTaskLease", in)
+}
+
+func (c *ExecutorClient) ReleaseTaskLease(
+	ctx context.Context, in *models.LeaseRequest,
+) (*models.TaskLease, error) {
+	return invoke[models.TaskLease](ctx, c.cc, "ReleaseTaskLease", in)
+}
+
+func (c *ExecutorClient) Dispatch(
+	ctx context.Context,
+) (grpc.BidiStreamingClient[models.PopTasksRequest, models.TaskBatch], error) {
+	stream, err := c.cc.NewStream(ctx, &ServiceDesc.Streams[0],
+		fullMethod("Dispatch"), grpc.CallContentSubtype(CodecName))
+	if err != nil {
+		return nil, err
+	}
+	return &grpc.GenericClientStream[models.PopTasksRequest, models.TaskBatch]{
+		ClientStream: stream,
+	}, nil
+}
+
+func (c *ExecutorClient) StreamLogs(
+	ctx context.Context,
+) (grpc.ClientStreamingClient[models.TaskLog, models.Empty], error) {
+	stream, err := c.cc.NewStream(ctx, &ServiceDesc.Streams[1],
+		fullMethod("StreamLogs"), grpc.CallContentSubtype(CodecName))
+	if err != nil {
+		return nil, err
+	}
+	return &grpc.GenericClientStream[models.TaskLog, models.Empty]{
+		ClientStream: stream,
+	}, nil
+}
+
+func invoke[Res any](
+	ctx context.Context, cc grpc.ClientConnInterface, method string, in any,
+) (*Res, error) {
+	out := new(Res)
+	err := cc.Invoke(ctx, fullMethod(method), in, out,
+		grpc.CallContentSubtype(CodecName))
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -2,14 +2,272 @@
 package models
 
 type TaskToExec struct {
+	DagId          string `json:"dagId"`
+	ExecTs         string `json:"execTs"`
+	TaskId         string `json:"taskId"`
+	LeaseId        string `json:"leaseId,omitempty"`
+	LeaseExpiresTs string `json:"leaseExpiresTs,omitempty"`
+
+	// DAG run parameters serialized as JSON object (see dag.ParseParams).
+	// It's kept as string, so TaskToExec stays comparable.
+	Params string `json:"params,omitempty"`
+
+	// Rendered task templates serialized as JSON object (see
+	// dag.ParseRendered).
+	Rendered string `json:"rendered,omitempty"`
+}
+
+// TaskLease is returned by the scheduler, when executor acknowledges or renews
+// lease on a task.
+type TaskLease struct {
+	LeaseId   string `json:"leaseId"`
+	ExpiresTs string `json:"expiresTs"`
+}
+
+type DagRunTaskStatus struct {
 	DagId  string `json:"dagId"`
 	ExecTs string `json:"execTs"`
 	TaskId string `json:"taskId"`
+	Status string `json:"status"`
+
+	// Lease of the task given by the scheduler (TaskToExec.LeaseId). When
+	// leases are enabled, status reports without the current lease of the
+	// task are rejected.
+	LeaseId string `json:"leaseId,omitempty"`
 }
 
-type DagRunTaskStatus struct {
+// DagRunTaskStatusError represents status update which failed in batch
+// status update.
+type DagRunTaskStatusError struct {
+	DagRunTaskStatus
+	Error string `json:"error"`
+}
+
+// DagAnalysis represents graph analysis of a DAG, including critical path
+// and estimated run time based on historical task durations.
+type DagAnalysis struct {
+	DagId                string           `json:"dagId"`
+	Levels               [][]string       `json:"levels"`
+	LongestPath          []string         `json:"longestPath"`
+	CriticalPath         []string         `json:"criticalPath"`
+	EstimatedDurationMs  int64            `json:"estimatedDurationMs"`
+	TaskDurationsMs      map[string]int64 `json:"taskDurationsMs"`
+	HistoricalDagRunsNum int              `json:"historicalDagRunsNum"`
+}
+
+// ExecutorInfo is sent by executor to the scheduler on registration.
+type ExecutorInfo struct {
+	ExecutorId      string `json:"executorId"`
+	Hostname        string `json:"hostname"`
+	Capacity        int    `json:"capacity"`
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion int    `json:"protocolVersion,omitempty"`
+}
+
+// ExecutorHeartbeat is periodically sent by executor to the scheduler, to
+// signal that the executor is still alive.
+type ExecutorHeartbeat struct {
+	ExecutorId string `json:"executorId"`
+}
+
+// ExecutorHeartbeatResponse is returned by the scheduler on executor
+// heartbeat. CancelledTasks lists tasks being executed by the executor, which
+// should be stopped, because their DAG run has been cancelled. Only DagId,
+// ExecTs and TaskId of those are set.
+type ExecutorHeartbeatResponse struct {
+	CancelledTasks []TaskToExec `json:"cancelledTasks"`
+}
+
+// ProtocolVersionHeader is HTTP header in which executors send negotiated
+// protocol version. Requests without this header are considered to be in
+// protocol version 1.
+const ProtocolVersionHeader = "X-Scheduler-Protocol-Version"
+
+// ProtocolInfo describes versions of the scheduler, returned in handshake.
+type ProtocolInfo struct {
+	Version            string `json:"version"`
+	ProtocolVersion    int    `json:"protocolVersion"`
+	MinProtocolVersion int    `json:"minProtocolVersion"`
+}
+
+// Machine-readable error codes returned by the scheduler in ErrorResponse.
+const (
+	ErrCodeBadRequest            = "BAD_REQUEST"
+	ErrCodeMethodNotAllowed      = "METHOD_NOT_ALLOWED"
+	ErrCodeInvalidStatus         = "INVALID_STATUS"
+	ErrCodeLeaseNotFound         = "LEASE_NOT_FOUND"
+	ErrCodeLeasesDisabled        = "LEASES_DISABLED"
+	ErrCodeExecutorNotRegistered = "EXECUTOR_NOT_REGISTERED"
+	ErrCodeIncompatibleProtocol  = "INCOMPATIBLE_PROTOCOL"
+	ErrCodeUnauthenticated       = "UNAUTHENTICATED"
+	ErrCodeForbidden             = "FORBIDDEN"
+	ErrCodeInternal              = "INTERNAL"
+)
+
+// Error describes an error returned by the scheduler.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is an envelope for errors returned by the scheduler to
+// executors, since protocol version 2.
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// PopTasksRequest is a request for tasks sent by executors over gRPC Dispatch
+// stream. Scheduler responds with TaskBatch of at most MaxTasks tasks, after
+// at least one task is available or WaitMs passed.
+type PopTasksRequest struct {
+	ExecutorId string   `json:"executorId"`
+	Labels     []string `json:"labels,omitempty"`
+	MaxTasks   int      `json:"maxTasks"`
+	WaitMs     int      `json:"waitMs"`
+}
+
+// TaskBatch is a list of tasks to be executed by an executor.
+type TaskBatch struct {
+	Tasks []TaskToExec `json:"tasks"`
+}
+
+// LeaseRequest identifies task lease to be acknowledged, renewed or released.
+type LeaseRequest struct {
+	LeaseId string `json:"leaseId"`
+}
+
+// TaskStatusBatch is a list of task status updates.
+type TaskStatusBatch struct {
+	Updates []DagRunTaskStatus `json:"updates"`
+}
+
+// TaskStatusBatchResult is a list of task status updates which failed.
+type TaskStatusBatchResult struct {
+	Failed []DagRunTaskStatusError `json:"failed"`
+}
+
+// TaskLog is a single line of task output streamed by an executor.
+type TaskLog struct {
 	DagId  string `json:"dagId"`
 	ExecTs string `json:"execTs"`
 	TaskId string `json:"taskId"`
-	Status string `json:"status"`
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+// Empty is a message without content.
+type Empty struct{}
+
+// AuditLogEntry describes single action recorded in the audit log.
+type AuditLogEntry struct {
+	InsertTs  string `json:"insertTs"`
+	Principal string `json:"principal"`
+	Action    string `json:"action"`
+	DagId     string `json:"dagId,omitempty"`
+	Details   string `json:"details,omitempty"`
+	Allowed   bool   `json:"allowed"`
+}
+
+// DagInfo describes a DAG in the read-only API.
+type DagInfo struct {
+	DagId          string   `json:"dagId"`
+	StartTs        string   `json:"startTs,omitempty"`
+	Schedule       string   `json:"schedule,omitempty"`
+	Tags           []string `json:"tags"`
+	IsPaused       bool     `json:"isPaused"`
+	CreateTs       string   `json:"createTs"`
+	LatestUpdateTs string   `json:"latestUpdateTs,omitempty"`
+}
+
+// DagTaskInfo describes current version of a DAG task in the read-only API.
+type DagTaskInfo struct {
+	TaskId       string   `json:"taskId"`
+	TaskTypeName string   `json:"taskTypeName"`
+	InsertTs     string   `json:"insertTs"`
+	Version      string   `json:"version"`
+	Parents      []string `json:"parents"`
+	Children     []string `json:"children"`
+}
+
+// DagDetails describes a DAG together with its task graph.
+type DagDetails struct {
+	DagInfo
+	Tasks []DagTaskInfo `json:"tasks"`
+}
+
+// DagRunInfo describes a DAG run in the read-only API.
+type DagRunInfo struct {
+	RunId          int64  `json:"runId"`
+	DagId          string `json:"dagId"`
+	ExecTs         string `json:"execTs"`
+	InsertTs       string `json:"insertTs"`
+	Status         string `json:"status"`
+	StatusUpdateTs string `json:"statusUpdateTs"`
+	Version        string `json:"version"`
+
+	// DAG run parameters, if the DAG run has any.
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// DagRunsPage is a single page of DAG runs. NextOffset is set, when there are
+// more DAG runs to be read.
+type DagRunsPage struct {
+	DagRuns    []DagRunInfo `json:"dagRuns"`
+	Limit      int          `json:"limit"`
+	Offset     int          `json:"offset"`
+	NextOffset *int         `json:"nextOffset,omitempty"`
+}
+
+// DagRunTaskInfo describes a task instance of a DAG run in the read-only API.
+type DagRunTaskInfo struct {
+	DagId          string `json:"dagId"`
+	ExecTs         string `json:"execTs"`
+	TaskId         string `json:"taskId"`
+	InsertTs       string `json:"insertTs"`
+	Status         string `json:"status"`
+	StatusUpdateTs string `json:"statusUpdateTs"`
+	Version        string `json:"version"`
+	ExecutorId     string `json:"executorId,omitempty"`
+
+	// Rendered task templates, if the task has any.
+	Rendered map[string]string `json:"rendered,omitempty"`
+}
+
+// ClearTasksResponse lists tasks of a DAG run which were cleared and will be
+// scheduled again.
+type ClearTasksResponse struct {
+	DagId          string   `json:"dagId"`
+	ExecTs         string   `json:"execTs"`
+	ClearedTaskIds []string `json:"clearedTaskIds"`
+}
+
+// CancelDagRunResponse lists tasks of a DAG run which were scheduled or
+// running, when the DAG run has been cancelled.
+type CancelDagRunResponse struct {
+	DagId            string   `json:"dagId"`
+	ExecTs           string   `json:"execTs"`
+	CancelledTaskIds []string `json:"cancelledTaskIds"`
+}
+
+// TriggerDagRunRequest is an optional body of DAG run trigger request.
+// Parameters have to be declared in the DAG (see dag.Attr.Params).
+type TriggerDagRunRequest struct {
+	Params map[string]any `json:"params"`
+}
+
+// TriggerDagRunResponse describes just triggered DAG run, including values of
+// all its parameters.
+type TriggerDagRunResponse struct {
+	DagId  string         `json:"dagId"`
+	ExecTs string         `json:"execTs"`
+	Params map[string]any `json:"params"`
+}
+
+// MarkStatusResponse lists tasks of a DAG run which status has been set
+// manually.
+type MarkStatusResponse struct {
+	DagId         string   `json:"dagId"`
+	ExecTs        string   `json:"execTs"`
+	Status        string   `json:"status"`
+	MarkedTaskIds []string `json:"markedTaskIds"`
 }
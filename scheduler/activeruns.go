@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"sort"
+
+	"github.com/dskrzypiec/scheduler/dag"
+)
+
+// Type activeDagRuns keeps track of DAG runs which are currently running and
+// DAG runs which are waiting to be started because of concurrency limits -
+// either global (TaskSchedulerConfig.MaxConcurrentDagRuns) or per DAG
+// (dag.Attr.MaxActiveRuns). Pending DAG runs are started in exec time order.
+// It's used only by the TaskScheduler main loop, so it's not safe for
+// concurrent use.
+type activeDagRuns struct {
+	maxTotal     int
+	total        int
+	active       map[dag.Id]int
+	pending      []DagRun
+	pendingByDag map[dag.Id]int
+}
+
+func newActiveDagRuns(maxTotal int) *activeDagRuns {
+	return &activeDagRuns{
+		maxTotal:     maxTotal,
+		active:       make(map[dag.Id]int),
+		pending:      make([]DagRun, 0),
+		pendingByDag: make(map[dag.Id]int),
+	}
+}
+
+// Adds new DAG run to pending DAG runs, keeping exec time order.
+func (adr *activeDagRuns) add(dagrun DagRun) {
+	idx := sort.Search(len(adr.pending), func(i int) bool {
+		return adr.pending[i].AtTime.After(dagrun.AtTime)
+	})
+	adr.pending = append(adr.pending, DagRun{})
+	copy(adr.pending[idx+1:], adr.pending[idx:])
+	adr.pending[idx] = dagrun
+	adr.pendingByDag[dagrun.DagId]++
+}
+
+// Returns pending DAG runs which can be started without exceeding limits and
+// marks them as active. Function maxActiveRuns should return per DAG limit,
+// where zero means no limit.
+func (adr *activeDagRuns) next(maxActiveRuns func(dag.Id) int) []DagRun {
+	toStart := make([]DagRun, 0)
+	stillPending := adr.pending[:0]
+	for _, dagrun := range adr.pending {
+		if adr.maxTotal > 0 && adr.total >= adr.maxTotal {
+			stillPending = append(stillPending, dagrun)
+			continue
+		}
+		limit := maxActiveRuns(dagrun.DagId)
+		if limit > 0 && adr.active[dagrun.DagId] >= limit {
+			stillPending = append(stillPending, dagrun)
+			continue
+		}
+		adr.active[dagrun.DagId]++
+		adr.total++
+		adr.pendingByDag[dagrun.DagId]--
+		if adr.pendingByDag[dagrun.DagId] == 0 {
+			delete(adr.pendingByDag, dagrun.DagId)
+		}
+		toStart = append(toStart, dagrun)
+	}
+	adr.pending = stillPending
+	return toStart
+}
+
+// Marks given DAG run as finished.
+func (adr *activeDagRuns) done(dagrun DagRun) {
+	if adr.active[dagrun.DagId] == 0 {
+		return
+	}
+	adr.active[dagrun.DagId]--
+	if adr.active[dagrun.DagId] == 0 {
+		delete(adr.active, dagrun.DagId)
+	}
+	adr.total--
+}
+
+// Number of pending DAG runs.
+func (adr *activeDagRuns) pendingNum() int {
+	return len(adr.pending)
+}
+
+// Number of pending DAG runs of given DAG.
+func (adr *activeDagRuns) pendingNumOf(dagId dag.Id) int {
+	return adr.pendingByDag[dagId]
+}
+
+// Returns DAG run limit from dag.Attr.MaxActiveRuns for given DAG. When DAG
+// cannot be found in the registry zero (no limit) is returned.
+func dagMaxActiveRuns(dagId dag.Id) int {
+	d, err := dag.Get(dagId)
+	if err != nil {
+		return 0
+	}
+	return d.Attr.MaxActiveRuns
+}
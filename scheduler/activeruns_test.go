@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+)
+
+func TestActiveDagRunsNoLimits(t *testing.T) {
+	adr := newActiveDagRuns(0)
+	start := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 500; i++ {
+		adr.add(DagRun{DagId: "dag1", AtTime: start.Add(time.Duration(i) * time.Hour)})
+	}
+	toStart := adr.next(noDagRunsLimit)
+	if len(toStart) != 500 {
+		t.Errorf("Expected all 500 dag runs to be started, got %d",
+			len(toStart))
+	}
+	if adr.pendingNum() != 0 {
+		t.Errorf("Expected no pending dag runs, got %d", adr.pendingNum())
+	}
+}
+
+func TestActiveDagRunsGlobalLimit(t *testing.T) {
+	const maxTotal = 3
+	adr := newActiveDagRuns(maxTotal)
+	start := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	// Added in reversed order, should be started in exec time order
+	for i := 9; i >= 0; i-- {
+		adr.add(DagRun{DagId: "dag1", AtTime: start.Add(time.Duration(i) * time.Hour)})
+	}
+
+	toStart := adr.next(noDagRunsLimit)
+	checkDagRunsExecTimes(t, toStart, start, 0, 1, 2)
+	if toStart := adr.next(noDagRunsLimit); len(toStart) != 0 {
+		t.Errorf("Expected no new dag runs before others are done, got %v",
+			toStart)
+	}
+
+	adr.done(toStart[1])
+	toStart = adr.next(noDagRunsLimit)
+	checkDagRunsExecTimes(t, toStart, start, 3)
+	if adr.pendingNum() != 6 {
+		t.Errorf("Expected 6 pending dag runs, got %d", adr.pendingNum())
+	}
+}
+
+func TestActiveDagRunsPerDagLimit(t *testing.T) {
+	adr := newActiveDagRuns(10)
+	start := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		execTs := start.Add(time.Duration(i) * time.Hour)
+		adr.add(DagRun{DagId: "limited", AtTime: execTs})
+		adr.add(DagRun{DagId: "unlimited", AtTime: execTs})
+	}
+	limits := func(dagId dag.Id) int {
+		if dagId == "limited" {
+			return 1
+		}
+		return 0
+	}
+
+	toStart := adr.next(limits)
+	if len(toStart) != 6 {
+		t.Fatalf("Expected 6 dag runs to start (1 limited + 5 unlimited), got %d",
+			len(toStart))
+	}
+	var limited DagRun
+	for _, dr := range toStart {
+		if dr.DagId == "limited" {
+			limited = dr
+		}
+	}
+	if !limited.AtTime.Equal(start) {
+		t.Errorf("Expected the earliest limited dag run to start, got %v",
+			limited.AtTime)
+	}
+
+	adr.done(limited)
+	toStart = adr.next(limits)
+	checkDagRunsExecTimes(t, toStart, start, 1)
+	if toStart[0].DagId != "limited" {
+		t.Errorf("Expected limited dag run, got %s", toStart[0].DagId)
+	}
+}
+
+func noDagRunsLimit(_ dag.Id) int {
+	return 0
+}
+
+func checkDagRunsExecTimes(
+	t *testing.T, dagruns []DagRun, start time.Time, hours ...int,
+) {
+	t.Helper()
+	if len(dagruns) != len(hours) {
+		t.Fatalf("Expected %d dag runs, got %d: %v", len(hours), len(dagruns),
+			dagruns)
+	}
+	for idx, h := range hours {
+		expected := start.Add(time.Duration(h) * time.Hour)
+		if !dagruns[idx].AtTime.Equal(expected) {
+			t.Errorf("Expected dag run %d at %v, got %v", idx, expected,
+				dagruns[idx].AtTime)
+		}
+	}
+}
+
+func TestPopDagRunsPendingLimit(t *testing.T) {
+	drQueue := ds.NewSimpleQueue[DagRun](100)
+	config := DefaultTaskSchedulerConfig
+	config.MaxPendingDagRuns = 3
+	ts := TaskScheduler{DagRunQueue: &drQueue, Config: config}
+	start := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		dagrun := DagRun{DagId: "dag1",
+			AtTime: start.Add(time.Duration(i) * time.Hour)}
+		ds.PutContext(context.Background(), ts.DagRunQueue, dagrun)
+	}
+	adr := newActiveDagRuns(1)
+
+	ts.popDagRuns(adr)
+	if adr.pendingNum() != 3 || ts.DagRunQueue.Size() != 2 {
+		t.Errorf("Expected 3 pending and 2 queued dag runs, got %d and %d",
+			adr.pendingNum(), ts.DagRunQueue.Size())
+	}
+	toStart := adr.next(noDagRunsLimit)
+	checkDagRunsExecTimes(t, toStart, start, 0)
+	ts.popDagRuns(adr)
+	if adr.pendingNum() != 3 || ts.DagRunQueue.Size() != 1 {
+		t.Errorf("Expected 3 pending and 1 queued dag runs, got %d and %d",
+			adr.pendingNum(), ts.DagRunQueue.Size())
+	}
+}
+
+func TestPopDagRunsPendingLimitPerDag(t *testing.T) {
+	drQueue := ds.NewSimpleQueue[DagRun](100)
+	config := DefaultTaskSchedulerConfig
+	config.MaxPendingDagRuns = 2
+	ts := TaskScheduler{DagRunQueue: &drQueue, Config: config}
+	start := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	// Throttled dag1 catches up, before dag2 run is scheduled
+	for i := 4; i >= 0; i-- {
+		dagrun := DagRun{DagId: "dag1",
+			AtTime: start.Add(time.Duration(i) * time.Hour)}
+		ds.PutContext(context.Background(), ts.DagRunQueue, dagrun)
+	}
+	dag2Run := DagRun{DagId: "dag2", AtTime: start.Add(10 * time.Hour)}
+	ds.PutContext(context.Background(), ts.DagRunQueue, dag2Run)
+	adr := newActiveDagRuns(0)
+	dag1Limit := func(dagId dag.Id) int {
+		if dagId == "dag1" {
+			return 1
+		}
+		return 0
+	}
+
+	ts.popDagRuns(adr)
+	if adr.pendingNumOf("dag1") != 2 || adr.pendingNumOf("dag2") != 1 {
+		t.Errorf("Expected 2 pending runs of dag1 and 1 of dag2, got %d and "+
+			"%d", adr.pendingNumOf("dag1"), adr.pendingNumOf("dag2"))
+	}
+	if ts.DagRunQueue.Size() != 3 {
+		t.Errorf("Expected 3 dag runs of dag1 back on the queue, got %d",
+			ts.DagRunQueue.Size())
+	}
+	toStart := adr.next(dag1Limit)
+	if len(toStart) != 2 || toStart[0].DagId != "dag1" ||
+		toStart[1] != dag2Run {
+		t.Fatalf("Expected first dag1 run and dag2 run to start, got %v",
+			toStart)
+	}
+	checkDagRunsExecTimes(t, toStart[:1], start, 0)
+
+	// Dag runs put back onto the queue are still taken in exec time order
+	adr.done(toStart[0])
+	ts.popDagRuns(adr)
+	checkDagRunsExecTimes(t, adr.next(dag1Limit), start, 1)
+	adr.done(DagRun{DagId: "dag1", AtTime: start.Add(time.Hour)})
+	checkDagRunsExecTimes(t, adr.next(dag1Limit), start, 2)
+	if ts.DagRunQueue.Size() != 2 {
+		t.Errorf("Expected 2 dag runs of dag1 on the queue, got %d",
+			ts.DagRunQueue.Size())
+	}
+}
@@ -0,0 +1,363 @@
+package scheduler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// Prefix of read-only JSON API endpoints. It's bumped on incompatible
+// changes of responses.
+const apiPrefix = "/api/v1"
+
+const (
+	defaultApiPageLimit = 100
+	maxApiPageLimit     = 1000
+)
+
+func (s *Scheduler) registerApiEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc(apiPrefix+"/dags", s.apiDags)
+	mux.HandleFunc(apiPrefix+"/dag", s.apiDag)
+	mux.HandleFunc(apiPrefix+"/dagruns", s.apiDagRuns)
+	mux.HandleFunc(apiPrefix+"/dagruntasks", s.apiDagRunTasks)
+}
+
+// HTTP handler for listing DAGs. Optional tag query parameter limits DAGs to
+// those of given tag. Only DAGs which the principal is allowed to view are
+// listed.
+func (s *Scheduler) apiDags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	dags, dbErr := s.dbClient.ReadDags(r.Context(), r.URL.Query().Get("tag"))
+	if dbErr != nil {
+		msg := fmt.Sprintf("Cannot read DAGs: %s", dbErr.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	result := make([]models.DagInfo, 0, len(dags))
+	for _, d := range dags {
+		if !s.allowed(r, ActionViewDag, d.DagId) {
+			continue
+		}
+		result = append(result, toDagInfo(d))
+	}
+	writeJson(w, result)
+}
+
+// HTTP handler for details of a single DAG (dagId query parameter), including
+// current versions of its tasks. Parents and children of tasks are known only
+// for DAGs registered in this scheduler.
+func (s *Scheduler) apiDag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	dagId := r.URL.Query().Get("dagId")
+	if dagId == "" {
+		http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+		return
+	}
+	if !s.authorize(w, r, ActionViewDag, dagId) {
+		return
+	}
+	d, dbErr := s.dbClient.ReadDag(r.Context(), dagId)
+	if dbErr == sql.ErrNoRows {
+		msg := fmt.Sprintf("DAG %s does not exist", dagId)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+	if dbErr != nil {
+		msg := fmt.Sprintf("Cannot read DAG %s: %s", dagId, dbErr.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	tasks, tErr := s.dbClient.ReadDagTasks(r.Context(), dagId)
+	if tErr != nil {
+		msg := fmt.Sprintf("Cannot read tasks of DAG %s: %s", dagId,
+			tErr.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	parents := map[string][]string{}
+	children := map[string][]string{}
+	if registered, err := dag.Get(dag.Id(dagId)); err == nil {
+		parents = registered.TaskParents()
+		for taskId, taskParents := range parents {
+			for _, parentId := range taskParents {
+				children[parentId] = append(children[parentId], taskId)
+			}
+		}
+		for _, taskChildren := range children {
+			sort.Strings(taskChildren)
+		}
+	}
+	details := models.DagDetails{
+		DagInfo: toDagInfo(d),
+		Tasks:   make([]models.DagTaskInfo, 0, len(tasks)),
+	}
+	for _, task := range tasks {
+		if !task.IsCurrent {
+			continue
+		}
+		details.Tasks = append(details.Tasks, models.DagTaskInfo{
+			TaskId:       task.TaskId,
+			TaskTypeName: task.TaskTypeName,
+			InsertTs:     task.InsertTs,
+			Version:      task.Version,
+			Parents:      nonNil(parents[task.TaskId]),
+			Children:     nonNil(children[task.TaskId]),
+		})
+	}
+	writeJson(w, details)
+}
+
+// HTTP handler for listing DAG runs, starting from the most recent. DAG runs
+// can be filtered by dagId, status, tag and range of execution timestamps
+// (from inclusive, to exclusive). Results are paginated by limit (default
+// 100, at most 1000) and offset parameters. DAG runs which the principal is
+// not allowed to view are skipped, so a page might contain less than limit
+// DAG runs even when NextOffset is set.
+func (s *Scheduler) apiDagRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	filter := db.DagRunFilter{
+		DagId:  query.Get("dagId"),
+		Status: query.Get("status"),
+		Tag:    query.Get("tag"),
+	}
+	if filter.Status != "" {
+		if _, err := dag.ParseRunStatus(filter.Status); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var pErr error
+	if filter.ExecTsFrom, pErr = parseApiTimestamp(query.Get("from")); pErr != nil {
+		http.Error(w, "Parameter from: "+pErr.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.ExecTsTo, pErr = parseApiTimestamp(query.Get("to")); pErr != nil {
+		http.Error(w, "Parameter to: "+pErr.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, lErr := parseNonNegativeInt(query.Get("limit"), defaultApiPageLimit)
+	if lErr != nil || limit == 0 || limit > maxApiPageLimit {
+		msg := fmt.Sprintf("Parameter limit should be integer between 1 and "+
+			"%d, got: %s", maxApiPageLimit, query.Get("limit"))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	offset, oErr := parseNonNegativeInt(query.Get("offset"), 0)
+	if oErr != nil {
+		msg := fmt.Sprintf("Parameter offset should be non-negative integer, "+
+			"got: %s", query.Get("offset"))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	// One more DAG run is read to find out if there is a next page
+	filter.Limit = limit + 1
+	filter.Offset = offset
+
+	dagruns, dbErr := s.dbClient.ReadDagRunsFiltered(r.Context(), filter)
+	if dbErr != nil {
+		msg := fmt.Sprintf("Cannot read DAG runs: %s", dbErr.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	page := models.DagRunsPage{
+		DagRuns: make([]models.DagRunInfo, 0, limit),
+		Limit:   limit,
+		Offset:  offset,
+	}
+	if len(dagruns) > limit {
+		nextOffset := offset + limit
+		page.NextOffset = &nextOffset
+		dagruns = dagruns[:limit]
+	}
+	for _, dr := range dagruns {
+		if !s.allowed(r, ActionViewDag, dr.DagId) {
+			continue
+		}
+		page.DagRuns = append(page.DagRuns, models.DagRunInfo{
+			RunId:          dr.RunId,
+			DagId:          dr.DagId,
+			ExecTs:         dr.ExecTs,
+			InsertTs:       dr.InsertTs,
+			Status:         dr.Status,
+			StatusUpdateTs: dr.StatusUpdateTs,
+			Version:        dr.Version,
+			Params:         dagRunInfoParams(dr),
+		})
+	}
+	writeJson(w, page)
+}
+
+// HTTP handler for listing task instances of a DAG run (dagId and execTs
+// query parameters). Optional status parameter limits tasks to those of given
+// status.
+func (s *Scheduler) apiDagRunTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	dagId := query.Get("dagId")
+	if dagId == "" {
+		http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+		return
+	}
+	execTs, tErr := timeutils.FromString(query.Get("execTs"))
+	if tErr != nil {
+		msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
+			tErr.Error())
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	status := query.Get("status")
+	if status != "" {
+		if _, err := dag.ParseTaskStatus(status); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !s.authorize(w, r, ActionViewDag, dagId) {
+		return
+	}
+	drts, dbErr := s.dbClient.ReadDagRunTasks(r.Context(), dagId,
+		timeutils.ToString(execTs))
+	if dbErr != nil {
+		msg := fmt.Sprintf("Cannot read dag run tasks: %s", dbErr.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	result := make([]models.DagRunTaskInfo, 0, len(drts))
+	for _, drt := range drts {
+		if status != "" && drt.Status != status {
+			continue
+		}
+		info := models.DagRunTaskInfo{
+			DagId:          drt.DagId,
+			ExecTs:         drt.ExecTs,
+			TaskId:         drt.TaskId,
+			InsertTs:       drt.InsertTs,
+			Status:         drt.Status,
+			StatusUpdateTs: drt.StatusUpdateTs,
+			Version:        drt.Version,
+		}
+		if drt.ExecutorId != nil {
+			info.ExecutorId = *drt.ExecutorId
+		}
+		if drt.Rendered != nil {
+			rendered, rErr := dag.ParseRendered(*drt.Rendered)
+			if rErr != nil {
+				slog.Error("Cannot parse rendered task templates", "dagId",
+					drt.DagId, "execTs", drt.ExecTs, "taskId", drt.TaskId,
+					"err", rErr)
+			}
+			info.Rendered = rendered
+		}
+		result = append(result, info)
+	}
+	writeJson(w, result)
+}
+
+func toDagInfo(d db.Dag) models.DagInfo {
+	info := models.DagInfo{
+		DagId:    d.DagId,
+		Tags:     []string{},
+		IsPaused: d.IsPaused,
+		CreateTs: d.CreateTs,
+	}
+	if d.StartTs != nil {
+		info.StartTs = *d.StartTs
+	}
+	if d.Schedule != nil {
+		info.Schedule = *d.Schedule
+	}
+	if d.LatestUpdateTs != nil {
+		info.LatestUpdateTs = *d.LatestUpdateTs
+	}
+	var attr dag.Attr
+	if err := json.Unmarshal([]byte(d.Attributes), &attr); err == nil {
+		info.Tags = nonNil(attr.Tags)
+	}
+	return info
+}
+
+// Parses optional timestamp query parameter into format stored in the
+// database. Empty string is returned for empty parameter.
+func parseApiTimestamp(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	t, err := timeutils.FromString(s)
+	if err != nil {
+		return "", fmt.Errorf("timestamp in incorrect format: %w", err)
+	}
+	return timeutils.ToString(t), nil
+}
+
+// Parses optional non-negative integer query parameter. Default value is
+// returned for empty parameter.
+func parseNonNegativeInt(s string, defaultValue int) (int, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("expected non-negative integer, got: %d", value)
+	}
+	return value, nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func writeJson(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	jsonErr := json.NewEncoder(w).Encode(value)
+	if jsonErr != nil {
+		http.Error(w, jsonErr.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Returns parameters of given DAG run for the API. Nil is returned for DAG runs
+// without parameters.
+func dagRunInfoParams(dr db.DagRun) map[string]any {
+	if dr.Params == nil {
+		return nil
+	}
+	params, err := dag.ParseParams(*dr.Params)
+	if err != nil {
+		slog.Error("Cannot parse dag run parameters", "dagId", dr.DagId,
+			"execTs", dr.ExecTs, "err", err)
+		return nil
+	}
+	return params
+}
@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestApiDagsAndDagRuns(t *testing.T) {
+	c, err := db.NewSqliteTmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.CleanUpSqliteTmp(c, t)
+	ctx := context.Background()
+
+	start := dag.Node{Task: EmptyTask{TaskId: "start"}}
+	end := dag.Node{Task: EmptyTask{TaskId: "end"}}
+	start.Next(&end)
+	d := dag.New("mock_dag_api").AddRoot(&start).
+		AddAttributes(dag.Attr{Tags: []string{"reporting"}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	other := dag.Node{Task: EmptyTask{TaskId: "other"}}
+	d2 := dag.New("mock_dag_api_other").AddRoot(&other).Done()
+	for _, dg := range []dag.Dag{d, d2} {
+		if uErr := c.UpsertDag(ctx, dg); uErr != nil {
+			t.Fatal(uErr)
+		}
+		if iErr := c.InsertDagTasks(ctx, dg); iErr != nil {
+			t.Fatal(iErr)
+		}
+	}
+	execTs := time.Date(2023, time.October, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		ts := timeutils.ToString(execTs.Add(time.Duration(i) * time.Hour))
+		for _, dagId := range []string{"mock_dag_api", "mock_dag_api_other"} {
+			if _, iErr := c.InsertDagRun(ctx, dagId, ts); iErr != nil {
+				t.Fatal(iErr)
+			}
+		}
+	}
+
+	config := DefaultConfig
+	config.Policy = NewPolicy(RoleBinding{Principal: "bob",
+		Role: RoleViewer, Tags: []string{"reporting"}})
+	s := New(c, Queues{}, config)
+	mux := http.NewServeMux()
+	s.registerApiEndpoints(mux)
+	get := func(target string, result any) int {
+		req := httptest.NewRequest("GET", target, nil)
+		reqCtx := context.WithValue(req.Context(), principalCtxKey{},
+			Principal{Name: "bob"})
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req.WithContext(reqCtx))
+		if rec.Code == http.StatusOK {
+			if jErr := json.NewDecoder(rec.Body).Decode(result); jErr != nil {
+				t.Fatalf("Cannot decode response of %s: %s", target,
+					jErr.Error())
+			}
+		}
+		return rec.Code
+	}
+
+	var dags []models.DagInfo
+	if code := get("/api/v1/dags", &dags); code != http.StatusOK {
+		t.Fatalf("Expected 200 for DAGs, got %d", code)
+	}
+	if len(dags) != 1 || dags[0].DagId != "mock_dag_api" ||
+		len(dags[0].Tags) != 1 {
+		t.Errorf("Expected only mock_dag_api to be visible, got %+v", dags)
+	}
+
+	var details models.DagDetails
+	if code := get("/api/v1/dag?dagId=mock_dag_api", &details); code != http.StatusOK {
+		t.Fatalf("Expected 200 for DAG details, got %d", code)
+	}
+	if len(details.Tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %+v", details.Tasks)
+	}
+	for _, task := range details.Tasks {
+		if task.TaskId == "end" && (len(task.Parents) != 1 ||
+			task.Parents[0] != "start") {
+			t.Errorf("Expected start to be parent of end, got %+v", task)
+		}
+		if task.TaskId == "start" && (len(task.Children) != 1 ||
+			task.Children[0] != "end") {
+			t.Errorf("Expected end to be child of start, got %+v", task)
+		}
+	}
+	code := get("/api/v1/dag?dagId=mock_dag_api_other", &details)
+	if code != http.StatusForbidden {
+		t.Errorf("Expected 403 for DAG not visible to bob, got %d", code)
+	}
+
+	var page models.DagRunsPage
+	code = get("/api/v1/dagruns?tag=reporting&limit=2", &page)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 for DAG runs, got %d", code)
+	}
+	if len(page.DagRuns) != 2 || page.NextOffset == nil ||
+		*page.NextOffset != 2 {
+		t.Errorf("Expected first page of 2 DAG runs, got %+v", page)
+	}
+	page = models.DagRunsPage{}
+	code = get("/api/v1/dagruns?tag=reporting&limit=2&offset=2", &page)
+	if code != http.StatusOK || len(page.DagRuns) != 1 ||
+		page.NextOffset != nil {
+		t.Errorf("Expected last page of 1 DAG run, got %d %+v", code, page)
+	}
+	code = get("/api/v1/dagruns?limit=5000", &page)
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for limit above maximum, got %d", code)
+	}
+}
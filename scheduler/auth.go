@@ -0,0 +1,296 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dskrzypiec/scheduler/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUnauthenticated is returned by Authenticator, when given credentials
+// don't identify any known principal.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Principal is an authenticated caller of the scheduler - an executor or a
+// user.
+type Principal struct {
+	Name string
+}
+
+// Credentials presented by a caller of the scheduler, regardless of the
+// transport (HTTP or gRPC).
+type Credentials struct {
+	// Token from "Authorization: Bearer <token>" header.
+	BearerToken string
+
+	// Verified client certificates chain, when mutual TLS is used. The first
+	// certificate is the client certificate.
+	PeerCertificates []*x509.Certificate
+}
+
+// Authenticator identifies callers of the scheduler based on presented
+// credentials. When Config.Authenticator is set, each request to the
+// scheduler endpoints has to be authenticated. Authenticator should return
+// ErrUnauthenticated for unknown credentials.
+type Authenticator interface {
+	Authenticate(creds Credentials) (Principal, error)
+}
+
+// TokenAuthenticator authenticates callers by shared bearer tokens. Each
+// principal (e.g. executor) has its own token.
+type TokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator creates new TokenAuthenticator for given tokens of
+// principals (principal name -> token). Empty tokens are ignored.
+func NewTokenAuthenticator(tokens map[string]string) *TokenAuthenticator {
+	nonEmpty := make(map[string]string, len(tokens))
+	for name, token := range tokens {
+		if token != "" {
+			nonEmpty[name] = token
+		}
+	}
+	return &TokenAuthenticator{tokens: nonEmpty}
+}
+
+// Authenticate finds principal of given bearer token. Tokens are compared in
+// constant time.
+func (ta *TokenAuthenticator) Authenticate(creds Credentials) (Principal, error) {
+	if creds.BearerToken == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	given := []byte(creds.BearerToken)
+	found := ""
+	for name, token := range ta.tokens {
+		if subtle.ConstantTimeCompare(given, []byte(token)) == 1 {
+			found = name
+		}
+	}
+	if found == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	return Principal{Name: found}, nil
+}
+
+// CertAuthenticator authenticates callers by client certificates verified in
+// mutual TLS handshake. Principal name is the certificate common name. Server
+// has to be configured to verify client certificates (see ServerTLSConfig).
+type CertAuthenticator struct {
+	// When not empty, only certificates of those common names are accepted.
+	AllowedNames []string
+}
+
+// Authenticate returns principal of the client certificate.
+func (ca CertAuthenticator) Authenticate(creds Credentials) (Principal, error) {
+	if len(creds.PeerCertificates) == 0 {
+		return Principal{}, ErrUnauthenticated
+	}
+	name := creds.PeerCertificates[0].Subject.CommonName
+	if name == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	if len(ca.AllowedNames) == 0 {
+		return Principal{Name: name}, nil
+	}
+	for _, allowed := range ca.AllowedNames {
+		if allowed == name {
+			return Principal{Name: name}, nil
+		}
+	}
+	return Principal{}, ErrUnauthenticated
+}
+
+// AnyAuthenticator tries given authenticators in order and returns the first
+// authenticated principal. It can be used to accept both bearer tokens and
+// client certificates.
+func AnyAuthenticator(authenticators ...Authenticator) Authenticator {
+	return anyAuthenticator(authenticators)
+}
+
+type anyAuthenticator []Authenticator
+
+func (aa anyAuthenticator) Authenticate(creds Credentials) (Principal, error) {
+	for _, auth := range aa {
+		principal, err := auth.Authenticate(creds)
+		if err == nil {
+			return principal, nil
+		}
+		if err != ErrUnauthenticated {
+			return Principal{}, err
+		}
+	}
+	return Principal{}, ErrUnauthenticated
+}
+
+// ServerTLSConfig loads TLS configuration for the scheduler server. When
+// clientCAFile is given, client certificates signed by that CA are verified
+// (mutual TLS). Client certificates are optional on the TLS level, so bearer
+// tokens can still be used - CertAuthenticator rejects requests without
+// them. The same configuration should be used for HTTP server serving
+// handler returned by Scheduler.Start and Config.GrpcTLSConfig.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load server certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	caPem, rErr := os.ReadFile(clientCAFile)
+	if rErr != nil {
+		return nil, fmt.Errorf("cannot read client CA file: %w", rErr)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
+
+type principalCtxKey struct{}
+
+// Returns principal who made the request. It's false, when authentication is
+// disabled.
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return principal, ok
+}
+
+// Wraps handler with authentication. When authenticator is nil, handler is
+// returned unchanged.
+func withAuthentication(auth Authenticator, handler http.Handler) http.Handler {
+	if auth == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := auth.Authenticate(httpCredentials(r))
+		if err != nil {
+			if err != ErrUnauthenticated {
+				slog.Error("Authentication failed", "path", r.URL.Path, "err",
+					err)
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized,
+				models.ErrCodeUnauthenticated, "Authentication required")
+			return
+		}
+		ctx := context.WithValue(r.Context(), principalCtxKey{}, principal)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Reads credentials of HTTP request.
+func httpCredentials(r *http.Request) Credentials {
+	creds := Credentials{
+		BearerToken: bearerToken(r.Header.Get("Authorization")),
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		creds.PeerCertificates = r.TLS.VerifiedChains[0]
+	}
+	return creds
+}
+
+// Reads credentials of gRPC call from metadata and peer TLS info.
+func grpcCredentials(ctx context.Context) Credentials {
+	var creds Credentials
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		creds.BearerToken = bearerToken(values[0])
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		tlsInfo, isTls := p.AuthInfo.(credentials.TLSInfo)
+		if isTls && len(tlsInfo.State.VerifiedChains) > 0 {
+			creds.PeerCertificates = tlsInfo.State.VerifiedChains[0]
+		}
+	}
+	return creds
+}
+
+func bearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) ||
+		!strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// Authenticates gRPC call. Returns context with the principal.
+func authenticateGrpc(
+	ctx context.Context, auth Authenticator,
+) (context.Context, error) {
+	if auth == nil {
+		return ctx, nil
+	}
+	principal, err := auth.Authenticate(grpcCredentials(ctx))
+	if err != nil {
+		if err != ErrUnauthenticated {
+			slog.Error("Authentication failed", "err", err)
+		}
+		return ctx, status.Error(codes.Unauthenticated,
+			"Authentication required")
+	}
+	return context.WithValue(ctx, principalCtxKey{}, principal), nil
+}
+
+// Returns gRPC interceptors which authenticate calls.
+func grpcAuthInterceptors(
+	auth Authenticator,
+) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		authCtx, err := authenticateGrpc(ctx, auth)
+		if err != nil {
+			return nil, err
+		}
+		return handler(authCtx, req)
+	}
+	stream := func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		authCtx, err := authenticateGrpc(ss.Context(), auth)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: authCtx})
+	}
+	return unary, stream
+}
+
+// ServerStream with context containing authenticated principal.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (as *authenticatedStream) Context() context.Context {
+	return as.ctx
+}
@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	auth := NewTokenAuthenticator(map[string]string{
+		"executor-1": "secret-1",
+		"executor-2": "secret-2",
+		"disabled":   "",
+	})
+	principal, err := auth.Authenticate(Credentials{BearerToken: "secret-2"})
+	if err != nil || principal.Name != "executor-2" {
+		t.Errorf("Expected executor-2, got %v, %v", principal, err)
+	}
+	for _, token := range []string{"", "secret", "secret-10"} {
+		_, err := auth.Authenticate(Credentials{BearerToken: token})
+		if err != ErrUnauthenticated {
+			t.Errorf("Expected ErrUnauthenticated for token %q, got %v", token,
+				err)
+		}
+	}
+}
+
+func TestCertAuthenticator(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "executor-1"}}
+	creds := Credentials{PeerCertificates: []*x509.Certificate{cert}}
+
+	principal, err := CertAuthenticator{}.Authenticate(creds)
+	if err != nil || principal.Name != "executor-1" {
+		t.Errorf("Expected executor-1, got %v, %v", principal, err)
+	}
+	_, err = CertAuthenticator{AllowedNames: []string{"executor-2"}}.
+		Authenticate(creds)
+	if err != ErrUnauthenticated {
+		t.Errorf("Expected ErrUnauthenticated for not allowed name, got %v", err)
+	}
+	_, err = CertAuthenticator{}.Authenticate(Credentials{})
+	if err != ErrUnauthenticated {
+		t.Errorf("Expected ErrUnauthenticated without certificate, got %v", err)
+	}
+}
+
+func TestWithAuthentication(t *testing.T) {
+	auth := AnyAuthenticator(
+		NewTokenAuthenticator(map[string]string{"executor-1": "secret"}),
+		CertAuthenticator{},
+	)
+	var got Principal
+	handler := withAuthentication(auth, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			got, _ = principalFromContext(r.Context())
+		}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/dag/task/pop", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/dag/task/pop", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for incorrect token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/dag/task/pop", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || got.Name != "executor-1" {
+		t.Errorf("Expected executor-1 to be authenticated, got %d %v",
+			rec.Code, got)
+	}
+
+	req = httptest.NewRequest("GET", "/dag/task/pop", nil)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "executor-2"}}
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || got.Name != "executor-2" {
+		t.Errorf("Expected executor-2 to be authenticated, got %d %v",
+			rec.Code, got)
+	}
+}
+
+func TestGrpcAuthentication(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	config := DefaultConfig
+	config.Authenticator = NewTokenAuthenticator(map[string]string{
+		"executor-1": "secret",
+	})
+	client := grpcTestClient(t, ts, config)
+
+	_, err := client.Handshake(context.Background(), &models.Empty{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer secret")
+	if _, err := client.Handshake(ctx, &models.Empty{}); err != nil {
+		t.Errorf("Expected authenticated call to succeed, got %v", err)
+	}
+}
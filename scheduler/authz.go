@@ -0,0 +1,328 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Role determines which actions a principal is allowed to perform. Each role
+// includes permissions of lower roles, except RoleExecutor.
+type Role int
+
+const (
+	// Viewer can read DAGs, DAG runs and their statuses.
+	RoleViewer Role = iota + 1
+
+	// Operator can additionally pause, trigger, clear and cancel DAG runs and
+	// mark tasks.
+	RoleOperator
+
+	// Admin can additionally read the audit log and execute tasks.
+	RoleAdmin
+
+	// Executor can only pop tasks and report their statuses (executor
+	// endpoints). It's not part of the hierarchy of other roles.
+	RoleExecutor
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	case RoleExecutor:
+		return "executor"
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole parses role name (viewer, operator, admin or executor).
+func ParseRole(s string) (Role, error) {
+	roles := []Role{RoleViewer, RoleOperator, RoleAdmin, RoleExecutor}
+	for _, role := range roles {
+		if role.String() == s {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role: %s", s)
+}
+
+// Actions which require authorization.
+const (
+	ActionViewDag      = "dag.view"
+	ActionPauseDag     = "dag.pause"
+	ActionUnpauseDag   = "dag.unpause"
+	ActionTriggerDag   = "dag.trigger"
+	ActionClearTasks   = "dagrun.clear"
+	ActionMarkTasks    = "dagrun.mark"
+	ActionCancelDagRun = "dagrun.cancel"
+	ActionReadAuditLog = "auditlog.read"
+	ActionExecuteTasks = "tasks.execute"
+)
+
+// Minimal role required for each action. Actions not listed here require
+// admin role.
+var actionRoles = map[string]Role{
+	ActionViewDag:      RoleViewer,
+	ActionPauseDag:     RoleOperator,
+	ActionUnpauseDag:   RoleOperator,
+	ActionTriggerDag:   RoleOperator,
+	ActionClearTasks:   RoleOperator,
+	ActionMarkTasks:    RoleOperator,
+	ActionCancelDagRun: RoleOperator,
+	ActionReadAuditLog: RoleAdmin,
+	ActionExecuteTasks: RoleExecutor,
+}
+
+// Returns minimal role required for given action.
+func requiredRole(action string) Role {
+	if role, ok := actionRoles[action]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// Checks if the role grants permissions of required role. Executor role is
+// granted only to executors and admins.
+func (r Role) includes(required Role) bool {
+	if required == RoleExecutor {
+		return r == RoleExecutor || r == RoleAdmin
+	}
+	return r != RoleExecutor && r >= required
+}
+
+// Checks if given action is recorded in the audit log. Actions of viewers
+// are not recorded and neither are allowed executor actions, because
+// executors call the scheduler all the time.
+func audited(action string, allowed bool) bool {
+	switch requiredRole(action) {
+	case RoleViewer:
+		return false
+	case RoleExecutor:
+		return !allowed
+	}
+	return true
+}
+
+// AnyPrincipal can be used in RoleBinding to grant role to all principals.
+const AnyPrincipal = "*"
+
+// RoleBinding grants role to a principal. When Tags are not empty, the role is
+// granted only on DAGs which have at least one of those tags (see
+// dag.Attr.Tags) and doesn't cover actions unrelated to a DAG.
+type RoleBinding struct {
+	Principal string
+	Role      Role
+	Tags      []string
+}
+
+// Policy decides which principals are allowed to perform which actions, based
+// on role bindings. Principals without any binding are not allowed to do
+// anything.
+type Policy struct {
+	bindings []RoleBinding
+}
+
+// NewPolicy creates new Policy of given role bindings.
+func NewPolicy(bindings ...RoleBinding) *Policy {
+	return &Policy{bindings: bindings}
+}
+
+// Allows checks if given principal is allowed to perform given action. When
+// dagId is not empty, the action concerns that DAG and bindings scoped by tags
+// of the DAG are also taken into account.
+func (p *Policy) Allows(principal, action string, dagId dag.Id) bool {
+	required := requiredRole(action)
+	var dagTags []string
+	if dagId != "" {
+		if d, err := dag.Get(dagId); err == nil {
+			dagTags = d.Attr.Tags
+		}
+	}
+	for _, binding := range p.bindings {
+		if binding.Principal != principal && binding.Principal != AnyPrincipal {
+			continue
+		}
+		if !binding.Role.includes(required) {
+			continue
+		}
+		if len(binding.Tags) == 0 || hasAnyTag(dagTags, binding.Tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyTag(tags, expected []string) bool {
+	for _, tag := range tags {
+		for _, e := range expected {
+			if tag == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Name of principal of requests, when authentication is disabled.
+const anonymousPrincipal = "anonymous"
+
+// Checks if principal of the request is allowed to perform given action, on
+// the DAG (dagId can be empty). When Config.Policy is nil, all actions are
+// allowed. Actions which require more than viewer role are recorded in the
+// audit log, also when they are denied (executor actions only when denied).
+// If the action is not allowed, then 403 response is written and false is
+// returned.
+func (s *Scheduler) authorize(
+	w http.ResponseWriter, r *http.Request, action, dagId string,
+) bool {
+	principal := requestPrincipal(r)
+	allowed := s.allowed(r, action, dagId)
+	if audited(action, allowed) {
+		s.audit(r.Context(), principal, action, dagId, r.URL.RawQuery, allowed)
+	}
+	if !allowed {
+		slog.Warn("Action denied", "principal", principal, "action", action,
+			"dagId", dagId)
+		msg := fmt.Sprintf("Principal %s is not allowed to perform %s",
+			principal, action)
+		writeError(w, r, http.StatusForbidden, models.ErrCodeForbidden, msg)
+		return false
+	}
+	return true
+}
+
+// Checks if principal of the request is allowed to perform given action, on
+// the DAG, without writing any response nor audit log entry. It's used to
+// filter lists returned by read-only endpoints.
+func (s *Scheduler) allowed(r *http.Request, action, dagId string) bool {
+	return s.config.Policy == nil ||
+		s.config.Policy.Allows(requestPrincipal(r), action, dag.Id(dagId))
+}
+
+// Returns name of principal of the request or anonymousPrincipal, when
+// authentication is disabled.
+func requestPrincipal(r *http.Request) string {
+	return contextPrincipal(r.Context())
+}
+
+// Returns name of principal stored in given context or anonymousPrincipal,
+// when authentication is disabled.
+func contextPrincipal(ctx context.Context) string {
+	if p, ok := principalFromContext(ctx); ok {
+		return p.Name
+	}
+	return anonymousPrincipal
+}
+
+// Wraps handler of executor endpoint, so it's available only for principals
+// allowed to execute tasks.
+func (s *Scheduler) withExecutorAuthorization(
+	handler http.HandlerFunc,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorize(w, r, ActionExecuteTasks, "") {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Checks if principal of gRPC call is allowed to execute tasks. Denied calls
+// are recorded in the audit log and PermissionDenied error is returned.
+func (s *Scheduler) authorizeGrpc(ctx context.Context, method string) error {
+	principal := contextPrincipal(ctx)
+	if s.config.Policy == nil ||
+		s.config.Policy.Allows(principal, ActionExecuteTasks, "") {
+		return nil
+	}
+	s.audit(ctx, principal, ActionExecuteTasks, "", method, false)
+	slog.Warn("Action denied", "principal", principal, "action",
+		ActionExecuteTasks, "method", method)
+	return status.Errorf(codes.PermissionDenied,
+		"Principal %s is not allowed to perform %s", principal,
+		ActionExecuteTasks)
+}
+
+// Records action in the audit log. Errors are only logged, so the action is
+// not blocked by audit log failures.
+func (s *Scheduler) audit(
+	ctx context.Context, principal, action, dagId, details string, allowed bool,
+) {
+	entry := db.AuditLogEntry{
+		Principal: principal,
+		Action:    action,
+		Allowed:   allowed,
+	}
+	if dagId != "" {
+		entry.DagId = &dagId
+	}
+	if details != "" {
+		entry.Details = &details
+	}
+	if err := s.dbClient.InsertAuditLog(ctx, entry); err != nil {
+		slog.Error("Cannot record action in audit log", "principal",
+			principal, "action", action, "dagId", dagId, "err", err)
+	}
+}
+
+// HTTP handler for reading the audit log. Optional limit query parameter
+// determines number of the latest entries (default 100, at most 1000).
+func (s *Scheduler) auditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed,
+			models.ErrCodeMethodNotAllowed, "Only GET requests are allowed")
+		return
+	}
+	if !s.authorize(w, r, ActionReadAuditLog, "") {
+		return
+	}
+	limitStr := r.URL.Query().Get("limit")
+	limit, lErr := parseNonNegativeInt(limitStr, defaultApiPageLimit)
+	if lErr != nil || limit == 0 || limit > maxApiPageLimit {
+		msg := fmt.Sprintf("Parameter limit should be integer between 1 and "+
+			"%d, got: %s", maxApiPageLimit, limitStr)
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, msg)
+		return
+	}
+	entries, dbErr := s.dbClient.ReadAuditLog(r.Context(), limit)
+	if dbErr != nil {
+		msg := fmt.Sprintf("Cannot read audit log: %s", dbErr.Error())
+		writeError(w, r, http.StatusInternalServerError,
+			models.ErrCodeInternal, msg)
+		return
+	}
+	result := make([]models.AuditLogEntry, len(entries))
+	for idx, entry := range entries {
+		result[idx] = models.AuditLogEntry{
+			InsertTs:  entry.InsertTs,
+			Principal: entry.Principal,
+			Action:    entry.Action,
+			Allowed:   entry.Allowed,
+		}
+		if entry.DagId != nil {
+			result[idx].DagId = *entry.DagId
+		}
+		if entry.Details != nil {
+			result[idx].Details = *entry.Details
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonErr := json.NewEncoder(w).Encode(result)
+	if jsonErr != nil {
+		writeError(w, r, http.StatusInternalServerError,
+			models.ErrCodeInternal, jsonErr.Error())
+	}
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	root := dag.Node{Task: EmptyTask{TaskId: "start"}}
+	d := dag.New("mock_dag_authz").AddRoot(&root).
+		AddAttributes(dag.Attr{Tags: []string{"finance"}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	policy := NewPolicy(
+		RoleBinding{Principal: "alice", Role: RoleAdmin},
+		RoleBinding{Principal: "bob", Role: RoleOperator,
+			Tags: []string{"finance"}},
+		RoleBinding{Principal: "carol", Role: RoleOperator,
+			Tags: []string{"marketing"}},
+		RoleBinding{Principal: "exec-1", Role: RoleExecutor},
+		RoleBinding{Principal: AnyPrincipal, Role: RoleViewer},
+	)
+	data := []struct {
+		principal string
+		action    string
+		dagId     dag.Id
+		expected  bool
+	}{
+		{"alice", ActionPauseDag, d.Id, true},
+		{"alice", ActionReadAuditLog, "", true},
+		{"bob", ActionPauseDag, d.Id, true},
+		{"bob", ActionPauseDag, "other_dag", false},
+		{"bob", ActionReadAuditLog, "", false},
+		{"carol", ActionPauseDag, d.Id, false},
+		{"carol", ActionViewDag, d.Id, true},
+		{"dave", ActionViewDag, d.Id, true},
+		{"dave", ActionUnpauseDag, d.Id, false},
+		{"dave", "unknown.action", "", false},
+		{"alice", ActionExecuteTasks, "", true},
+		{"bob", ActionExecuteTasks, "", false},
+		{"dave", ActionExecuteTasks, "", false},
+		{"exec-1", ActionExecuteTasks, "", true},
+		{"exec-1", ActionViewDag, d.Id, true},
+		{"exec-1", ActionPauseDag, d.Id, false},
+		{"exec-1", ActionReadAuditLog, "", false},
+	}
+	for _, input := range data {
+		allowed := policy.Allows(input.principal, input.action, input.dagId)
+		if allowed != input.expected {
+			t.Errorf("Expected Allows(%s, %s, %s) = %v, got %v",
+				input.principal, input.action, input.dagId, input.expected,
+				allowed)
+		}
+	}
+}
+
+func TestAuthorizeRecordsAuditLog(t *testing.T) {
+	c, err := db.NewSqliteTmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.CleanUpSqliteTmp(c, t)
+	config := DefaultConfig
+	config.Policy = NewPolicy(
+		RoleBinding{Principal: "alice", Role: RoleOperator},
+		RoleBinding{Principal: "bob", Role: RoleViewer},
+	)
+	s := New(c, Queues{}, config)
+	request := func(principal, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, nil)
+		ctx := context.WithValue(req.Context(), principalCtxKey{},
+			Principal{Name: principal})
+		rec := httptest.NewRecorder()
+		s.pauseDag(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	rec := request("bob", "/dag/pause?dagId=d1")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for viewer, got %d", rec.Code)
+	}
+	rec = request("alice", "/dag/pause?dagId=d1")
+	if rec.Code == http.StatusForbidden {
+		t.Errorf("Expected operator to be allowed, got %d", rec.Code)
+	}
+
+	entries, rErr := c.ReadAuditLog(context.Background(), 10)
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit log entries, got %d", len(entries))
+	}
+	if entries[0].Principal != "alice" || !entries[0].Allowed ||
+		entries[0].Action != ActionPauseDag {
+		t.Errorf("Expected allowed pause of alice, got %+v", entries[0])
+	}
+	if entries[1].Principal != "bob" || entries[1].Allowed {
+		t.Errorf("Expected denied action of bob, got %+v", entries[1])
+	}
+}
+
+func TestExecutorEndpointsRequireExecutorRole(t *testing.T) {
+	c, err := db.NewSqliteTmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.CleanUpSqliteTmp(c, t)
+	config := DefaultConfig
+	config.Policy = NewPolicy(
+		RoleBinding{Principal: "exec-1", Role: RoleExecutor},
+		RoleBinding{Principal: "alice", Role: RoleOperator},
+	)
+	s := New(c, Queues{}, config)
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	mux := http.NewServeMux()
+	s.registerEndpoints(mux, ts)
+	request := func(principal string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/dag/task/pop", nil)
+		req.Header.Set(models.ProtocolVersionHeader,
+			strconv.Itoa(version.ProtocolVersion))
+		ctx := context.WithValue(req.Context(), principalCtxKey{},
+			Principal{Name: principal})
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	if rec := request("alice"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for operator, got %d", rec.Code)
+	}
+	if rec := request("exec-1"); rec.Code == http.StatusForbidden {
+		t.Errorf("Expected executor to be allowed, got %d", rec.Code)
+	}
+
+	entries, rErr := c.ReadAuditLog(context.Background(), 10)
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected only denied call in audit log, got %+v", entries)
+	}
+	if entries[0].Principal != "alice" || entries[0].Allowed ||
+		entries[0].Action != ActionExecuteTasks {
+		t.Errorf("Expected denied task execution of alice, got %+v",
+			entries[0])
+	}
+}
+
+func TestAuditLogLimit(t *testing.T) {
+	c, err := db.NewSqliteTmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.CleanUpSqliteTmp(c, t)
+	config := DefaultConfig
+	config.Policy = NewPolicy(RoleBinding{Principal: "root", Role: RoleAdmin})
+	s := New(c, Queues{}, config)
+	request := func(limit string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/auditlog?limit="+limit, nil)
+		req.Header.Set(models.ProtocolVersionHeader,
+			strconv.Itoa(version.ProtocolVersion))
+		ctx := context.WithValue(req.Context(), principalCtxKey{},
+			Principal{Name: "root"})
+		rec := httptest.NewRecorder()
+		s.auditLog(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	if rec := request(strconv.Itoa(maxApiPageLimit)); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for maximum limit, got %d", rec.Code)
+	}
+	for _, limit := range []string{"0", "-1", "x",
+		strconv.Itoa(maxApiPageLimit + 1)} {
+		rec := request(limit)
+		var errResp models.ErrorResponse
+		if jErr := json.Unmarshal(rec.Body.Bytes(), &errResp); jErr != nil {
+			t.Fatalf("Expected error envelope, got %s", rec.Body.String())
+		}
+		if rec.Code != http.StatusBadRequest ||
+			errResp.Error.Code != models.ErrCodeBadRequest {
+			t.Errorf("Expected 400 %s for limit %s, got %d %s",
+				models.ErrCodeBadRequest, limit, rec.Code, errResp.Error.Code)
+		}
+	}
+}
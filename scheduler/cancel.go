@@ -0,0 +1,353 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// ErrDagRunFinished is returned on cancelling a DAG run which is already
+// finished.
+var ErrDagRunFinished = errors.New("dag run is already finished")
+
+// CancelDagRun cancels DAG run which is not finished yet. Scheduling of new
+// tasks for the DAG run is stopped, scheduled tasks are removed from the task
+// queue and running tasks are marked as CANCELLED. Executors of running tasks
+// get cancellation signal in the next heartbeat response. The DAG run ends up
+// in CANCELLED status. Returns identifiers of cancelled tasks in topological
+// order.
+func (ts *TaskScheduler) CancelDagRun(
+	ctx context.Context, dagrun DagRun,
+) ([]string, error) {
+	d, dagErr := dag.Get(dagrun.DagId)
+	if dagErr != nil {
+		return nil, dagErr
+	}
+	dagId := string(dagrun.DagId)
+	execTs := timeutils.ToString(dagrun.AtTime)
+	dbDagRun, rErr := ts.DbClient.ReadDagRun(ctx, dagId, execTs)
+	if rErr != nil {
+		return nil, rErr
+	}
+	runStatus, _ := dag.ParseRunStatus(dbDagRun.Status)
+	switch runStatus {
+	case dag.RunSuccess, dag.RunFailed, dag.RunCancelled:
+		return nil, fmt.Errorf("%w: status %s", ErrDagRunFinished,
+			dbDagRun.Status)
+	}
+
+	if sErr := ts.stopDagRun(ctx, dagrun, dag.RunCancelled); sErr != nil {
+		return nil, sErr
+	}
+
+	cancelledTaskIds := make([]string, 0)
+	for _, taskId := range d.Graph().TopologicalOrder() {
+		status, sErr := ts.getDagRunTaskStatus(dagrun, taskId)
+		if sErr == sql.ErrNoRows {
+			continue
+		}
+		if sErr != nil {
+			return cancelledTaskIds, sErr
+		}
+		if status != dag.TaskScheduled && status != dag.TaskRunning {
+			continue
+		}
+		drt := DagRunTask{DagId: dagrun.DagId, AtTime: dagrun.AtTime,
+			TaskId: taskId}
+		uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskCancelled)
+		if uErr != nil {
+			return cancelledTaskIds, uErr
+		}
+		cancelledTaskIds = append(cancelledTaskIds, taskId)
+	}
+	if rq, ok := ts.TaskQueue.(ds.RemovableQueue[DagRunTask]); ok {
+		removed := rq.RemoveWhere(func(drt DagRunTask) bool {
+			return drt.DagId == dagrun.DagId && drt.AtTime.Equal(dagrun.AtTime)
+		})
+		slog.Info("Removed cancelled tasks from the queue", "dagrun", dagrun,
+			"removed", removed)
+	}
+	sErr := ts.signalCancelledTasks(ctx, dagrun, cancelledTaskIds)
+	if sErr != nil {
+		return cancelledTaskIds, sErr
+	}
+	slog.Info("Cancelled dag run", "dagrun", dagrun, "cancelledTaskIds",
+		cancelledTaskIds)
+	return cancelledTaskIds, nil
+}
+
+// Sets given final status of the DAG run and stops its scheduling, if it's
+// being scheduled. It waits until the scheduling is finished, so no new tasks
+// of the DAG run are scheduled after that.
+func (ts *TaskScheduler) stopDagRun(
+	ctx context.Context, dagrun DagRun, status dag.RunStatus,
+) error {
+	dagId := string(dagrun.DagId)
+	execTs := timeutils.ToString(dagrun.AtTime)
+	// DAG run which is not being scheduled yet, won't be started once it's
+	// finished.
+	uErr := ts.DbClient.UpdateDagRunStatusByExecTs(ctx, dagId, execTs,
+		status.String())
+	if uErr != nil {
+		return uErr
+	}
+	done, active := ts.scheduledRuns.cancel(dagrun)
+	if !active {
+		return nil
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// Scheduling might have set RUNNING status in the meantime
+	return ts.DbClient.UpdateDagRunStatusByExecTs(ctx, dagId, execTs,
+		status.String())
+}
+
+// Prepares cancellation signals for executors of given tasks. Tasks executed
+// by LocalExecutor are cancelled right away. Tasks without an owner, which
+// haven't been popped by any executor yet, are skipped.
+func (ts *TaskScheduler) signalCancelledTasks(
+	ctx context.Context, dagrun DagRun, taskIds []string,
+) error {
+	if len(taskIds) == 0 {
+		return nil
+	}
+	execTs := timeutils.ToString(dagrun.AtTime)
+	drts, dbErr := ts.DbClient.ReadDagRunTasks(ctx, string(dagrun.DagId),
+		execTs)
+	if dbErr != nil {
+		return dbErr
+	}
+	toSignal := make(map[string]struct{}, len(taskIds))
+	for _, taskId := range taskIds {
+		toSignal[taskId] = struct{}{}
+	}
+	for _, drt := range drts {
+		if _, ok := toSignal[drt.TaskId]; !ok {
+			continue
+		}
+		if drt.ExecutorId == nil {
+			ts.localTasks.cancel(DagRunTask{DagId: dagrun.DagId,
+				AtTime: dagrun.AtTime, TaskId: drt.TaskId})
+			continue
+		}
+		ts.cancelledTasks.add(*drt.ExecutorId, models.TaskToExec{
+			DagId:  drt.DagId,
+			ExecTs: execTs,
+			TaskId: drt.TaskId,
+		})
+	}
+	return nil
+}
+
+// HTTP handler for cancelling DAG run, given by dagId and execTs query
+// parameters (see TaskScheduler.CancelDagRun).
+func (s *Scheduler) cancelDagRun(ts *TaskScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST requests are allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		dagId := query.Get("dagId")
+		if dagId == "" {
+			http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+			return
+		}
+		execTs, tErr := timeutils.FromString(query.Get("execTs"))
+		if tErr != nil {
+			msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
+				tErr.Error())
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(w, r, ActionCancelDagRun, dagId) {
+			return
+		}
+		if _, dagErr := dag.Get(dag.Id(dagId)); dagErr != nil {
+			http.Error(w, dagErr.Error(), http.StatusNotFound)
+			return
+		}
+
+		dagrun := DagRun{DagId: dag.Id(dagId), AtTime: execTs}
+		cancelled, err := ts.CancelDagRun(r.Context(), dagrun)
+		switch {
+		case err == nil:
+		case errors.Is(err, sql.ErrNoRows):
+			msg := fmt.Sprintf("There is no dag run for DAG %s at %s", dagId,
+				query.Get("execTs"))
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		case errors.Is(err, ErrDagRunFinished):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			msg := fmt.Sprintf("Cannot cancel dag run: %s", err.Error())
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, models.CancelDagRunResponse{
+			DagId:            dagId,
+			ExecTs:           timeutils.ToString(execTs),
+			CancelledTaskIds: cancelled,
+		})
+	}
+}
+
+// Registry of DAG runs which are being scheduled by TaskScheduler, so their
+// scheduling can be cancelled. Zero value is ready to use and it's safe for
+// concurrent use.
+type scheduledDagRuns struct {
+	sync.Mutex
+	runs map[dagRunKey]scheduledDagRun
+}
+
+// DAG runs are identified by serialized execution timestamp, so the same DAG
+// run is found regardless of time.Time location.
+type dagRunKey struct {
+	DagId  dag.Id
+	ExecTs string
+}
+
+func newDagRunKey(dagrun DagRun) dagRunKey {
+	return dagRunKey{DagId: dagrun.DagId,
+		ExecTs: timeutils.ToString(dagrun.AtTime)}
+}
+
+type scheduledDagRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Registers given DAG run and returns context for its scheduling.
+func (sr *scheduledDagRuns) start(dagrun DagRun) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sr.Lock()
+	defer sr.Unlock()
+	if sr.runs == nil {
+		sr.runs = make(map[dagRunKey]scheduledDagRun)
+	}
+	sr.runs[newDagRunKey(dagrun)] = scheduledDagRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	return ctx
+}
+
+// Unregisters given DAG run, once its scheduling is finished.
+func (sr *scheduledDagRuns) finish(dagrun DagRun) {
+	sr.Lock()
+	defer sr.Unlock()
+	key := newDagRunKey(dagrun)
+	run, exists := sr.runs[key]
+	if !exists {
+		return
+	}
+	delete(sr.runs, key)
+	run.cancel()
+	close(run.done)
+}
+
+// Cancels scheduling of given DAG run. Returns channel which is closed once
+// the scheduling is finished. False is returned, when the DAG run is not being
+// scheduled.
+func (sr *scheduledDagRuns) cancel(dagrun DagRun) (<-chan struct{}, bool) {
+	sr.Lock()
+	defer sr.Unlock()
+	run, exists := sr.runs[newDagRunKey(dagrun)]
+	if !exists {
+		return nil, false
+	}
+	run.cancel()
+	return run.done, true
+}
+
+// Cancellation signals for tasks which are being executed by executors. They
+// are delivered to executors in heartbeat responses. Zero value is ready to
+// use and it's safe for concurrent use.
+type taskCancellations struct {
+	sync.Mutex
+	byExecutor map[string][]models.TaskToExec
+}
+
+func (tc *taskCancellations) add(executorId string, tte models.TaskToExec) {
+	tc.Lock()
+	defer tc.Unlock()
+	if tc.byExecutor == nil {
+		tc.byExecutor = make(map[string][]models.TaskToExec)
+	}
+	tc.byExecutor[executorId] = append(tc.byExecutor[executorId], tte)
+}
+
+// Removes and returns cancellation signals for given executor.
+func (tc *taskCancellations) drain(executorId string) []models.TaskToExec {
+	tc.Lock()
+	defer tc.Unlock()
+	ttes, exists := tc.byExecutor[executorId]
+	if !exists {
+		return []models.TaskToExec{}
+	}
+	delete(tc.byExecutor, executorId)
+	return ttes
+}
+
+// Cancel functions of tasks which are being executed by LocalExecutor. Zero
+// value is ready to use and it's safe for concurrent use.
+type localTaskCancels struct {
+	sync.Mutex
+	cancels map[localTaskKey]context.CancelFunc
+}
+
+type localTaskKey struct {
+	dagRunKey
+	TaskId string
+}
+
+func newLocalTaskKey(drt DagRunTask) localTaskKey {
+	dagrun := DagRun{DagId: drt.DagId, AtTime: drt.AtTime}
+	return localTaskKey{dagRunKey: newDagRunKey(dagrun), TaskId: drt.TaskId}
+}
+
+// Registers given task and returns context for its execution.
+func (lt *localTaskCancels) start(drt DagRunTask) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	lt.Lock()
+	defer lt.Unlock()
+	if lt.cancels == nil {
+		lt.cancels = make(map[localTaskKey]context.CancelFunc)
+	}
+	lt.cancels[newLocalTaskKey(drt)] = cancel
+	return ctx
+}
+
+// Unregisters given task, once its execution is finished.
+func (lt *localTaskCancels) finish(drt DagRunTask) {
+	lt.Lock()
+	defer lt.Unlock()
+	key := newLocalTaskKey(drt)
+	if cancel, exists := lt.cancels[key]; exists {
+		cancel()
+		delete(lt.cancels, key)
+	}
+}
+
+// Cancels context of given task, if it's being executed.
+func (lt *localTaskCancels) cancel(drt DagRunTask) {
+	lt.Lock()
+	defer lt.Unlock()
+	if cancel, exists := lt.cancels[newLocalTaskKey(drt)]; exists {
+		cancel()
+	}
+}
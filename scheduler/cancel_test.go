@@ -0,0 +1,221 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestCancelDagRunStopsSchedulingAndSignalsExecutor(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 15, 8, 0, 0, 0, time.UTC)
+	execTs := timeutils.ToString(startTs)
+	d := dag.New("mock_dag_cancel").AddRoot(nodes131()).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id), execTs); iErr != nil {
+		t.Fatal(iErr)
+	}
+	executorId := "exec_cancel"
+	rErr := ts.DbClient.RegisterExecutor(ctx, executorId, "localhost", 1)
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	errsChan := make(chan taskSchedulerError)
+	go listenOnSchedulerErrors(errsChan, t)
+	go executeAllTasksExceptStuck(ctx, ts, map[string]struct{}{"n22": {}})
+
+	scheduled := make(chan struct{})
+	schedCtx := ts.scheduledRuns.start(dagrun)
+	go func() {
+		ts.scheduleDagTasks(schedCtx, dagrun, errsChan)
+		ts.scheduledRuns.finish(dagrun)
+		close(scheduled)
+	}()
+	n22 := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "n22"}
+	waitForTaskStatus(ts, n22, dag.TaskRunning, t)
+	// Only n22 should be running, when the dag run is cancelled
+	for _, taskId := range []string{"n21", "n23"} {
+		drt := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: taskId}
+		waitForTaskStatus(ts, drt, dag.TaskSuccess, t)
+	}
+	sErr := ts.DbClient.SetDagRunTaskExecutor(ctx, string(d.Id), execTs, "n22",
+		&executorId)
+	if sErr != nil {
+		t.Fatal(sErr)
+	}
+
+	cancelled, cErr := ts.CancelDagRun(ctx, dagrun)
+	if cErr != nil {
+		t.Fatalf("Cannot cancel dag run: %s", cErr.Error())
+	}
+	if !reflect.DeepEqual(cancelled, []string{"n22"}) {
+		t.Errorf("Expected n22 to be cancelled, got: %v", cancelled)
+	}
+	select {
+	case <-scheduled:
+	case <-ctx.Done():
+		t.Fatal("Dag run scheduling has not stopped after cancellation")
+	}
+	testDagRunStatus(ts, dagrun, dag.RunCancelled, t)
+	checkDagRunTaskStatus(t, ts, n22, dag.TaskCancelled)
+	n3Status, _ := ts.getDagRunTaskStatus(dagrun, "n3")
+	if n3Status != dag.TaskNoStatus {
+		t.Errorf("Expected n3 not to be scheduled, got status %s",
+			n3Status.String())
+	}
+	_, cErr = ts.CancelDagRun(ctx, dagrun)
+	if !errors.Is(cErr, ErrDagRunFinished) {
+		t.Errorf("Expected ErrDagRunFinished for cancelled dag run, got: %v",
+			cErr)
+	}
+
+	// Cancellation signal is delivered in the next heartbeat only
+	s := New(ts.DbClient, Queues{}, DefaultConfig)
+	handler := s.executorHeartbeat(ts)
+	expected := []models.TaskToExec{
+		{DagId: string(d.Id), ExecTs: execTs, TaskId: "n22"},
+	}
+	for _, want := range [][]models.TaskToExec{expected, {}} {
+		body, _ := json.Marshal(models.ExecutorHeartbeat{
+			ExecutorId: executorId,
+		})
+		req := httptest.NewRequest("POST", "/executor/heartbeat",
+			bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for heartbeat, got %d", rec.Code)
+		}
+		var resp models.ExecutorHeartbeatResponse
+		if jErr := json.Unmarshal(rec.Body.Bytes(), &resp); jErr != nil {
+			t.Fatal(jErr)
+		}
+		if !reflect.DeepEqual(resp.CancelledTasks, want) {
+			t.Errorf("Expected cancelled tasks %v, got: %v", want,
+				resp.CancelledTasks)
+		}
+	}
+}
+
+func TestCancelDagRunRemovesQueuedTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 15, 9, 0, 0, 0, time.UTC)
+	d := dag.New("mock_dag_cancel_queued").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx := context.Background()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id),
+		timeutils.ToString(startTs)); iErr != nil {
+		t.Fatal(iErr)
+	}
+	drt := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "task"}
+	if uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled); uErr != nil {
+		t.Fatal(uErr)
+	}
+	if pErr := ts.TaskQueue.Put(drt); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	cancelled, cErr := ts.CancelDagRun(ctx, dagrun)
+	if cErr != nil {
+		t.Fatalf("Cannot cancel dag run: %s", cErr.Error())
+	}
+	if !reflect.DeepEqual(cancelled, []string{"task"}) {
+		t.Errorf("Expected task to be cancelled, got: %v", cancelled)
+	}
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected no tasks on the queue, got %d", ts.TaskQueue.Size())
+	}
+	testDagRunStatus(ts, dagrun, dag.RunCancelled, t)
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskCancelled)
+
+	// Cancelled dag run which is picked up later is not scheduled
+	errsChan := make(chan taskSchedulerError)
+	go listenOnSchedulerErrors(errsChan, t)
+	ts.scheduleDagTasks(ctx, dagrun, errsChan)
+	testDagRunStatus(ts, dagrun, dag.RunCancelled, t)
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected cancelled dag run not to be scheduled, got %d "+
+			"tasks on the queue", ts.TaskQueue.Size())
+	}
+}
+
+// Task which blocks until its context is cancelled.
+type waitForCancelTask struct {
+	TaskId    string
+	cancelled chan struct{}
+}
+
+func (wt waitForCancelTask) Id() string { return wt.TaskId }
+func (wt waitForCancelTask) Execute()   {}
+func (wt waitForCancelTask) ExecuteContext(ctx context.Context) {
+	<-ctx.Done()
+	close(wt.cancelled)
+}
+
+func TestCancelDagRunCancelsLocalExecutorTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 15, 10, 0, 0, 0, time.UTC)
+	task := waitForCancelTask{TaskId: "task", cancelled: make(chan struct{})}
+	d := dag.New("mock_dag_cancel_local").AddRoot(&dag.Node{Task: task}).
+		Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id),
+		timeutils.ToString(startTs)); iErr != nil {
+		t.Fatal(iErr)
+	}
+	drt := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "task"}
+	if uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled); uErr != nil {
+		t.Fatal(uErr)
+	}
+	le := NewLocalExecutor(ts, DefaultLocalExecutorConfig)
+	executed := make(chan struct{})
+	go func() {
+		le.executeTask(drt)
+		close(executed)
+	}()
+	waitForTaskStatus(ts, drt, dag.TaskRunning, t)
+
+	cancelled, cErr := ts.CancelDagRun(ctx, dagrun)
+	if cErr != nil {
+		t.Fatalf("Cannot cancel dag run: %s", cErr.Error())
+	}
+	if !reflect.DeepEqual(cancelled, []string{"task"}) {
+		t.Errorf("Expected task to be cancelled, got: %v", cancelled)
+	}
+	for _, done := range []chan struct{}{task.cancelled, executed} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.Fatal("Local task has not been cancelled")
+		}
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskCancelled)
+}
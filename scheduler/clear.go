@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+var (
+	// ErrDagRunNotFinished is returned on clearing tasks of a DAG run which
+	// is not finished yet.
+	ErrDagRunNotFinished = errors.New("dag run is not finished")
+
+	// ErrTaskNotFound is returned when given task does not exist in the DAG.
+	ErrTaskNotFound = errors.New("task not found in the DAG")
+)
+
+// ClearOptions determines which tasks, besides explicitly given, should be
+// cleared.
+type ClearOptions struct {
+	// Clear also all tasks downstream of given tasks.
+	Downstream bool
+
+	// Clear also all tasks upstream of given tasks.
+	Upstream bool
+}
+
+// ClearTasks clears given tasks of finished DAG run, so they are scheduled
+// and executed again. Statuses of cleared tasks are removed and the DAG run
+// is put back onto DagRunQueue, where it's picked up by TaskScheduler main
+// loop as any other DAG run (it's going to be RUNNING again). Tasks which are
+// not cleared keep their statuses and are not executed again. Returns
+// identifiers of cleared tasks in topological order.
+func (ts *TaskScheduler) ClearTasks(
+	ctx context.Context, dagrun DagRun, taskIds []string, opts ClearOptions,
+) ([]string, error) {
+	d, dagErr := dag.Get(dagrun.DagId)
+	if dagErr != nil {
+		return nil, dagErr
+	}
+	graph := d.Graph()
+	toClear := make(map[string]struct{}, len(taskIds))
+	for _, taskId := range taskIds {
+		if _, exists := graph.Task(taskId); !exists {
+			return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskId)
+		}
+		toClear[taskId] = struct{}{}
+		if opts.Downstream {
+			for _, downstreamId := range graph.Downstream(taskId) {
+				toClear[downstreamId] = struct{}{}
+			}
+		}
+		if opts.Upstream {
+			for _, upstreamId := range graph.Upstream(taskId) {
+				toClear[upstreamId] = struct{}{}
+			}
+		}
+	}
+	cleared := make([]string, 0, len(toClear))
+	for _, taskId := range graph.TopologicalOrder() {
+		if _, ok := toClear[taskId]; ok {
+			cleared = append(cleared, taskId)
+		}
+	}
+
+	dagId := string(dagrun.DagId)
+	execTs := timeutils.ToString(dagrun.AtTime)
+	dbDagRun, rErr := ts.DbClient.ReadDagRun(ctx, dagId, execTs)
+	if rErr != nil {
+		return nil, rErr
+	}
+	runStatus, _ := dag.ParseRunStatus(dbDagRun.Status)
+	if runStatus != dag.RunSuccess && runStatus != dag.RunFailed &&
+		runStatus != dag.RunCancelled {
+		return nil, fmt.Errorf("%w: status %s", ErrDagRunNotFinished,
+			dbDagRun.Status)
+	}
+	_, cErr := ts.DbClient.ClearDagRunTasks(ctx, dagId, execTs, cleared)
+	if cErr == sql.ErrNoRows {
+		// DAG run has been cleared in the meantime
+		return nil, ErrDagRunNotFinished
+	}
+	if cErr != nil {
+		return nil, cErr
+	}
+	ts.cleanTaskCache(dagrun, tasksByIds(graph, cleared))
+	ds.PutContext(ctx, ts.DagRunQueue, dagrun)
+	slog.Info("Cleared dag run tasks", "dagrun", dagrun, "taskIds", cleared)
+	return cleared, nil
+}
+
+func tasksByIds(graph *dag.Graph, taskIds []string) []dag.Task {
+	tasks := make([]dag.Task, 0, len(taskIds))
+	for _, taskId := range taskIds {
+		if task, exists := graph.Task(taskId); exists {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// HTTP handler for clearing tasks of finished DAG run, given by dagId and
+// execTs query parameters. Tasks are given in comma-separated taskIds
+// parameter. When downstream or upstream parameter is true, then also tasks
+// downstream or upstream of given tasks are cleared. Cleared tasks are
+// scheduled again (see TaskScheduler.ClearTasks).
+func (s *Scheduler) clearTasks(ts *TaskScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST requests are allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		dagId := query.Get("dagId")
+		if dagId == "" {
+			http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+			return
+		}
+		execTs, tErr := timeutils.FromString(query.Get("execTs"))
+		if tErr != nil {
+			msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
+				tErr.Error())
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		taskIds := parseTaskIds(query.Get("taskIds"))
+		if len(taskIds) == 0 {
+			http.Error(w, "Parameter taskIds is required",
+				http.StatusBadRequest)
+			return
+		}
+		downstream, dErr := parseBoolParam(query.Get("downstream"))
+		upstream, uErr := parseBoolParam(query.Get("upstream"))
+		if dErr != nil || uErr != nil {
+			http.Error(w, "Parameters downstream and upstream should be "+
+				"booleans", http.StatusBadRequest)
+			return
+		}
+		opts := ClearOptions{Downstream: downstream, Upstream: upstream}
+		if !s.authorize(w, r, ActionClearTasks, dagId) {
+			return
+		}
+		if _, dagErr := dag.Get(dag.Id(dagId)); dagErr != nil {
+			http.Error(w, dagErr.Error(), http.StatusNotFound)
+			return
+		}
+
+		dagrun := DagRun{DagId: dag.Id(dagId), AtTime: execTs}
+		cleared, err := ts.ClearTasks(r.Context(), dagrun, taskIds, opts)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrTaskNotFound):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, sql.ErrNoRows):
+			msg := fmt.Sprintf("There is no dag run for DAG %s at %s", dagId,
+				query.Get("execTs"))
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		case errors.Is(err, ErrDagRunNotFinished):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			msg := fmt.Sprintf("Cannot clear dag run tasks: %s", err.Error())
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, models.ClearTasksResponse{
+			DagId:          dagId,
+			ExecTs:         timeutils.ToString(execTs),
+			ClearedTaskIds: cleared,
+		})
+	}
+}
+
+// Parses comma-separated list of task identifiers. Empty elements are
+// skipped.
+func parseTaskIds(s string) []string {
+	taskIds := make([]string, 0)
+	for _, taskId := range strings.Split(s, ",") {
+		if taskId = strings.TrimSpace(taskId); taskId != "" {
+			taskIds = append(taskIds, taskId)
+		}
+	}
+	return taskIds
+}
+
+// Parses optional boolean query parameter. Empty parameter is false.
+func parseBoolParam(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestClearTasksReschedulesFinishedDagRun(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 12, 8, 0, 0, 0, time.UTC)
+	d := dag.New("mock_dag_clear_n22").AddRoot(nodes131()).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	execTs := timeutils.ToString(startTs)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id), execTs); iErr != nil {
+		t.Fatal(iErr)
+	}
+	errsChan := make(chan taskSchedulerError)
+	go listenOnSchedulerErrors(errsChan, t)
+
+	// The first run fails on n22, so n3 is UPSTREAM_FAILED
+	firstCtx, firstCancel := context.WithCancel(ctx)
+	executorDone := make(chan struct{})
+	go func() {
+		markSuccessAllTasksExceptFew(firstCtx, ts,
+			map[string]struct{}{"n22": {}}, time.Millisecond, t)
+		close(executorDone)
+	}()
+	ts.scheduleDagTasks(ctx, dagrun, errsChan)
+	// Dag run might be finished based on TaskCache, before the last status
+	// is written into the database
+	for ts.DbClient.CountWhere("dagruntasks", "Status='SCHEDULED'") > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	firstCancel()
+	<-executorDone
+	testDagRunStatus(ts, dagrun, dag.RunFailed, t)
+
+	_, nfErr := ts.ClearTasks(ctx, dagrun, []string{"n4"}, ClearOptions{})
+	if !errors.Is(nfErr, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for unknown task, got: %v", nfErr)
+	}
+	cleared, cErr := ts.ClearTasks(ctx, dagrun, []string{"n22"},
+		ClearOptions{Downstream: true})
+	if cErr != nil {
+		t.Fatalf("Cannot clear tasks: %s", cErr.Error())
+	}
+	if !reflect.DeepEqual(cleared, []string{"n22", "n3"}) {
+		t.Errorf("Expected n22 and n3 to be cleared, got: %v", cleared)
+	}
+	_, nfErr = ts.ClearTasks(ctx, dagrun, []string{"n1"}, ClearOptions{})
+	if !errors.Is(nfErr, ErrDagRunNotFinished) {
+		t.Errorf("Expected ErrDagRunNotFinished for cleared dag run, got: %v",
+			nfErr)
+	}
+	requeued, popErr := ts.DagRunQueue.Pop()
+	if popErr != nil || requeued != dagrun {
+		t.Fatalf("Expected dag run to be put back onto the queue, got: %v, %v",
+			requeued, popErr)
+	}
+
+	// The second run executes only cleared tasks
+	var executedMu sync.Mutex
+	executed := make([]string, 0)
+	go func() {
+		for ctx.Err() == nil {
+			drt, err := ts.TaskQueue.Pop()
+			if err == ds.ErrQueueIsEmpty {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			executedMu.Lock()
+			executed = append(executed, drt.TaskId)
+			executedMu.Unlock()
+			ts.UpsertTaskStatus(ctx, drt, dag.TaskSuccess)
+		}
+	}()
+	ts.scheduleDagTasks(ctx, requeued, errsChan)
+	testDagRunStatus(ts, dagrun, dag.RunSuccess, t)
+	executedMu.Lock()
+	defer executedMu.Unlock()
+	sort.Strings(executed)
+	if !reflect.DeepEqual(executed, []string{"n22", "n3"}) {
+		t.Errorf("Expected only n22 and n3 to be executed again, got: %v",
+			executed)
+	}
+}
+
+func testDagRunStatus(
+	ts *TaskScheduler, dagrun DagRun, expected dag.RunStatus, t *testing.T,
+) {
+	dr, err := ts.DbClient.ReadDagRun(context.Background(),
+		string(dagrun.DagId), timeutils.ToString(dagrun.AtTime))
+	if err != nil {
+		t.Fatalf("Cannot read dag run %v: %s", dagrun, err.Error())
+	}
+	if dr.Status != expected.String() {
+		t.Errorf("Expected dag run %v status %s, got: %s", dagrun,
+			expected.String(), dr.Status)
+	}
+}
@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/dskrzypiec/scheduler/ds"
@@ -24,11 +25,41 @@ type Config struct {
 	// setup in Start context.
 	StartupContextTimeout time.Duration
 
+	// Named pools with number of slots. Tasks which implement dag.PoolTask
+	// share slots of their pool. Pools are persisted in the database on
+	// Scheduler startup and pools which are not configured anymore are
+	// deleted.
+	Pools map[string]int
+
 	// Configuration for taskScheduler.
 	TaskSchedulerConfig TaskSchedulerConfig
 
 	// Configuration for dagRunWatcher
 	DagRunWatcherConfig DagRunWatcherConfig
+
+	// Configuration for detecting dead executors and their lost tasks.
+	ExecutorReaperConfig ExecutorReaperConfig
+
+	// Configuration for in-process local executor.
+	LocalExecutorConfig LocalExecutorConfig
+
+	// Address (host:port) on which gRPC executor service is served, as an
+	// alternative to HTTP endpoints. When empty, gRPC is disabled.
+	GrpcAddr string
+
+	// TLS configuration of gRPC executor service (see ServerTLSConfig). When
+	// nil, gRPC connections are not encrypted.
+	GrpcTLSConfig *tls.Config
+
+	// Authenticator of requests to the scheduler, both HTTP and gRPC (see
+	// TokenAuthenticator and CertAuthenticator). When nil, authentication is
+	// disabled.
+	Authenticator Authenticator
+
+	// Authorization policy for DAG management and executor endpoints (see
+	// RoleBinding). Executors need RoleExecutor binding. When nil, all
+	// authenticated principals can perform all actions.
+	Policy *Policy
 }
 
 // Default Scheduler configuration.
@@ -39,6 +70,8 @@ var DefaultConfig Config = Config{
 	StartupContextTimeout: 30 * time.Second,
 	TaskSchedulerConfig:   DefaultTaskSchedulerConfig,
 	DagRunWatcherConfig:   DefaultDagRunWatcherConfig,
+	ExecutorReaperConfig:  DefaultExecutorReaperConfig,
+	LocalExecutorConfig:   DefaultLocalExecutorConfig,
 }
 
 // Configuration for taskScheduler which is responsible for scheduling tasks
@@ -51,12 +84,55 @@ type TaskSchedulerConfig struct {
 	// How often taskScheduler should check if all dependencies are met before
 	// scheduling new task. Expressed in milliseconds.
 	CheckDependenciesStatusMs int
+
+	// Maximum number of DAG runs (of all DAGs) which can be running at the
+	// same time. DAG runs exceeding the limit wait in SCHEDULED state and are
+	// started in exec time order. Zero means no limit.
+	MaxConcurrentDagRuns int
+
+	// Maximum number of DAG runs of a single DAG taken from the DagRunQueue
+	// which wait to be started, because of concurrency limits. When a DAG
+	// reaches the limit, its further DAG runs are left on the DagRunQueue,
+	// while DAG runs of other DAGs are still taken. Zero means no limit.
+	MaxPendingDagRuns int
+
+	// How long lease on a popped task is valid, unless it's acknowledged or
+	// renewed by the executor. Expressed in milliseconds. Zero disables task
+	// leases.
+	TaskLeaseTimeoutMs int
+
+	// How often expired task leases should be checked. Expressed in
+	// milliseconds. When it's not positive, default value from
+	// DefaultTaskSchedulerConfig is used.
+	TaskLeaseCheckMs int
+
+	// Maximum time executor can wait on /dag/task/pop for a task, when the
+	// queue is empty (long polling). Expressed in milliseconds.
+	MaxTaskPopWaitMs int
+
+	// Maximum number of tasks popped in a single /dag/task/popmany request.
+	// When it's not positive, default value from DefaultTaskSchedulerConfig
+	// is used.
+	MaxTaskPopBatch int
+
+	// Context timeout for database and task queue operations which are not
+	// bound to a request context (e.g. putting tasks back onto the queue).
+	// When it's not positive, default value from DefaultTaskSchedulerConfig
+	// is used.
+	DatabaseContextTimeout time.Duration
 }
 
 // Default taskScheduler configuration.
 var DefaultTaskSchedulerConfig TaskSchedulerConfig = TaskSchedulerConfig{
 	HeartbeatMs:               1,
 	CheckDependenciesStatusMs: 1,
+	MaxConcurrentDagRuns:      100,
+	MaxPendingDagRuns:         1000,
+	TaskLeaseTimeoutMs:        30000,
+	TaskLeaseCheckMs:          1000,
+	MaxTaskPopWaitMs:          30000,
+	MaxTaskPopBatch:           100,
+	DatabaseContextTimeout:    10 * time.Second,
 }
 
 // Configuration for DagRunWatcher which is responsible for scheduling new DAG
@@ -81,6 +157,62 @@ var DefaultDagRunWatcherConfig DagRunWatcherConfig = DagRunWatcherConfig{
 	DatabaseContextTimeout: 10 * time.Second,
 }
 
+// Configuration for detecting dead executors. Executor is considered dead
+// when it hasn't sent a heartbeat for longer then HeartbeatTimeout. Tasks
+// owned by dead executors, which are not yet finished, are either marked as
+// failed or re-queued, depending on RequeueLostTasks.
+type ExecutorReaperConfig struct {
+	// How often executors heartbeats should be checked.
+	CheckInterval time.Duration
+
+	// Executor is considered dead when its latest heartbeat is older than
+	// HeartbeatTimeout.
+	HeartbeatTimeout time.Duration
+
+	// When set to true, then lost tasks are put back onto the task queue to
+	// be executed by another executor. Otherwise they are marked as FAILED.
+	RequeueLostTasks bool
+
+	// Context timeout for database operations.
+	DatabaseContextTimeout time.Duration
+}
+
+// Default executor reaper configuration.
+var DefaultExecutorReaperConfig ExecutorReaperConfig = ExecutorReaperConfig{
+	CheckInterval:          5 * time.Second,
+	HeartbeatTimeout:       30 * time.Second,
+	RequeueLostTasks:       false,
+	DatabaseContextTimeout: 10 * time.Second,
+}
+
+// Configuration for LocalExecutor which executes tasks inside the scheduler
+// process.
+type LocalExecutorConfig struct {
+	// When set to true, Scheduler starts LocalExecutor on Start. It might be
+	// used together with regular executors.
+	Enabled bool
+
+	// Maximum number of concurrently executed tasks.
+	MaxConcurrentTasks int
+
+	// How long LocalExecutor should wait for a task in case when task queue
+	// is empty, before trying again. In case of errors it's also a pause
+	// before the next try.
+	PollInterval time.Duration
+
+	// Context timeout for database operations.
+	DatabaseContextTimeout time.Duration
+}
+
+// Default local executor configuration. Local executor is disabled by
+// default.
+var DefaultLocalExecutorConfig LocalExecutorConfig = LocalExecutorConfig{
+	Enabled:                false,
+	MaxConcurrentTasks:     10,
+	PollInterval:           time.Second,
+	DatabaseContextTimeout: 10 * time.Second,
+}
+
 // Queues contains queues internally needed by the Scheduler. It's
 // exposed publicly, because those queues are of type ds.Queue which is a
 // generic interface. This way one can link external queues like AWS SQS or
@@ -90,11 +222,24 @@ type Queues struct {
 	DagRunTasks ds.Queue[DagRunTask]
 }
 
-// Returns default instance of Queues which uses ds.SimpleQueue - fixed size
-// buffer queues. Size of buffers are based on Config.
+// Returns default instance of Queues which uses ds.SimpleQueue for DAG runs
+// and ds.KeyedQueue of ds.PriorityQueue for DAG run tasks - fixed size
+// buffer queues. Size of buffers are based on Config. DAG run tasks are put
+// onto separate queues for each set of task labels (see LabeledQueue). DAG run
+// tasks are popped by executors in order of effective task priority (see
+// dag.Dag.TaskPriorities) among all queues matching executor labels and in
+// FIFO order among tasks of the same priority within a queue.
 func DefaultQueues(config Config) Queues {
 	dagRuns := ds.NewSimpleQueue[DagRun](config.DagRunQueueLen)
-	tasks := ds.NewSimpleQueue[DagRunTask](config.DagRunTaskQueueLen)
+	tasks := ds.NewKeyedQueue[DagRunTask](
+		config.DagRunTaskQueueLen, dagRunTaskLabelsKey,
+		func() ds.Queue[DagRunTask] {
+			q := ds.NewPriorityQueue[DagRunTask](
+				config.DagRunTaskQueueLen, dagRunTaskPriority,
+			)
+			return &q
+		},
+	)
 	return Queues{
 		DagRuns:     &dagRuns,
 		DagRunTasks: &tasks,
@@ -46,19 +46,78 @@ func NewDagRunWatcher(queue ds.Queue[DagRun], dbClient *db.Client, config DagRun
 // queue would be full for longer then an interval between two next DAG runs,
 // those DAG runs won't be skipped. They will be scheduled in expected order
 // but possibly a bit later.
+//
+// Paused DAGs are not scheduled. When DAG is unpaused, then DAG runs for
+// intervals missed during the pause are scheduled (backfilled) only if the
+// DAG has Attr.CatchUp set. Otherwise missed intervals are skipped and the
+// next DAG run is scheduled based on the current time.
 func (drw *DagRunWatcher) Watch(dags []dag.Dag) {
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, drw.config.DatabaseContextTimeout)
 	defer cancel()
 	nextSchedules := make(map[dag.Id]*time.Time)
+	paused := make(map[dag.Id]struct{})
 	updateNextSchedules(ctx, dags, time.Now(), drw.dbClient, nextSchedules)
 	for {
 		now := time.Now()
+		updatePausedDags(dags, now, drw.dbClient, nextSchedules, paused,
+			drw.config)
 		trySchedule(dags, drw.queue, nextSchedules, now, drw.dbClient, drw.config)
 		time.Sleep(drw.config.WatchInterval)
 	}
 }
 
+// Function updatePausedDags reads paused DAGs from the database and updates
+// nextSchedules accordingly. Paused DAGs have nil next schedule, so they are
+// not scheduled. For DAGs which were unpaused since the previous call, next
+// schedule is determined based on dag.Attr.CatchUp - either since the latest
+// DAG run (catch up) or since the current time (missed intervals are
+// skipped). Map paused keeps state between calls.
+func updatePausedDags(
+	dags []dag.Dag,
+	currentTime time.Time,
+	dbClient *db.Client,
+	nextSchedules map[dag.Id]*time.Time,
+	paused map[dag.Id]struct{},
+	config DagRunWatcherConfig,
+) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, config.DatabaseContextTimeout)
+	defer cancel()
+
+	pausedDagIds, err := dbClient.ReadPausedDagIds(ctx)
+	if err != nil {
+		slog.Error("Cannot read paused DAGs. Paused state is unchanged", "err",
+			err)
+		return
+	}
+	for _, d := range dags {
+		_, isPaused := pausedDagIds[string(d.Id)]
+		_, wasPaused := paused[d.Id]
+		if isPaused {
+			paused[d.Id] = struct{}{}
+			nextSchedules[d.Id] = nil
+			continue
+		}
+		if !wasPaused {
+			continue
+		}
+		delete(paused, d.Id)
+		slog.Info("DAG has been unpaused", "dagId", string(d.Id), "catchUp",
+			d.Attr.CatchUp)
+		if d.Schedule == nil {
+			continue
+		}
+		if d.Attr.CatchUp {
+			updateNextSchedules(ctx, []dag.Dag{d}, currentTime, dbClient,
+				nextSchedules)
+			continue
+		}
+		nextSched := (*d.Schedule).Next(currentTime)
+		nextSchedules[d.Id] = &nextSched
+	}
+}
+
 func trySchedule(
 	dags []dag.Dag,
 	queue ds.Queue[DagRun],
@@ -133,7 +192,12 @@ func tryScheduleDag(
 		}
 		return nil
 	}
-	runId, iErr := dbClient.InsertDagRun(ctx, string(d.Id), execTs)
+	params, pErr := encodeParams(d.DefaultParams())
+	if pErr != nil {
+		return pErr
+	}
+	runId, iErr := dbClient.InsertDagRunWithParams(ctx, string(d.Id), execTs,
+		params)
 	if iErr != nil {
 		return iErr
 	}
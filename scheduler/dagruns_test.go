@@ -555,6 +555,68 @@ func TestTryScheduleAfterSchedulerRestart(t *testing.T) {
 	}
 }
 
+func TestUpdatePausedDags(t *testing.T) {
+	for _, catchUp := range []bool{false, true} {
+		c, err := db.NewInMemoryClient(sqlSchemaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		start := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+		sched := dag.FixedSchedule{Interval: 1 * time.Hour, Start: start}
+		d := emptyDag("mock_dag", &sched, dag.Attr{CatchUp: catchUp})
+		if uErr := c.UpsertDag(ctx, d); uErr != nil {
+			t.Fatalf("Cannot insert DAG: %s", uErr.Error())
+		}
+		_, iErr := c.InsertDagRun(ctx, string(d.Id), timeutils.ToString(start))
+		if iErr != nil {
+			t.Fatalf("Cannot insert dag run: %s", iErr.Error())
+		}
+
+		config := DefaultDagRunWatcherConfig
+		nextSchedules := make(map[dag.Id]*time.Time)
+		paused := make(map[dag.Id]struct{})
+		currTime := start.Add(30 * time.Minute)
+		updateNextSchedules(ctx, []dag.Dag{d}, currTime, c, nextSchedules)
+
+		if pErr := c.SetDagPaused(ctx, string(d.Id), true); pErr != nil {
+			t.Fatalf("Cannot pause DAG: %s", pErr.Error())
+		}
+		updatePausedDags([]dag.Dag{d}, currTime, c, nextSchedules, paused,
+			config)
+		if nextSchedules[d.Id] != nil {
+			t.Errorf("Expected nil next schedule for paused DAG, got: %v",
+				*nextSchedules[d.Id])
+		}
+		queue := ds.NewSimpleQueue[DagRun](10)
+		currTime = start.Add(3*time.Hour + 30*time.Minute)
+		sErr := tryScheduleDag(ctx, d, currTime, &queue, nextSchedules, c)
+		if sErr != nil {
+			t.Errorf("Error while trying to schedule paused DAG: %s",
+				sErr.Error())
+		}
+		if queue.Size() != 0 {
+			t.Errorf("Expected paused DAG not to be scheduled, got %d dag runs",
+				queue.Size())
+		}
+
+		if pErr := c.SetDagPaused(ctx, string(d.Id), false); pErr != nil {
+			t.Fatalf("Cannot unpause DAG: %s", pErr.Error())
+		}
+		updatePausedDags([]dag.Dag{d}, currTime, c, nextSchedules, paused,
+			config)
+		if _, stillPaused := paused[d.Id]; stillPaused {
+			t.Error("Expected DAG to be removed from paused map")
+		}
+		expectedNext := start.Add(4 * time.Hour)
+		if catchUp {
+			// Missed intervals should be backfilled since the latest dag run
+			expectedNext = start.Add(1 * time.Hour)
+		}
+		checkNextSchedule(nextSchedules, d, expectedNext, t)
+	}
+}
+
 func checkNextSchedule(
 	ns map[dag.Id]*time.Time, d dag.Dag, nextSchedExp time.Time, t *testing.T,
 ) {
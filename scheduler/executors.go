@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+	"github.com/dskrzypiec/scheduler/version"
+)
+
+// HTTP handler for registering new executor. Executor should register itself
+// on startup and then periodically send heartbeats.
+func (s *Scheduler) registerExecutor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed,
+			models.ErrCodeMethodNotAllowed, "Only POST requests are allowed")
+		return
+	}
+	var info models.ExecutorInfo
+	err := json.NewDecoder(r.Body).Decode(&info)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			err.Error())
+		return
+	}
+	if info.ExecutorId == "" {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			"Executor ID is required")
+		return
+	}
+	rErr := s.register(r.Context(), info)
+	if rErr != nil {
+		msg := fmt.Sprintf("Cannot register executor: %s", rErr.Error())
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			msg)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Registers given executor in the database.
+func (s *Scheduler) register(
+	ctx context.Context, info models.ExecutorInfo,
+) error {
+	rErr := s.dbClient.RegisterExecutor(ctx, info.ExecutorId, info.Hostname,
+		info.Capacity)
+	if rErr != nil {
+		return rErr
+	}
+	if info.Version != "" && info.Version != version.Current() {
+		slog.Warn("Executor version differs from the scheduler version",
+			"executorId", info.ExecutorId, "executorVersion", info.Version,
+			"schedulerVersion", version.Current())
+	}
+	slog.Info("Registered executor", "executorId", info.ExecutorId,
+		"hostname", info.Hostname, "capacity", info.Capacity, "version",
+		info.Version, "protocolVersion", info.ProtocolVersion)
+	return nil
+}
+
+// HTTP handler for executor heartbeats. If executor is not registered or it
+// was already considered dead, then 404 is returned and the executor should
+// register again. Response contains tasks of the executor which have been
+// cancelled since the last heartbeat and should be stopped.
+func (s *Scheduler) executorHeartbeat(ts *TaskScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeError(w, r, http.StatusMethodNotAllowed,
+				models.ErrCodeMethodNotAllowed, "Only POST requests are allowed")
+			return
+		}
+		var hb models.ExecutorHeartbeat
+		err := json.NewDecoder(r.Body).Decode(&hb)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+				err.Error())
+			return
+		}
+		hErr := s.dbClient.UpdateExecutorHeartbeat(r.Context(), hb.ExecutorId)
+		if errors.Is(hErr, sql.ErrNoRows) {
+			msg := fmt.Sprintf("Executor %s is not registered", hb.ExecutorId)
+			writeError(w, r, http.StatusNotFound,
+				models.ErrCodeExecutorNotRegistered, msg)
+			return
+		}
+		if hErr != nil {
+			msg := fmt.Sprintf("Cannot update executor heartbeat: %s",
+				hErr.Error())
+			writeError(w, r, http.StatusInternalServerError,
+				models.ErrCodeInternal, msg)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		jsonErr := json.NewEncoder(w).Encode(ts.heartbeatResponse(hb))
+		if jsonErr != nil {
+			writeError(w, r, http.StatusInternalServerError,
+				models.ErrCodeInternal, jsonErr.Error())
+		}
+	}
+}
+
+// Prepares response for given executor heartbeat, including cancellation
+// signals for the executor tasks.
+func (ts *TaskScheduler) heartbeatResponse(
+	hb models.ExecutorHeartbeat,
+) models.ExecutorHeartbeatResponse {
+	cancelled := ts.cancelledTasks.drain(hb.ExecutorId)
+	if len(cancelled) > 0 {
+		slog.Info("Sending cancellation signals to executor", "executorId",
+			hb.ExecutorId, "tasks", cancelled)
+	}
+	return models.ExecutorHeartbeatResponse{CancelledTasks: cancelled}
+}
+
+// WatchExecutors periodically checks executors heartbeats. Executors which
+// haven't sent heartbeat within config.HeartbeatTimeout are marked as dead
+// and their unfinished tasks are either marked as FAILED or put back onto the
+// task queue.
+func (ts *TaskScheduler) WatchExecutors(config ExecutorReaperConfig) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			config.DatabaseContextTimeout)
+		err := ts.reapDeadExecutors(ctx, time.Now(), config)
+		cancel()
+		if err != nil {
+			slog.Error("Error while checking executors heartbeats", "err", err)
+		}
+		time.Sleep(config.CheckInterval)
+	}
+}
+
+// Marks alive executors without heartbeat within config.HeartbeatTimeout
+// before currentTime as dead and handles their lost tasks.
+func (ts *TaskScheduler) reapDeadExecutors(
+	ctx context.Context, currentTime time.Time, config ExecutorReaperConfig,
+) error {
+	executors, rErr := ts.DbClient.ReadExecutors(ctx, db.ExecutorStatusAlive)
+	if rErr != nil {
+		return rErr
+	}
+	for _, e := range executors {
+		lastHeartbeat, tErr := timeutils.FromString(e.LastHeartbeatTs)
+		if tErr != nil {
+			slog.Error("Cannot parse executor heartbeat timestamp",
+				"executorId", e.ExecutorId, "lastHeartbeatTs",
+				e.LastHeartbeatTs, "err", tErr)
+			continue
+		}
+		if currentTime.Sub(lastHeartbeat) <= config.HeartbeatTimeout {
+			continue
+		}
+		slog.Warn("Executor seems to be dead", "executorId", e.ExecutorId,
+			"hostname", e.Hostname, "lastHeartbeatTs", e.LastHeartbeatTs)
+		uErr := ts.DbClient.UpdateExecutorStatus(ctx, e.ExecutorId,
+			db.ExecutorStatusDead)
+		if uErr != nil {
+			return uErr
+		}
+		// Tasks of dead executor are handled below, signals are not needed
+		ts.cancelledTasks.drain(e.ExecutorId)
+		lErr := ts.handleLostTasks(ctx, e.ExecutorId, config.RequeueLostTasks)
+		if lErr != nil {
+			return lErr
+		}
+	}
+	return nil
+}
+
+// Marks unfinished tasks of given executor as FAILED or puts them back onto
+// the task queue.
+func (ts *TaskScheduler) handleLostTasks(
+	ctx context.Context, executorId string, requeue bool,
+) error {
+	drts, rErr := ts.DbClient.ReadExecutorDagRunTasks(ctx, executorId)
+	if rErr != nil {
+		return rErr
+	}
+	for _, drtDb := range drts {
+		execTs, tErr := timeutils.FromString(drtDb.ExecTs)
+		if tErr != nil {
+			slog.Error("Cannot parse dag run task execTs", "dagruntask", drtDb,
+				"err", tErr)
+			continue
+		}
+		drt := DagRunTask{
+			DagId:  dag.Id(drtDb.DagId),
+			AtTime: execTs,
+			TaskId: drtDb.TaskId,
+		}
+		sErr := ts.DbClient.SetDagRunTaskExecutor(ctx, drtDb.DagId,
+			drtDb.ExecTs, drtDb.TaskId, nil)
+		if sErr != nil {
+			return sErr
+		}
+		lErr := ts.DbClient.SetDagRunTaskLease(ctx, drtDb.DagId, drtDb.ExecTs,
+			drtDb.TaskId, nil)
+		if lErr != nil {
+			return lErr
+		}
+		if !requeue {
+			slog.Warn("Marking lost task as failed", "dagruntask", drt,
+				"executorId", executorId)
+			uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskFailed)
+			if uErr != nil {
+				return uErr
+			}
+			continue
+		}
+		slog.Warn("Putting lost task back onto the queue", "dagruntask", drt,
+			"executorId", executorId)
+		// Lease of the dead executor is released, so the task is not put
+		// back onto the queue again, once the lease expires.
+		ts.Leases.release(drt)
+		uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled)
+		if uErr != nil {
+			return uErr
+		}
+		ds.PutContext(ctx, ts.TaskQueue, drt)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestReapDeadExecutorsFailsLostTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	drt := prepareExecutorWithTask(t, ts, "exec1")
+	config := DefaultExecutorReaperConfig
+
+	ctx := context.Background()
+	// Executor is still alive
+	rErr := ts.reapDeadExecutors(ctx, time.Now(), config)
+	if rErr != nil {
+		t.Fatalf("Error while reaping dead executors: %s", rErr.Error())
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskRunning)
+
+	afterTimeout := time.Now().Add(config.HeartbeatTimeout + time.Second)
+	rErr = ts.reapDeadExecutors(ctx, afterTimeout, config)
+	if rErr != nil {
+		t.Fatalf("Error while reaping dead executors: %s", rErr.Error())
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskFailed)
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected no tasks on the queue, got %d", ts.TaskQueue.Size())
+	}
+	executors, eErr := ts.DbClient.ReadExecutors(ctx, db.ExecutorStatusDead)
+	if eErr != nil {
+		t.Fatalf("Cannot read executors: %s", eErr.Error())
+	}
+	if len(executors) != 1 {
+		t.Errorf("Expected executor to be marked as dead, got: %+v", executors)
+	}
+}
+
+func TestReapDeadExecutorsRequeuesLostTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	drt := prepareExecutorWithTask(t, ts, "exec1")
+	config := DefaultExecutorReaperConfig
+	config.RequeueLostTasks = true
+	ts.Leases = NewTaskLeases(time.Minute)
+	ts.Leases.grant(drt, "exec1", time.Now())
+
+	ctx := context.Background()
+	afterTimeout := time.Now().Add(config.HeartbeatTimeout + time.Second)
+	rErr := ts.reapDeadExecutors(ctx, afterTimeout, config)
+	if rErr != nil {
+		t.Fatalf("Error while reaping dead executors: %s", rErr.Error())
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskScheduled)
+	queued, popErr := ts.TaskQueue.Pop()
+	if popErr != nil {
+		t.Fatalf("Expected lost task on the queue, got: %s", popErr.Error())
+	}
+	if queued != drt {
+		t.Errorf("Expected %v on the queue, got %v", drt, queued)
+	}
+	ts.requeueExpiredLeases(afterTimeout.Add(time.Minute))
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected lost task not to be requeued again after its "+
+			"lease expired, got %d tasks on the queue", ts.TaskQueue.Size())
+	}
+	drts, dErr := ts.DbClient.ReadExecutorDagRunTasks(ctx, "exec1")
+	if dErr != nil {
+		t.Fatalf("Cannot read executor tasks: %s", dErr.Error())
+	}
+	if len(drts) != 0 {
+		t.Errorf("Expected dead executor not to own any tasks, got: %+v", drts)
+	}
+}
+
+func prepareExecutorWithTask(
+	t *testing.T, ts *TaskScheduler, executorId string,
+) DagRunTask {
+	t.Helper()
+	ctx := context.Background()
+	rErr := ts.DbClient.RegisterExecutor(ctx, executorId, "localhost", 1)
+	if rErr != nil {
+		t.Fatalf("Cannot register executor: %s", rErr.Error())
+	}
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt := DagRunTask{DagId: "mock_dag", AtTime: execTs, TaskId: "task"}
+	uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskRunning)
+	if uErr != nil {
+		t.Fatalf("Cannot insert dag run task: %s", uErr.Error())
+	}
+	sErr := ts.DbClient.SetDagRunTaskExecutor(ctx, string(drt.DagId),
+		timeutils.ToString(execTs), drt.TaskId, &executorId)
+	if sErr != nil {
+		t.Fatalf("Cannot set dag run task executor: %s", sErr.Error())
+	}
+	return drt
+}
+
+func checkDagRunTaskStatus(
+	t *testing.T, ts *TaskScheduler, drt DagRunTask, expected dag.TaskStatus,
+) {
+	t.Helper()
+	drtDb, err := ts.DbClient.ReadDagRunTask(context.Background(),
+		string(drt.DagId), timeutils.ToString(drt.AtTime), drt.TaskId)
+	if err != nil {
+		t.Fatalf("Cannot read dag run task %v: %s", drt, err.Error())
+	}
+	if drtDb.Status != expected.String() {
+		t.Errorf("Expected status %s for %v, got %s", expected.String(), drt,
+			drtDb.Status)
+	}
+}
@@ -0,0 +1,344 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/grpcapi"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+	"github.com/dskrzypiec/scheduler/version"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcExecutorServer implements gRPC executor service (see grpcapi). It's an
+// alternative to HTTP endpoints used by executors, with the same semantics.
+// Instead of polling for tasks, executors open Dispatch stream and the
+// scheduler sends tasks as soon as they are available.
+type grpcExecutorServer struct {
+	s  *Scheduler
+	ts *TaskScheduler
+}
+
+// Creates new gRPC server with registered executor service. Calls are
+// authenticated and authorized the same way as HTTP requests.
+func newGrpcServer(s *Scheduler, ts *TaskScheduler) *grpc.Server {
+	authUnary, authStream := grpcAuthInterceptors(s.config.Authenticator)
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(authUnary, grpcProtocolUnaryInterceptor,
+			s.grpcAuthzUnaryInterceptor),
+		grpc.ChainStreamInterceptor(authStream, grpcProtocolStreamInterceptor,
+			s.grpcAuthzStreamInterceptor),
+	}
+	if s.config.GrpcTLSConfig != nil {
+		opts = append(opts,
+			grpc.Creds(credentials.NewTLS(s.config.GrpcTLSConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	grpcapi.RegisterExecutorServer(server, &grpcExecutorServer{s: s, ts: ts})
+	return server
+}
+
+// Serves gRPC executor service on Config.GrpcAddr. It blocks until the
+// server stops.
+func (s *Scheduler) serveGrpc(ts *TaskScheduler) {
+	listener, err := net.Listen("tcp", s.config.GrpcAddr)
+	if err != nil {
+		slog.Error("Cannot listen for gRPC connections", "addr",
+			s.config.GrpcAddr, "err", err)
+		return
+	}
+	slog.Info("Serving gRPC executor service", "addr", s.config.GrpcAddr)
+	if sErr := newGrpcServer(s, ts).Serve(listener); sErr != nil {
+		slog.Error("gRPC server stopped", "err", sErr)
+	}
+}
+
+func (g *grpcExecutorServer) Handshake(
+	context.Context, *models.Empty,
+) (*models.ProtocolInfo, error) {
+	return &models.ProtocolInfo{
+		Version:            version.Current(),
+		ProtocolVersion:    version.ProtocolVersion,
+		MinProtocolVersion: version.MinProtocolVersion,
+	}, nil
+}
+
+func (g *grpcExecutorServer) Register(
+	ctx context.Context, info *models.ExecutorInfo,
+) (*models.Empty, error) {
+	if info.ExecutorId == "" {
+		return nil, status.Error(codes.InvalidArgument,
+			"Executor ID is required")
+	}
+	if err := g.s.register(ctx, *info); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"Cannot register executor: %s", err.Error())
+	}
+	return &models.Empty{}, nil
+}
+
+func (g *grpcExecutorServer) Heartbeat(
+	ctx context.Context, hb *models.ExecutorHeartbeat,
+) (*models.ExecutorHeartbeatResponse, error) {
+	err := g.s.dbClient.UpdateExecutorHeartbeat(ctx, hb.ExecutorId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound,
+			"Executor %s is not registered", hb.ExecutorId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"Cannot update executor heartbeat: %s", err.Error())
+	}
+	resp := g.ts.heartbeatResponse(*hb)
+	return &resp, nil
+}
+
+func (g *grpcExecutorServer) UpdateTaskStatuses(
+	ctx context.Context, batch *models.TaskStatusBatch,
+) (*models.TaskStatusBatchResult, error) {
+	drts := make([]DagRunTask, len(batch.Updates))
+	statuses := make([]dag.TaskStatus, len(batch.Updates))
+	for idx, update := range batch.Updates {
+		drt, taskStatus, pErr := parseDagRunTaskStatus(update)
+		if pErr != nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"Incorrect update %d: %s", idx, pErr.Error())
+		}
+		drts[idx] = drt
+		statuses[idx] = taskStatus
+	}
+	result := models.TaskStatusBatchResult{
+		Failed: make([]models.DagRunTaskStatusError, 0),
+	}
+	for idx, drt := range drts {
+		updateErr := g.ts.upsertLeasedTaskStatus(ctx, drt, statuses[idx],
+			batch.Updates[idx].LeaseId)
+		if updateErr != nil {
+			slog.Error("Error while updating dag run task status", "dagruntask",
+				drt, "status", statuses[idx], "err", updateErr)
+			result.Failed = append(result.Failed, models.DagRunTaskStatusError{
+				DagRunTaskStatus: batch.Updates[idx],
+				Error:            updateErr.Error(),
+			})
+		}
+	}
+	return &result, nil
+}
+
+func (g *grpcExecutorServer) AckTask(
+	_ context.Context, req *models.LeaseRequest,
+) (*models.TaskLease, error) {
+	return g.extendLease(req.LeaseId, g.ts.Leases.ack)
+}
+
+func (g *grpcExecutorServer) RenewTaskLease(
+	_ context.Context, req *models.LeaseRequest,
+) (*models.TaskLease, error) {
+	return g.extendLease(req.LeaseId, g.ts.Leases.renew)
+}
+
+func (g *grpcExecutorServer) ReleaseTaskLease(
+	_ context.Context, req *models.LeaseRequest,
+) (*models.TaskLease, error) {
+	return g.extendLease(req.LeaseId, g.ts.Leases.revoke)
+}
+
+func (g *grpcExecutorServer) extendLease(
+	leaseId string, extend func(string, time.Time) (taskLease, error),
+) (*models.TaskLease, error) {
+	if g.ts.Leases == nil {
+		return nil, status.Error(codes.Unimplemented,
+			"Task leases are not enabled")
+	}
+	lease, err := extend(leaseId, time.Now())
+	if err == ErrLeaseNotFound {
+		return nil, status.Errorf(codes.NotFound,
+			"Lease %s does not exist or has expired", leaseId)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &models.TaskLease{
+		LeaseId:   lease.LeaseId,
+		ExpiresTs: timeutils.ToString(lease.ExpiresAt),
+	}, nil
+}
+
+// Dispatch handles stream of task requests from an executor. For each
+// request the scheduler sends single batch of tasks, once at least one task
+// is available or after WaitMs (capped by Config.MaxTaskPopWaitMs) with an
+// empty batch. Tasks which couldn't be sent are put back onto the queue.
+func (g *grpcExecutorServer) Dispatch(
+	stream grpc.BidiStreamingServer[models.PopTasksRequest, models.TaskBatch],
+) error {
+	ctx := stream.Context()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		waitMs := min(max(req.WaitMs, 0), g.ts.Config.MaxTaskPopWaitMs)
+		wait := time.Duration(waitMs) * time.Millisecond
+		labels := dag.NormalizeLabels(req.Labels)
+		drts, pErr := g.ts.popTasksForLabels(ctx, labels, wait,
+			max(req.MaxTasks, 1))
+		if pErr != nil {
+			return status.Errorf(codes.Internal,
+				"cannot get scheduled task from the queue: %s", pErr.Error())
+		}
+		batch := models.TaskBatch{Tasks: make([]models.TaskToExec, len(drts))}
+		for idx, drt := range drts {
+			batch.Tasks[idx] = g.ts.taskToExec(ctx, drt, req.ExecutorId)
+		}
+		if sErr := stream.Send(&batch); sErr != nil {
+			g.ts.requeueUnsent(drts, batch.Tasks)
+			return sErr
+		}
+	}
+}
+
+// Puts back onto the queue dag run tasks which were popped, but couldn't be
+// sent to the executor. When leases are enabled, leases are revoked instead,
+// so tasks are put back onto the queue on the next leases check, together
+// with clearing their owner.
+func (ts *TaskScheduler) requeueUnsent(
+	drts []DagRunTask, ttes []models.TaskToExec,
+) {
+	for idx, drt := range drts {
+		slog.Warn("Cannot send task to the executor. Putting task back onto "+
+			"the queue", "dagruntask", drt)
+		if ts.Leases != nil {
+			_, err := ts.Leases.revoke(ttes[idx].LeaseId, time.Now())
+			if err == nil {
+				continue
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(),
+			ts.databaseContextTimeout())
+		ds.PutContext(ctx, ts.TaskQueue, drt)
+		cancel()
+	}
+}
+
+// StreamLogs receives task output from an executor and writes it into the
+// scheduler log.
+func (g *grpcExecutorServer) StreamLogs(
+	stream grpc.ClientStreamingServer[models.TaskLog, models.Empty],
+) error {
+	for {
+		taskLog, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&models.Empty{})
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Task log", "dagId", taskLog.DagId, "execTs",
+			taskLog.ExecTs, "taskId", taskLog.TaskId, "stream",
+			taskLog.Stream, "line", taskLog.Line)
+	}
+}
+
+// Rejects unary calls in protocol version which is not supported by the
+// scheduler. Handshake is not checked, because executors call it to find out
+// supported protocol versions, the same as /protocol HTTP endpoint.
+func grpcProtocolUnaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if info.FullMethod != grpcHandshakeMethod {
+		if err := checkGrpcProtocol(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// Rejects streams in protocol version which is not supported by the
+// scheduler.
+func grpcProtocolStreamInterceptor(
+	srv any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := checkGrpcProtocol(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// Full name of handshake method, which is available for all principals, the
+// same as /protocol HTTP endpoint.
+const grpcHandshakeMethod = "/" + grpcapi.ServiceName + "/Handshake"
+
+// Rejects unary calls of principals which are not allowed to execute tasks.
+func (s *Scheduler) grpcAuthzUnaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if info.FullMethod != grpcHandshakeMethod {
+		if err := s.authorizeGrpc(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// Rejects streams of principals which are not allowed to execute tasks.
+func (s *Scheduler) grpcAuthzStreamInterceptor(
+	srv any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := s.authorizeGrpc(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// Checks protocol version sent in gRPC metadata. Calls without protocol
+// version are in protocol version 1, the same as HTTP requests.
+func checkGrpcProtocol(ctx context.Context, method string) error {
+	protocolVersion := 1
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(grpcapi.ProtocolVersionKey); len(values) > 0 {
+		v, err := strconv.Atoi(values[0])
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "incorrect %s: %s",
+				grpcapi.ProtocolVersionKey, values[0])
+		}
+		protocolVersion = v
+	}
+	if !version.IsProtocolSupported(protocolVersion) {
+		slog.Warn("Rejected gRPC call in unsupported protocol version",
+			"method", method, "protocolVersion", protocolVersion)
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf(
+			"Protocol version %d is not supported. Supported versions: %d-%d",
+			protocolVersion, version.MinProtocolVersion,
+			version.ProtocolVersion))
+	}
+	return nil
+}
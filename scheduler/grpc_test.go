@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/grpcapi"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGrpcDispatch(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Leases = NewTaskLeases(time.Minute)
+	client := grpcTestClient(t, ts, DefaultConfig)
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		grpcapi.ProtocolVersionKey, strconv.Itoa(version.ProtocolVersion))
+
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for _, taskId := range []string{"t1", "t2"} {
+		drt := DagRunTask{DagId: "mock_dag_grpc", AtTime: execTs,
+			TaskId: taskId}
+		if err := ts.TaskQueue.Put(drt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream, err := client.Dispatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pop := func(req models.PopTasksRequest) []models.TaskToExec {
+		if sErr := stream.Send(&req); sErr != nil {
+			t.Fatal(sErr)
+		}
+		batch, rErr := stream.Recv()
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		return batch.Tasks
+	}
+
+	ttes := pop(models.PopTasksRequest{MaxTasks: 5})
+	if len(ttes) != 2 || ttes[0].TaskId != "t1" || ttes[1].TaskId != "t2" {
+		t.Fatalf("Expected t1 and t2, got %+v", ttes)
+	}
+	if ttes[0].LeaseId == "" {
+		t.Error("Expected task lease to be granted")
+	}
+	empty := pop(models.PopTasksRequest{MaxTasks: 5, WaitMs: 20})
+	if len(empty) != 0 {
+		t.Errorf("Expected empty batch, got %+v", empty)
+	}
+
+	// Task put onto the queue while waiting is sent right away
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ts.TaskQueue.Put(DagRunTask{DagId: "mock_dag_grpc", AtTime: execTs,
+			TaskId: "t3"})
+	}()
+	start := time.Now()
+	ttes = pop(models.PopTasksRequest{MaxTasks: 1, WaitMs: 5000})
+	if len(ttes) != 1 || ttes[0].TaskId != "t3" {
+		t.Errorf("Expected t3, got %+v", ttes)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Expected task to be sent before the wait ends, took %v",
+			time.Since(start))
+	}
+
+	lease, aErr := client.AckTask(ctx, &models.LeaseRequest{
+		LeaseId: ttes[0].LeaseId,
+	})
+	if aErr != nil || lease.LeaseId != ttes[0].LeaseId {
+		t.Errorf("Expected lease to be acknowledged, got %+v, %v", lease, aErr)
+	}
+	_, aErr = client.AckTask(ctx, &models.LeaseRequest{LeaseId: "unknown"})
+	if status.Code(aErr) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown lease, got %v", aErr)
+	}
+}
+
+func TestGrpcRejectsUnsupportedProtocol(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	client := grpcTestClient(t, ts, DefaultConfig)
+
+	info, err := client.Handshake(context.Background(), &models.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ProtocolVersion != version.ProtocolVersion {
+		t.Errorf("Expected protocol version %d, got %d",
+			version.ProtocolVersion, info.ProtocolVersion)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		grpcapi.ProtocolVersionKey, strconv.Itoa(version.ProtocolVersion+1))
+	_, hErr := client.Heartbeat(ctx, &models.ExecutorHeartbeat{
+		ExecutorId: "e1",
+	})
+	if status.Code(hErr) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition, got %v", hErr)
+	}
+}
+
+func TestGrpcRejectsOutdatedProtocol(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	client := grpcTestClient(t, ts, DefaultConfig)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		grpcapi.ProtocolVersionKey,
+		strconv.Itoa(version.MinProtocolVersion-1))
+	_, hErr := client.Heartbeat(ctx, &models.ExecutorHeartbeat{
+		ExecutorId: "e1",
+	})
+	if status.Code(hErr) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for outdated heartbeat, got %v",
+			hErr)
+	}
+	_, aErr := client.AckTask(ctx, &models.LeaseRequest{LeaseId: "x"})
+	if status.Code(aErr) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for outdated ack, got %v", aErr)
+	}
+	stream, err := client.Dispatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rErr := stream.Recv()
+	if status.Code(rErr) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for outdated dispatch, got %v",
+			rErr)
+	}
+}
+
+// Starts gRPC executor service over in-memory connection and returns its
+// client.
+func grpcTestClient(
+	t *testing.T, ts *TaskScheduler, config Config,
+) *grpcapi.ExecutorClient {
+	s := &Scheduler{dbClient: ts.DbClient, config: config}
+	listener := bufconn.Listen(1024 * 1024)
+	server := newGrpcServer(s, ts)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(
+			func(context.Context, string) (net.Conn, error) {
+				return listener.Dial()
+			}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpcapi.NewExecutorClient(conn)
+}
+
+func TestGrpcAuthorization(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Leases = NewTaskLeases(time.Minute)
+	config := DefaultConfig
+	config.Authenticator = NewTokenAuthenticator(map[string]string{
+		"exec-1": "secret-exec",
+		"alice":  "secret-alice",
+	})
+	config.Policy = NewPolicy(
+		RoleBinding{Principal: "exec-1", Role: RoleExecutor},
+		RoleBinding{Principal: "alice", Role: RoleOperator},
+	)
+	client := grpcTestClient(t, ts, config)
+	callCtx := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(),
+			"authorization", "Bearer "+token, grpcapi.ProtocolVersionKey,
+			strconv.Itoa(version.ProtocolVersion))
+	}
+	alice, exec1 := callCtx("secret-alice"), callCtx("secret-exec")
+
+	if _, err := client.Handshake(alice, &models.Empty{}); err != nil {
+		t.Errorf("Expected handshake to be allowed, got %v", err)
+	}
+	unknownLease := &models.LeaseRequest{LeaseId: "unknown"}
+	_, aErr := client.AckTask(alice, unknownLease)
+	if status.Code(aErr) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for operator, got %v", aErr)
+	}
+	_, aErr = client.AckTask(exec1, unknownLease)
+	if status.Code(aErr) != codes.NotFound {
+		t.Errorf("Expected executor to be allowed, got %v", aErr)
+	}
+
+	stream, err := client.Dispatch(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rErr := stream.Recv()
+	if status.Code(rErr) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied on dispatch stream, got %v", rErr)
+	}
+
+	entries, lErr := ts.DbClient.ReadAuditLog(context.Background(), 10)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 denied calls in audit log, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Principal != "alice" || entry.Allowed ||
+			entry.Action != ActionExecuteTasks {
+			t.Errorf("Expected denied task execution of alice, got %+v",
+				entry)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+)
+
+// LabeledQueue is an optional interface for task queues which keep separate
+// queue for each set of task labels (see dag.LabeledTask). Keys are labels
+// joined by comma. Queue of empty key contains tasks without labels, which
+// can be executed by any executor. PopFrom should pop the task of the highest
+// priority among queues of given keys, preferring earlier keys on ties.
+// ds.KeyedQueue implements this interface.
+type LabeledQueue interface {
+	Keys() []string
+	PopFrom(keys ...string) (DagRunTask, error)
+}
+
+// Returns key of task queue for given dag run task - task labels joined by
+// comma. When DAG or task cannot be found in the registry, then empty key is
+// returned.
+func dagRunTaskLabelsKey(drt DagRunTask) string {
+	d, err := dag.Get(drt.DagId)
+	if err != nil {
+		return ""
+	}
+	task, tErr := d.GetTask(drt.TaskId)
+	if tErr != nil {
+		return ""
+	}
+	return strings.Join(dag.TaskLabels(task), ",")
+}
+
+// Parses comma-separated executor labels.
+func parseLabels(labels string) []string {
+	if labels == "" {
+		return []string{}
+	}
+	return dag.NormalizeLabels(strings.Split(labels, ","))
+}
+
+// Returns keys of queues which tasks can be executed by executor of given
+// labels. The most specific queues (of the most labels) go first, so among
+// tasks of the same priority executors of special capabilities prefer tasks
+// which need them. Queue of tasks without labels goes last.
+func matchingLabelKeys(keys []string, executorLabels []string) []string {
+	labels := make(map[string]struct{}, len(executorLabels))
+	for _, label := range executorLabels {
+		labels[label] = struct{}{}
+	}
+	matching := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		allMatch := true
+		for _, required := range strings.Split(key, ",") {
+			if _, ok := labels[required]; !ok {
+				allMatch = false
+				break
+			}
+		}
+		if allMatch {
+			matching = append(matching, key)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return strings.Count(matching[i], ",") > strings.Count(matching[j], ",")
+	})
+	return append(matching, "")
+}
+
+// Pops dag run task which can be executed by executor of given labels. When
+// task queue doesn't implement LabeledQueue, then labels are ignored. Tasks
+// which are already finished, because they were marked manually, are dropped.
+func (ts *TaskScheduler) popTaskForLabels(labels []string) (DagRunTask, error) {
+	return ts.popNotFinishedTask(func() (DagRunTask, error) {
+		return ts.popQueuedTaskForLabels(labels)
+	})
+}
+
+// Pops dag run tasks using given pop function, until it finds a task which is
+// not yet finished. Finished tasks are dropped.
+func (ts *TaskScheduler) popNotFinishedTask(
+	pop func() (DagRunTask, error),
+) (DagRunTask, error) {
+	for {
+		drt, err := pop()
+		if err != nil {
+			return drt, err
+		}
+		if !ts.taskIsFinished(drt) {
+			return drt, nil
+		}
+		// Task has been marked manually while it was waiting on the queue
+		slog.Info("Skipping already finished task popped from the queue",
+			"dagruntask", drt)
+	}
+}
+
+func (ts *TaskScheduler) popQueuedTaskForLabels(
+	labels []string,
+) (DagRunTask, error) {
+	lq, ok := ts.TaskQueue.(LabeledQueue)
+	if !ok {
+		if ts.TaskQueue.Size() == 0 {
+			return DagRunTask{}, ds.ErrQueueIsEmpty
+		}
+		return ts.TaskQueue.Pop()
+	}
+	return lq.PopFrom(matchingLabelKeys(lq.Keys(), labels)...)
+}
+
+// How often queue is checked while waiting for a task, when the task queue
+// doesn't implement ds.NotifyingQueue.
+const popWaitPollInterval = 10 * time.Millisecond
+
+// Waits up to given duration for a task to be popped by given pop function.
+// When task queue implements ds.NotifyingQueue, pop is retried only after new
+// tasks are put onto the queue. Otherwise the queue is polled. If there is
+// still no task after the wait or context is done, ds.ErrQueueIsEmpty is
+// returned.
+func (ts *TaskScheduler) waitForTask(
+	ctx context.Context, wait time.Duration, pop func() (DagRunTask, error),
+) (DagRunTask, error) {
+	nq, notifying := ts.TaskQueue.(ds.NotifyingQueue[DagRunTask])
+	deadline := time.Now().Add(wait)
+	for {
+		var changed <-chan struct{}
+		var poll <-chan time.Time
+		if notifying {
+			changed = nq.Changed()
+		} else {
+			poll = time.After(popWaitPollInterval)
+		}
+		drt, err := pop()
+		if err != ds.ErrQueueIsEmpty {
+			return drt, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return DagRunTask{}, ds.ErrQueueIsEmpty
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-poll:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return DagRunTask{}, ds.ErrQueueIsEmpty
+		}
+		timer.Stop()
+	}
+}
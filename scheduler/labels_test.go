@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+)
+
+type LabeledTask struct {
+	TaskId     string
+	TaskLabels []string
+}
+
+func (lt LabeledTask) Id() string       { return lt.TaskId }
+func (lt LabeledTask) Execute()         {}
+func (lt LabeledTask) Labels() []string { return lt.TaskLabels }
+
+type WeightedTask struct {
+	TaskId string
+	Weight int
+}
+
+func (wt WeightedTask) Id() string          { return wt.TaskId }
+func (wt WeightedTask) Execute()            {}
+func (wt WeightedTask) PriorityWeight() int { return wt.Weight }
+
+func TestMatchingLabelKeys(t *testing.T) {
+	keys := []string{"", "db_vpn", "db_vpn,highmem", "gpu", "highmem"}
+	data := []struct {
+		labels   []string
+		expected []string
+	}{
+		{[]string{}, []string{""}},
+		{[]string{"gpu"}, []string{"gpu", ""}},
+		{[]string{"highmem", "db_vpn"},
+			[]string{"db_vpn,highmem", "db_vpn", "highmem", ""}},
+		{[]string{"other"}, []string{""}},
+	}
+	for _, d := range data {
+		matching := matchingLabelKeys(keys, d.labels)
+		if !reflect.DeepEqual(matching, d.expected) {
+			t.Errorf("For labels %v expected keys %v, got %v", d.labels,
+				d.expected, matching)
+		}
+	}
+}
+
+func TestPopTaskRoutesByLabels(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.TaskQueue = DefaultQueues(DefaultConfig).DagRunTasks
+
+	root := dag.Node{Task: LabeledTask{"any", nil}}
+	gpu := dag.Node{Task: LabeledTask{"gpu", []string{"gpu"}}}
+	vpn := dag.Node{Task: LabeledTask{"vpn", []string{"db_vpn", "db_vpn"}}}
+	root.Next(&gpu)
+	root.Next(&vpn)
+	d := dag.New("mock_dag_labels").AddRoot(&root).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for _, taskId := range []string{"gpu", "vpn", "any"} {
+		drt := DagRunTask{DagId: d.Id, AtTime: execTs, TaskId: taskId}
+		if putErr := ts.TaskQueue.Put(drt); putErr != nil {
+			t.Fatalf("Cannot put task on the queue: %s", putErr.Error())
+		}
+	}
+
+	pop := func(query string) (int, string) {
+		rec := httptest.NewRecorder()
+		ts.popTask(rec, httptest.NewRequest("GET", "/dag/task/pop"+query, nil))
+		if rec.Code != http.StatusOK {
+			return rec.Code, ""
+		}
+		var tte models.TaskToExec
+		if jErr := json.Unmarshal(rec.Body.Bytes(), &tte); jErr != nil {
+			t.Fatal(jErr)
+		}
+		return rec.Code, tte.TaskId
+	}
+
+	// Executor with labels prefers tasks which need them
+	if code, taskId := pop("?labels=db_vpn,highmem"); taskId != "vpn" {
+		t.Errorf("Expected vpn task, got %d %s", code, taskId)
+	}
+	// Executor without labels gets only tasks without labels
+	if code, taskId := pop(""); taskId != "any" {
+		t.Errorf("Expected any task, got %d %s", code, taskId)
+	}
+	if code, _ := pop(""); code != http.StatusNoContent {
+		t.Errorf("Expected no task for executor without labels, got %d", code)
+	}
+	if code, _ := pop("?labels=db_vpn"); code != http.StatusNoContent {
+		t.Errorf("Expected no task for executor without gpu, got %d", code)
+	}
+	if code, taskId := pop("?labels=highmem,gpu"); taskId != "gpu" {
+		t.Errorf("Expected gpu task, got %d %s", code, taskId)
+	}
+}
+
+func TestPopTaskPrefersPriorityOverLabels(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.TaskQueue = DefaultQueues(DefaultConfig).DagRunTasks
+
+	root := dag.Node{Task: WeightedTask{"urgent", 100}}
+	gpu := dag.Node{Task: LabeledTask{"gpu", []string{"gpu"}}}
+	root.Next(&gpu)
+	d := dag.New("mock_dag_labels_priority").AddRoot(&root).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for _, taskId := range []string{"gpu", "urgent"} {
+		drt := DagRunTask{DagId: d.Id, AtTime: execTs, TaskId: taskId}
+		if putErr := ts.TaskQueue.Put(drt); putErr != nil {
+			t.Fatalf("Cannot put task on the queue: %s", putErr.Error())
+		}
+	}
+	for _, expected := range []string{"urgent", "gpu"} {
+		drt, err := ts.popTaskForLabels([]string{"gpu"})
+		if err != nil || drt.TaskId != expected {
+			t.Errorf("Expected %s task, got %v (err: %v)", expected, drt, err)
+		}
+	}
+}
+
+func TestPopTaskLongPolling(t *testing.T) {
+	for _, notifying := range []bool{true, false} {
+		ts := defaultTaskScheduler(t, 100)
+		if notifying {
+			ts.TaskQueue = DefaultQueues(DefaultConfig).DagRunTasks
+		}
+		execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+		drt := DagRunTask{DagId: "mock_dag_long_poll", AtTime: execTs,
+			TaskId: "t1"}
+
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		ts.popTask(rec, httptest.NewRequest("GET", "/dag/task/pop?waitMs=50",
+			nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Expected 204 after wait, got %d", rec.Code)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected pop to wait at least 50ms, waited %v", elapsed)
+		}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			if putErr := ts.TaskQueue.Put(drt); putErr != nil {
+				t.Errorf("Cannot put task on the queue: %s", putErr.Error())
+			}
+		}()
+		start = time.Now()
+		rec = httptest.NewRecorder()
+		ts.popTask(rec, httptest.NewRequest("GET", "/dag/task/pop?waitMs=5000",
+			nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200 when task is put while waiting, got %d",
+				rec.Code)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected pop to return soon after Put, waited %v",
+				elapsed)
+		}
+		db.CleanUpSqliteTmp(ts.DbClient, t)
+	}
+}
+
+func TestPopTaskIncorrectWait(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	rec := httptest.NewRecorder()
+	ts.popTask(rec, httptest.NewRequest("GET", "/dag/task/pop?waitMs=abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for incorrect waitMs, got %d", rec.Code)
+	}
+}
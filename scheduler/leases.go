@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// ErrLeaseNotFound is returned when lease does not exist, because it has
+// already expired or task is finished.
+var ErrLeaseNotFound = errors.New("task lease not found")
+
+// TaskLeases keeps track of dag run tasks handed out to executors. When task
+// is popped from the task queue by an executor, it gets a lease with expiry
+// time. Executor should acknowledge the lease right after receiving the task
+// and then renew it, until the task is finished. Leases which are not
+// acknowledged or renewed before expiry are returned and tasks are put back
+// onto the task queue. This way tasks are delivered at least once, even if
+// the response to the executor was lost. Lease is released when task reaches
+// terminal status. TaskLeases is safe for concurrent use.
+type TaskLeases struct {
+	sync.Mutex
+	timeout time.Duration
+	leases  map[string]*taskLease
+	byTask  map[DagRunTask]string
+}
+
+type taskLease struct {
+	LeaseId    string
+	Task       DagRunTask
+	ExecutorId string
+	ExpiresAt  time.Time
+	Acked      bool
+}
+
+// NewTaskLeases creates new TaskLeases where each lease is valid for given
+// timeout since it's granted, acknowledged or renewed.
+func NewTaskLeases(timeout time.Duration) *TaskLeases {
+	return &TaskLeases{
+		timeout: timeout,
+		leases:  make(map[string]*taskLease),
+		byTask:  make(map[DagRunTask]string),
+	}
+}
+
+// Creates TaskLeases based on TaskLeaseTimeoutMs from given configuration.
+// When the timeout is not positive, task leases are disabled and nil is
+// returned.
+func newTaskLeases(config TaskSchedulerConfig) *TaskLeases {
+	if config.TaskLeaseTimeoutMs <= 0 {
+		return nil
+	}
+	timeout := time.Duration(config.TaskLeaseTimeoutMs) * time.Millisecond
+	return NewTaskLeases(timeout)
+}
+
+// Grants new lease on given dag run task. If the task already had a lease, it
+// is replaced.
+func (tl *TaskLeases) grant(
+	drt DagRunTask, executorId string, now time.Time,
+) taskLease {
+	tl.Lock()
+	defer tl.Unlock()
+	if prevLeaseId, exists := tl.byTask[drt]; exists {
+		delete(tl.leases, prevLeaseId)
+	}
+	lease := &taskLease{
+		LeaseId:    newLeaseId(),
+		Task:       drt,
+		ExecutorId: executorId,
+		ExpiresAt:  now.Add(tl.timeout),
+	}
+	tl.leases[lease.LeaseId] = lease
+	tl.byTask[drt] = lease.LeaseId
+	return *lease
+}
+
+// Acknowledges receipt of the task and extends the lease.
+func (tl *TaskLeases) ack(leaseId string, now time.Time) (taskLease, error) {
+	return tl.extend(leaseId, now, true)
+}
+
+// Extends the lease.
+func (tl *TaskLeases) renew(leaseId string, now time.Time) (taskLease, error) {
+	return tl.extend(leaseId, now, false)
+}
+
+// Revokes the lease, by making it expire at given time. Task of revoked lease
+// is put back onto the queue on the next leases check.
+func (tl *TaskLeases) revoke(leaseId string, now time.Time) (taskLease, error) {
+	tl.Lock()
+	defer tl.Unlock()
+	lease, exists := tl.leases[leaseId]
+	if !exists || now.After(lease.ExpiresAt) {
+		return taskLease{}, ErrLeaseNotFound
+	}
+	lease.ExpiresAt = now
+	return *lease, nil
+}
+
+func (tl *TaskLeases) extend(
+	leaseId string, now time.Time, ack bool,
+) (taskLease, error) {
+	tl.Lock()
+	defer tl.Unlock()
+	lease, exists := tl.leases[leaseId]
+	if !exists || now.After(lease.ExpiresAt) {
+		return taskLease{}, ErrLeaseNotFound
+	}
+	lease.ExpiresAt = now.Add(tl.timeout)
+	if ack {
+		lease.Acked = true
+	}
+	return *lease, nil
+}
+
+// Checks if given lease is the current, not expired lease of given dag run
+// task. Otherwise ErrLeaseNotFound is returned.
+func (tl *TaskLeases) check(
+	drt DagRunTask, leaseId string, now time.Time,
+) error {
+	tl.Lock()
+	defer tl.Unlock()
+	currentLeaseId, exists := tl.byTask[drt]
+	if !exists || leaseId == "" || currentLeaseId != leaseId {
+		return ErrLeaseNotFound
+	}
+	if now.After(tl.leases[currentLeaseId].ExpiresAt) {
+		return ErrLeaseNotFound
+	}
+	return nil
+}
+
+// Restores lease with given identifier on given dag run task, e.g. after
+// scheduler restart. Restored lease is valid for the timeout since given time.
+func (tl *TaskLeases) restore(
+	drt DagRunTask, leaseId, executorId string, now time.Time,
+) {
+	tl.Lock()
+	defer tl.Unlock()
+	if prevLeaseId, exists := tl.byTask[drt]; exists {
+		delete(tl.leases, prevLeaseId)
+	}
+	tl.leases[leaseId] = &taskLease{
+		LeaseId:    leaseId,
+		Task:       drt,
+		ExecutorId: executorId,
+		ExpiresAt:  now.Add(tl.timeout),
+	}
+	tl.byTask[drt] = leaseId
+}
+
+// Releases lease of given dag run task, if there's any.
+func (tl *TaskLeases) release(drt DagRunTask) {
+	if tl == nil {
+		return
+	}
+	tl.Lock()
+	defer tl.Unlock()
+	leaseId, exists := tl.byTask[drt]
+	if !exists {
+		return
+	}
+	delete(tl.byTask, drt)
+	delete(tl.leases, leaseId)
+}
+
+// Removes and returns leases which expired before given time.
+func (tl *TaskLeases) expired(now time.Time) []taskLease {
+	tl.Lock()
+	defer tl.Unlock()
+	expired := make([]taskLease, 0)
+	for leaseId, lease := range tl.leases {
+		if now.After(lease.ExpiresAt) {
+			expired = append(expired, *lease)
+			delete(tl.leases, leaseId)
+			delete(tl.byTask, lease.Task)
+		}
+	}
+	return expired
+}
+
+func newLeaseId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// It should never happen, crypto/rand.Read on supported platforms
+		// doesn't return errors.
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Restores leases of not finished dag run tasks which were handed out to
+// executors, based on leases stored in the database. Executors have the lease
+// timeout since given time to renew them, otherwise tasks are put back onto
+// the queue.
+func restoreTaskLeases(
+	ctx context.Context, dbClient *db.Client, leases *TaskLeases,
+	now time.Time,
+) error {
+	drts, rErr := dbClient.ReadNotFinishedDagRunTasks(ctx)
+	if rErr != nil {
+		return rErr
+	}
+	for _, drtDb := range drts {
+		if drtDb.LeaseId == nil {
+			continue
+		}
+		execTs, tErr := timeutils.FromString(drtDb.ExecTs)
+		if tErr != nil {
+			slog.Error("Cannot parse dag run task execTs", "dagruntask", drtDb,
+				"err", tErr)
+			continue
+		}
+		drt := DagRunTask{
+			DagId:  dag.Id(drtDb.DagId),
+			AtTime: execTs,
+			TaskId: drtDb.TaskId,
+		}
+		executorId := ""
+		if drtDb.ExecutorId != nil {
+			executorId = *drtDb.ExecutorId
+		}
+		leases.restore(drt, *drtDb.LeaseId, executorId, now)
+	}
+	return nil
+}
+
+// Updates dag run task status reported by a remote executor. When leases are
+// enabled, the report has to come with the current lease of the task.
+// Otherwise it's rejected with ErrLeaseNotFound, because the lease has expired
+// and the task might have been handed out to another executor. Reports on
+// already finished tasks are ignored, as in upsertReportedTaskStatus.
+func (ts *TaskScheduler) upsertLeasedTaskStatus(
+	ctx context.Context, drt DagRunTask, status dag.TaskStatus, leaseId string,
+) error {
+	if ts.Leases == nil {
+		return ts.upsertReportedTaskStatus(ctx, drt, status)
+	}
+	if err := ts.Leases.check(drt, leaseId, time.Now()); err != nil {
+		dagrun := DagRun{DagId: drt.DagId, AtTime: drt.AtTime}
+		current, sErr := ts.getDagRunTaskStatus(dagrun, drt.TaskId)
+		if sErr == nil && current.IsTerminal() {
+			slog.Warn("Dag run task is already finished. Ignoring reported "+
+				"status", "dagruntask", drt, "currentStatus", current.String(),
+				"status", status.String())
+			return nil
+		}
+		slog.Warn("Status reported without current task lease. Rejecting",
+			"dagruntask", drt, "status", status.String(), "leaseId", leaseId)
+		return err
+	}
+	return ts.upsertReportedTaskStatus(ctx, drt, status)
+}
+
+// WatchLeases periodically checks task leases. Tasks of expired leases are put
+// back onto the task queue with status SCHEDULED.
+func (ts *TaskScheduler) WatchLeases() {
+	interval := ts.leaseCheckInterval()
+	for {
+		ts.requeueExpiredLeases(time.Now())
+		time.Sleep(interval)
+	}
+}
+
+// Returns interval of checking expired task leases. Not positive
+// TaskLeaseCheckMs is replaced by the default value, to avoid busy looping.
+func (ts *TaskScheduler) leaseCheckInterval() time.Duration {
+	checkMs := ts.Config.TaskLeaseCheckMs
+	if checkMs <= 0 {
+		checkMs = DefaultTaskSchedulerConfig.TaskLeaseCheckMs
+	}
+	return time.Duration(checkMs) * time.Millisecond
+}
+
+// Puts tasks of leases expired before given time back onto the task queue.
+func (ts *TaskScheduler) requeueExpiredLeases(now time.Time) {
+	if ts.Leases == nil {
+		return
+	}
+	for _, lease := range ts.Leases.expired(now) {
+		slog.Warn("Task lease expired. Putting task back onto the queue",
+			"dagruntask", lease.Task, "executorId", lease.ExecutorId,
+			"acked", lease.Acked)
+		ctx, cancel := context.WithTimeout(context.Background(),
+			ts.databaseContextTimeout())
+		lErr := ts.DbClient.SetDagRunTaskLease(ctx, string(lease.Task.DagId),
+			timeutils.ToString(lease.Task.AtTime), lease.Task.TaskId, nil)
+		if lErr != nil {
+			slog.Error("Cannot clear dag run task lease", "dagruntask",
+				lease.Task, "err", lErr)
+		}
+		if lease.ExecutorId != "" {
+			sErr := ts.DbClient.SetDagRunTaskExecutor(ctx,
+				string(lease.Task.DagId), timeutils.ToString(lease.Task.AtTime),
+				lease.Task.TaskId, nil)
+			if sErr != nil {
+				slog.Error("Cannot clear dag run task owner", "dagruntask",
+					lease.Task, "err", sErr)
+			}
+		}
+		uErr := ts.UpsertTaskStatus(ctx, lease.Task, dag.TaskScheduled)
+		if uErr != nil {
+			slog.Error("Cannot update dag run task status", "dagruntask",
+				lease.Task, "status", dag.TaskScheduled.String(), "err", uErr)
+		}
+		ds.PutContext(ctx, ts.TaskQueue, lease.Task)
+		cancel()
+	}
+}
@@ -0,0 +1,254 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestTaskLeasesExpiry(t *testing.T) {
+	const timeout = 10 * time.Second
+	leases := NewTaskLeases(timeout)
+	now := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt1 := DagRunTask{DagId: "dag", AtTime: now, TaskId: "t1"}
+	drt2 := DagRunTask{DagId: "dag", AtTime: now, TaskId: "t2"}
+	drt3 := DagRunTask{DagId: "dag", AtTime: now, TaskId: "t3"}
+
+	l1 := leases.grant(drt1, "exec1", now)
+	l2 := leases.grant(drt2, "exec1", now)
+	leases.grant(drt3, "exec1", now)
+	if l1.LeaseId == l2.LeaseId {
+		t.Errorf("Expected unique lease IDs, got %s twice", l1.LeaseId)
+	}
+
+	// t1 is acked and renewed, t2 is only acked, t3 is finished
+	if _, err := leases.ack(l1.LeaseId, now.Add(5*time.Second)); err != nil {
+		t.Errorf("Cannot ack lease: %s", err.Error())
+	}
+	if _, err := leases.ack(l2.LeaseId, now.Add(5*time.Second)); err != nil {
+		t.Errorf("Cannot ack lease: %s", err.Error())
+	}
+	renewed, rErr := leases.renew(l1.LeaseId, now.Add(12*time.Second))
+	if rErr != nil {
+		t.Errorf("Cannot renew lease: %s", rErr.Error())
+	}
+	if !renewed.Acked || !renewed.ExpiresAt.Equal(now.Add(22*time.Second)) {
+		t.Errorf("Unexpected renewed lease: %+v", renewed)
+	}
+	leases.release(drt3)
+
+	expired := leases.expired(now.Add(16 * time.Second))
+	if len(expired) != 1 || expired[0].Task != drt2 {
+		t.Errorf("Expected only lease on t2 to expire, got: %+v", expired)
+	}
+	_, rErr = leases.renew(l2.LeaseId, now.Add(16*time.Second))
+	if rErr != ErrLeaseNotFound {
+		t.Errorf("Expected ErrLeaseNotFound for expired lease, got: %v", rErr)
+	}
+	if expired := leases.expired(now.Add(23 * time.Second)); len(expired) != 1 {
+		t.Errorf("Expected lease on t1 to expire, got: %+v", expired)
+	}
+}
+
+func TestTaskLeasesConfig(t *testing.T) {
+	config := DefaultTaskSchedulerConfig
+	if leases := newTaskLeases(config); leases == nil {
+		t.Error("Expected task leases to be enabled by default config")
+	}
+	config.TaskLeaseTimeoutMs = 0
+	if leases := newTaskLeases(config); leases != nil {
+		t.Errorf("Expected task leases to be disabled for zero timeout, got %v",
+			leases)
+	}
+
+	ts := TaskScheduler{Config: TaskSchedulerConfig{TaskLeaseCheckMs: 0}}
+	expected := time.Duration(DefaultTaskSchedulerConfig.TaskLeaseCheckMs) *
+		time.Millisecond
+	if interval := ts.leaseCheckInterval(); interval != expected {
+		t.Errorf("Expected default lease check interval %v, got %v", expected,
+			interval)
+	}
+}
+
+func TestPopTaskLeaseExpiresAndTaskIsRequeued(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Leases = NewTaskLeases(time.Minute)
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt := DagRunTask{DagId: "mock_dag_lease", AtTime: execTs, TaskId: "t1"}
+	if err := ts.TaskQueue.Put(drt); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	ts.popTask(rec, httptest.NewRequest("GET", "/dag/task/pop", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from pop, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var tte models.TaskToExec
+	if jErr := json.Unmarshal(rec.Body.Bytes(), &tte); jErr != nil {
+		t.Fatal(jErr)
+	}
+	if tte.LeaseId == "" || tte.LeaseExpiresTs == "" {
+		t.Errorf("Expected lease in popped task, got: %+v", tte)
+	}
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected empty queue after pop, got %d", ts.TaskQueue.Size())
+	}
+
+	rec = httptest.NewRecorder()
+	ts.ackTask(rec, httptest.NewRequest("POST",
+		"/dag/task/ack?leaseId="+tte.LeaseId, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 from ack, got %d: %s", rec.Code,
+			rec.Body.String())
+	}
+
+	// Executor does not renew the lease
+	ts.requeueExpiredLeases(time.Now().Add(2 * time.Minute))
+	requeued, popErr := ts.TaskQueue.Pop()
+	if popErr != nil {
+		t.Fatalf("Expected task to be back on the queue: %s", popErr.Error())
+	}
+	if requeued != drt {
+		t.Errorf("Expected %v on the queue, got %v", drt, requeued)
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskScheduled)
+
+	rec = httptest.NewRecorder()
+	ts.renewTaskLease(rec, httptest.NewRequest("POST",
+		"/dag/task/renew?leaseId="+tte.LeaseId, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when renewing expired lease, got %d", rec.Code)
+	}
+}
+
+func TestTaskLeasesRevoke(t *testing.T) {
+	leases := NewTaskLeases(time.Minute)
+	now := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt := DagRunTask{DagId: "dag", AtTime: now, TaskId: "t1"}
+	lease := leases.grant(drt, "exec1", now)
+
+	if _, err := leases.revoke(lease.LeaseId, now.Add(time.Second)); err != nil {
+		t.Fatalf("Cannot revoke lease: %s", err.Error())
+	}
+	_, rErr := leases.renew(lease.LeaseId, now.Add(2*time.Second))
+	if rErr != ErrLeaseNotFound {
+		t.Errorf("Expected ErrLeaseNotFound for revoked lease, got: %v", rErr)
+	}
+	expired := leases.expired(now.Add(2 * time.Second))
+	if len(expired) != 1 || expired[0].Task != drt {
+		t.Errorf("Expected revoked lease on %v to expire, got: %+v", drt,
+			expired)
+	}
+}
+
+func TestStaleLeaseStatusReportIsRejected(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Leases = NewTaskLeases(time.Minute)
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt := DagRunTask{DagId: "mock_dag_lease_stale", AtTime: execTs,
+		TaskId: "t1"}
+	if err := ts.TaskQueue.Put(drt); err != nil {
+		t.Fatal(err)
+	}
+	pop := func() models.TaskToExec {
+		rec := httptest.NewRecorder()
+		ts.popTask(rec, httptest.NewRequest("GET", "/dag/task/pop", nil))
+		var tte models.TaskToExec
+		if jErr := json.Unmarshal(rec.Body.Bytes(), &tte); jErr != nil {
+			t.Fatal(jErr)
+		}
+		return tte
+	}
+	update := func(leaseId, status string) int {
+		body, _ := json.Marshal(models.DagRunTaskStatus{
+			DagId:   string(drt.DagId),
+			ExecTs:  timeutils.ToString(execTs),
+			TaskId:  drt.TaskId,
+			Status:  status,
+			LeaseId: leaseId,
+		})
+		rec := httptest.NewRecorder()
+		ts.updateTaskStatus(rec, httptest.NewRequest("POST",
+			"/dag/task/update", bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	staleTte := pop()
+	// Lease of the first executor expires and the task is handed out again
+	ts.requeueExpiredLeases(time.Now().Add(2 * time.Minute))
+	tte := pop()
+
+	if code := update(staleTte.LeaseId, "SUCCESS"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for stale lease, got %d", code)
+	}
+	if code := update("", "SUCCESS"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for status without lease, got %d", code)
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskScheduled)
+	if code := update(tte.LeaseId, "RUNNING"); code != http.StatusOK {
+		t.Errorf("Expected 200 for current lease, got %d", code)
+	}
+	if code := update(tte.LeaseId, "SUCCESS"); code != http.StatusOK {
+		t.Errorf("Expected 200 for current lease, got %d", code)
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskSuccess)
+	// Lease is released, but reports on finished tasks are ignored
+	if code := update(staleTte.LeaseId, "FAILED"); code != http.StatusOK {
+		t.Errorf("Expected 200 for finished task, got %d", code)
+	}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskSuccess)
+}
+
+func TestTaskLeasesAreRestoredAfterRestart(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Leases = NewTaskLeases(time.Minute)
+	ctx := context.Background()
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt1 := DagRunTask{DagId: "mock_dag_lease_restart", AtTime: execTs,
+		TaskId: "t1"}
+	drt2 := DagRunTask{DagId: "mock_dag_lease_restart", AtTime: execTs,
+		TaskId: "t2"}
+	ttes := make([]models.TaskToExec, 0, 2)
+	for _, drt := range []DagRunTask{drt1, drt2} {
+		if err := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled); err != nil {
+			t.Fatal(err)
+		}
+		ttes = append(ttes, ts.taskToExec(ctx, drt, "exec1"))
+	}
+	// Lease on t2 expires before restart and the task is put back
+	ts.Leases.revoke(ttes[1].LeaseId, time.Now())
+	ts.requeueExpiredLeases(time.Now().Add(time.Second))
+
+	// Scheduler is restarted
+	ts.Leases = NewTaskLeases(time.Minute)
+	now := time.Now()
+	if err := restoreTaskLeases(ctx, ts.DbClient, ts.Leases, now); err != nil {
+		t.Fatalf("Cannot restore task leases: %s", err.Error())
+	}
+	if _, err := ts.Leases.renew(ttes[0].LeaseId, now); err != nil {
+		t.Errorf("Expected lease on t1 to be restored, got: %v", err)
+	}
+	if err := ts.Leases.check(drt2, ttes[1].LeaseId, now); err == nil {
+		t.Error("Expected expired lease on t2 not to be restored")
+	}
+	uErr := ts.upsertLeasedTaskStatus(ctx, drt1, dag.TaskSuccess,
+		ttes[0].LeaseId)
+	if uErr != nil {
+		t.Errorf("Expected status report with restored lease to be "+
+			"accepted, got: %v", uErr)
+	}
+	checkDagRunTaskStatus(t, ts, drt1, dag.TaskSuccess)
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/ds"
+)
+
+// LocalExecutor executes tasks inside the scheduler process. It takes dag run
+// tasks directly from the task queue and updates their status via
+// TaskScheduler, without HTTP communication. It's meant for development and
+// small deployments, where a single binary runs the whole system. Local
+// executor takes tasks regardless of their labels.
+type LocalExecutor struct {
+	ts     *TaskScheduler
+	config LocalExecutorConfig
+}
+
+// NewLocalExecutor creates new LocalExecutor for given TaskScheduler.
+func NewLocalExecutor(
+	ts *TaskScheduler, config LocalExecutorConfig,
+) *LocalExecutor {
+	if config.MaxConcurrentTasks <= 0 {
+		config.MaxConcurrentTasks = DefaultLocalExecutorConfig.MaxConcurrentTasks
+	}
+	return &LocalExecutor{ts: ts, config: config}
+}
+
+// Start starts LocalExecutor. It's a blocking loop which pops tasks from the
+// queue and executes them in separate goroutines, up to MaxConcurrentTasks at
+// the same time.
+func (le *LocalExecutor) Start() {
+	slots := make(chan struct{}, le.config.MaxConcurrentTasks)
+	for {
+		slots <- struct{}{}
+		drt, err := le.ts.waitForTask(context.Background(),
+			le.config.PollInterval, le.popTask)
+		if err == ds.ErrQueueIsEmpty {
+			<-slots
+			continue
+		}
+		if err != nil {
+			<-slots
+			slog.Error("Local executor cannot pop task from the queue", "err",
+				err)
+			time.Sleep(le.config.PollInterval)
+			continue
+		}
+		go func() {
+			defer func() { <-slots }()
+			le.executeTask(drt)
+		}()
+	}
+}
+
+// Pops dag run task from the task queue. In case of LabeledQueue tasks of all
+// labels are taken into account. Tasks which are already finished, because
+// they were marked manually, are dropped.
+func (le *LocalExecutor) popTask() (DagRunTask, error) {
+	return le.ts.popNotFinishedTask(le.popQueuedTask)
+}
+
+func (le *LocalExecutor) popQueuedTask() (DagRunTask, error) {
+	lq, ok := le.ts.TaskQueue.(LabeledQueue)
+	if !ok {
+		if le.ts.TaskQueue.Size() == 0 {
+			return DagRunTask{}, ds.ErrQueueIsEmpty
+		}
+		return le.ts.TaskQueue.Pop()
+	}
+	return lq.PopFrom(lq.Keys()...)
+}
+
+// Executes given dag run task and updates its status. Task gets parameters of
+// its DAG run and its rendered templates in the context. The context is
+// cancelled, when the DAG run is cancelled (see TaskScheduler.CancelDagRun).
+// Panics in tasks are recovered and such tasks are marked as FAILED.
+func (le *LocalExecutor) executeTask(drt DagRunTask) {
+	d, dErr := dag.Get(drt.DagId)
+	if dErr != nil {
+		slog.Error("Could not get DAG from registry", "dagId", drt.DagId)
+		le.updateStatus(drt, dag.TaskFailed)
+		return
+	}
+	task, tErr := d.GetTask(drt.TaskId)
+	if tErr != nil {
+		slog.Error("Could not get task from DAG", "dagId", drt.DagId,
+			"taskId", drt.TaskId)
+		le.updateStatus(drt, dag.TaskFailed)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			le.updateStatus(drt, dag.TaskFailed)
+			slog.Error("Recovered from panic:", "err", r, "stack",
+				string(debug.Stack()))
+		}
+	}()
+	slog.Info("Start executing task locally", "dagruntask", drt)
+	le.updateStatus(drt, dag.TaskRunning)
+	taskCtx := le.ts.localTasks.start(drt)
+	defer le.ts.localTasks.finish(drt)
+	ctx := dag.ContextWithParams(taskCtx, le.runParams(d, drt))
+	ctx = dag.ContextWithRendered(ctx, le.rendered(drt))
+	dag.ExecuteTask(ctx, task)
+	slog.Info("Finished executing task locally", "dagruntask", drt)
+	le.updateStatus(drt, dag.TaskSuccess)
+}
+
+func (le *LocalExecutor) updateStatus(drt DagRunTask, status dag.TaskStatus) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		le.config.DatabaseContextTimeout)
+	defer cancel()
+	err := le.ts.upsertReportedTaskStatus(ctx, drt, status)
+	if err != nil {
+		slog.Error("Cannot update dag run task status", "dagruntask", drt,
+			"status", status.String(), "err", err)
+	}
+}
+
+// Returns parameters of the DAG run of given task. Defaults are used, when
+// stored parameters cannot be read.
+func (le *LocalExecutor) runParams(d dag.Dag, drt DagRunTask) dag.Params {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		le.config.DatabaseContextTimeout)
+	defer cancel()
+	stored, err := dag.ParseParams(le.ts.dagRunParams(ctx, drt))
+	if err != nil {
+		slog.Error("Cannot parse dag run parameters. Using defaults",
+			"dagruntask", drt, "err", err)
+	}
+	return d.RunParams(stored)
+}
+
+// Returns rendered templates of given task.
+func (le *LocalExecutor) rendered(drt DagRunTask) map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		le.config.DatabaseContextTimeout)
+	defer cancel()
+	rendered, err := dag.ParseRendered(le.ts.renderedTemplates(ctx, drt))
+	if err != nil {
+		slog.Error("Cannot parse rendered task templates", "dagruntask", drt,
+			"err", err)
+	}
+	return rendered
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+)
+
+type panicTask struct {
+	TaskId string
+}
+
+func (pt panicTask) Id() string { return pt.TaskId }
+func (pt panicTask) Execute()   { panic("task failed") }
+
+func TestLocalExecutorExecutesTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.TaskQueue = DefaultQueues(DefaultConfig).DagRunTasks
+
+	root := dag.Node{Task: EmptyTask{TaskId: "ok"}}
+	labeled := dag.Node{Task: LabeledTask{"labeled", []string{"gpu"}}}
+	failing := dag.Node{Task: panicTask{TaskId: "panic"}}
+	root.Next(&labeled)
+	root.Next(&failing)
+	d := dag.New("mock_dag_local_exec").AddRoot(&root).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	expected := map[DagRunTask]dag.TaskStatus{
+		{DagId: d.Id, AtTime: execTs, TaskId: "ok"}:      dag.TaskSuccess,
+		{DagId: d.Id, AtTime: execTs, TaskId: "labeled"}: dag.TaskSuccess,
+		{DagId: d.Id, AtTime: execTs, TaskId: "panic"}:   dag.TaskFailed,
+	}
+	for drt := range expected {
+		if putErr := ts.TaskQueue.Put(drt); putErr != nil {
+			t.Fatalf("Cannot put task on the queue: %s", putErr.Error())
+		}
+	}
+
+	le := NewLocalExecutor(ts, DefaultLocalExecutorConfig)
+	for range expected {
+		drt, popErr := le.popTask()
+		if popErr != nil {
+			t.Fatalf("Cannot pop task: %s", popErr.Error())
+		}
+		le.executeTask(drt)
+	}
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected empty task queue, got %d", ts.TaskQueue.Size())
+	}
+	for drt, status := range expected {
+		checkDagRunTaskStatus(t, ts, drt, status)
+	}
+}
+
+func TestLocalExecutorSkipsFinishedTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	marked := DagRunTask{DagId: "mock_dag_local", AtTime: execTs, TaskId: "t1"}
+	queued := DagRunTask{DagId: "mock_dag_local", AtTime: execTs, TaskId: "t2"}
+	ctx := context.Background()
+	for _, drt := range []DagRunTask{marked, queued} {
+		if uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled); uErr != nil {
+			t.Fatal(uErr)
+		}
+		if putErr := ts.TaskQueue.Put(drt); putErr != nil {
+			t.Fatalf("Cannot put task on the queue: %s", putErr.Error())
+		}
+	}
+	// Task is marked as failed while it's waiting on the queue
+	if uErr := ts.UpsertTaskStatus(ctx, marked, dag.TaskFailed); uErr != nil {
+		t.Fatal(uErr)
+	}
+
+	le := NewLocalExecutor(ts, DefaultLocalExecutorConfig)
+	drt, popErr := le.popTask()
+	if popErr != nil {
+		t.Fatalf("Cannot pop task: %s", popErr.Error())
+	}
+	if drt != queued {
+		t.Errorf("Expected marked task to be skipped and %v popped, got %v",
+			queued, drt)
+	}
+	if _, popErr = le.popTask(); popErr != ds.ErrQueueIsEmpty {
+		t.Errorf("Expected empty queue, got: %v", popErr)
+	}
+}
@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// ErrStatusNotMarkable is returned on marking a task or a DAG run with status
+// other than SUCCESS or FAILED.
+var ErrStatusNotMarkable = errors.New(
+	"only SUCCESS and FAILED statuses can be marked")
+
+// MarkTaskStatus sets status of given dag run task manually. Only SUCCESS and
+// FAILED statuses can be set. When the DAG run is still being scheduled, the
+// scheduler reacts as if the task would have been executed - children waiting
+// for the task are scheduled (SUCCESS) or marked as UPSTREAM_FAILED (FAILED).
+// If the task is on the queue, it won't be executed and if it's running, then
+// its lease is released and statuses reported by the executor are ignored.
+// Status of already finished DAG run is not changed.
+func (ts *TaskScheduler) MarkTaskStatus(
+	ctx context.Context, drt DagRunTask, status dag.TaskStatus,
+) error {
+	if status != dag.TaskSuccess && status != dag.TaskFailed {
+		return fmt.Errorf("%w: %s", ErrStatusNotMarkable, status.String())
+	}
+	d, dagErr := dag.Get(drt.DagId)
+	if dagErr != nil {
+		return dagErr
+	}
+	if _, exists := d.Graph().Task(drt.TaskId); !exists {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, drt.TaskId)
+	}
+	_, rErr := ts.DbClient.ReadDagRun(ctx, string(drt.DagId),
+		timeutils.ToString(drt.AtTime))
+	if rErr != nil {
+		return rErr
+	}
+	if uErr := ts.UpsertTaskStatus(ctx, drt, status); uErr != nil {
+		return uErr
+	}
+	slog.Info("Marked dag run task status", "dagruntask", drt, "status",
+		status.String())
+	return nil
+}
+
+// MarkDagRun sets status of the whole DAG run manually. Only SUCCESS and
+// FAILED statuses can be set. On SUCCESS all tasks which are not successful
+// are marked as SUCCESS. On FAILED scheduled and running tasks are marked as
+// FAILED and tasks which haven't been scheduled yet are marked as
+// UPSTREAM_FAILED, so nothing new is scheduled in this DAG run. Finished tasks
+// keep their statuses in this case. Scheduling of the DAG run is stopped, the
+// same as in CancelDagRun, and executors of running tasks get cancellation
+// signal in the next heartbeat response. Returns identifiers of marked tasks
+// in topological order.
+func (ts *TaskScheduler) MarkDagRun(
+	ctx context.Context, dagrun DagRun, status dag.RunStatus,
+) ([]string, error) {
+	if status != dag.RunSuccess && status != dag.RunFailed {
+		return nil, fmt.Errorf("%w: %s", ErrStatusNotMarkable, status.String())
+	}
+	d, dagErr := dag.Get(dagrun.DagId)
+	if dagErr != nil {
+		return nil, dagErr
+	}
+	dagId := string(dagrun.DagId)
+	execTs := timeutils.ToString(dagrun.AtTime)
+	if _, rErr := ts.DbClient.ReadDagRun(ctx, dagId, execTs); rErr != nil {
+		return nil, rErr
+	}
+	if status == dag.RunFailed {
+		if sErr := ts.stopDagRun(ctx, dagrun, status); sErr != nil {
+			return nil, sErr
+		}
+	}
+
+	marked := make([]string, 0)
+	interrupted := make([]string, 0)
+	for _, taskId := range d.Graph().TopologicalOrder() {
+		current, sErr := ts.getDagRunTaskStatus(dagrun, taskId)
+		if sErr != nil && sErr != sql.ErrNoRows {
+			return marked, sErr
+		}
+		newStatus, mark := markedTaskStatus(current, status)
+		if !mark {
+			continue
+		}
+		drt := DagRunTask{DagId: dagrun.DagId, AtTime: dagrun.AtTime,
+			TaskId: taskId}
+		if uErr := ts.UpsertTaskStatus(ctx, drt, newStatus); uErr != nil {
+			return marked, uErr
+		}
+		marked = append(marked, taskId)
+		if current == dag.TaskScheduled || current == dag.TaskRunning {
+			interrupted = append(interrupted, taskId)
+		}
+	}
+	if status == dag.RunFailed {
+		sErr := ts.signalCancelledTasks(ctx, dagrun, interrupted)
+		if sErr != nil {
+			return marked, sErr
+		}
+	}
+	uErr := ts.DbClient.UpdateDagRunStatusByExecTs(ctx, dagId, execTs,
+		status.String())
+	if uErr != nil {
+		return marked, uErr
+	}
+	slog.Info("Marked dag run status", "dagrun", dagrun, "status",
+		status.String(), "markedTaskIds", marked)
+	return marked, nil
+}
+
+// Returns status which a task of given current status should get, when its
+// DAG run is marked with given status. False is returned, when the task should
+// keep its current status.
+func markedTaskStatus(
+	current dag.TaskStatus, runStatus dag.RunStatus,
+) (dag.TaskStatus, bool) {
+	if runStatus == dag.RunSuccess {
+		return dag.TaskSuccess, current != dag.TaskSuccess
+	}
+	switch current {
+	case dag.TaskScheduled, dag.TaskRunning:
+		return dag.TaskFailed, true
+	case dag.TaskNoStatus:
+		return dag.TaskUpstreamFailed, true
+	}
+	return current, false
+}
+
+// HTTP handler for marking status of a single dag run task, given by dagId,
+// execTs and taskId query parameters. Parameter status should be SUCCESS or
+// FAILED (see TaskScheduler.MarkTaskStatus).
+func (s *Scheduler) markTaskStatus(ts *TaskScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST requests are allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		dagId := query.Get("dagId")
+		if dagId == "" {
+			http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+			return
+		}
+		execTs, tErr := timeutils.FromString(query.Get("execTs"))
+		if tErr != nil {
+			msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
+				tErr.Error())
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		taskId := query.Get("taskId")
+		if taskId == "" {
+			http.Error(w, "Parameter taskId is required", http.StatusBadRequest)
+			return
+		}
+		status, sErr := dag.ParseTaskStatus(query.Get("status"))
+		if sErr != nil {
+			http.Error(w, sErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(w, r, ActionMarkTasks, dagId) {
+			return
+		}
+		if _, dagErr := dag.Get(dag.Id(dagId)); dagErr != nil {
+			http.Error(w, dagErr.Error(), http.StatusNotFound)
+			return
+		}
+
+		drt := DagRunTask{DagId: dag.Id(dagId), AtTime: execTs, TaskId: taskId}
+		err := ts.MarkTaskStatus(r.Context(), drt, status)
+		if !writeMarkError(w, err, dagId, query.Get("execTs")) {
+			return
+		}
+		writeJson(w, models.MarkStatusResponse{
+			DagId:         dagId,
+			ExecTs:        timeutils.ToString(execTs),
+			Status:        status.String(),
+			MarkedTaskIds: []string{taskId},
+		})
+	}
+}
+
+// HTTP handler for marking status of the whole DAG run, given by dagId and
+// execTs query parameters. Parameter status should be SUCCESS or FAILED (see
+// TaskScheduler.MarkDagRun).
+func (s *Scheduler) markDagRun(ts *TaskScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST requests are allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		dagId := query.Get("dagId")
+		if dagId == "" {
+			http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+			return
+		}
+		execTs, tErr := timeutils.FromString(query.Get("execTs"))
+		if tErr != nil {
+			msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
+				tErr.Error())
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		status, sErr := dag.ParseRunStatus(query.Get("status"))
+		if sErr != nil {
+			http.Error(w, sErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(w, r, ActionMarkTasks, dagId) {
+			return
+		}
+		if _, dagErr := dag.Get(dag.Id(dagId)); dagErr != nil {
+			http.Error(w, dagErr.Error(), http.StatusNotFound)
+			return
+		}
+
+		dagrun := DagRun{DagId: dag.Id(dagId), AtTime: execTs}
+		marked, err := ts.MarkDagRun(r.Context(), dagrun, status)
+		if !writeMarkError(w, err, dagId, query.Get("execTs")) {
+			return
+		}
+		writeJson(w, models.MarkStatusResponse{
+			DagId:         dagId,
+			ExecTs:        timeutils.ToString(execTs),
+			Status:        status.String(),
+			MarkedTaskIds: marked,
+		})
+	}
+}
+
+// Writes response for error returned while marking statuses. Returns true,
+// when there is no error and response is not written.
+func writeMarkError(
+	w http.ResponseWriter, err error, dagId, execTs string,
+) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrStatusNotMarkable), errors.Is(err, ErrTaskNotFound):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		msg := fmt.Sprintf("There is no dag run for DAG %s at %s", dagId,
+			execTs)
+		http.Error(w, msg, http.StatusNotFound)
+	default:
+		msg := fmt.Sprintf("Cannot mark status: %s", err.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+	return false
+}
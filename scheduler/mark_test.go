@@ -0,0 +1,297 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestMarkTaskStatusUnblocksChildren(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 14, 8, 0, 0, 0, time.UTC)
+	d := dag.New("mock_dag_mark_task").AddRoot(nodes131()).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id),
+		timeutils.ToString(startTs)); iErr != nil {
+		t.Fatal(iErr)
+	}
+	errsChan := make(chan taskSchedulerError)
+	go listenOnSchedulerErrors(errsChan, t)
+	go executeAllTasksExceptStuck(ctx, ts, map[string]struct{}{"n22": {}})
+
+	scheduled := make(chan struct{})
+	go func() {
+		ts.scheduleDagTasks(ctx, dagrun, errsChan)
+		close(scheduled)
+	}()
+	n22 := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "n22"}
+	waitForTaskStatus(ts, n22, dag.TaskRunning, t)
+	n3Status, _ := ts.getDagRunTaskStatus(dagrun, "n3")
+	if n3Status != dag.TaskNoStatus {
+		t.Errorf("Expected n3 to wait for n22, got status %s",
+			n3Status.String())
+	}
+
+	mErr := ts.MarkTaskStatus(ctx, n22, dag.TaskRunning)
+	if !errors.Is(mErr, ErrStatusNotMarkable) {
+		t.Errorf("Expected ErrStatusNotMarkable for RUNNING, got: %v", mErr)
+	}
+	unknown := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "n4"}
+	mErr = ts.MarkTaskStatus(ctx, unknown, dag.TaskSuccess)
+	if !errors.Is(mErr, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for unknown task, got: %v", mErr)
+	}
+	if mErr = ts.MarkTaskStatus(ctx, n22, dag.TaskSuccess); mErr != nil {
+		t.Fatalf("Cannot mark n22 as SUCCESS: %s", mErr.Error())
+	}
+	select {
+	case <-scheduled:
+	case <-ctx.Done():
+		t.Fatal("Dag run has not finished after marking n22 as SUCCESS")
+	}
+	testDagRunStatus(ts, dagrun, dag.RunSuccess, t)
+
+	// Late status reported by the executor is ignored
+	if uErr := ts.upsertReportedTaskStatus(ctx, n22, dag.TaskFailed); uErr != nil {
+		t.Fatalf("Cannot report n22 status: %s", uErr.Error())
+	}
+	drt, rErr := ts.DbClient.ReadDagRunTask(ctx, string(d.Id),
+		timeutils.ToString(startTs), "n22")
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if drt.Status != dag.TaskSuccess.String() {
+		t.Errorf("Expected n22 to stay SUCCESS, got: %s", drt.Status)
+	}
+}
+
+func TestMarkDagRunFailedStopsScheduling(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 14, 9, 0, 0, 0, time.UTC)
+	d := dag.New("mock_dag_mark_dagrun").AddRoot(nodes131()).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id),
+		timeutils.ToString(startTs)); iErr != nil {
+		t.Fatal(iErr)
+	}
+	errsChan := make(chan taskSchedulerError)
+	go listenOnSchedulerErrors(errsChan, t)
+	go executeAllTasksExceptStuck(ctx, ts, map[string]struct{}{"n22": {}})
+
+	scheduled := make(chan struct{})
+	go func() {
+		ts.scheduleDagTasks(ctx, dagrun, errsChan)
+		close(scheduled)
+	}()
+	for _, taskId := range []string{"n21", "n23"} {
+		drt := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: taskId}
+		waitForTaskStatus(ts, drt, dag.TaskSuccess, t)
+	}
+	n22 := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "n22"}
+	waitForTaskStatus(ts, n22, dag.TaskRunning, t)
+
+	marked, mErr := ts.MarkDagRun(ctx, dagrun, dag.RunFailed)
+	if mErr != nil {
+		t.Fatalf("Cannot mark dag run as FAILED: %s", mErr.Error())
+	}
+	if !reflect.DeepEqual(marked, []string{"n22", "n3"}) {
+		t.Errorf("Expected n22 and n3 to be marked, got: %v", marked)
+	}
+	select {
+	case <-scheduled:
+	case <-ctx.Done():
+		t.Fatal("Dag run has not finished after marking it as FAILED")
+	}
+	testDagRunStatus(ts, dagrun, dag.RunFailed, t)
+
+	expected := map[string]dag.TaskStatus{
+		"n1":  dag.TaskSuccess,
+		"n21": dag.TaskSuccess,
+		"n22": dag.TaskFailed,
+		"n23": dag.TaskSuccess,
+		"n3":  dag.TaskUpstreamFailed,
+	}
+	for taskId, status := range expected {
+		drt, rErr := ts.DbClient.ReadDagRunTask(ctx, string(d.Id),
+			timeutils.ToString(startTs), taskId)
+		if rErr != nil {
+			t.Fatalf("Cannot read task %s: %s", taskId, rErr.Error())
+		}
+		if drt.Status != status.String() {
+			t.Errorf("Expected task %s status %s, got: %s", taskId,
+				status.String(), drt.Status)
+		}
+	}
+}
+
+func TestMarkDagRunFailedSignalsExecutor(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 14, 10, 0, 0, 0, time.UTC)
+	execTs := timeutils.ToString(startTs)
+	d := dag.New("mock_dag_mark_dagrun_signal").AddRoot(nodes131()).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id), execTs); iErr != nil {
+		t.Fatal(iErr)
+	}
+	executorId := "exec_mark"
+	rErr := ts.DbClient.RegisterExecutor(ctx, executorId, "localhost", 1)
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	errsChan := make(chan taskSchedulerError)
+	go listenOnSchedulerErrors(errsChan, t)
+	go executeAllTasksExceptStuck(ctx, ts, map[string]struct{}{"n22": {}})
+
+	scheduled := make(chan struct{})
+	schedCtx := ts.scheduledRuns.start(dagrun)
+	go func() {
+		ts.scheduleDagTasks(schedCtx, dagrun, errsChan)
+		ts.scheduledRuns.finish(dagrun)
+		close(scheduled)
+	}()
+	n22 := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "n22"}
+	waitForTaskStatus(ts, n22, dag.TaskRunning, t)
+	sErr := ts.DbClient.SetDagRunTaskExecutor(ctx, string(d.Id), execTs, "n22",
+		&executorId)
+	if sErr != nil {
+		t.Fatal(sErr)
+	}
+
+	if _, mErr := ts.MarkDagRun(ctx, dagrun, dag.RunFailed); mErr != nil {
+		t.Fatalf("Cannot mark dag run as FAILED: %s", mErr.Error())
+	}
+	select {
+	case <-scheduled:
+	default:
+		t.Error("Expected dag run scheduling to be stopped after marking")
+	}
+	testDagRunStatus(ts, dagrun, dag.RunFailed, t)
+	checkDagRunTaskStatus(t, ts, n22, dag.TaskFailed)
+
+	expected := []models.TaskToExec{
+		{DagId: string(d.Id), ExecTs: execTs, TaskId: "n22"},
+	}
+	signals := ts.cancelledTasks.drain(executorId)
+	if !reflect.DeepEqual(signals, expected) {
+		t.Errorf("Expected cancellation signals %v, got: %v", expected,
+			signals)
+	}
+}
+
+func TestMarkTaskStatusHandlerSkipsQueuedTask(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	startTs := time.Date(2023, time.October, 14, 10, 0, 0, 0, time.UTC)
+	execTs := timeutils.ToString(startTs)
+	d := dag.New("mock_dag_mark_handler").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	ctx := context.Background()
+	if _, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id), execTs); iErr != nil {
+		t.Fatal(iErr)
+	}
+	drt := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "task"}
+	if uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled); uErr != nil {
+		t.Fatal(uErr)
+	}
+	if pErr := ts.TaskQueue.Put(drt); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	s := New(ts.DbClient, Queues{}, DefaultConfig)
+	handler := s.markTaskStatus(ts)
+	post := func(execTs, status string) int {
+		query := url.Values{}
+		query.Set("dagId", "mock_dag_mark_handler")
+		query.Set("execTs", execTs)
+		query.Set("taskId", "task")
+		query.Set("status", status)
+		req := httptest.NewRequest("POST",
+			"/dagrun/task/mark?"+query.Encode(), nil)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+	if code := post(execTs, "RUNNING"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for RUNNING status, got %d", code)
+	}
+	otherTs := timeutils.ToString(startTs.Add(time.Hour))
+	if code := post(otherTs, "SUCCESS"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing dag run, got %d", code)
+	}
+	if code := post(execTs, "SUCCESS"); code != http.StatusOK {
+		t.Fatalf("Expected 200 for marking task, got %d", code)
+	}
+	if popped, pErr := ts.popTaskForLabels(nil); pErr != ds.ErrQueueIsEmpty {
+		t.Errorf("Expected marked task to be skipped, got: %v, %v", popped,
+			pErr)
+	}
+}
+
+// Executes tasks popped from the queue and marks them as SUCCESS, except
+// stuck tasks, which stay RUNNING.
+func executeAllTasksExceptStuck(
+	ctx context.Context, ts *TaskScheduler, stuck map[string]struct{},
+) {
+	for ctx.Err() == nil {
+		drt, err := ts.popTaskForLabels(nil)
+		if err == ds.ErrQueueIsEmpty {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		ts.upsertReportedTaskStatus(ctx, drt, dag.TaskRunning)
+		if _, isStuck := stuck[drt.TaskId]; !isStuck {
+			ts.upsertReportedTaskStatus(ctx, drt, dag.TaskSuccess)
+		}
+	}
+}
+
+// Waits until given dag run task has expected status in the database. Status
+// is written into the database after the cache, so once it's there, the
+// update is complete.
+func waitForTaskStatus(
+	ts *TaskScheduler, drt DagRunTask, expected dag.TaskStatus, t *testing.T,
+) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		drtDb, err := ts.DbClient.ReadDagRunTask(context.Background(),
+			string(drt.DagId), timeutils.ToString(drt.AtTime), drt.TaskId)
+		if err == nil && drtDb.Status == expected.String() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Dag run task %v has not reached status %s", drt,
+		expected.String())
+}
@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// Pools keeps track of used slots in named pools. Tasks which implement
+// dag.PoolTask can be scheduled (put on the task queue) only when there's a
+// free slot in their pool. Slot is released when the task reaches terminal
+// status. Pools is safe for concurrent use.
+type Pools struct {
+	sync.Mutex
+	slots   map[string]int
+	used    map[string]int
+	holders map[DagRunTask]string
+}
+
+// NewPools creates Pools based on mapping from pool name onto number of
+// slots.
+func NewPools(slots map[string]int) *Pools {
+	s := make(map[string]int, len(slots))
+	for name, cnt := range slots {
+		s[name] = cnt
+	}
+	return &Pools{
+		slots:   s,
+		used:    make(map[string]int, len(slots)),
+		holders: make(map[DagRunTask]string),
+	}
+}
+
+// Tries to acquire a slot in given pool for given dag run task. Returns true,
+// if slot was acquired or if there's no need for a slot (no pool, or not
+// defined pool). Acquiring slot more then once for the same dag run task is a
+// no-op.
+func (p *Pools) tryAcquire(drt DagRunTask, pool string) bool {
+	if p == nil || pool == "" {
+		return true
+	}
+	p.Lock()
+	defer p.Unlock()
+	slots, exists := p.slots[pool]
+	if !exists {
+		slog.Warn("Task is assigned to not defined pool. It's scheduled without limits",
+			"dagruntask", drt, "pool", pool)
+		return true
+	}
+	if _, alreadyHolds := p.holders[drt]; alreadyHolds {
+		return true
+	}
+	if p.used[pool] >= slots {
+		return false
+	}
+	p.used[pool]++
+	p.holders[drt] = pool
+	return true
+}
+
+// Releases slot held by given dag run task. If the task does not hold any
+// slot, it's a no-op.
+func (p *Pools) release(drt DagRunTask) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	pool, holds := p.holders[drt]
+	if !holds {
+		return
+	}
+	delete(p.holders, drt)
+	p.used[pool]--
+	slog.Debug("Released pool slot", "dagruntask", drt, "pool", pool,
+		"used", p.used[pool], "slots", p.slots[pool])
+}
+
+// Registers given dag run task as a holder of a slot in given pool, even if
+// the pool is already full. It's used to restore slots of tasks which were
+// scheduled before the scheduler restart. Tasks without defined pool are
+// skipped.
+func (p *Pools) hold(drt DagRunTask, pool string) {
+	if p == nil || pool == "" {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if _, exists := p.slots[pool]; !exists {
+		return
+	}
+	if _, alreadyHolds := p.holders[drt]; alreadyHolds {
+		return
+	}
+	p.used[pool]++
+	p.holders[drt] = pool
+}
+
+// Returns number of used slots in given pool.
+func (p *Pools) usedSlots(pool string) int {
+	p.Lock()
+	defer p.Unlock()
+	return p.used[pool]
+}
+
+// Synchronize pools defined in the configuration with pools table in the
+// database and returns Pools based on the configuration. Pools which are no
+// longer configured are deleted from the database. Slots of not finished
+// (SCHEDULED or RUNNING) dag run tasks are restored, so pools are not
+// over-committed after the scheduler restart.
+func syncPools(
+	ctx context.Context, dbClient *db.Client, pools map[string]int,
+) (*Pools, error) {
+	for name, slots := range pools {
+		uErr := dbClient.UpsertPool(ctx, name, slots)
+		if uErr != nil {
+			slog.Error("Could not upsert pool", "name", name, "err", uErr)
+			return nil, uErr
+		}
+	}
+	dbPools, rErr := dbClient.ReadPools(ctx)
+	if rErr != nil {
+		return nil, rErr
+	}
+	for _, pool := range dbPools {
+		if _, configured := pools[pool.Name]; configured {
+			continue
+		}
+		dErr := dbClient.DeletePool(ctx, pool.Name)
+		if dErr != nil {
+			slog.Error("Could not delete not configured pool", "name",
+				pool.Name, "err", dErr)
+			return nil, dErr
+		}
+		slog.Info("Deleted pool which is no longer configured", "name",
+			pool.Name)
+	}
+	p := NewPools(pools)
+	if hErr := restorePoolHolders(ctx, dbClient, p); hErr != nil {
+		return nil, hErr
+	}
+	return p, nil
+}
+
+// Restores pool slots held by not finished dag run tasks.
+func restorePoolHolders(
+	ctx context.Context, dbClient *db.Client, pools *Pools,
+) error {
+	drts, rErr := dbClient.ReadNotFinishedDagRunTasks(ctx)
+	if rErr != nil {
+		return rErr
+	}
+	for _, drtDb := range drts {
+		pool := taskPool(dag.Id(drtDb.DagId), drtDb.TaskId)
+		if pool == "" {
+			continue
+		}
+		execTs, tErr := timeutils.FromString(drtDb.ExecTs)
+		if tErr != nil {
+			slog.Error("Cannot parse dag run task execTs", "dagruntask", drtDb,
+				"err", tErr)
+			continue
+		}
+		drt := DagRunTask{
+			DagId:  dag.Id(drtDb.DagId),
+			AtTime: execTs,
+			TaskId: drtDb.TaskId,
+		}
+		pools.hold(drt, pool)
+	}
+	return nil
+}
+
+// Returns pool name of given task in given DAG. If DAG or the task cannot be
+// found, then empty string (no pool) is returned.
+func taskPool(dagId dag.Id, taskId string) string {
+	d, err := dag.Get(dagId)
+	if err != nil {
+		return ""
+	}
+	task, tErr := d.GetTask(taskId)
+	if tErr != nil {
+		return ""
+	}
+	return dag.TaskPool(task)
+}
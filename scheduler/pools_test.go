@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+type PoolTask struct {
+	TaskId   string
+	PoolName string
+}
+
+func (pt PoolTask) Id() string   { return pt.TaskId }
+func (pt PoolTask) Execute()     {}
+func (pt PoolTask) Pool() string { return pt.PoolName }
+
+func TestPoolsAcquireAndRelease(t *testing.T) {
+	pools := NewPools(map[string]int{"vendor_api": 2})
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt1 := DagRunTask{DagId: "dag1", AtTime: execTs, TaskId: "t1"}
+	drt2 := DagRunTask{DagId: "dag2", AtTime: execTs, TaskId: "t1"}
+	drt3 := DagRunTask{DagId: "dag3", AtTime: execTs, TaskId: "t1"}
+
+	if !pools.tryAcquire(drt1, "vendor_api") {
+		t.Error("Expected to acquire the first slot")
+	}
+	if !pools.tryAcquire(drt1, "vendor_api") {
+		t.Error("Expected acquiring slot again by the same task to succeed")
+	}
+	if !pools.tryAcquire(drt2, "vendor_api") {
+		t.Error("Expected to acquire the second slot")
+	}
+	if pools.tryAcquire(drt3, "vendor_api") {
+		t.Error("Expected not to acquire slot when pool is full")
+	}
+	if !pools.tryAcquire(drt3, "") || !pools.tryAcquire(drt3, "not_defined") {
+		t.Error("Expected tasks without defined pool to be not limited")
+	}
+
+	pools.release(drt1)
+	pools.release(drt1) // no-op
+	if used := pools.usedSlots("vendor_api"); used != 1 {
+		t.Errorf("Expected 1 used slot after release, got %d", used)
+	}
+	if !pools.tryAcquire(drt3, "vendor_api") {
+		t.Error("Expected to acquire slot after release")
+	}
+}
+
+func TestScheduleSingleTaskWaitsForPoolSlot(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Pools = NewPools(map[string]int{"vendor_api": 1})
+
+	start := dag.Node{Task: PoolTask{"start", "vendor_api"}}
+	d := dag.New("mock_dag_pools").AddRoot(&start).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	dagrun1 := DagRun{DagId: d.Id, AtTime: execTs}
+	dagrun2 := DagRun{DagId: d.Id, AtTime: execTs.Add(time.Hour)}
+
+	ts.scheduleSingleTask(context.Background(), dagrun1, "start")
+	scheduled := make(chan struct{})
+	go func() {
+		ts.scheduleSingleTask(context.Background(), dagrun2, "start")
+		close(scheduled)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if ts.TaskQueue.Size() != 1 {
+		t.Errorf("Expected only one task on the queue while pool is full, got %d",
+			ts.TaskQueue.Size())
+	}
+
+	drt1 := DagRunTask{DagId: d.Id, AtTime: execTs, TaskId: "start"}
+	uErr := ts.UpsertTaskStatus(context.Background(), drt1, dag.TaskSuccess)
+	if uErr != nil {
+		t.Fatalf("Cannot update task status: %s", uErr.Error())
+	}
+	select {
+	case <-scheduled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task was not scheduled after pool slot was released")
+	}
+	if ts.TaskQueue.Size() != 2 {
+		t.Errorf("Expected two tasks on the queue, got %d", ts.TaskQueue.Size())
+	}
+}
+
+func TestSyncPools(t *testing.T) {
+	c, err := db.NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if uErr := c.UpsertPool(ctx, "from_db", 3); uErr != nil {
+		t.Fatal(uErr)
+	}
+	pools, sErr := syncPools(ctx, c, map[string]int{"from_config": 1})
+	if sErr != nil {
+		t.Fatalf("Cannot sync pools: %s", sErr.Error())
+	}
+	if len(pools.slots) != 1 || pools.slots["from_config"] != 1 {
+		t.Errorf("Expected only pool from config, got %v", pools.slots)
+	}
+	dbPools, rErr := c.ReadPools(ctx)
+	if rErr != nil {
+		t.Fatalf("Cannot read pools: %s", rErr.Error())
+	}
+	if len(dbPools) != 1 || dbPools[0].Name != "from_config" {
+		t.Errorf("Expected not configured pool to be deleted, got %v", dbPools)
+	}
+}
+
+func TestSyncPoolsRestoresHolders(t *testing.T) {
+	c, err := db.NewInMemoryClient(sqlSchemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	t1 := dag.Node{Task: PoolTask{"t1", "dwh"}}
+	t2 := dag.Node{Task: PoolTask{"t2", "dwh"}}
+	t3 := dag.Node{Task: PoolTask{"t3", "dwh"}}
+	t1.Next(&t2)
+	t2.Next(&t3)
+	d := dag.New("mock_dag_pools_restore").AddRoot(&t1).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	execTs := timeutils.ToString(
+		time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC))
+	statuses := map[string]string{
+		"t1": db.DagRunTaskStatusSuccess,
+		"t2": db.DagRunTaskStatusRunning,
+		"t3": db.DagRunTaskStatusScheduled,
+	}
+	for taskId, status := range statuses {
+		iErr := c.InsertDagRunTask(ctx, string(d.Id), execTs, taskId, status)
+		if iErr != nil {
+			t.Fatal(iErr)
+		}
+	}
+
+	pools, sErr := syncPools(ctx, c, map[string]int{"dwh": 2})
+	if sErr != nil {
+		t.Fatalf("Cannot sync pools: %s", sErr.Error())
+	}
+	if used := pools.usedSlots("dwh"); used != 2 {
+		t.Errorf("Expected 2 slots held by not finished tasks, got %d", used)
+	}
+	drt := DagRunTask{DagId: "other", AtTime: time.Now(), TaskId: "t1"}
+	if pools.tryAcquire(drt, "dwh") {
+		t.Error("Expected pool to be full after restoring holders")
+	}
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+)
+
+// HTTP handler for protocol handshake. Executors should call it before
+// registration, to negotiate protocol version.
+func (s *Scheduler) protocolInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(models.ProtocolInfo{
+		Version:            version.Current(),
+		ProtocolVersion:    version.ProtocolVersion,
+		MinProtocolVersion: version.MinProtocolVersion,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Wraps executor endpoint handler with protocol version check. Requests in
+// protocol version which is not supported by the scheduler are rejected.
+func withProtocolCheck(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		protocolVersion, err := requestProtocolVersion(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest,
+				models.ErrCodeIncompatibleProtocol, err.Error())
+			return
+		}
+		if !version.IsProtocolSupported(protocolVersion) {
+			slog.Warn("Rejected request in unsupported protocol version",
+				"path", r.URL.Path, "protocolVersion", protocolVersion)
+			msg := fmt.Sprintf("Protocol version %d is not supported. "+
+				"Supported versions: %d-%d", protocolVersion,
+				version.MinProtocolVersion, version.ProtocolVersion)
+			writeError(w, r, http.StatusBadRequest,
+				models.ErrCodeIncompatibleProtocol, msg)
+			return
+		}
+		w.Header().Set(models.ProtocolVersionHeader,
+			strconv.Itoa(protocolVersion))
+		handler(w, r)
+	}
+}
+
+// Returns protocol version of given request. Requests without protocol
+// version header are in protocol version 1.
+func requestProtocolVersion(r *http.Request) (int, error) {
+	header := r.Header.Get(models.ProtocolVersionHeader)
+	if header == "" {
+		return 1, nil
+	}
+	protocolVersion, err := strconv.Atoi(header)
+	if err != nil {
+		return 0, fmt.Errorf("incorrect %s header: %s",
+			models.ProtocolVersionHeader, header)
+	}
+	return protocolVersion, nil
+}
+
+// Writes error response. Since protocol version 2 errors are sent in
+// models.ErrorResponse envelope, for older protocol versions errors are sent
+// as plain text.
+func writeError(
+	w http.ResponseWriter, r *http.Request, statusCode int, code, msg string,
+) {
+	protocolVersion, _ := requestProtocolVersion(r)
+	if protocolVersion < 2 {
+		http.Error(w, msg, statusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(models.ErrorResponse{
+		Error: models.Error{Code: code, Message: msg},
+	})
+	if err != nil {
+		slog.Error("Cannot write error response", "code", code, "err", err)
+	}
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/version"
+)
+
+func TestProtocolCheckRejectsUnsupportedVersion(t *testing.T) {
+	called := false
+	handler := withProtocolCheck(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	req := httptest.NewRequest("GET", "/dag/task/pop", nil)
+	req.Header.Set(models.ProtocolVersionHeader,
+		strconv.Itoa(version.ProtocolVersion+1))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if called {
+		t.Error("Expected handler not to be called")
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+	var errResp models.ErrorResponse
+	if jErr := json.Unmarshal(rec.Body.Bytes(), &errResp); jErr != nil {
+		t.Fatalf("Expected error envelope, got %s", rec.Body.String())
+	}
+	if errResp.Error.Code != models.ErrCodeIncompatibleProtocol {
+		t.Errorf("Expected code %s, got %s",
+			models.ErrCodeIncompatibleProtocol, errResp.Error.Code)
+	}
+}
+
+func TestProtocolCheckRejectsOutdatedVersion(t *testing.T) {
+	ts := &TaskScheduler{}
+	handler := withProtocolCheck(ts.ackTask)
+
+	// Protocol version 1 (no header) gets plain text errors
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/dag/task/ack?leaseId=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+	if strings.HasPrefix(rec.Body.String(), "{") {
+		t.Errorf("Expected plain text error, got %s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest("POST", "/dag/task/ack?leaseId=x", nil)
+	req.Header.Set(models.ProtocolVersionHeader,
+		strconv.Itoa(version.MinProtocolVersion-1))
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	var errResp models.ErrorResponse
+	if jErr := json.Unmarshal(rec.Body.Bytes(), &errResp); jErr != nil {
+		t.Fatalf("Expected error envelope, got %s", rec.Body.String())
+	}
+	if errResp.Error.Code != models.ErrCodeIncompatibleProtocol {
+		t.Errorf("Expected code %s, got %s",
+			models.ErrCodeIncompatibleProtocol, errResp.Error.Code)
+	}
+}
+
+func TestProtocolCheckPassesSupportedVersion(t *testing.T) {
+	ts := &TaskScheduler{}
+	handler := withProtocolCheck(ts.ackTask)
+
+	req := httptest.NewRequest("POST", "/dag/task/ack?leaseId=x", nil)
+	req.Header.Set(models.ProtocolVersionHeader,
+		strconv.Itoa(version.MinProtocolVersion))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	var errResp models.ErrorResponse
+	if jErr := json.Unmarshal(rec.Body.Bytes(), &errResp); jErr != nil {
+		t.Fatalf("Expected error envelope, got %s", rec.Body.String())
+	}
+	if errResp.Error.Code != models.ErrCodeLeasesDisabled {
+		t.Errorf("Expected code %s, got %s", models.ErrCodeLeasesDisabled,
+			errResp.Error.Code)
+	}
+	expected := strconv.Itoa(version.MinProtocolVersion)
+	if rec.Header().Get(models.ProtocolVersionHeader) != expected {
+		t.Errorf("Expected negotiated protocol version in response header")
+	}
+}
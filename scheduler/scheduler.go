@@ -2,10 +2,13 @@ package scheduler
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/dskrzypiec/scheduler/dag"
@@ -41,13 +44,15 @@ func New(dbClient *db.Client, queues Queues, config Config) *Scheduler {
 // Start starts Scheduler. It synchronize internal queues with the database,
 // fires up DAG watcher, task scheduler and finally returns HTTP ServeMux
 // with attached HTTP endpoints for communication between scheduler and
-// executors. TODO(dskrzypiec): more docs
+// executors. When Config.Authenticator is set, all endpoints require
+// authentication. TODO(dskrzypiec): more docs
 func (s *Scheduler) Start() http.Handler {
 	cacheSize := s.config.DagRunTaskCacheLen
 	taskCache := ds.NewLruCache[DagRunTask, DagRunTaskState](cacheSize)
 
 	// Syncing queues with the database in case of program restarts.
 	syncWithDatabase(s.queues.DagRuns, s.dbClient, s.config)
+	pools := s.initPools()
 	//syncDagRunTaskCache(context.TODO(), taskCache, s.dbClient) // TODO
 
 	dagRunWatcher := NewDagRunWatcher(
@@ -59,6 +64,8 @@ func (s *Scheduler) Start() http.Handler {
 		DagRunQueue: s.queues.DagRuns,
 		TaskQueue:   s.queues.DagRunTasks,
 		TaskCache:   taskCache,
+		Pools:       pools,
+		Leases:      s.initLeases(),
 		Config:      s.config.TaskSchedulerConfig,
 	}
 
@@ -74,24 +81,130 @@ func (s *Scheduler) Start() http.Handler {
 		taskScheduler.Start()
 	}()
 
+	if taskScheduler.Leases != nil {
+		go func() {
+			// Running in the background requeueing tasks of expired leases
+			taskScheduler.WatchLeases()
+		}()
+	}
+
+	go func() {
+		// Running in the background detection of dead executors
+		taskScheduler.WatchExecutors(s.config.ExecutorReaperConfig)
+	}()
+
+	if s.config.LocalExecutorConfig.Enabled {
+		localExecutor := NewLocalExecutor(&taskScheduler,
+			s.config.LocalExecutorConfig)
+		go func() {
+			// Running in the background executing tasks in this process
+			localExecutor.Start()
+		}()
+	}
+
+	if s.config.GrpcAddr != "" {
+		go func() {
+			// Running in the background gRPC executor service
+			s.serveGrpc(&taskScheduler)
+		}()
+	}
+
 	mux := http.NewServeMux()
 	s.registerEndpoints(mux, &taskScheduler)
 
-	return mux
+	return withAuthentication(s.config.Authenticator, mux)
+}
+
+// Synchronize pools from the configuration with the database and initialize
+// Pools. When that fails, then only pools from the configuration are used.
+func (s *Scheduler) initPools() *Pools {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		s.config.StartupContextTimeout)
+	defer cancel()
+	pools, err := syncPools(ctx, s.dbClient, s.config.Pools)
+	if err != nil {
+		slog.Error("Cannot sync pools with the database. Only pools from "+
+			"config are used", "err", err)
+		return NewPools(s.config.Pools)
+	}
+	return pools
+}
+
+// Creates task leases and restores leases of tasks handed out to executors
+// before restart, so their status reports are still accepted. When leases are
+// disabled, nil is returned.
+func (s *Scheduler) initLeases() *TaskLeases {
+	leases := newTaskLeases(s.config.TaskSchedulerConfig)
+	if leases == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(),
+		s.config.StartupContextTimeout)
+	defer cancel()
+	if err := restoreTaskLeases(ctx, s.dbClient, leases, time.Now()); err != nil {
+		slog.Error("Cannot restore task leases. Status reports of tasks "+
+			"handed out before restart will be rejected", "err", err)
+	}
+	return leases
 }
 
 func (s *Scheduler) registerEndpoints(mux *http.ServeMux, ts *TaskScheduler) {
-	mux.HandleFunc("/dag/task/pop", ts.popTask)
-	mux.HandleFunc("/dag/task/update", ts.updateTaskStatus)
+	// Endpoints used by executors
+	executorEndpoints := map[string]http.HandlerFunc{
+		"/dag/task/pop":        ts.popTask,
+		"/dag/task/update":     ts.updateTaskStatus,
+		"/dag/task/popmany":    ts.popTasks,
+		"/dag/task/updatemany": ts.updateTaskStatuses,
+		"/dag/task/ack":        ts.ackTask,
+		"/dag/task/renew":      ts.renewTaskLease,
+		"/dag/task/release":    ts.releaseTaskLease,
+		"/executor/register":   s.registerExecutor,
+		"/executor/heartbeat":  s.executorHeartbeat(ts),
+	}
+	for pattern, handler := range executorEndpoints {
+		mux.HandleFunc(pattern,
+			withProtocolCheck(s.withExecutorAuthorization(handler)))
+	}
+	mux.HandleFunc("/protocol", s.protocolInfo)
+	mux.HandleFunc("/dag/graph", s.dagGraph)
+	mux.HandleFunc("/dag/analysis", s.dagAnalysis)
+	mux.HandleFunc("/dag/pause", s.pauseDag)
+	mux.HandleFunc("/dag/unpause", s.unpauseDag)
+	mux.HandleFunc("/dag/trigger", s.triggerDagRun(ts))
+	mux.HandleFunc("/dagrun/clear", s.clearTasks(ts))
+	mux.HandleFunc("/dagrun/mark", s.markDagRun(ts))
+	mux.HandleFunc("/dagrun/cancel", s.cancelDagRun(ts))
+	mux.HandleFunc("/dagrun/task/mark", s.markTaskStatus(ts))
+	mux.HandleFunc("/auditlog", s.auditLog)
+	s.registerApiEndpoints(mux)
 }
 
-// HTTP handler for popping dag run task from the queue.
-func (ts *TaskScheduler) popTask(w http.ResponseWriter, _ *http.Request) {
-	if ts.TaskQueue.Size() == 0 {
-		w.WriteHeader(http.StatusNoContent)
+// HTTP handler for popping dag run task from the queue. Task queue contains
+// only tasks which are ready to be executed. With default Queues the task of
+// the highest priority is returned. When executorId query parameter is given,
+// then the executor becomes the owner of popped task. Tasks of executors which
+// stop sending heartbeats are considered lost. When task leases are enabled,
+// popped task is leased to the executor - the executor has to acknowledge the
+// lease (/dag/task/ack) and then renew it (/dag/task/renew), otherwise the
+// task would be put back onto the queue after the lease expires. Executor
+// might advertise its labels in comma-separated labels query parameter, to get
+// also tasks which require those labels (see dag.LabeledTask). Tasks without
+// labels can be popped by any executor. When the queue is empty and waitMs
+// query parameter is given, then the request blocks until a task is
+// available, but not longer than waitMs milliseconds (capped by
+// Config.MaxTaskPopWaitMs). This way executors don't need to poll the
+// scheduler in a tight loop.
+func (ts *TaskScheduler) popTask(w http.ResponseWriter, r *http.Request) {
+	labels := parseLabels(r.URL.Query().Get("labels"))
+	wait, wErr := ts.taskPopWait(r.URL.Query().Get("waitMs"))
+	if wErr != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			wErr.Error())
 		return
 	}
-	drt, err := ts.TaskQueue.Pop()
+	drt, err := ts.waitForTask(r.Context(), wait, func() (DagRunTask, error) {
+		return ts.popTaskForLabels(labels)
+	})
 	if err == ds.ErrQueueIsEmpty {
 		w.WriteHeader(http.StatusNoContent)
 		return
@@ -99,66 +212,506 @@ func (ts *TaskScheduler) popTask(w http.ResponseWriter, _ *http.Request) {
 	if err != nil {
 		errMsg := fmt.Sprintf("cannot get scheduled task from the queue: %s",
 			err.Error())
-		http.Error(w, errMsg, http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			errMsg)
 		return
 	}
+	executorId := r.URL.Query().Get("executorId")
+	drtmodel := ts.taskToExec(r.Context(), drt, executorId)
 	w.Header().Set("Content-Type", "application/json")
-	drtmodel := models.TaskToExec{
-		DagId:  string(drt.DagId),
-		ExecTs: timeutils.ToString(drt.AtTime),
-		TaskId: drt.TaskId,
-	}
 	jsonBytes, jsonErr := json.Marshal(drtmodel)
 	if jsonErr != nil {
-		http.Error(w, jsonErr.Error(), http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			jsonErr.Error())
 		return
 	}
 	w.Write(jsonBytes)
 }
 
+// HTTP handler for popping many dag run tasks at once. It works the same as
+// /dag/task/pop, but returns list of at most max tasks (query parameter,
+// capped by Config.MaxTaskPopBatch). Only the first task is awaited, when
+// waitMs is given.
+func (ts *TaskScheduler) popTasks(w http.ResponseWriter, r *http.Request) {
+	labels := parseLabels(r.URL.Query().Get("labels"))
+	wait, wErr := ts.taskPopWait(r.URL.Query().Get("waitMs"))
+	if wErr != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			wErr.Error())
+		return
+	}
+	maxTasks, mErr := strconv.Atoi(r.URL.Query().Get("max"))
+	if mErr != nil || maxTasks <= 0 {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			"Parameter max should be a positive integer")
+		return
+	}
+	drts, err := ts.popTasksForLabels(r.Context(), labels, wait, maxTasks)
+	if err != nil {
+		errMsg := fmt.Sprintf("cannot get scheduled task from the queue: %s",
+			err.Error())
+		writeError(w, r, http.StatusInternalServerError,
+			models.ErrCodeInternal, errMsg)
+		return
+	}
+	if len(drts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	executorId := r.URL.Query().Get("executorId")
+	ttes := make([]models.TaskToExec, len(drts))
+	for idx, drt := range drts {
+		ttes[idx] = ts.taskToExec(r.Context(), drt, executorId)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonErr := json.NewEncoder(w).Encode(ttes)
+	if jsonErr != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			jsonErr.Error())
+	}
+}
+
+// Pops at most maxTasks (capped by Config.MaxTaskPopBatch) dag run tasks for
+// an executor of given labels. Only the first task is awaited, up to given
+// wait duration. Empty list is returned, when there are no tasks. Error is
+// returned only when no task could be popped.
+func (ts *TaskScheduler) popTasksForLabels(
+	ctx context.Context, labels []string, wait time.Duration, maxTasks int,
+) ([]DagRunTask, error) {
+	maxTasks = min(maxTasks, ts.maxTaskPopBatch())
+	pop := func() (DagRunTask, error) {
+		return ts.popTaskForLabels(labels)
+	}
+	drts := make([]DagRunTask, 0, maxTasks)
+	drt, err := ts.waitForTask(ctx, wait, pop)
+	for err == nil {
+		drts = append(drts, drt)
+		if len(drts) == maxTasks {
+			break
+		}
+		drt, err = pop()
+	}
+	if err != nil && err != ds.ErrQueueIsEmpty {
+		if len(drts) == 0 {
+			return nil, err
+		}
+		// Already popped tasks are not lost, they are sent to the executor
+		slog.Error("Cannot get scheduled task from the queue", "err", err)
+	}
+	return drts, nil
+}
+
+// Returns Config.MaxTaskPopBatch. Not positive value is replaced by the
+// default one, so a single pop never drains the whole queue.
+func (ts *TaskScheduler) maxTaskPopBatch() int {
+	if ts.Config.MaxTaskPopBatch <= 0 {
+		return DefaultTaskSchedulerConfig.MaxTaskPopBatch
+	}
+	return ts.Config.MaxTaskPopBatch
+}
+
+// Prepares popped dag run task to be sent to the executor. When executorId is
+// not empty, the executor becomes the owner of the task. If leases are
+// enabled, new lease is granted.
+func (ts *TaskScheduler) taskToExec(
+	ctx context.Context, drt DagRunTask, executorId string,
+) models.TaskToExec {
+	execTs := timeutils.ToString(drt.AtTime)
+	if executorId != "" {
+		sErr := ts.DbClient.SetDagRunTaskExecutor(ctx, string(drt.DagId),
+			execTs, drt.TaskId, &executorId)
+		if sErr != nil {
+			// Task is still sent to the executor, but it won't be tracked
+			slog.Error("Cannot set dag run task owner", "dagruntask", drt,
+				"executorId", executorId, "err", sErr)
+		}
+	}
+	tte := models.TaskToExec{
+		DagId:    string(drt.DagId),
+		ExecTs:   execTs,
+		TaskId:   drt.TaskId,
+		Params:   ts.dagRunParams(ctx, drt),
+		Rendered: ts.renderedTemplates(ctx, drt),
+	}
+	if ts.Leases != nil {
+		lease := ts.Leases.grant(drt, executorId, time.Now())
+		tte.LeaseId = lease.LeaseId
+		tte.LeaseExpiresTs = timeutils.ToString(lease.ExpiresAt)
+		lErr := ts.DbClient.SetDagRunTaskLease(ctx, string(drt.DagId), execTs,
+			drt.TaskId, &lease.LeaseId)
+		if lErr != nil {
+			// Lease is valid, but it won't be restored after restart
+			slog.Error("Cannot store dag run task lease", "dagruntask", drt,
+				"leaseId", lease.LeaseId, "err", lErr)
+		}
+	}
+	return tte
+}
+
+// Parses waitMs parameter of /dag/task/pop. Empty value means no waiting.
+func (ts *TaskScheduler) taskPopWait(waitMs string) (time.Duration, error) {
+	if waitMs == "" {
+		return 0, nil
+	}
+	ms, err := strconv.Atoi(waitMs)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("incorrect waitMs parameter: %s", waitMs)
+	}
+	ms = min(ms, ts.Config.MaxTaskPopWaitMs)
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
 // Updates task status in the task cache and the database.
 func (ts *TaskScheduler) updateTaskStatus(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	if r.Method != "POST" {
-		http.Error(w, "Only POST requests are allowed",
-			http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed,
+			models.ErrCodeMethodNotAllowed, "Only POST requests are allowed")
 		return
 	}
 
 	var drts models.DagRunTaskStatus
 	err := json.NewDecoder(r.Body).Decode(&drts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			err.Error())
 		return
 	}
+	drt, status, pErr := parseDagRunTaskStatus(drts)
+	if pErr != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidStatus,
+			pErr.Error())
+		return
+	}
+
+	ctx := context.TODO()
+	updateErr := ts.upsertLeasedTaskStatus(ctx, drt, status, drts.LeaseId)
+	if errors.Is(updateErr, ErrLeaseNotFound) {
+		msg := fmt.Sprintf("Lease %s is not the current lease of the task",
+			drts.LeaseId)
+		writeError(w, r, http.StatusConflict, models.ErrCodeLeaseNotFound, msg)
+		return
+	}
+	if updateErr != nil {
+		msg := fmt.Sprintf("Error while updating dag run task status: %s",
+			updateErr.Error())
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			msg)
+		return
+	}
+	slog.Debug("Updated task status", "dagruntask", drt, "status", status,
+		"duration", time.Since(start))
+}
+
+// Updates many task statuses at once. Request body is a list of
+// models.DagRunTaskStatus. If any of them is incorrect, then nothing is
+// updated and 400 is returned. Otherwise all updates are applied and list of
+// those which failed is returned (empty, when all succeeded).
+func (ts *TaskScheduler) updateTaskStatuses(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed,
+			models.ErrCodeMethodNotAllowed, "Only POST requests are allowed")
+		return
+	}
+	var drtsList []models.DagRunTaskStatus
+	err := json.NewDecoder(r.Body).Decode(&drtsList)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			err.Error())
+		return
+	}
+	drts := make([]DagRunTask, len(drtsList))
+	statuses := make([]dag.TaskStatus, len(drtsList))
+	for idx, update := range drtsList {
+		drt, status, pErr := parseDagRunTaskStatus(update)
+		if pErr != nil {
+			msg := fmt.Sprintf("Incorrect update %d: %s", idx, pErr.Error())
+			writeError(w, r, http.StatusBadRequest,
+				models.ErrCodeInvalidStatus, msg)
+			return
+		}
+		drts[idx] = drt
+		statuses[idx] = status
+	}
+	failed := make([]models.DagRunTaskStatusError, 0)
+	for idx, drt := range drts {
+		updateErr := ts.upsertLeasedTaskStatus(r.Context(), drt,
+			statuses[idx], drtsList[idx].LeaseId)
+		if updateErr != nil {
+			slog.Error("Error while updating dag run task status", "dagruntask",
+				drt, "status", statuses[idx], "err", updateErr)
+			failed = append(failed, models.DagRunTaskStatusError{
+				DagRunTaskStatus: drtsList[idx],
+				Error:            updateErr.Error(),
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonErr := json.NewEncoder(w).Encode(failed)
+	if jsonErr != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			jsonErr.Error())
+		return
+	}
+	slog.Debug("Updated task statuses", "updates", len(drts), "failed",
+		len(failed), "duration", time.Since(start))
+}
+
+// Parses dag run task status sent by an executor.
+func parseDagRunTaskStatus(
+	drts models.DagRunTaskStatus,
+) (DagRunTask, dag.TaskStatus, error) {
 	execTs, tErr := timeutils.FromString(drts.ExecTs)
 	if tErr != nil {
-		msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
-			tErr.Error())
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+		return DagRunTask{}, 0, fmt.Errorf(
+			"given execTs timestamp in incorrect format: %s", tErr.Error())
 	}
 	status, statusErr := dag.ParseTaskStatus(drts.Status)
 	if statusErr != nil {
-		msg := fmt.Sprintf("Incorrect dag run task status: %s",
-			statusErr.Error())
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+		return DagRunTask{}, 0, fmt.Errorf(
+			"incorrect dag run task status: %s", statusErr.Error())
 	}
 	drt := DagRunTask{
 		DagId:  dag.Id(drts.DagId),
 		AtTime: execTs,
 		TaskId: drts.TaskId,
 	}
+	return drt, status, nil
+}
 
-	ctx := context.TODO()
-	updateErr := ts.UpsertTaskStatus(ctx, drt, status)
-	if updateErr != nil {
-		msg := fmt.Sprintf("Error while updating dag run task status: %s",
-			updateErr.Error())
+// HTTP handler for acknowledging receipt of popped task. Lease is given in
+// leaseId query parameter. If the lease has already expired, then 404 is
+// returned and the executor should not execute the task, because it's been
+// put back onto the queue.
+func (ts *TaskScheduler) ackTask(w http.ResponseWriter, r *http.Request) {
+	ts.extendTaskLease(w, r, ts.Leases.ack)
+}
+
+// HTTP handler for renewing lease of a task which is being executed. Lease is
+// given in leaseId query parameter.
+func (ts *TaskScheduler) renewTaskLease(w http.ResponseWriter, r *http.Request) {
+	ts.extendTaskLease(w, r, ts.Leases.renew)
+}
+
+// HTTP handler for releasing lease of a task which executor won't finish (for
+// example because it's shutting down). Lease is given in leaseId query
+// parameter. The task is put back onto the queue on the next leases check.
+func (ts *TaskScheduler) releaseTaskLease(w http.ResponseWriter, r *http.Request) {
+	ts.extendTaskLease(w, r, ts.Leases.revoke)
+}
+
+func (ts *TaskScheduler) extendTaskLease(
+	w http.ResponseWriter,
+	r *http.Request,
+	extend func(string, time.Time) (taskLease, error),
+) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed,
+			models.ErrCodeMethodNotAllowed, "Only POST requests are allowed")
+		return
+	}
+	if ts.Leases == nil {
+		writeError(w, r, http.StatusNotFound, models.ErrCodeLeasesDisabled,
+			"Task leases are not enabled")
+		return
+	}
+	leaseId := r.URL.Query().Get("leaseId")
+	lease, err := extend(leaseId, time.Now())
+	if err == ErrLeaseNotFound {
+		msg := fmt.Sprintf("Lease %s does not exist or has expired", leaseId)
+		writeError(w, r, http.StatusNotFound, models.ErrCodeLeaseNotFound, msg)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonErr := json.NewEncoder(w).Encode(models.TaskLease{
+		LeaseId:   lease.LeaseId,
+		ExpiresTs: timeutils.ToString(lease.ExpiresAt),
+	})
+	if jsonErr != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal,
+			jsonErr.Error())
+	}
+}
+
+// HTTP handler for rendering DAG graph in DOT or Mermaid format. Expected
+// query parameters are dagId, format (dot - the default - or mermaid) and
+// optional execTs. When execTs is given, then nodes are coloured based on
+// task statuses of that DAG run read from dagruntasks table.
+func (s *Scheduler) dagGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	dagId := r.URL.Query().Get("dagId")
+	if !s.authorize(w, r, ActionViewDag, dagId) {
+		return
+	}
+	d, dagErr := dag.Get(dag.Id(dagId))
+	if dagErr != nil {
+		http.Error(w, dagErr.Error(), http.StatusNotFound)
+		return
+	}
+
+	var statuses map[string]dag.TaskStatus
+	if execTsStr := r.URL.Query().Get("execTs"); execTsStr != "" {
+		execTs, tErr := timeutils.FromString(execTsStr)
+		if tErr != nil {
+			msg := fmt.Sprintf("Given execTs timestamp in incorrect format: %s",
+				tErr.Error())
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		var sErr error
+		statuses, sErr = s.dagRunTaskStatuses(r.Context(), dagId, execTs)
+		if sErr != nil {
+			msg := fmt.Sprintf("Cannot read dag run task statuses: %s",
+				sErr.Error())
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write([]byte(d.ToDot(statuses)))
+	case "mermaid":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(d.ToMermaid(statuses)))
+	default:
+		msg := fmt.Sprintf("Unsupported graph format: %s", format)
+		http.Error(w, msg, http.StatusBadRequest)
+	}
+}
+
+// Reads statuses of all tasks within given DAG run from the database.
+func (s *Scheduler) dagRunTaskStatuses(
+	ctx context.Context, dagId string, execTs time.Time,
+) (map[string]dag.TaskStatus, error) {
+	drts, dbErr := s.dbClient.ReadDagRunTasks(
+		ctx, dagId, timeutils.ToString(execTs),
+	)
+	if dbErr != nil {
+		return nil, dbErr
+	}
+	statuses := make(map[string]dag.TaskStatus, len(drts))
+	for _, drt := range drts {
+		status, sErr := dag.ParseTaskStatus(drt.Status)
+		if sErr != nil {
+			slog.Warn("Cannot parse dag run task status", "dagruntask", drt,
+				"err", sErr)
+			continue
+		}
+		statuses[drt.TaskId] = status
+	}
+	return statuses, nil
+}
+
+// HTTP handler for DAG graph analysis. Expected query parameters are dagId and
+// optional runs - number of latest DAG runs which are taken into account for
+// estimating task durations (default 10).
+func (s *Scheduler) dagAnalysis(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	dagId := r.URL.Query().Get("dagId")
+	if !s.authorize(w, r, ActionViewDag, dagId) {
+		return
+	}
+	d, dagErr := dag.Get(dag.Id(dagId))
+	if dagErr != nil {
+		http.Error(w, dagErr.Error(), http.StatusNotFound)
+		return
+	}
+	runs := 10
+	if runsStr := r.URL.Query().Get("runs"); runsStr != "" {
+		var convErr error
+		runs, convErr = strconv.Atoi(runsStr)
+		if convErr != nil || runs <= 0 {
+			msg := fmt.Sprintf("Parameter runs should be positive integer, got: %s",
+				runsStr)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	durations, foundRuns, dbErr := s.dbClient.ReadDagRunTaskDurations(
+		r.Context(), dagId, runs,
+	)
+	if dbErr != nil {
+		msg := fmt.Sprintf("Cannot read dag run task durations: %s",
+			dbErr.Error())
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
-	slog.Debug("Updated task status", "dagruntask", drt, "status", status,
-		"duration", time.Since(start))
+	criticalPath, estimation := d.CriticalPath(durations)
+	durationsMs := make(map[string]int64, len(durations))
+	for taskId, duration := range durations {
+		durationsMs[taskId] = duration.Milliseconds()
+	}
+	analysis := models.DagAnalysis{
+		DagId:                dagId,
+		Levels:               d.TopologicalLevels(),
+		LongestPath:          d.LongestPath(),
+		CriticalPath:         criticalPath,
+		EstimatedDurationMs:  estimation.Milliseconds(),
+		TaskDurationsMs:      durationsMs,
+		HistoricalDagRunsNum: foundRuns,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonErr := json.NewEncoder(w).Encode(analysis)
+	if jsonErr != nil {
+		http.Error(w, jsonErr.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Pauses DAG given in dagId query parameter. New DAG runs of paused DAG are
+// not scheduled. DAG runs which were already scheduled are not affected.
+func (s *Scheduler) pauseDag(w http.ResponseWriter, r *http.Request) {
+	s.setDagPaused(w, r, ActionPauseDag, true)
+}
+
+// Unpauses DAG given in dagId query parameter.
+func (s *Scheduler) unpauseDag(w http.ResponseWriter, r *http.Request) {
+	s.setDagPaused(w, r, ActionUnpauseDag, false)
+}
+
+func (s *Scheduler) setDagPaused(
+	w http.ResponseWriter, r *http.Request, action string, paused bool,
+) {
+	if r.Method != "POST" {
+		http.Error(w, "Only POST requests are allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	dagId := r.URL.Query().Get("dagId")
+	if dagId == "" {
+		http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+		return
+	}
+	if !s.authorize(w, r, action, dagId) {
+		return
+	}
+	err := s.dbClient.SetDagPaused(r.Context(), dagId, paused)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("There is no DAG %s", dagId)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Cannot update DAG pause state: %s", err.Error())
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	slog.Info("DAG pause state updated", "dagId", dagId, "paused", paused)
+	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+func TestPopTasksBatch(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	for _, taskId := range []string{"t1", "t2", "t3"} {
+		drt := DagRunTask{DagId: "mock_dag_batch", AtTime: execTs,
+			TaskId: taskId}
+		if err := ts.TaskQueue.Put(drt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	popMany := func(query string) (int, []models.TaskToExec) {
+		rec := httptest.NewRecorder()
+		ts.popTasks(rec, httptest.NewRequest("GET", "/dag/task/popmany"+query,
+			nil))
+		var ttes []models.TaskToExec
+		if rec.Code == http.StatusOK {
+			if jErr := json.Unmarshal(rec.Body.Bytes(), &ttes); jErr != nil {
+				t.Fatal(jErr)
+			}
+		}
+		return rec.Code, ttes
+	}
+
+	if code, ttes := popMany("?max=2"); code != http.StatusOK ||
+		len(ttes) != 2 || ttes[0].TaskId != "t1" || ttes[1].TaskId != "t2" {
+		t.Errorf("Expected t1 and t2, got %d %+v", code, ttes)
+	}
+	if code, ttes := popMany("?max=5"); code != http.StatusOK ||
+		len(ttes) != 1 || ttes[0].TaskId != "t3" {
+		t.Errorf("Expected only t3, got %d %+v", code, ttes)
+	}
+	if code, _ := popMany("?max=5"); code != http.StatusNoContent {
+		t.Errorf("Expected 204 on empty queue, got %d", code)
+	}
+	if code, _ := popMany(""); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without max parameter, got %d", code)
+	}
+}
+
+func TestPopTasksBatchWithoutConfiguredLimit(t *testing.T) {
+	ts := defaultTaskScheduler(t, 200)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	ts.Config.MaxTaskPopBatch = 0
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	tasks := DefaultTaskSchedulerConfig.MaxTaskPopBatch + 10
+	for i := 0; i < tasks; i++ {
+		drt := DagRunTask{DagId: "mock_dag_batch", AtTime: execTs,
+			TaskId: fmt.Sprintf("t%d", i)}
+		if err := ts.TaskQueue.Put(drt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drts, err := ts.popTasksForLabels(context.Background(), nil, 0, tasks)
+	if err != nil {
+		t.Fatalf("Cannot pop tasks: %s", err.Error())
+	}
+	if len(drts) != DefaultTaskSchedulerConfig.MaxTaskPopBatch {
+		t.Errorf("Expected %d popped tasks, got %d",
+			DefaultTaskSchedulerConfig.MaxTaskPopBatch, len(drts))
+	}
+}
+
+func TestUpdateTaskStatusesBatch(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drt1 := DagRunTask{DagId: "mock_dag_batch", AtTime: execTs, TaskId: "t1"}
+	drt2 := DagRunTask{DagId: "mock_dag_batch", AtTime: execTs, TaskId: "t2"}
+	update := func(drt DagRunTask, status string) models.DagRunTaskStatus {
+		return models.DagRunTaskStatus{
+			DagId:  string(drt.DagId),
+			ExecTs: timeutils.ToString(drt.AtTime),
+			TaskId: drt.TaskId,
+			Status: status,
+		}
+	}
+	post := func(updates []models.DagRunTaskStatus) *httptest.ResponseRecorder {
+		body, jErr := json.Marshal(updates)
+		if jErr != nil {
+			t.Fatal(jErr)
+		}
+		rec := httptest.NewRecorder()
+		ts.updateTaskStatuses(rec, httptest.NewRequest("POST",
+			"/dag/task/updatemany", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := post([]models.DagRunTaskStatus{
+		update(drt1, dag.TaskRunning.String()),
+		update(drt2, dag.TaskRunning.String()),
+		update(drt1, dag.TaskSuccess.String()),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var failed []models.DagRunTaskStatusError
+	if jErr := json.Unmarshal(rec.Body.Bytes(), &failed); jErr != nil {
+		t.Fatal(jErr)
+	}
+	if len(failed) != 0 {
+		t.Errorf("Expected no failed updates, got %+v", failed)
+	}
+	checkDagRunTaskStatus(t, ts, drt1, dag.TaskSuccess)
+	checkDagRunTaskStatus(t, ts, drt2, dag.TaskRunning)
+
+	// Incorrect update rejects the whole batch
+	rec = post([]models.DagRunTaskStatus{
+		update(drt2, dag.TaskSuccess.String()),
+		update(drt1, "NOT_A_STATUS"),
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for incorrect status, got %d", rec.Code)
+	}
+	checkDagRunTaskStatus(t, ts, drt2, dag.TaskRunning)
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,6 +26,16 @@ type DagRunTaskState struct {
 	StatusUpdateTs time.Time
 }
 
+// Returns effective priority of given dag run task. When DAG cannot be found
+// in the registry, then dag.DefaultPriorityWeight is returned.
+func dagRunTaskPriority(drt DagRunTask) int {
+	d, err := dag.Get(drt.DagId)
+	if err != nil {
+		return dag.DefaultPriorityWeight
+	}
+	return d.TaskPriority(drt.TaskId)
+}
+
 // TaskScheduler is responsible for scheduling tasks for a single DagRun. When
 // new DagRun is scheduled (by DagRunWatcher) it should appear on DagRunQueue,
 // then TaskScheduler pick it up and start scheduling DAG tasks for that DagRun
@@ -36,7 +47,23 @@ type TaskScheduler struct {
 	DagRunQueue ds.Queue[DagRun]
 	TaskQueue   ds.Queue[DagRunTask]
 	TaskCache   ds.Cache[DagRunTask, DagRunTaskState]
+	Pools       *Pools
+	Leases      *TaskLeases
 	Config      TaskSchedulerConfig
+
+	scheduledRuns  scheduledDagRuns
+	cancelledTasks taskCancellations
+	localTasks     localTaskCancels
+	taskInputs     taskInputs
+}
+
+// Returns Config.DatabaseContextTimeout or the default timeout, when it's not
+// positive.
+func (ts *TaskScheduler) databaseContextTimeout() time.Duration {
+	if ts.Config.DatabaseContextTimeout <= 0 {
+		return DefaultTaskSchedulerConfig.DatabaseContextTimeout
+	}
+	return ts.Config.DatabaseContextTimeout
 }
 
 type taskSchedulerError struct {
@@ -47,10 +74,16 @@ type taskSchedulerError struct {
 
 // Start starts TaskScheduler main loop. It check if there are new DagRuns on
 // the DagRunQueue and if so, it spins up DAG tasks scheduling for that DagRun
-// in a separate goroutine. If DagRunQueue is empty at the moment, then main
-// loop waits Config.HeartbeatMs milliseconds before the next try.
+// in a separate goroutine. Number of concurrently running DAG runs is limited
+// by Config.MaxConcurrentDagRuns and per DAG by dag.Attr.MaxActiveRuns. DAG
+// runs exceeding those limits wait (in SCHEDULED state) and are started in
+// exec time order, once other DAG runs are finished. If there's nothing to do
+// at the moment, then main loop waits Config.HeartbeatMs milliseconds before
+// the next try.
 func (ts *TaskScheduler) Start() {
 	taskSchedulerErrors := make(chan taskSchedulerError, 100)
+	finishedDagRuns := make(chan DagRun, 100)
+	dagruns := newActiveDagRuns(ts.Config.MaxConcurrentDagRuns)
 	for {
 		select {
 		case err := <-taskSchedulerErrors:
@@ -59,36 +92,89 @@ func (ts *TaskScheduler) Start() {
 				string(err.DagId), "execTs", err.ExecTs, "err", err.Err)
 		default:
 		}
-		if ts.DagRunQueue.Size() == 0 {
-			// DagRunQueue is empty, we wait for a bit and then we'll try again
+		ts.collectFinishedDagRuns(finishedDagRuns, dagruns)
+		ts.popDagRuns(dagruns)
+
+		toStart := dagruns.next(dagMaxActiveRuns)
+		for _, dagrun := range toStart {
+			// TODO(dskrzypiec): Add timeout for overall DAG run timeout. For
+			// now the context is done only when the DAG run is cancelled (see
+			// CancelDagRun). Start scheduling new DAG run in a separate
+			// goroutine.
+			ctx := ts.scheduledRuns.start(dagrun)
+			go func(ctx context.Context, dr DagRun) {
+				ts.scheduleDagTasks(ctx, dr, taskSchedulerErrors)
+				ts.scheduledRuns.finish(dr)
+				finishedDagRuns <- dr
+			}(ctx, dagrun)
+		}
+		if len(toStart) == 0 {
+			// Nothing new to start, we wait for a bit and then we'll try again
 			time.Sleep(time.Duration(ts.Config.HeartbeatMs) * time.Millisecond)
-			continue
 		}
+	}
+}
+
+// Pops DAG runs from DagRunQueue and adds them to pending DAG runs in exec
+// time order. When Config.MaxPendingDagRuns DAG runs of a DAG are already
+// pending, its further DAG runs are put back onto the DagRunQueue, so a single
+// throttled DAG doesn't block DAG runs of other DAGs. If the queue has been
+// filled in the meantime, DAG run is kept pending, to not block the main loop.
+func (ts *TaskScheduler) popDagRuns(dagruns *activeDagRuns) {
+	popped := make([]DagRun, 0, ts.DagRunQueue.Size())
+	for n := ts.DagRunQueue.Size(); n > 0; n-- {
 		dagrun, err := ts.DagRunQueue.Pop()
 		if err == ds.ErrQueueIsEmpty {
-			continue
+			break
 		}
 		if err != nil {
 			// TODO: should we do anything else? Probably not, because item
 			// should be probably still on the queue
 			slog.Error("Error while getting dag run from the queue", "err", err)
-			continue
+			break
+		}
+		popped = append(popped, dagrun)
+	}
+	sort.SliceStable(popped, func(i, j int) bool {
+		return popped[i].AtTime.Before(popped[j].AtTime)
+	})
+	maxPending := ts.Config.MaxPendingDagRuns
+	for _, dagrun := range popped {
+		if maxPending > 0 && dagruns.pendingNumOf(dagrun.DagId) >= maxPending {
+			if ts.DagRunQueue.Put(dagrun) == nil {
+				continue
+			}
+		}
+		dagruns.add(dagrun)
+	}
+}
+
+// Marks DAG runs which has been already finished as done, without blocking.
+func (ts *TaskScheduler) collectFinishedDagRuns(
+	finished <-chan DagRun, dagruns *activeDagRuns,
+) {
+	for {
+		select {
+		case dagrun := <-finished:
+			dagruns.done(dagrun)
+		default:
+			return
 		}
-		// TODO(dskrzypiec): Think about the context. At least we need to add
-		// timeout for overall DAG run timeout. Start scheduling new DAG run in
-		// a separate goroutine.
-		go ts.scheduleDagTasks(context.TODO(), dagrun, taskSchedulerErrors)
 	}
 }
 
 // UpsertTaskStatus inserts or updates given DAG run task status. That includes
-// caches, queues, database and every place that needs to be included regarding
-// task status update.
+// caches, queues, pools, leases, database and every place that needs to be included
+// regarding task status update.
 func (ts *TaskScheduler) UpsertTaskStatus(
 	ctx context.Context, drt DagRunTask, status dag.TaskStatus,
 ) error {
 	slog.Info("Start upserting dag run task status", "dagruntask", drt,
 		"status", status.String())
+	if status.IsTerminal() {
+		ts.Pools.release(drt)
+		ts.Leases.release(drt)
+	}
 
 	// Insert/update info in the cache
 	drts := DagRunTaskState{Status: status, StatusUpdateTs: time.Now()}
@@ -131,6 +217,23 @@ func (ts *TaskScheduler) UpsertTaskStatus(
 	return nil
 }
 
+// Updates dag run task status reported by an executor. Reports concerning
+// tasks which are already in a terminal state are ignored, because those tasks
+// might have been marked manually while they were still running.
+func (ts *TaskScheduler) upsertReportedTaskStatus(
+	ctx context.Context, drt DagRunTask, status dag.TaskStatus,
+) error {
+	dagrun := DagRun{DagId: drt.DagId, AtTime: drt.AtTime}
+	current, err := ts.getDagRunTaskStatus(dagrun, drt.TaskId)
+	if err == nil && current.IsTerminal() {
+		slog.Warn("Dag run task is already finished. Ignoring reported status",
+			"dagruntask", drt, "currentStatus", current.String(), "status",
+			status.String())
+		return nil
+	}
+	return ts.UpsertTaskStatus(ctx, drt, status)
+}
+
 // Function scheduleDagTasks is responsible for scheduling tasks of single DAG
 // run. Each call to this function by taskScheduler is fire up in separate
 // goroutine.
@@ -144,6 +247,18 @@ func (ts *TaskScheduler) scheduleDagTasks(
 		dagrun.AtTime)
 	execTs := timeutils.ToString(dagrun.AtTime)
 
+	dbDagRun, rErr := ts.DbClient.ReadDagRun(ctx, dagId, execTs)
+	if rErr == nil && dbDagRun.Status == dag.RunCancelled.String() {
+		slog.Info("Dag run has been cancelled. Tasks will not be scheduled",
+			"dagrun", dagrun)
+		return
+	}
+	if rErr == nil {
+		// Parameters are read from the database only once per DAG run
+		ts.taskInputs.start(dagrun, dbDagRun.Params)
+		defer ts.taskInputs.finish(dagrun)
+	}
+
 	// Update dagrun state to running
 	stateUpdateErr := ts.DbClient.UpdateDagRunStatusByExecTs(
 		ctx, dagId, execTs, dag.RunRunning.String(),
@@ -180,11 +295,17 @@ func (ts *TaskScheduler) scheduleDagTasks(
 		return
 	}
 
+	ts.seedPrevExecTs(ctx, d, dagrun)
+
 	sharedState := newDagRunSharedState(d.TaskParents())
+	sharedState.FinishedTasks = ts.finishedTasks(ctx, dagrun)
 	var wg sync.WaitGroup
 	wg.Add(1)
 	ts.walkAndSchedule(ctx, dagrun, d.Root, sharedState, &wg)
 	wg.Wait()
+	if schedulingCancelled(ctx, dagrun) {
+		return
+	}
 
 	// Check whenever any task has failed and if so, then mark downstream tasks
 	// with status UPSTREAM_FAILED.
@@ -193,6 +314,9 @@ func (ts *TaskScheduler) scheduleDagTasks(
 	// At this point all tasks has been scheduled, but not necessarily done.
 	tasks := d.Flatten()
 	for !ts.allTasksAreDone(dagrun, tasks, sharedState) {
+		if schedulingCancelled(ctx, dagrun) {
+			return
+		}
 		time.Sleep(time.Duration(ts.Config.HeartbeatMs) * time.Millisecond)
 	}
 
@@ -231,6 +355,12 @@ type dagRunSharedState struct {
 	// Map of taskId -> []{ parent task ids } for the DAG.
 	TasksParents *ds.AsyncMap[string, []string]
 
+	// Tasks which were already finished before scheduling of the dag run has
+	// started. That happens when the dag run is re-entered after clearing
+	// some of its tasks (see TaskScheduler.ClearTasks). Those tasks are not
+	// scheduled again. It's read-only once scheduling has started.
+	FinishedTasks map[string]dag.TaskStatus
+
 	// Overall dag run status
 	sync.Mutex
 	DagRunStatus *dag.RunStatus
@@ -242,6 +372,7 @@ func newDagRunSharedState(taskParents map[string][]string) *dagRunSharedState {
 		AlreadyMarkedTasks:              ds.NewAsyncMap[DagRunTask, any](),
 		AlreadyMarkedForUpstreamFailure: ds.NewAsyncMap[DagRunTask, any](),
 		TasksParents:                    ds.NewAsyncMapFromMap(taskParents),
+		FinishedTasks:                   map[string]dag.TaskStatus{},
 		DagRunStatus:                    &dagrunStatus,
 	}
 }
@@ -261,16 +392,28 @@ func (ts *TaskScheduler) walkAndSchedule(
 	taskId := node.Task.Id()
 	slog.Info("Start walkAndSchedule", "dagrun", dagrun, "taskId", taskId)
 
-	for {
+	status, finished := sharedState.FinishedTasks[taskId]
+	if finished {
+		slog.Info("Task is already finished in this dag run. Will not be "+
+			"scheduled again", "dagrun", dagrun, "taskId", taskId, "status",
+			status.String())
+	}
+	for !finished {
 		select {
 		case <-ctx.Done():
-			// TODO: What to do with errors in here? Probably we should have a
-			// queue for retries on DagRunTasks level.
-			slog.Error("Context canceled while walkAndSchedule", "dagrun",
+			slog.Warn("Context is done. Task will not be scheduled", "dagrun",
 				dagrun, "taskId", node.Task.Id(), "err", ctx.Err())
+			return
 		default:
 		}
 
+		drt := DagRunTask{dagrun.DagId, dagrun.AtTime, taskId}
+		if ts.taskIsFinished(drt) {
+			// Task has been marked manually (see TaskScheduler.MarkTaskStatus)
+			slog.Info("Task is already finished. Will not be scheduled",
+				"dagrun", dagrun, "taskId", taskId)
+			break
+		}
 		canSchedule, parentsStatus := ts.checkIfCanBeScheduled(
 			dagrun, taskId, sharedState.TasksParents,
 		)
@@ -280,7 +423,7 @@ func (ts *TaskScheduler) walkAndSchedule(
 			return
 		}
 		if canSchedule {
-			ts.scheduleSingleTask(dagrun, taskId)
+			ts.scheduleSingleTask(ctx, dagrun, taskId)
 			break
 		}
 		time.Sleep(checkDelay)
@@ -298,8 +441,12 @@ func (ts *TaskScheduler) walkAndSchedule(
 }
 
 // Schedules single task. That means putting metadata on the queue, updating
-// cache, etc... TODO
-func (ts *TaskScheduler) scheduleSingleTask(dagrun DagRun, taskId string) {
+// cache, etc... When the task belongs to a pool, then it waits for a free slot
+// in that pool before the task is put on the queue, unless given context is
+// done in the meantime. TODO
+func (ts *TaskScheduler) scheduleSingleTask(
+	ctx context.Context, dagrun DagRun, taskId string,
+) {
 	slog.Info("Start scheduling new dag run task", "dagrun", dagrun, "taskId",
 		taskId)
 	drt := DagRunTask{
@@ -307,21 +454,45 @@ func (ts *TaskScheduler) scheduleSingleTask(dagrun DagRun, taskId string) {
 		AtTime: dagrun.AtTime,
 		TaskId: taskId,
 	}
-	ctx := context.TODO()
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second) // TODO: config
+	pool := taskPool(dagrun.DagId, taskId)
+	checkDelay := time.Duration(ts.Config.CheckDependenciesStatusMs) * time.Millisecond
+	for !ts.Pools.tryAcquire(drt, pool) {
+		if ts.taskIsFinished(drt) {
+			slog.Info("Task has been finished while waiting for pool slot",
+				"dagruntask", drt, "pool", pool)
+			return
+		}
+		if ctx.Err() != nil {
+			slog.Warn("Context is done while waiting for pool slot",
+				"dagruntask", drt, "pool", pool, "err", ctx.Err())
+			return
+		}
+		time.Sleep(checkDelay)
+	}
+
+	// Once pool slot is acquired, the task is scheduled even if scheduling is
+	// cancelled in the meantime. This way CancelDagRun finds it SCHEDULED and
+	// releases the slot.
+	ctx, cancel := context.WithTimeout(context.TODO(),
+		10*time.Second) // TODO: config
 	defer cancel()
-	ds.PutContext(ctx, ts.TaskQueue, drt)
+	// Status has to be updated before the task is put on the queue, because
+	// executor might pick it up and report next status in the meantime.
 	usErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskScheduled)
 	if usErr != nil {
 		slog.Error("Cannot update dag run task status", "dagruntask", drt,
 			"status", dag.TaskScheduled.String(), "err", usErr)
 		// Consider putting those on the TaskToRetryQueue
 	}
+	if !ts.renderTaskTemplates(ctx, drt) {
+		return
+	}
+	ds.PutContext(ctx, ts.TaskQueue, drt)
 }
 
 // CheckFailsAndMarkDownstream performs DFS and if it finds a task in the tree
-// which is in FAILED state it marks the dag run as FAILED and also marks all
-// tasks in this sub-tree with status UPSTREAM_FAILED.
+// which is in FAILED (or CANCELLED) state it marks the dag run as FAILED and
+// also marks all tasks in this sub-tree with status UPSTREAM_FAILED.
 func (ts *TaskScheduler) checkFailsAndMarkDownstream(
 	ctx context.Context,
 	dagrun DagRun,
@@ -339,7 +510,7 @@ func (ts *TaskScheduler) checkFailsAndMarkDownstream(
 			" unexpected. This dag run task is treated as not failed", "dagrun",
 			dagrun, "taskId", node.Task.Id())
 	}
-	if status != dag.TaskFailed {
+	if status != dag.TaskFailed && status != dag.TaskCancelled {
 		// Parent is not FAILED, we should continue DFS.
 		for _, child := range node.Children {
 			ts.checkFailsAndMarkDownstream(ctx, dagrun, child, sharedState)
@@ -395,7 +566,7 @@ func (ts *TaskScheduler) checkIfCanBeScheduled(
 			TaskId: parentTaskId,
 		}
 		isParentTaskDone, status := ts.checkIfParentTaskIsDone(dagrun, key)
-		if status == dag.TaskFailed {
+		if status == dag.TaskFailed || status == dag.TaskCancelled {
 			return false, dag.TaskFailed
 		}
 		if !isParentTaskDone {
@@ -450,10 +621,12 @@ func (ts *TaskScheduler) checkIfParentTaskIsDone(
 }
 
 // Checks whenever all tasks within the dag run are in terminal states and thus
-// dag run is finished.
+// dag run is finished. In that case overall dag run status is set based on
+// final task statuses, which might have been changed manually in the meantime.
 func (ts *TaskScheduler) allTasksAreDone(
 	dagrun DagRun, tasks []dag.Task, sharedState *dagRunSharedState,
 ) bool {
+	anyFailed := false
 	for _, task := range tasks {
 		status, err := ts.getDagRunTaskStatus(dagrun, task.Id())
 		if err != nil {
@@ -462,22 +635,69 @@ func (ts *TaskScheduler) allTasksAreDone(
 		if !status.IsTerminal() {
 			return false
 		}
-		if status == dag.TaskFailed {
+		if status == dag.TaskFailed || status == dag.TaskUpstreamFailed ||
+			status == dag.TaskCancelled {
 			// Almost all cases should be covered by
 			// checkFailsAndMarkDownstream but in case when all tasks are
 			// scheduled, then checkFailsAndMarkDownstream might be run before
 			// all task (especially leafs) has been done. Those cases are
 			// cought only in here. There is no need for marking downstream
 			// tasks, because there is no downstream tasks. This can only
-			// happen for leafs of the tree.
-			sharedState.Lock()
-			*sharedState.DagRunStatus = dag.RunFailed
-			sharedState.Unlock()
+			// happen for leafs of the tree. Tasks in UPSTREAM_FAILED or
+			// CANCELLED status might be left from before clearing only their
+			// upstream tasks.
+			anyFailed = true
 		}
 	}
+	sharedState.Lock()
+	defer sharedState.Unlock()
+	if anyFailed {
+		*sharedState.DagRunStatus = dag.RunFailed
+	} else {
+		*sharedState.DagRunStatus = dag.RunSuccess
+	}
 	return true
 }
 
+// Checks if given dag run task is already in a terminal state, based only on
+// TaskCache.
+func (ts *TaskScheduler) taskIsFinished(drt DagRunTask) bool {
+	drts, exists := ts.TaskCache.Get(drt)
+	return exists && drts.Status.IsTerminal()
+}
+
+// Reads tasks of given dag run which are already in terminal states and puts
+// their statuses into TaskCache. For new dag runs the result is empty. In case
+// of database errors, empty map is returned, so all tasks are scheduled.
+func (ts *TaskScheduler) finishedTasks(
+	ctx context.Context, dagrun DagRun,
+) map[string]dag.TaskStatus {
+	finished := map[string]dag.TaskStatus{}
+	drts, dbErr := ts.DbClient.ReadDagRunTasks(ctx, string(dagrun.DagId),
+		timeutils.ToString(dagrun.AtTime))
+	if dbErr != nil {
+		slog.Error("Cannot read dag run tasks. All tasks will be scheduled",
+			"dagrun", dagrun, "err", dbErr)
+		return finished
+	}
+	for _, drt := range drts {
+		status, sErr := dag.ParseTaskStatus(drt.Status)
+		if sErr != nil || !status.IsTerminal() {
+			continue
+		}
+		finished[drt.TaskId] = status
+		ts.TaskCache.Put(
+			DagRunTask{DagId: dagrun.DagId, AtTime: dagrun.AtTime,
+				TaskId: drt.TaskId},
+			DagRunTaskState{
+				Status:         status,
+				StatusUpdateTs: timeutils.FromStringMust(drt.StatusUpdateTs),
+			},
+		)
+	}
+	return finished
+}
+
 // This methods gets dag run task status. It tries to check TaskCache first.
 // When given dag run task is not there it tries to pull it from database. If
 // there is also no entry in the database, then sql.ErrNoRows is returned.
@@ -538,6 +758,18 @@ func (ts *TaskScheduler) cleanTaskCache(dagrun DagRun, tasks []dag.Task) {
 	}
 }
 
+// Checks if scheduling of given dag run has been cancelled. In that case dag run
+// status is set by CancelDagRun, so the scheduling should be stopped without
+// any further updates.
+func schedulingCancelled(ctx context.Context, dagrun DagRun) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	slog.Warn("Scheduling of dag run has been cancelled", "dagrun", dagrun,
+		"err", ctx.Err())
+	return true
+}
+
 func sendTaskSchedulerErr(
 	errChan chan taskSchedulerError,
 	dagrun DagRun,
@@ -60,7 +60,7 @@ func TestScheduleSingleTaskSimple(t *testing.T) {
 	dagrun := DagRun{DagId: d.Id, AtTime: schedule.Next(startTs)}
 	taskId := "start"
 
-	ts.scheduleSingleTask(dagrun, taskId)
+	ts.scheduleSingleTask(context.Background(), dagrun, taskId)
 
 	// Task should be on the TaskQeueu
 	expectedDrt := DagRunTask{
@@ -771,6 +771,42 @@ func TestGetDagRunTaskStatusNoCacheNoDatabase(t *testing.T) {
 	}
 }
 
+func TestDefaultQueuesTaskPriorities(t *testing.T) {
+	backfill := dag.New("mock_dag_prio_backfill").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).
+		Done()
+	urgent := dag.New("mock_dag_prio_urgent").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).
+		AddAttributes(dag.Attr{PriorityWeight: 10}).
+		Done()
+	for _, d := range []dag.Dag{backfill, urgent} {
+		if addErr := dag.Add(d); addErr != nil {
+			t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+		}
+	}
+	queues := DefaultQueues(DefaultConfig)
+	execTs := time.Date(2023, time.October, 5, 12, 0, 0, 0, time.UTC)
+	drts := []DagRunTask{
+		{DagId: backfill.Id, AtTime: execTs, TaskId: "task"},
+		{DagId: backfill.Id, AtTime: execTs.Add(time.Hour), TaskId: "task"},
+		{DagId: urgent.Id, AtTime: execTs, TaskId: "task"},
+	}
+	for _, drt := range drts {
+		if putErr := queues.DagRunTasks.Put(drt); putErr != nil {
+			t.Fatalf("Cannot put task on the queue: %s", putErr.Error())
+		}
+	}
+	for _, expected := range []DagRunTask{drts[2], drts[0], drts[1]} {
+		drt, popErr := queues.DagRunTasks.Pop()
+		if popErr != nil {
+			t.Fatalf("Cannot pop task from the queue: %s", popErr.Error())
+		}
+		if drt != expected {
+			t.Errorf("Expected %v, got %v", expected, drt)
+		}
+	}
+}
+
 // Marks all tasks popped from the queue as success.
 func markSuccessAllTasks(
 	ctx context.Context,
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// Renders templates of given dag run task (see dag.TemplatedTask) and stores
+// them in the database, so they can be inspected and sent to executors.
+// Returns false, when templates cannot be rendered or stored - in that case
+// the task is marked as FAILED and it shouldn't be put onto the task queue.
+func (ts *TaskScheduler) renderTaskTemplates(
+	ctx context.Context, drt DagRunTask,
+) bool {
+	d, dagErr := dag.Get(drt.DagId)
+	if dagErr != nil {
+		// Executor is going to fail the task anyway
+		return true
+	}
+	task, tErr := d.GetTask(drt.TaskId)
+	if tErr != nil || len(dag.TaskTemplates(task)) == 0 {
+		return true
+	}
+	stored, pErr := dag.ParseParams(ts.dagRunParams(ctx, drt))
+	if pErr != nil {
+		slog.Error("Cannot parse dag run parameters. Using defaults",
+			"dagruntask", drt, "err", pErr)
+	}
+	rendered, rErr := d.RenderTemplates(drt.TaskId, drt.AtTime,
+		d.RunParams(stored))
+	if rErr != nil {
+		slog.Error("Cannot render task templates. Task is marked as FAILED",
+			"dagruntask", drt, "err", rErr)
+		ts.failTaskPreparation(ctx, drt)
+		return false
+	}
+	renderedJson, jErr := json.Marshal(rendered)
+	if jErr != nil {
+		slog.Error("Cannot serialize rendered task templates. Task is marked "+
+			"as FAILED", "dagruntask", drt, "err", jErr)
+		ts.failTaskPreparation(ctx, drt)
+		return false
+	}
+	renderedStr := string(renderedJson)
+	sErr := ts.DbClient.SetDagRunTaskRendered(ctx, string(drt.DagId),
+		timeutils.ToString(drt.AtTime), drt.TaskId, &renderedStr)
+	if sErr != nil {
+		slog.Error("Cannot store rendered task templates. Task is marked as "+
+			"FAILED", "dagruntask", drt, "err", sErr)
+		ts.failTaskPreparation(ctx, drt)
+		return false
+	}
+	ts.taskInputs.setRendered(drt, renderedStr)
+	slog.Debug("Rendered task templates", "dagruntask", drt, "rendered",
+		rendered)
+	return true
+}
+
+// Determines the previous schedule tick of given DAG run, starting from the
+// previous stored DAG run, so rendering templates of its tasks doesn't iterate
+// schedules which don't implement dag.PrevSchedule since their StartTime. The
+// tick is cached by the DAG (see dag.Dag.PrevExecTsFrom).
+func (ts *TaskScheduler) seedPrevExecTs(
+	ctx context.Context, d dag.Dag, dagrun DagRun,
+) {
+	if d.Schedule == nil || !d.HasTemplates() {
+		return
+	}
+	if _, ok := (*d.Schedule).(dag.PrevSchedule); ok {
+		return
+	}
+	prevExecTs, rErr := ts.DbClient.ReadPrevDagRunExecTs(ctx,
+		string(dagrun.DagId), timeutils.ToString(dagrun.AtTime))
+	if rErr != nil {
+		if !errors.Is(rErr, sql.ErrNoRows) {
+			slog.Warn("Cannot read previous dag run", "dagrun", dagrun, "err",
+				rErr)
+		}
+		return
+	}
+	from, pErr := timeutils.FromString(prevExecTs)
+	if pErr != nil {
+		slog.Warn("Cannot parse previous dag run execution timestamp",
+			"dagrun", dagrun, "prevExecTs", prevExecTs, "err", pErr)
+		return
+	}
+	d.PrevExecTsFrom(dagrun.AtTime, from)
+}
+
+func (ts *TaskScheduler) failTaskPreparation(
+	ctx context.Context, drt DagRunTask,
+) {
+	if uErr := ts.UpsertTaskStatus(ctx, drt, dag.TaskFailed); uErr != nil {
+		slog.Error("Cannot update dag run task status", "dagruntask", drt,
+			"status", dag.TaskFailed.String(), "err", uErr)
+	}
+}
+
+// Reads rendered templates of given dag run task, serialized as JSON object.
+// Templates rendered for DAG run which is being scheduled are taken from
+// memory, the database is read only otherwise. Empty string is returned for
+// tasks without templates or when rendered templates cannot be read.
+func (ts *TaskScheduler) renderedTemplates(
+	ctx context.Context, drt DagRunTask,
+) string {
+	d, dagErr := dag.Get(drt.DagId)
+	if dagErr != nil {
+		return ""
+	}
+	task, tErr := d.GetTask(drt.TaskId)
+	if tErr != nil || len(dag.TaskTemplates(task)) == 0 {
+		return ""
+	}
+	if rendered, cached := ts.taskInputs.rendered(drt); cached {
+		return rendered
+	}
+	drtDb, rErr := ts.DbClient.ReadDagRunTask(ctx, string(drt.DagId),
+		timeutils.ToString(drt.AtTime), drt.TaskId)
+	if rErr != nil {
+		slog.Error("Cannot read rendered task templates", "dagruntask", drt,
+			"err", rErr)
+		return ""
+	}
+	if drtDb.Rendered == nil {
+		return ""
+	}
+	return *drtDb.Rendered
+}
+
+// Inputs of tasks of DAG runs which are being scheduled - DAG run parameters
+// and rendered task templates. They are kept in memory, so popping tasks
+// doesn't need to read them from the database. Inputs are registered, when DAG
+// run scheduling starts and dropped, when it's finished. Zero value is ready
+// to use and it's safe for concurrent use.
+type taskInputs struct {
+	sync.Mutex
+	runs map[dagRunKey]*dagRunInputs
+}
+
+type dagRunInputs struct {
+	params   string
+	rendered map[string]string // by task id
+}
+
+func newTaskDagRunKey(drt DagRunTask) dagRunKey {
+	return newDagRunKey(DagRun{DagId: drt.DagId, AtTime: drt.AtTime})
+}
+
+// Registers inputs of given DAG run with its stored parameters.
+func (ti *taskInputs) start(dagrun DagRun, params *string) {
+	ti.Lock()
+	defer ti.Unlock()
+	if ti.runs == nil {
+		ti.runs = make(map[dagRunKey]*dagRunInputs)
+	}
+	inputs := &dagRunInputs{rendered: make(map[string]string)}
+	if params != nil {
+		inputs.params = *params
+	}
+	ti.runs[newDagRunKey(dagrun)] = inputs
+}
+
+// Drops inputs of given DAG run.
+func (ti *taskInputs) finish(dagrun DagRun) {
+	ti.Lock()
+	defer ti.Unlock()
+	delete(ti.runs, newDagRunKey(dagrun))
+}
+
+// Returns parameters of the DAG run of given task. False is returned, when
+// the DAG run is not registered.
+func (ti *taskInputs) params(drt DagRunTask) (string, bool) {
+	ti.Lock()
+	defer ti.Unlock()
+	inputs, exists := ti.runs[newTaskDagRunKey(drt)]
+	if !exists {
+		return "", false
+	}
+	return inputs.params, true
+}
+
+// Stores rendered templates of given task. It's no-op, when the DAG run is
+// not registered.
+func (ti *taskInputs) setRendered(drt DagRunTask, rendered string) {
+	ti.Lock()
+	defer ti.Unlock()
+	if inputs, exists := ti.runs[newTaskDagRunKey(drt)]; exists {
+		inputs.rendered[drt.TaskId] = rendered
+	}
+}
+
+// Returns rendered templates of given task. False is returned, when they
+// haven't been stored for the DAG run.
+func (ti *taskInputs) rendered(drt DagRunTask) (string, bool) {
+	ti.Lock()
+	defer ti.Unlock()
+	inputs, exists := ti.runs[newTaskDagRunKey(drt)]
+	if !exists {
+		return "", false
+	}
+	rendered, exists := inputs.rendered[drt.TaskId]
+	return rendered, exists
+}
@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// Task with templates which records its rendered templates.
+type templatedTask struct {
+	TaskId    string
+	templates map[string]string
+	rendered  chan map[string]string
+}
+
+func (tt templatedTask) Id() string                   { return tt.TaskId }
+func (tt templatedTask) Execute()                     {}
+func (tt templatedTask) Templates() map[string]string { return tt.templates }
+func (tt templatedTask) ExecuteContext(ctx context.Context) {
+	tt.rendered <- dag.RenderedFromContext(ctx)
+}
+
+func TestScheduledTaskTemplatesAreRendered(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	task := templatedTask{
+		TaskId: "load",
+		templates: map[string]string{
+			"partition": "dt={{ ds_nodash }}/prev={{ prev_ds }}",
+			"customer":  "{{ param \"customerId\" }}",
+		},
+		rendered: make(chan map[string]string, 1),
+	}
+	start := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	d := dag.New("mock_dag_templates_scheduled").
+		AddRoot(&dag.Node{Task: task}).
+		AddSchedule(dag.FixedSchedule{Start: start, Interval: time.Hour}).
+		AddAttributes(dag.Attr{Params: map[string]dag.Param{
+			"customerId": {Type: dag.ParamString, Default: "c1"},
+		}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	ctx := context.Background()
+	execTs := time.Date(2023, time.October, 16, 0, 0, 0, 0, time.UTC)
+	params := `{"customerId":"c42"}`
+	_, iErr := ts.DbClient.InsertDagRunWithParams(ctx, string(d.Id),
+		timeutils.ToString(execTs), &params)
+	if iErr != nil {
+		t.Fatalf("Cannot insert dag run: %s", iErr.Error())
+	}
+
+	dagrun := DagRun{DagId: d.Id, AtTime: execTs}
+	ts.scheduleSingleTask(ctx, dagrun, "load")
+	drt := DagRunTask{DagId: d.Id, AtTime: execTs, TaskId: "load"}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskScheduled)
+	if ts.TaskQueue.Size() != 1 {
+		t.Errorf("Expected task on the queue, got %d", ts.TaskQueue.Size())
+	}
+
+	expected := `{"customer":"c42","partition":"dt=20231016/prev=2023-10-15"}`
+	drtDb, rErr := ts.DbClient.ReadDagRunTask(ctx, string(d.Id),
+		timeutils.ToString(execTs), "load")
+	if rErr != nil {
+		t.Fatalf("Cannot read dag run task: %s", rErr.Error())
+	}
+	if drtDb.Rendered == nil || *drtDb.Rendered != expected {
+		t.Errorf("Expected stored rendered templates %s, got %v", expected,
+			drtDb.Rendered)
+	}
+	if tte := ts.taskToExec(ctx, drt, ""); tte.Rendered != expected {
+		t.Errorf("Expected rendered templates %s of task to execute, got %s",
+			expected, tte.Rendered)
+	}
+
+	le := NewLocalExecutor(ts, DefaultLocalExecutorConfig)
+	le.executeTask(drt)
+	rendered := <-task.rendered
+	expectedMap := map[string]string{
+		"customer":  "c42",
+		"partition": "dt=20231016/prev=2023-10-15",
+	}
+	if !reflect.DeepEqual(rendered, expectedMap) {
+		t.Errorf("Expected rendered templates %v in task context, got %v",
+			expectedMap, rendered)
+	}
+}
+
+func TestInvalidTaskTemplatesFailTask(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	task := templatedTask{
+		TaskId:    "load",
+		templates: map[string]string{"customer": "{{ param \"unknown\" }}"},
+		rendered:  make(chan map[string]string, 1),
+	}
+	d := dag.New("mock_dag_templates_invalid").AddRoot(&dag.Node{Task: task}).
+		Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	ctx := context.Background()
+	execTs := time.Date(2023, time.October, 16, 0, 0, 0, 0, time.UTC)
+	_, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id),
+		timeutils.ToString(execTs))
+	if iErr != nil {
+		t.Fatalf("Cannot insert dag run: %s", iErr.Error())
+	}
+
+	ts.scheduleSingleTask(ctx, DagRun{DagId: d.Id, AtTime: execTs}, "load")
+	drt := DagRunTask{DagId: d.Id, AtTime: execTs, TaskId: "load"}
+	checkDagRunTaskStatus(t, ts, drt, dag.TaskFailed)
+	if ts.TaskQueue.Size() != 0 {
+		t.Errorf("Expected no tasks on the queue, got %d", ts.TaskQueue.Size())
+	}
+}
+
+func TestTaskToExecTakesInputsFromMemory(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	task := templatedTask{
+		TaskId:    "load",
+		templates: map[string]string{"customer": "{{ param \"customerId\" }}"},
+		rendered:  make(chan map[string]string, 1),
+	}
+	d := dag.New("mock_dag_templates_in_memory").
+		AddRoot(&dag.Node{Task: task}).
+		AddAttributes(dag.Attr{Params: map[string]dag.Param{
+			"customerId": {Type: dag.ParamString, Default: "c1"},
+		}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	ctx := context.Background()
+	execTs := time.Date(2023, time.October, 16, 0, 0, 0, 0, time.UTC)
+	dbParams := `{"customerId":"c42"}`
+	_, iErr := ts.DbClient.InsertDagRunWithParams(ctx, string(d.Id),
+		timeutils.ToString(execTs), &dbParams)
+	if iErr != nil {
+		t.Fatalf("Cannot insert dag run: %s", iErr.Error())
+	}
+
+	// Inputs are registered on DAG run scheduling start, memory values differ
+	// from the database, to see where they are taken from.
+	dagrun := DagRun{DagId: d.Id, AtTime: execTs}
+	params := `{"customerId":"c7"}`
+	ts.taskInputs.start(dagrun, &params)
+	ts.scheduleSingleTask(ctx, dagrun, "load")
+	drt := DagRunTask{DagId: d.Id, AtTime: execTs, TaskId: "load"}
+	dbRendered := `{"customer":"db"}`
+	sErr := ts.DbClient.SetDagRunTaskRendered(ctx, string(d.Id),
+		timeutils.ToString(execTs), "load", &dbRendered)
+	if sErr != nil {
+		t.Fatalf("Cannot set rendered templates: %s", sErr.Error())
+	}
+
+	tte := ts.taskToExec(ctx, drt, "")
+	if tte.Params != params {
+		t.Errorf("Expected params %s from memory, got %s", params, tte.Params)
+	}
+	expected := `{"customer":"c7"}`
+	if tte.Rendered != expected {
+		t.Errorf("Expected rendered templates %s from memory, got %s",
+			expected, tte.Rendered)
+	}
+
+	ts.taskInputs.finish(dagrun)
+	tte = ts.taskToExec(ctx, drt, "")
+	if tte.Params != dbParams || tte.Rendered != dbRendered {
+		t.Errorf("Expected inputs %s and %s from the database after DAG run "+
+			"is finished, got %s and %s", dbParams, dbRendered, tte.Params,
+			tte.Rendered)
+	}
+}
+
+// Schedule without Prev method, which counts calls of Next.
+type nextOnlySchedule struct {
+	dag.FixedSchedule
+	nextCalls *int
+}
+
+func (ns nextOnlySchedule) Next(t time.Time) time.Time {
+	*ns.nextCalls++
+	return ns.FixedSchedule.Next(t)
+}
+
+func TestPrevExecTsIsSeededFromPrevDagRun(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	task := templatedTask{
+		TaskId:    "load",
+		templates: map[string]string{"partition": "prev={{ prev_ts }}"},
+		rendered:  make(chan map[string]string, 1),
+	}
+	nextCalls := 0
+	start := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	sched := nextOnlySchedule{
+		FixedSchedule: dag.FixedSchedule{Start: start, Interval: time.Minute},
+		nextCalls:     &nextCalls,
+	}
+	d := dag.New("mock_dag_templates_prev_seeded").
+		AddRoot(&dag.Node{Task: task}).AddSchedule(sched).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	d, _ = dag.Get(d.Id)
+	ctx := context.Background()
+	prevExecTs := time.Date(2023, time.October, 16, 0, 0, 0, 0, time.UTC)
+	execTs := prevExecTs.Add(time.Minute)
+	for _, atTime := range []time.Time{prevExecTs, execTs} {
+		_, iErr := ts.DbClient.InsertDagRun(ctx, string(d.Id),
+			timeutils.ToString(atTime))
+		if iErr != nil {
+			t.Fatalf("Cannot insert dag run: %s", iErr.Error())
+		}
+	}
+
+	ts.seedPrevExecTs(ctx, d, DagRun{DagId: d.Id, AtTime: execTs})
+	rendered, rErr := d.RenderTemplates("load", execTs, nil)
+	if rErr != nil {
+		t.Fatalf("Cannot render templates: %s", rErr.Error())
+	}
+	expected := "prev=" + prevExecTs.Format(time.RFC3339)
+	if rendered["partition"] != expected {
+		t.Errorf("Expected rendered template %s, got %s", expected,
+			rendered["partition"])
+	}
+	// Ticks since schedule start are not iterated
+	if nextCalls > 5 {
+		t.Errorf("Expected schedule to be iterated from the previous dag "+
+			"run, got %d Next calls", nextCalls)
+	}
+}
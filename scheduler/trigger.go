@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// ErrDagRunExists is returned on triggering a DAG run, when there is already
+// a DAG run of the DAG at the same execution timestamp.
+var ErrDagRunExists = errors.New("dag run already exists")
+
+// TriggerDagRun creates new DAG run manually, with given parameters values.
+// Parameters are validated against parameters declared in the DAG (see
+// dag.Dag.ValidateParams) and not given parameters get their defaults. The DAG
+// run is put onto DagRunQueue, where it's picked up by TaskScheduler main loop
+// as any other DAG run. Returns parameters of the DAG run.
+func (ts *TaskScheduler) TriggerDagRun(
+	ctx context.Context, dagrun DagRun, values map[string]any,
+) (dag.Params, error) {
+	d, dagErr := dag.Get(dagrun.DagId)
+	if dagErr != nil {
+		return nil, dagErr
+	}
+	params, vErr := d.ValidateParams(values)
+	if vErr != nil {
+		return nil, vErr
+	}
+	paramsJson, pErr := encodeParams(params)
+	if pErr != nil {
+		return nil, pErr
+	}
+	dagId := string(dagrun.DagId)
+	execTs := timeutils.ToString(dagrun.AtTime)
+	_, iErr := ts.DbClient.InsertNewDagRun(ctx, dagId, execTs, paramsJson)
+	if errors.Is(iErr, db.ErrDagRunExists) {
+		return nil, fmt.Errorf("%w: %s at %s", ErrDagRunExists, dagId, execTs)
+	}
+	if iErr != nil {
+		return nil, iErr
+	}
+	// The DAG run is already committed, so it has to be queued even if the
+	// request is cancelled in the meantime.
+	ds.PutContext(context.WithoutCancel(ctx), ts.DagRunQueue, dagrun)
+	slog.Info("Triggered dag run", "dagrun", dagrun, "params", params)
+	return params, nil
+}
+
+// Serializes DAG run parameters into JSON object. Nil is returned for empty
+// parameters, so DAG runs of DAGs without parameters don't store any.
+func encodeParams(params dag.Params) (*string, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	paramsJson, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serialize dag run parameters: %w", err)
+	}
+	s := string(paramsJson)
+	return &s, nil
+}
+
+// Reads parameters of given dag run task DAG run, serialized as JSON object.
+// Parameters of DAG run which is being scheduled are taken from memory, the
+// database is read only otherwise. Empty string is returned, when the DAG run
+// has no parameters or they cannot be read - in that case tasks would use
+// parameters defaults.
+func (ts *TaskScheduler) dagRunParams(
+	ctx context.Context, drt DagRunTask,
+) string {
+	if params, cached := ts.taskInputs.params(drt); cached {
+		return params
+	}
+	dr, err := ts.DbClient.ReadDagRun(ctx, string(drt.DagId),
+		timeutils.ToString(drt.AtTime))
+	if err != nil {
+		slog.Error("Cannot read dag run parameters", "dagruntask", drt, "err",
+			err)
+		return ""
+	}
+	if dr.Params == nil {
+		return ""
+	}
+	return *dr.Params
+}
+
+// HTTP handler for triggering new DAG run of DAG given by dagId query
+// parameter. Optional execTs parameter sets execution timestamp of the DAG run
+// (current time by default). Parameters values are given in optional JSON body
+// (models.TriggerDagRunRequest), see TaskScheduler.TriggerDagRun.
+func (s *Scheduler) triggerDagRun(ts *TaskScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST requests are allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		dagId := query.Get("dagId")
+		if dagId == "" {
+			http.Error(w, "Parameter dagId is required", http.StatusBadRequest)
+			return
+		}
+		execTs := time.Now().Truncate(time.Second)
+		if query.Get("execTs") != "" {
+			var tErr error
+			execTs, tErr = timeutils.FromString(query.Get("execTs"))
+			if tErr != nil {
+				msg := fmt.Sprintf("Given execTs timestamp in incorrect "+
+					"format: %s", tErr.Error())
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+		}
+		var req models.TriggerDagRunRequest
+		jErr := json.NewDecoder(r.Body).Decode(&req)
+		if jErr != nil && jErr != io.EOF {
+			msg := fmt.Sprintf("Cannot parse request body: %s", jErr.Error())
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(w, r, ActionTriggerDag, dagId) {
+			return
+		}
+		if _, dagErr := dag.Get(dag.Id(dagId)); dagErr != nil {
+			http.Error(w, dagErr.Error(), http.StatusNotFound)
+			return
+		}
+
+		dagrun := DagRun{DagId: dag.Id(dagId), AtTime: execTs}
+		params, err := ts.TriggerDagRun(r.Context(), dagrun, req.Params)
+		switch {
+		case err == nil:
+		case errors.Is(err, dag.ErrInvalidParams):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrDagRunExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			msg := fmt.Sprintf("Cannot trigger dag run: %s", err.Error())
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, models.TriggerDagRunResponse{
+			DagId:  dagId,
+			ExecTs: timeutils.ToString(execTs),
+			Params: params,
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dskrzypiec/scheduler/dag"
+	"github.com/dskrzypiec/scheduler/db"
+	"github.com/dskrzypiec/scheduler/ds"
+	"github.com/dskrzypiec/scheduler/models"
+	"github.com/dskrzypiec/scheduler/timeutils"
+)
+
+// Task which records parameters of its DAG run.
+type paramsTask struct {
+	TaskId string
+	params chan dag.Params
+}
+
+func (pt paramsTask) Id() string { return pt.TaskId }
+func (pt paramsTask) Execute()   {}
+func (pt paramsTask) ExecuteContext(ctx context.Context) {
+	pt.params <- dag.ParamsFromContext(ctx)
+}
+
+var triggerTestParams = map[string]dag.Param{
+	"customerId":  {Type: dag.ParamString, Default: ""},
+	"fullRefresh": {Type: dag.ParamBool, Default: false},
+}
+
+func TestTriggerDagRunHandler(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	d := dag.New("mock_dag_trigger").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).
+		AddAttributes(dag.Attr{Params: triggerTestParams}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	startTs := time.Date(2023, time.October, 16, 8, 0, 0, 0, time.UTC)
+	execTs := timeutils.ToString(startTs)
+
+	s := New(ts.DbClient, Queues{}, DefaultConfig)
+	handler := s.triggerDagRun(ts)
+	post := func(dagId, body string) *httptest.ResponseRecorder {
+		query := url.Values{}
+		query.Set("dagId", dagId)
+		query.Set("execTs", execTs)
+		req := httptest.NewRequest("POST", "/dag/trigger?"+query.Encode(),
+			strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	if rec := post("not_existing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown DAG, got %d", rec.Code)
+	}
+	invalid := []string{
+		`{"params": {"unknown": "x"}}`,
+		`{"params": {"fullRefresh": "yes"}}`,
+		`{"params": `,
+	}
+	for _, body := range invalid {
+		if rec := post(string(d.Id), body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for body %s, got %d", body, rec.Code)
+		}
+	}
+	if ts.DbClient.Count("dagruns") != 0 {
+		t.Errorf("Expected no dag runs after invalid triggers")
+	}
+
+	rec := post(string(d.Id), `{"params": {"customerId": "c42"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for trigger, got %d: %s", rec.Code,
+			rec.Body.String())
+	}
+	var resp models.TriggerDagRunResponse
+	if jErr := json.Unmarshal(rec.Body.Bytes(), &resp); jErr != nil {
+		t.Fatal(jErr)
+	}
+	expected := map[string]any{"customerId": "c42", "fullRefresh": false}
+	if !reflect.DeepEqual(resp.Params, expected) {
+		t.Errorf("Expected params %v, got %v", expected, resp.Params)
+	}
+	dr, rErr := ts.DbClient.ReadDagRun(context.Background(), string(d.Id),
+		execTs)
+	if rErr != nil {
+		t.Fatalf("Cannot read triggered dag run: %s", rErr.Error())
+	}
+	if dr.Params == nil ||
+		*dr.Params != `{"customerId":"c42","fullRefresh":false}` {
+		t.Errorf("Unexpected stored params: %v", dr.Params)
+	}
+	if !ts.DagRunQueue.Contains(DagRun{DagId: d.Id, AtTime: startTs}) {
+		t.Error("Expected triggered dag run on the queue")
+	}
+	if rec := post(string(d.Id), ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for existing dag run, got %d", rec.Code)
+	}
+}
+
+func TestTriggerDagRunConcurrently(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	d := dag.New("mock_dag_trigger_concurrent").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	dagrun := DagRun{DagId: d.Id,
+		AtTime: time.Date(2023, time.October, 16, 9, 0, 0, 0, time.UTC)}
+
+	const triggers = 10
+	errs := make(chan error, triggers)
+	var wg sync.WaitGroup
+	for i := 0; i < triggers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ts.TriggerDagRun(context.Background(), dagrun, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	triggered := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			triggered++
+		case !errors.Is(err, ErrDagRunExists):
+			t.Errorf("Expected ErrDagRunExists, got: %s", err.Error())
+		}
+	}
+	if triggered != 1 {
+		t.Errorf("Expected exactly one triggered dag run, got %d", triggered)
+	}
+	if cnt := ts.DbClient.Count("dagruns"); cnt != 1 {
+		t.Errorf("Expected 1 dag run in the database, got %d", cnt)
+	}
+	if size := ts.DagRunQueue.Size(); size != 1 {
+		t.Errorf("Expected 1 dag run on the queue, got %d", size)
+	}
+}
+
+func TestTriggeredDagRunIsQueuedAfterRequestIsCancelled(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	drQueue := ds.NewSimpleQueue[DagRun](1)
+	ts.DagRunQueue = &drQueue
+	d := dag.New("mock_dag_trigger_cancelled").
+		AddRoot(&dag.Node{Task: EmptyTask{TaskId: "task"}}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	other := DagRun{DagId: "other_dag", AtTime: time.Now()}
+	if pErr := ts.DagRunQueue.Put(other); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	dagrun := DagRun{DagId: d.Id,
+		AtTime: time.Date(2023, time.October, 16, 10, 0, 0, 0, time.UTC)}
+	ctx, cancel := context.WithCancel(context.Background())
+	triggered := make(chan error)
+	go func() {
+		_, err := ts.TriggerDagRun(ctx, dagrun, nil)
+		triggered <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for ts.DbClient.Count("dagruns") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Request is cancelled, while the queue is full
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if _, pErr := ts.DagRunQueue.Pop(); pErr != nil {
+		t.Fatal(pErr)
+	}
+	select {
+	case err := <-triggered:
+		if err != nil {
+			t.Fatalf("Cannot trigger dag run: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Trigger has not finished after the queue was freed")
+	}
+	if !ts.DagRunQueue.Contains(dagrun) {
+		t.Error("Expected triggered dag run on the queue")
+	}
+}
+
+func TestTriggeredDagRunParamsReachTasks(t *testing.T) {
+	ts := defaultTaskScheduler(t, 100)
+	defer db.CleanUpSqliteTmp(ts.DbClient, t)
+	task := paramsTask{TaskId: "task", params: make(chan dag.Params, 1)}
+	d := dag.New("mock_dag_trigger_params").
+		AddRoot(&dag.Node{Task: task}).
+		AddAttributes(dag.Attr{Params: triggerTestParams}).Done()
+	if addErr := dag.Add(d); addErr != nil {
+		t.Fatalf("Cannot add DAG to the registry: %s", addErr.Error())
+	}
+	startTs := time.Date(2023, time.October, 16, 9, 0, 0, 0, time.UTC)
+	dagrun := DagRun{DagId: d.Id, AtTime: startTs}
+	ctx := context.Background()
+	_, tErr := ts.TriggerDagRun(ctx, dagrun, map[string]any{
+		"fullRefresh": true,
+	})
+	if tErr != nil {
+		t.Fatalf("Cannot trigger dag run: %s", tErr.Error())
+	}
+
+	drt := DagRunTask{DagId: d.Id, AtTime: startTs, TaskId: "task"}
+	tte := ts.taskToExec(ctx, drt, "")
+	if tte.Params != `{"customerId":"","fullRefresh":true}` {
+		t.Errorf("Unexpected params of task to execute: %s", tte.Params)
+	}
+	le := NewLocalExecutor(ts, DefaultLocalExecutorConfig)
+	le.executeTask(drt)
+	params := <-task.params
+	if !params.Bool("fullRefresh") || params.String("customerId") != "" {
+		t.Errorf("Unexpected params in task context: %v", params)
+	}
+}
@@ -10,6 +10,7 @@ CREATE TABLE IF NOT EXISTS dags (
     HashDagMeta TEXT NOT NULL,      -- SHA256 hash of DAG attributes + StartTs + Schedule
     HashTasks TEXT NOT NULL,        -- SHA256 hash of DAG tasks
     Attributes TEXT NOT NULL,       -- DAG attributes like tags
+    IsPaused INT NOT NULL DEFAULT 0,-- Flag if DAG is paused (new DAG runs are not scheduled)
     -- TODO: probably many more, but sometime later
 
     PRIMARY KEY (DagId)
@@ -38,7 +39,8 @@ CREATE TABLE IF NOT EXISTS dagruns (
     InsertTs TEXT NOT NULL,         -- Row insertion timestamp
     Status TEXT NOT NULL,           -- DAG run status
     StatusUpdateTs TEXT NOT NULL,   -- Status update timestamp (on first insert it's the same as InsertTs)
-    Version TEXT NOT NULL           -- Scheduler Version
+    Version TEXT NOT NULL,          -- Scheduler Version
+    Params TEXT NULL                -- DAG run parameters as JSON object
 );
 
 -- Table dagruntasks stores information about tasks state of DAG runs.
@@ -50,10 +52,48 @@ CREATE TABLE IF NOT EXISTS dagruntasks (
     Status TEXT NOT NULL,           -- DAG task execution status
     StatusUpdateTs TEXT NOT NULL,   -- Status update timestamp (on first insert it's the same as InsertTs)
     Version TEXT NOT NULL,          -- Scheduler version
+    ExecutorId TEXT NULL,           -- ID of executor which owns (executes) the task
+    Rendered TEXT NULL,             -- Rendered task templates as JSON object
+    LeaseId TEXT NULL,              -- Current lease of the task handed out to an executor
 
     PRIMARY KEY (DagId, ExecTs, TaskId)
 );
 
+-- Table pools stores named pools of slots. Tasks can be assigned to a pool,
+-- to limit number of concurrently running tasks which use the same resource.
+CREATE TABLE IF NOT EXISTS pools (
+    Name TEXT NOT NULL,             -- Pool name
+    Slots INT NOT NULL,             -- Number of slots in the pool
+    CreateTs TEXT NOT NULL,         -- Timestamp when pool was initially inserted
+    LatestUpdateTs TEXT NULL,       -- Timestamp of the pool latest update
+
+    PRIMARY KEY (Name)
+);
+
+-- Table executors stores registered executors and their latest heartbeats.
+CREATE TABLE IF NOT EXISTS executors (
+    ExecutorId TEXT NOT NULL,       -- Executor ID
+    Hostname TEXT NOT NULL,         -- Hostname of the executor
+    Capacity INT NOT NULL,          -- Maximum number of concurrently executed tasks
+    Status TEXT NOT NULL,           -- Executor status (ALIVE or DEAD)
+    RegisterTs TEXT NOT NULL,       -- Timestamp of the latest registration
+    LastHeartbeatTs TEXT NOT NULL,  -- Timestamp of the latest heartbeat
+
+    PRIMARY KEY (ExecutorId)
+);
+
+-- Table auditlog stores operator actions (e.g. pausing a DAG) - who did what
+-- and when, including actions which were denied.
+CREATE TABLE IF NOT EXISTS auditlog (
+    Id INTEGER PRIMARY KEY,         -- Auto-incremented entry ID
+    InsertTs TEXT NOT NULL,         -- Timestamp of the action
+    Principal TEXT NOT NULL,        -- Name of authenticated caller
+    Action TEXT NOT NULL,           -- Action name, like dag.pause
+    DagId TEXT NULL,                -- DAG ID, if the action concerns a DAG
+    Details TEXT NULL,              -- Additional details, like request parameters
+    Allowed INT NOT NULL            -- Flag if the action was allowed by the policy
+);
+
 -- TODO: Think about caching latest dagrun into a separate table with PK(DagId)
 
 
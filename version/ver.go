@@ -1,6 +1,68 @@
 package version
 
-import _ "embed"
+import (
+	_ "embed"
+	"errors"
+	"strings"
+)
 
 //go:embed VERSION
 var Version string
+
+// Version of the protocol between executors and the scheduler implemented by
+// this build. It should be increased on every change of the protocol.
+// Version 1 is the initial protocol, without protocol version headers and
+// with plain text errors. Version 2 introduced error envelope with error
+// codes. Version 3 added cancelled tasks to heartbeat responses. Version 4
+// added DAG run parameters to tasks to execute. Version 5 added rendered task
+// templates to tasks to execute.
+const ProtocolVersion = 5
+
+// Protocol versions which introduced data executors have to act on.
+// Executors in older protocol versions would silently ignore such data, so
+// MinProtocolVersion is at least the newest of them.
+const (
+	// Heartbeat responses contain tasks which executor should cancel.
+	ProtocolTaskCancellation = 3
+
+	// Popped tasks contain parameters of their DAG run.
+	ProtocolDagRunParams = 4
+
+	// Popped tasks contain rendered templates of the task.
+	ProtocolRenderedTemplates = 5
+)
+
+// The oldest protocol version still supported by this build. Executors which
+// don't support it are rejected on handshake and registration, instead of
+// failing on every request later on. It has to be raised together with
+// ProtocolVersion, whenever a new protocol version adds data which executors
+// have to act on.
+const MinProtocolVersion = ProtocolRenderedTemplates
+
+// ErrIncompatibleProtocol is returned, when two sides of the communication do
+// not support any common protocol version.
+var ErrIncompatibleProtocol = errors.New("incompatible protocol versions")
+
+// Current returns version of this build without surrounding whitespaces.
+func Current() string {
+	return strings.TrimSpace(Version)
+}
+
+// NegotiateProtocol returns the highest protocol version supported by both
+// this build and the other side which supports versions from minVersion to
+// maxVersion. If there is no such version, ErrIncompatibleProtocol is
+// returned.
+func NegotiateProtocol(minVersion, maxVersion int) (int, error) {
+	negotiated := min(maxVersion, ProtocolVersion)
+	if negotiated < max(minVersion, MinProtocolVersion) {
+		return 0, ErrIncompatibleProtocol
+	}
+	return negotiated, nil
+}
+
+// IsProtocolSupported checks if given protocol version is supported by this
+// build.
+func IsProtocolSupported(protocolVersion int) bool {
+	return protocolVersion >= MinProtocolVersion &&
+		protocolVersion <= ProtocolVersion
+}
@@ -0,0 +1,29 @@
+package version
+
+import "testing"
+
+func TestNegotiateProtocol(t *testing.T) {
+	data := []struct {
+		minVersion, maxVersion int
+		expected               int
+		expectErr              bool
+	}{
+		{MinProtocolVersion, ProtocolVersion, ProtocolVersion, false},
+		{1, MinProtocolVersion, MinProtocolVersion, false},
+		{1, MinProtocolVersion - 1, 0, true},
+		{1, ProtocolVersion + 5, ProtocolVersion, false},
+		{ProtocolVersion + 1, ProtocolVersion + 2, 0, true},
+		{0, MinProtocolVersion - 1, 0, true},
+	}
+	for _, d := range data {
+		negotiated, err := NegotiateProtocol(d.minVersion, d.maxVersion)
+		if d.expectErr && err != ErrIncompatibleProtocol {
+			t.Errorf("Expected ErrIncompatibleProtocol for %d-%d, got %v",
+				d.minVersion, d.maxVersion, err)
+		}
+		if !d.expectErr && negotiated != d.expected {
+			t.Errorf("Expected protocol version %d for %d-%d, got %d (%v)",
+				d.expected, d.minVersion, d.maxVersion, negotiated, err)
+		}
+	}
+}